@@ -1,77 +1,23 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"reflect"
-	"sort"
-	"strconv"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
-	"nhooyr.io/websocket"
+	"options-ws/aevo"
 )
 
-type Greeks struct {
-	Delta float64 `json:"delta,string"`
-	Theta float64 `json:"theta,string"`
-	Gamma float64 `json:"gamma,string"`
-	Rho   float64 `json:"rho,string"`
-	Vega  float64 `json:"vega,string"`
-	Iv    float64 `json:"iv,string"`
-}
-
-type Market struct {
-	InstrumentId     int64   `json:"instrument_id,string"`
-	InstrumentName   string  `json:"instrument_name"`
-	InstrumentType   string  `json:"instrument_type"`
-	UnderlyingAsset  string  `json:"underlying_asset"`
-	QuoteAsset       string  `json:"quote_asset"`
-	PriceStep        float64 `json:"price_step,string"`
-	AmountStep       float64 `json:"amount_step,string"`
-	MinOrderValue    float64 `json:"min_order_value,string"`
-	MaxOrderValue    float64 `json:"max_order_value,string"`
-	MaxNotionalValue float64 `json:"max_notional_value,string"`
-	MarkPrice        float64 `json:"mark_price,string"`
-	ForwardPrice     float64 `json:"forward_price,string"`
-	IndexPrice       float64 `json:"index_price,string"`
-	IsActive         bool    `json:"is_active"`
-	OptionType       string  `json:"option_type"`
-	Expiry           int64   `json:"expiry,string"`
-	Strike           int64   `json:"strike,string"`
-	Greeks           Greeks  `json:"greeks"`
-}
-
-func aevoMarkets(asset string) []Market {
-	url := AevoHttp + "/markets?asset=" + asset + "&instrument_type=OPTION"
-
-	req, _ := http.NewRequest("GET", url, nil) //NewRequest + Client.Do used to pass headers, otherwise http.Get can be used
-
-	req.Header.Add("accept", "application/json")
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Fatalf("aevoMarkets request error: %v", err)
-	}
-
-	defer res.Body.Close() //Client.Do, http.Get, http.Post, etc all need response Body to be closed when done reading from it
-	// defer defers execution until enclosing function returns
-
-	var markets []Market
-
-	decoder := json.NewDecoder(res.Body)
-	err = decoder.Decode(&markets)
-	if err != nil {
-		log.Fatalf("aevoMarkets json decode error: %v", err)
-	}
+// AevoClient is used for every aevo REST request, Credentials are set at startup when available.
+var AevoClient = aevo.NewClient()
 
-	return markets
-}
+// AevoMarketsMode is how FetchMarkets lists aevo's markets: "per-asset", a request (or paginated sweep) per asset, or
+// "all", one sweep of every asset's markets keeping the assets asked for, fewer requests when most are subscribed.
+var AevoMarketsMode = "per-asset"
 
-func aevoInstruments(markets []Market) []string {
+func aevoInstruments(markets []aevo.Market) []string {
 	var instruments []string
 	for _, market := range markets {
 		if market.IsActive {
@@ -82,231 +28,195 @@ func aevoInstruments(markets []Market) []string {
 	return instruments
 }
 
-func aevoOrderbookJson(instruments []string) []byte {
-	var orderbooks []string
-	for _, instrument := range instruments {
-		orderbooks = append(orderbooks, "orderbook:"+instrument)
-	}
-
-	data := wssData{
-		Op:   "subscribe",
-		Data: orderbooks,
-	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Fatalf("orderbook json marshal error: %v", err)
+// aevoListings are the active options of markets with their expiry times, aevo settles in USDC.
+func aevoListings(markets []aevo.Market) []Listing {
+	listings := make([]Listing, 0, len(markets))
+	for _, market := range markets {
+		if !market.IsActive {
+			continue
+		}
+		listing, err := newListing("aevo", market.InstrumentName, time.Unix(0, market.Expiry), "USD")
+		if err == nil {
+			listings = append(listings, listing)
+		}
 	}
-
-	return jsonData
+	return listings
 }
 
-func aevoIndexJson(assets []string) []byte {
-	var indices []string
-	for _, asset := range assets {
-		indices = append(indices, "index:"+asset)
+// aevoOrders converts decoded levels to Orders sorted best first, bids descending and asks ascending.
+func aevoOrders(levels []aevo.Level, descending bool) []Order {
+	orders := make([]Order, len(levels))
+	for i, level := range levels {
+		orders[i] = Order{level.Price, level.Amount, level.Iv, "aevo"}
 	}
+	sortOrders(orders, descending)
 
-	data := wssData{
-		Op:   "subscribe",
-		Data: indices,
-	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Fatalf("orderbook json marshal error: %v", err)
-	}
-
-	return jsonData
+	return orders
 }
 
-func aevoWssReqOrderbook(instruments []string, ctx context.Context, c *websocket.Conn) {
-	var data []byte
-	for i := 0; true; i += 20 {
-		if i+20 < len(instruments) {
-			data = aevoOrderbookJson(instruments[i : i+20])
-		} else {
-			data = aevoOrderbookJson(instruments[i:])
-		}
-
-		// fmt.Printf("subscribe: %v\n\n", string(data))
-		err := c.Write(ctx, 1, data)
-		if err != nil {
-			log.Fatalf("Write error: %v\n", err)
+// aevoUpdateOrderbooks applies an orderbook message: a snapshot replaces the aevo side of the book, an update carries
+// changed levels only and is applied on top of it. Updates must follow a snapshot and be newer than the last message
+// applied, otherwise the aevo side is cleared, it's out of sync unless a REST snapshot, and a new snapshot requested,
+// updates are dropped until it arrives.
+func aevoUpdateOrderbooks(channel string, data aevo.Orderbook) {
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[data.InstrumentName]
+	if !exists {
+		if data.Type != "update" && len(data.Bids) <= 0 && len(data.Asks) <= 0 { //instruments without bids/asks are useless and discarded
+			return
 		}
-
-		if i+20 > len(instruments) {
-			break
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[data.InstrumentName] = orderbook
+	}
+	if orderbook.Sequences == nil {
+		orderbook.Sequences = make(map[string]float64)
+	}
+
+	if data.Type == "update" {
+		last, synced := orderbook.Sequences["aevo"]
+		if !synced || data.LastUpdated <= last {
+			if synced {
+				slog.Warn("aevoUpdateOrderbooks: out of order update, requesting snapshot", "instrument", data.InstrumentName, "last_updated", data.LastUpdated, "previous", last)
+			}
+			if !orderbook.RestSourced["aevo"] { //a REST snapshot is a whole book, deltas just can't apply to it
+				delete(orderbook.Bids, "aevo")
+				delete(orderbook.Asks, "aevo")
+			}
+			delete(orderbook.Sequences, "aevo")
+			requestSnapshot("aevo", channel)
+			return
 		}
-
-		time.Sleep(100 * time.Millisecond)
-	}
-}
-
-func aevoWssReqIndex(assets []string, ctx context.Context, c *websocket.Conn) {
-	data := aevoIndexJson(assets)
-	fmt.Printf("subscribe: %v\n\n", string(data))
-
-	err := c.Write(ctx, 1, data)
-	if err != nil {
-		log.Fatalf("Write error: %v\n", err)
+		orderbook.Bids["aevo"] = applyOrderDeltas(orderbook.Bids["aevo"], aevoOrders(data.Bids, true), true, orderbook.DepthLimit)
+		orderbook.Asks["aevo"] = applyOrderDeltas(orderbook.Asks["aevo"], aevoOrders(data.Asks, false), false, orderbook.DepthLimit)
+	} else {
+		orderbook.Bids["aevo"] = aevoOrders(data.Bids, true)
+		orderbook.Asks["aevo"] = aevoOrders(data.Asks, false)
 	}
-}
-
-// loop through []Orders and replace each element with best bid (highest) and best ask (lowest)
 
-func aevoUpdateOrderbooks(res map[string]interface{}) {
-	data, ok := res["data"].(map[string]interface{})
-	if !ok {
-		log.Printf("aevoUpdateOrderbooks: unable to cast response to type map[string]interface{}\n")
+	if !verifyChecksum(orderbook, "aevo", data.InstrumentName, channel, data.Checksum) {
 		return
 	}
 
-	// if len(data) <= 3 { //check for ping response, not very robust and inappropriate to catch here, might need to fix later
-	// 	return
-	// }
-
-	instrument, ok := data["instrument_name"].(string)
-	bidsRaw, bidsOk := data["bids"].([]interface{})
-	asksRaw, asksOk := data["asks"].([]interface{})
-	timeStr, timeOk := data["last_updated"].(string)
-	if (!ok || !timeOk) || !(bidsOk || asksOk) {
-		log.Printf("aevoUpdateOrderbooks: unable to convert field: response: %+v", res)
-		return
+	orderbook.Sequences["aevo"] = data.LastUpdated
+	orderbook.LastUpdated = data.LastUpdated
+	markBookUpdated(orderbook, "aevo", time.Unix(0, int64(data.LastUpdated)))
+	applyDepthLimit(orderbook, "aevo")
+	orderbook.UpdateCount++
+	publishBookEvent("aevo", data.InstrumentName, orderbook.Bids["aevo"], orderbook.Asks["aevo"])
+	if debugEnabled() {
+		slog.Debug("aevoUpdateOrderbooks: book", "instrument", data.InstrumentName, "bids", orderbook.Bids["aevo"], "asks", orderbook.Asks["aevo"])
 	}
+}
 
-	if len(bidsRaw) <= 0 && len(asksRaw) <= 0 { //if instrument has no bids/asks its useless and discarded
-		return
+func aevoUpdateIndex(channel string, data aevo.Index) {
+	if data.Price > 0 {
+		asset := strings.TrimPrefix(channel, "index:")
+		checkIndexMove("aevo", asset, data.Price)
+		AevoIndex.Set(asset, data.Price)
+		publishIndexEvent("aevo", asset, data.Price)
 	}
+}
 
-	bids, bidsErr := unpackOrders(bidsRaw, "aevo")
-	asks, asksErr := unpackOrders(asksRaw, "aevo")
-	if bidsErr != nil && asksErr != nil {
-		log.Printf("unpackOrders error: \n%v\n", bidsErr)
-		log.Printf("%v\n", asksErr)
-		return
-	}
+var aevoOrderbookMessages = newMessagePool(func(message *aevo.OrderbookMessage) {
+	*message = aevo.OrderbookMessage{Data: aevo.Orderbook{Bids: message.Data.Bids[:0], Asks: message.Data.Asks[:0]}}
+})
 
-	lastUpdated, err := strconv.ParseFloat(timeStr, 64)
+// aevoDecodeOrderbook decodes an orderbook frame once, straight into a pooled message. It and the other aevo decoders
+// are registered in Channels by their channel's prefix.
+func aevoDecodeOrderbook(raw []byte) error {
+	message := aevoOrderbookMessages.Get()
+	defer aevoOrderbookMessages.Put(message)
+	err := json.Unmarshal(raw, message)
 	if err != nil {
-		log.Printf("Failed to convert last_updated timestamp to int64: %v\n", err)
-		return
-	}
-
-	_, exists := Orderbooks[instrument]
-
-	if exists {
-		Orderbooks[instrument].Bids["aevo"] = bids
-		Orderbooks[instrument].Asks["aevo"] = asks
-		Orderbooks[instrument].LastUpdated = lastUpdated
-	} else {
-		Orderbooks[instrument] = &OrderbookData{}
-		Orderbooks[instrument].Bids = make(map[string][]Order)
-		Orderbooks[instrument].Asks = make(map[string][]Order)
-		// Orderbooks[instrument].Bids["aevo"] = make([]Order, 0)
-		// Orderbooks[instrument].Asks["aevo"] = make([]Order, 0)
-
-		Orderbooks[instrument].Bids["aevo"] = bids
-		Orderbooks[instrument].Asks["aevo"] = asks
-		Orderbooks[instrument].LastUpdated = lastUpdated
+		return err
 	}
-
-	sort.Slice(Orderbooks[instrument].Bids["aevo"], func(i, j int) bool {
-		return Orderbooks[instrument].Bids["aevo"][i].Price > Orderbooks[instrument].Bids["aevo"][j].Price
-	})
-	sort.Slice(Orderbooks[instrument].Asks["aevo"], func(i, j int) bool {
-		return Orderbooks[instrument].Asks["aevo"][i].Price < Orderbooks[instrument].Asks["aevo"][j].Price
-	})
-
-	// fmt.Printf("%v: %+v\n\n", instrument, Orderbooks[instrument])
-	// if strings.Contains(instrument, "-C") {
-	// 	instrumentTrim, _ := strings.CutSuffix(instrument, "-C")
-	// 	fmt.Printf("%v: %+v\n\n", instrumentTrim, ArbTables[instrumentTrim])
-	// }
+	aevoUpdateOrderbooks(message.Channel, message.Data)
+	return nil
 }
 
-func aevoUpdateIndex(res map[string]interface{}) {
-	AevoIndex.Mu.Lock()
-	defer AevoIndex.Mu.Unlock()
-
-	channel, ok := res["channel"].(string)
-	if !ok {
-		log.Printf("aevoUpdateIndex: unable to convert response 'channel' to string: %v\n\n", reflect.TypeOf(res["channel"]))
-		return
-	}
-
-	data, ok := res["data"].(map[string]interface{})
-	if !ok {
-		log.Printf("aevoUpdateIndex: unable to cast response to type map[string]interface{}\n\n")
-		return
-	}
-	// if reflect.TypeOf(data["price"]) == nil { //catch ping response, inappropriate to catch here, should fix later
-	// 	return
-	// }
-
-	asset := strings.TrimPrefix(channel, "index:")
-	// fmt.Printf("asset: %v\n\n", asset)
-
-	priceStr, ok := data["price"].(string)
-	if !ok {
-		log.Printf("aevoUpdateIndex: unable to cast field to type string: %v\n\n", reflect.TypeOf(data["price"]))
-		return
-	}
-
-	price, err := strconv.ParseFloat(priceStr, 64)
+func aevoDecodeIndex(raw []byte) error {
+	var message aevo.IndexMessage
+	err := json.Unmarshal(raw, &message)
 	if err != nil {
-		log.Printf("aevoUpdateIndex: error converting string to float64: %v\n\n", err)
-		return
-	}
-
-	if price > 0 {
-		AevoIndex.Index[asset] = price
+		return err
 	}
-
-	// fmt.Printf("index: %+v\n\n", Index)
+	aevoUpdateIndex(message.Channel, message.Data)
+	return nil
 }
 
-func aevoWssRead(ctx context.Context, c *websocket.Conn) { //add exit condition, add ping or use Reader instead of Read to automatically manage ping, disconnect, etc
-	var res map[string]interface{}
-	raw, err := wssRead(ctx, c)
+func aevoDecodeTicker(raw []byte) error {
+	var message aevo.TickerMessage
+	err := json.Unmarshal(raw, &message)
 	if err != nil {
-		log.Printf("aevoWssRead: %v\n(response): %v\n\n", err, string(raw))
-		return
+		return err
 	}
+	aevoUpdateTickers(message.Channel, message.Data)
+	return nil
+}
 
-	err = json.Unmarshal(raw, &res)
-	if err != nil {
-		log.Printf("aevoWssRead: error unmarshaling orderbookRaw: %v\n\n", err)
-		return
-	}
+// aevoExchange adapts AevoClient to Exchange.
+type aevoExchange struct{}
 
-	channel, ok := res["channel"].(string)
-	if !ok {
-		log.Printf("aevoWssRead: unable to convert response 'channel' to string\n\n")
-		return
-	}
+func (aevoExchange) Name() string { return "aevo" }
 
-	if strings.Contains(channel, "orderbook") {
-		aevoUpdateOrderbooks(res)
+func (aevoExchange) FetchMarkets(assets []string) ([]string, error) {
+	markets := make([]aevo.Market, 0)
+	if AevoMarketsMode == "all" {
+		allMarkets, err := AevoClient.Markets("")
+		if err != nil {
+			return nil, err
+		}
+		for _, market := range allMarkets {
+			if slices.Contains(assets, market.UnderlyingAsset) {
+				markets = append(markets, market)
+			}
+		}
+	} else {
+		for _, asset := range assets {
+			assetMarkets, err := AevoClient.Markets(asset)
+			if err != nil {
+				return nil, err
+			}
+			markets = append(markets, assetMarkets...)
+		}
 	}
 
-	if strings.Contains(channel, "index") {
-		aevoUpdateIndex(res)
-	}
+	aevoUpdateMarkets(markets)
+	aevoUpdateLimits(markets)
+	aevoUpdateMarks(markets)
+	aevoUpdateForwards(markets)
+	Matcher.Register("aevo", aevoListings(markets))
+	return aevoInstruments(markets), nil
 }
 
-func aevoWssReqLoop(ctx context.Context, c *websocket.Conn) {
-	for {
-		assets := []string{"ETH"}
-		markets := aevoMarkets("ETH")
-		instruments := aevoInstruments(markets)
-		fmt.Printf("Aevo number of instruments: %v\n\n", len(instruments))
+func (aevoExchange) OrderbookChannels(instruments []string) []string {
+	return aevo.OrderbookChannels(instruments)
+}
 
-		aevoWssReqOrderbook(instruments, ctx, c)
-		log.Printf("Requested Aevo Orderbooks")
-		aevoWssReqIndex(assets, ctx, c)
-		log.Printf("Requested Aevo Index")
+func (aevoExchange) TickerChannels(instruments []string) []string {
+	return aevo.InstrumentTickerChannels(instruments)
+}
 
-		time.Sleep(time.Minute * 10)
-	}
+func (aevoExchange) TradeChannels(instruments []string) []string {
+	return aevo.TradeChannels(instruments)
+}
+
+// IndexChannels subscribes the perpetual tickers along with the index, their funding prices parity forwards.
+func (aevoExchange) IndexChannels(assets []string) []string {
+	return append(aevo.IndexChannels(assets), aevo.TickerChannels(assets)...)
+}
+
+func (aevoExchange) FetchOrderbook(instrument string) (OrderbookSnapshot, error) {
+	data, err := AevoClient.Orderbook(instrument)
+	if err != nil {
+		return OrderbookSnapshot{}, err
+	}
+	return OrderbookSnapshot{
+		Instrument:  instrument,
+		Bids:        map[string][]Order{"aevo": aevoOrders(data.Bids, true)},
+		Asks:        map[string][]Order{"aevo": aevoOrders(data.Asks, false)},
+		LastUpdated: data.LastUpdated,
+	}, nil
 }
@@ -0,0 +1,234 @@
+// Package aevo is a client for the aevo REST and websocket APIs: markets, instrument data, authenticated account
+// endpoints and the subscribe messages and frame types of the public and private (authenticated) websocket feeds.
+package aevo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"options-ws/ratelimit"
+)
+
+const HttpUrl string = "https://api.aevo.xyz"
+const WssUrl string = "wss://ws.aevo.xyz"
+
+const ServerErrorRetries = 3 //retries of a GET answered with a 5xx, after a backoff doubling from ServerErrorBackoff
+
+var ServerErrorBackoff = 500 * time.Millisecond
+
+// StatusError is a response other than 200 OK, Body its first KB.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v %v: %v: %v", e.Method, e.Path, e.Status, e.Body)
+}
+
+// Temporary reports whether the request may succeed if retried later, the exchange being down or rate limiting.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Credentials are an aevo API key and secret, only needed for account endpoints.
+type Credentials struct {
+	Key    string
+	Secret string
+}
+
+// CredentialsFromEnv reads AEVO_API_KEY / AEVO_API_SECRET, ok is false unless both are set.
+func CredentialsFromEnv() (Credentials, bool) {
+	credentials := Credentials{os.Getenv("AEVO_API_KEY"), os.Getenv("AEVO_API_SECRET")}
+	return credentials, credentials.Key != "" && credentials.Secret != ""
+}
+
+type Client struct {
+	HttpUrl     string
+	WssUrl      string
+	Http        *http.Client
+	Credentials *Credentials       //nil disables account endpoints
+	Signer      *Signer            //nil disables order placement
+	DryRun      bool               //sign orders but don't send them or cancels
+	Limiter     *ratelimit.Limiter //nil doesn't limit requests
+
+	MarketsPageSize int //markets requested a page at a time, 0 requests them all at once
+}
+
+func NewClient() *Client {
+	return &Client{HttpUrl: HttpUrl, WssUrl: WssUrl, Http: &http.Client{Timeout: 10 * time.Second}, DryRun: true}
+}
+
+// Signature is hex(HMAC-SHA256(secret, "key,timestamp,METHOD,path,body")), as aevo expects in AEVO-SIGNATURE.
+func Signature(credentials Credentials, timestamp string, method string, path string, body string) string {
+	mac := hmac.New(sha256.New, []byte(credentials.Secret))
+	mac.Write([]byte(credentials.Key + "," + timestamp + "," + strings.ToUpper(method) + "," + path + "," + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// request sends a request to path (including any query), signed when signed is set, and decodes the JSON response
+// into v. A GET answered with a 5xx is retried up to ServerErrorRetries times, other methods aren't idempotent. A
+// response other than 200 OK is returned as a *StatusError.
+func (c *Client) request(method string, path string, body []byte, signed bool, v interface{}) error {
+	if signed && c.Credentials == nil {
+		return fmt.Errorf("%v %v: no credentials", method, path)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.requestOnce(method, path, body, signed, v)
+		var statusErr *StatusError
+		if method != "GET" || attempt == ServerErrorRetries || !errors.As(err, &statusErr) || statusErr.StatusCode < 500 {
+			return err
+		}
+		time.Sleep(ServerErrorBackoff << attempt)
+	}
+}
+
+func (c *Client) requestOnce(method string, path string, body []byte, signed bool, v interface{}) error {
+	res, err := ratelimit.Do(c.Http, c.Limiter, func() (*http.Request, error) { //signed again on retries, the timestamp is part of the signature
+		req, err := http.NewRequest(method, c.HttpUrl+path, strings.NewReader(string(body)))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("content-type", "application/json")
+		if signed {
+			timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+			req.Header.Add("AEVO-KEY", c.Credentials.Key)
+			req.Header.Add("AEVO-TIMESTAMP", timestamp)
+			req.Header.Add("AEVO-SIGNATURE", Signature(*c.Credentials, timestamp, method, path, string(body)))
+		}
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%v %v: request error: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &StatusError{method, path, res.StatusCode, res.Status, string(raw)}
+	}
+
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("%v %v: json decode error: %v", method, path, err)
+	}
+
+	return nil
+}
+
+// Markets returns the option markets of asset, of every asset if asset is empty. With MarketsPageSize set they're
+// requested a page at a time with limit and offset, until a page comes back short, or longer than asked for or
+// repeating the last (the endpoint answering all of them at once). Errors wrap the request's *StatusError, if any.
+func (c *Client) Markets(asset string) ([]Market, error) {
+	query := "/markets?instrument_type=OPTION"
+	if asset != "" {
+		query += "&asset=" + asset
+	}
+	if c.MarketsPageSize <= 0 {
+		var markets []Market
+		err := c.request("GET", query, nil, false, &markets)
+		if err != nil {
+			return nil, fmt.Errorf("Markets: %w", err)
+		}
+		return markets, nil
+	}
+
+	markets := make([]Market, 0)
+	seen := make(map[int64]bool)
+	for offset := 0; ; offset += c.MarketsPageSize {
+		var page []Market
+		err := c.request("GET", query+"&limit="+strconv.Itoa(c.MarketsPageSize)+"&offset="+strconv.Itoa(offset), nil, false, &page)
+		if err != nil {
+			return nil, fmt.Errorf("Markets: page at %v: %w", offset, err)
+		}
+		added := 0
+		for _, market := range page {
+			if !seen[market.InstrumentId] {
+				seen[market.InstrumentId] = true
+				markets = append(markets, market)
+				added++
+			}
+		}
+		if len(page) != c.MarketsPageSize || added == 0 {
+			return markets, nil
+		}
+	}
+}
+
+// Perpetual returns asset's perpetual market, e.g. ETH-PERP.
+func (c *Client) Perpetual(asset string) (Market, error) {
+	var markets []Market
+	err := c.request("GET", "/markets?asset="+asset+"&instrument_type=PERPETUAL", nil, false, &markets)
+	if err != nil {
+		return Market{}, fmt.Errorf("Perpetual: %v", err)
+	}
+	for _, market := range markets {
+		if market.IsActive {
+			return market, nil
+		}
+	}
+	return Market{}, fmt.Errorf("Perpetual: no active %v perpetual", asset)
+}
+
+// Orderbook returns a REST snapshot of an instrument's book, the same shape as a websocket snapshot.
+func (c *Client) Orderbook(instrument string) (Orderbook, error) {
+	var orderbook Orderbook
+	err := c.request("GET", "/orderbook?instrument_name="+instrument, nil, false, &orderbook)
+	if err != nil {
+		return orderbook, fmt.Errorf("Orderbook: %v", err)
+	}
+	return orderbook, nil
+}
+
+// OpenInterest returns an instrument's open interest in contracts.
+func (c *Client) OpenInterest(instrument string) (float64, error) {
+	var res struct {
+		OpenInterest float64 `json:"open_interest,string"`
+	}
+	err := c.request("GET", "/instrument/"+instrument, nil, false, &res)
+	if err != nil {
+		return 0, fmt.Errorf("OpenInterest: %v", err)
+	}
+	return res.OpenInterest, nil
+}
+
+// GetPositions is Positions, named after the trading API's methods.
+func (c *Client) GetPositions() ([]Position, error) {
+	return c.Positions()
+}
+
+func (c *Client) Positions() ([]Position, error) {
+	var res struct {
+		Positions []Position `json:"positions"`
+	}
+	err := c.request("GET", "/positions", nil, true, &res)
+	if err != nil {
+		return nil, fmt.Errorf("Positions: %v", err)
+	}
+	return res.Positions, nil
+}
+
+func (c *Client) Orders() ([]Order, error) {
+	var orders []Order
+	err := c.request("GET", "/orders", nil, true, &orders)
+	if err != nil {
+		return nil, fmt.Errorf("Orders: %v", err)
+	}
+	return orders, nil
+}
@@ -0,0 +1,94 @@
+package aevo
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PrivateChannels are the account's own feeds, readable after AuthJson on the same connection.
+var PrivateChannels = []string{"fills", "positions", "orders"}
+
+// AuthJson logs a websocket connection in to the account's private channels, sent before subscribing on every new
+// connection.
+func AuthJson(credentials Credentials) []byte {
+	data := struct {
+		Op   string `json:"op"`
+		Data struct {
+			Key    string `json:"key"`
+			Secret string `json:"secret"`
+		} `json:"data"`
+	}{Op: "auth"}
+	data.Data.Key, data.Data.Secret = credentials.Key, credentials.Secret
+
+	jsonData, _ := json.Marshal(data)
+	return jsonData
+}
+
+// CancelOnDisconnectJson enables (or disables) cancelling the account's open orders when the connection it's sent on
+// drops, sent after AuthJson.
+func CancelOnDisconnectJson(enabled bool) []byte {
+	data := struct {
+		Op   string `json:"op"`
+		Data struct {
+			Enabled bool `json:"enabled"`
+		} `json:"data"`
+	}{Op: "cancel_on_disconnect"}
+	data.Data.Enabled = enabled
+
+	jsonData, _ := json.Marshal(data)
+	return jsonData
+}
+
+// Fill is one execution of the account's order, Filled contracts at Price.
+type Fill struct {
+	TradeId        string  `json:"trade_id"`
+	OrderId        string  `json:"order_id"`
+	InstrumentName string  `json:"instrument_name"`
+	Side           string  `json:"side"`
+	Price          float64 `json:"price,string"`
+	Filled         float64 `json:"filled,string"`
+	Fees           float64 `json:"fees,string"`
+	OrderStatus    string  `json:"order_status"`
+	Created        int64   `json:"created_timestamp,string"` //unix nanoseconds
+}
+
+type FillMessage struct {
+	Channel string `json:"channel"`
+	Data    struct {
+		Fill Fill `json:"fill"`
+	} `json:"data"`
+}
+
+// PositionsMessage carries every open position, not only the changed ones.
+type PositionsMessage struct {
+	Channel string `json:"channel"`
+	Data    struct {
+		Positions []Position `json:"positions"`
+	} `json:"data"`
+}
+
+// OrdersMessage carries the orders that changed, closed ones with their final OrderStatus.
+type OrdersMessage struct {
+	Channel string `json:"channel"`
+	Data    struct {
+		Orders []Order `json:"orders"`
+	} `json:"data"`
+}
+
+// Account is the margin state of the account from GET /account.
+type Account struct {
+	Equity            float64 `json:"equity,string"`
+	Balance           float64 `json:"balance,string"`
+	AvailableBalance  float64 `json:"available_balance,string"`
+	InitialMargin     float64 `json:"initial_margin,string"`
+	MaintenanceMargin float64 `json:"maintenance_margin,string"`
+}
+
+func (c *Client) Account() (Account, error) {
+	var account Account
+	err := c.request("GET", "/account", nil, true, &account)
+	if err != nil {
+		return account, fmt.Errorf("Account: %v", err)
+	}
+	return account, nil
+}
@@ -0,0 +1,206 @@
+package aevo
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// Signer signs orders for an account: Maker is the account's wallet address and Key the signing key registered for
+// it, orders are EIP-712 typed data in the domain of DomainName on ChainId.
+type Signer struct {
+	Maker      string
+	Key        *secp256k1.PrivateKey
+	DomainName string
+	ChainId    int64
+}
+
+// SignerFromEnv reads AEVO_WALLET_ADDRESS / AEVO_SIGNING_KEY (hex), ok is false unless both are set.
+func SignerFromEnv() (Signer, bool, error) {
+	maker, key := os.Getenv("AEVO_WALLET_ADDRESS"), os.Getenv("AEVO_SIGNING_KEY")
+	if maker == "" || key == "" {
+		return Signer{}, false, nil
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+	if err != nil || len(raw) != 32 {
+		return Signer{}, false, errors.New("SignerFromEnv: AEVO_SIGNING_KEY is not a 32 byte hex key")
+	}
+	return Signer{Maker: maker, Key: secp256k1.PrivKeyFromBytes(raw), DomainName: "Aevo Mainnet", ChainId: 1}, true, nil
+}
+
+// OrderRequest is a limit order to place, Amount in contracts and LimitPrice in USD.
+type OrderRequest struct {
+	InstrumentId int64
+	IsBuy        bool
+	Amount       float64
+	LimitPrice   float64
+	PostOnly     bool
+	ReduceOnly   bool
+	TimeInForce  string //"GTC" or "IOC", empty is GTC
+}
+
+// orderBody is the POST /orders body, amounts and prices are 6 decimal fixed point integers as strings.
+type orderBody struct {
+	Instrument  int64  `json:"instrument"`
+	Maker       string `json:"maker"`
+	IsBuy       bool   `json:"is_buy"`
+	Amount      string `json:"amount"`
+	LimitPrice  string `json:"limit_price"`
+	Salt        string `json:"salt"`
+	Signature   string `json:"signature"`
+	PostOnly    bool   `json:"post_only"`
+	ReduceOnly  bool   `json:"reduce_only"`
+	TimeInForce string `json:"time_in_force"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// word left pads an unsigned integer, bool or address to a 32 byte ABI word.
+func word(value *big.Int) []byte {
+	return value.FillBytes(make([]byte, 32))
+}
+
+func fixedPoint(value float64) uint64 {
+	return uint64(math.Round(value * 1e6))
+}
+
+var orderTypeHash = keccak256([]byte("Order(address maker,bool isBuy,uint256 limitPrice,uint256 amount,uint256 salt,uint256 instrument,uint256 timestamp)"))
+var domainTypeHash = keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId)"))
+
+// Sign returns the 0x prefixed r || s || v signature of an order's EIP-712 digest.
+func (s Signer) Sign(instrument int64, isBuy bool, limitPrice uint64, amount uint64, salt uint64, timestamp int64) (string, error) {
+	maker, err := hex.DecodeString(strings.TrimPrefix(s.Maker, "0x"))
+	if err != nil || len(maker) != 20 {
+		return "", fmt.Errorf("Sign: invalid maker address: %v", s.Maker)
+	}
+	isBuyWord := big.NewInt(0)
+	if isBuy {
+		isBuyWord = big.NewInt(1)
+	}
+
+	structHash := keccak256(orderTypeHash,
+		word(new(big.Int).SetBytes(maker)),
+		word(isBuyWord),
+		word(new(big.Int).SetUint64(limitPrice)),
+		word(new(big.Int).SetUint64(amount)),
+		word(new(big.Int).SetUint64(salt)),
+		word(big.NewInt(instrument)),
+		word(big.NewInt(timestamp)),
+	)
+	domainSeparator := keccak256(domainTypeHash, keccak256([]byte(s.DomainName)), keccak256([]byte("1")), word(big.NewInt(s.ChainId)))
+	digest := keccak256([]byte{0x19, 0x01}, domainSeparator, structHash)
+
+	compact := ecdsa.SignCompact(s.Key, digest, false) //v || r || s with v = 27 + recovery id
+	signature := append(compact[1:], compact[0])
+	return "0x" + hex.EncodeToString(signature), nil
+}
+
+// PlaceOrder signs and sends a limit order. With DryRun set (the default) nothing is sent, the order is signed and
+// returned with OrderStatus "dry_run".
+func (c *Client) PlaceOrder(order OrderRequest) (Order, error) {
+	if c.Signer == nil {
+		return Order{}, errors.New("PlaceOrder: no signer")
+	}
+
+	var saltBytes [8]byte
+	_, err := rand.Read(saltBytes[:])
+	if err != nil {
+		return Order{}, fmt.Errorf("PlaceOrder: salt: %v", err)
+	}
+	salt := binary.BigEndian.Uint64(saltBytes[:]) >> 1 //keeps it within int64 for exchanges parsing it as such
+	timestamp := time.Now().Unix()
+	limitPrice, amount := fixedPoint(order.LimitPrice), fixedPoint(order.Amount)
+
+	signature, err := c.Signer.Sign(order.InstrumentId, order.IsBuy, limitPrice, amount, salt, timestamp)
+	if err != nil {
+		return Order{}, fmt.Errorf("PlaceOrder: %v", err)
+	}
+	timeInForce := order.TimeInForce
+	if timeInForce == "" {
+		timeInForce = "GTC"
+	}
+	body, err := json.Marshal(orderBody{
+		Instrument:  order.InstrumentId,
+		Maker:       c.Signer.Maker,
+		IsBuy:       order.IsBuy,
+		Amount:      strconv.FormatUint(amount, 10),
+		LimitPrice:  strconv.FormatUint(limitPrice, 10),
+		Salt:        strconv.FormatUint(salt, 10),
+		Signature:   signature,
+		PostOnly:    order.PostOnly,
+		ReduceOnly:  order.ReduceOnly,
+		TimeInForce: timeInForce,
+		Timestamp:   timestamp,
+	})
+	if err != nil {
+		return Order{}, fmt.Errorf("PlaceOrder: %v", err)
+	}
+
+	side := "sell"
+	if order.IsBuy {
+		side = "buy"
+	}
+	if c.DryRun {
+		return Order{OrderId: "dry-run-" + strconv.FormatUint(salt, 16), Side: side, Price: order.LimitPrice, Amount: order.Amount, OrderStatus: "dry_run"}, nil
+	}
+
+	var placed Order
+	err = c.request("POST", "/orders", body, true, &placed)
+	if err != nil {
+		return Order{}, fmt.Errorf("PlaceOrder: %v", err)
+	}
+	return placed, nil
+}
+
+// CancelAll cancels every open order of the account, returning their ids, a no-op with DryRun set.
+func (c *Client) CancelAll() ([]string, error) {
+	if c.DryRun {
+		return nil, nil
+	}
+
+	var res struct {
+		OrderIds []string `json:"order_ids"`
+	}
+	err := c.request("DELETE", "/orders-all", nil, true, &res)
+	if err != nil {
+		return nil, fmt.Errorf("CancelAll: %v", err)
+	}
+	return res.OrderIds, nil
+}
+
+// CancelOrder cancels an open order, a no-op with DryRun set.
+func (c *Client) CancelOrder(orderId string) error {
+	if c.DryRun {
+		return nil
+	}
+
+	var res struct {
+		OrderId string `json:"order_id"`
+	}
+	err := c.request("DELETE", "/orders/"+orderId, nil, true, &res)
+	if err != nil {
+		return fmt.Errorf("CancelOrder: %v", err)
+	}
+	return nil
+}
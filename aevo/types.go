@@ -0,0 +1,203 @@
+package aevo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"options-ws/decimal"
+)
+
+type Greeks struct {
+	Delta float64 `json:"delta,string"`
+	Theta float64 `json:"theta,string"`
+	Gamma float64 `json:"gamma,string"`
+	Rho   float64 `json:"rho,string"`
+	Vega  float64 `json:"vega,string"`
+	Iv    float64 `json:"iv,string"`
+}
+
+type Market struct {
+	InstrumentId     int64           `json:"instrument_id,string"`
+	InstrumentName   string          `json:"instrument_name"`
+	InstrumentType   string          `json:"instrument_type"`
+	UnderlyingAsset  string          `json:"underlying_asset"`
+	QuoteAsset       string          `json:"quote_asset"`
+	PriceStep        decimal.Decimal `json:"price_step"` //sent as a string
+	AmountStep       decimal.Decimal `json:"amount_step"`
+	MinOrderValue    float64         `json:"min_order_value,string"`
+	MaxOrderValue    float64         `json:"max_order_value,string"`
+	MaxNotionalValue float64         `json:"max_notional_value,string"`
+	MarkPrice        float64         `json:"mark_price,string"`
+	ForwardPrice     float64         `json:"forward_price,string"`
+	IndexPrice       float64         `json:"index_price,string"`
+	IsActive         bool            `json:"is_active"`
+	OptionType       string          `json:"option_type"`
+	Expiry           int64           `json:"expiry,string"`
+	Strike           int64           `json:"strike,string"`
+	Greeks           Greeks          `json:"greeks"`
+}
+
+// Position is an open position from GET /positions, Amount is unsigned, Side says which way.
+type Position struct {
+	InstrumentName string  `json:"instrument_name"`
+	Amount         float64 `json:"amount,string"`
+	Side           string  `json:"side"`
+	AvgEntryPrice  float64 `json:"avg_entry_price,string"`
+	MarkPrice      float64 `json:"mark_price,string"`
+	Greeks         Greeks  `json:"greeks"`
+}
+
+type Order struct {
+	OrderId        string  `json:"order_id"`
+	InstrumentName string  `json:"instrument_name"`
+	Side           string  `json:"side"`
+	Price          float64 `json:"price,string"`
+	Amount         float64 `json:"amount,string"`
+	Filled         float64 `json:"filled,string"`
+	OrderStatus    string  `json:"order_status"` //"opened", "filled", "cancelled", "dry_run" for orders DryRun didn't send
+}
+
+// Message is the envelope of every websocket frame, Data is decoded according to Channel.
+type Message struct {
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Level is one [price, amount, iv] orderbook level, sent as an array of number strings.
+type Level struct {
+	Price  decimal.Decimal
+	Amount float64
+	Iv     float64
+}
+
+// UnmarshalJSON parses the level array in place instead of going through []interface{} or [3]string, orderbook frames
+// are the bulk of the feed.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var price decimal.Decimal
+	var values [2]float64
+	err := parseNumberStrings(data, &price, values[:])
+	if err != nil {
+		return fmt.Errorf("Level: %v", err)
+	}
+	*l = Level{price, values[0], values[1]}
+	return nil
+}
+
+// Orderbook is the data of an "orderbook:<instrument>" frame.
+type Orderbook struct {
+	Type           string  `json:"type"` //"snapshot" or "update"
+	InstrumentName string  `json:"instrument_name"`
+	Bids           []Level `json:"bids"`
+	Asks           []Level `json:"asks"`
+	LastUpdated    float64 `json:"last_updated,string"` //unix nanoseconds
+	Checksum       string  `json:"checksum"`            //CRC32 of the book after this message, "" if not sent
+}
+
+// Index is the data of an "index:<asset>" frame.
+type Index struct {
+	Price     float64 `json:"price,string"`
+	Timestamp int64   `json:"timestamp,string"` //unix nanoseconds
+}
+
+// Ticker is one instrument of a "ticker:<asset>:PERPETUAL" or "ticker:<instrument>" frame, Bid and Ask are only
+// set for options.
+type Ticker struct {
+	InstrumentName string      `json:"instrument_name"` //e.g. "ETH-PERP"
+	InstrumentType string      `json:"instrument_type"`
+	FundingRate    float64     `json:"funding_rate,string"` //per hour
+	IndexPrice     float64     `json:"index_price,string"`
+	Bid            TickerLevel `json:"bid"`
+	Ask            TickerLevel `json:"ask"`
+	Mark           struct {
+		Price float64 `json:"price,string"`
+		Greeks
+	} `json:"mark"`
+}
+
+type TickerLevel struct {
+	Price  decimal.Decimal `json:"price"` //sent as a string
+	Amount float64         `json:"amount,string"`
+	Iv     float64         `json:"iv,string"`
+}
+
+type Tickers struct {
+	Timestamp int64    `json:"timestamp,string"` //unix nanoseconds
+	Tickers   []Ticker `json:"tickers"`
+}
+
+// Trade is the data of a "trades:<instrument>" frame, one print.
+type Trade struct {
+	InstrumentName   string  `json:"instrument_name"`
+	Price            float64 `json:"price,string"`
+	Amount           float64 `json:"amount,string"`
+	Side             string  `json:"side"`                     //"buy" or "sell", the taker's
+	CreatedTimestamp int64   `json:"created_timestamp,string"` //unix nanoseconds
+}
+
+// OrderbookMessage and IndexMessage decode a whole frame in one pass when the channel is already known, e.g. from
+// scanning the raw frame, saving the json.RawMessage copy of Message.
+type OrderbookMessage struct {
+	Channel string    `json:"channel"`
+	Data    Orderbook `json:"data"`
+}
+
+type IndexMessage struct {
+	Channel string `json:"channel"`
+	Data    Index  `json:"data"`
+}
+
+type TradeMessage struct {
+	Channel string `json:"channel"`
+	Data    Trade  `json:"data"`
+}
+
+type TickerMessage struct {
+	Channel string  `json:"channel"`
+	Data    Tickers `json:"data"`
+}
+
+// parseNumberStrings parses a JSON array of a price and exactly len(values) more number strings, e.g.
+// ["3000.5","1.2","0.65"], the price into price and the others into values.
+func parseNumberStrings(data []byte, price *decimal.Decimal, values []float64) error {
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '[' || data[len(data)-1] != ']' {
+		return fmt.Errorf("not an array: %s", data)
+	}
+
+	fields := data[1 : len(data)-1]
+	for i := -1; i < len(values); i++ {
+		end := bytes.IndexByte(fields, ',')
+		if end < 0 {
+			end = len(fields)
+		}
+		if (end == len(fields)) != (i == len(values)-1) {
+			return fmt.Errorf("expected %v elements: %s", len(values)+1, data)
+		}
+
+		field := bytes.TrimSpace(fields[:end])
+		if len(field) < 2 || field[0] != '"' || field[len(field)-1] != '"' {
+			return fmt.Errorf("element %v not a string: %s", i+1, data)
+		}
+		if i < 0 {
+			value, err := decimal.Parse(string(field[1 : len(field)-1]))
+			if err != nil {
+				return fmt.Errorf("element 0: %v", err)
+			}
+			*price = value
+		} else {
+			value, err := strconv.ParseFloat(string(field[1:len(field)-1]), 64)
+			if err != nil {
+				return fmt.Errorf("element %v: %v", i+1, err)
+			}
+			values[i] = value
+		}
+
+		if end < len(fields) {
+			fields = fields[end+1:]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package aevo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Subscriber sends subscribe messages built by SubscribeJson on a websocket connection, e.g. a reconnecting
+// connection manager that replays them after a reconnect.
+type Subscriber interface {
+	Subscribe(channels []string) error
+}
+
+func SubscribeJson(channels []string) []byte {
+	data := struct {
+		Op   string   `json:"op"`
+		Data []string `json:"data"`
+	}{"subscribe", channels}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
+	return jsonData
+}
+
+func UnsubscribeJson(channels []string) []byte {
+	data := struct {
+		Op   string   `json:"op"`
+		Data []string `json:"data"`
+	}{"unsubscribe", channels}
+
+	jsonData, _ := json.Marshal(data)
+	return jsonData
+}
+
+// PingJson is aevo's application level ping, answered with a frame without a channel.
+func PingJson() []byte {
+	return []byte(`{"op":"ping","id":1}`)
+}
+
+func OrderbookChannels(instruments []string) []string {
+	var orderbooks []string
+	for _, instrument := range instruments {
+		orderbooks = append(orderbooks, "orderbook:"+instrument)
+	}
+
+	return orderbooks
+}
+
+// TradeChannels are the prints of instruments, e.g. "trades:ETH-28JUN24-3000-C".
+func TradeChannels(instruments []string) []string {
+	var trades []string
+	for _, instrument := range instruments {
+		trades = append(trades, "trades:"+instrument)
+	}
+
+	return trades
+}
+
+// InstrumentTickerChannels are the best bid/ask and greeks of instruments, e.g. "ticker:ETH-28JUN24-3000-C", a
+// lighter feed than their orderbooks.
+func InstrumentTickerChannels(instruments []string) []string {
+	var tickers []string
+	for _, instrument := range instruments {
+		tickers = append(tickers, "ticker:"+instrument)
+	}
+
+	return tickers
+}
+
+func IndexChannels(assets []string) []string {
+	var indices []string
+	for _, asset := range assets {
+		indices = append(indices, "index:"+asset)
+	}
+
+	return indices
+}
+
+// TickerChannels are the perpetual tickers of assets, e.g. "ticker:ETH:PERPETUAL", carrying the perp's mark and
+// funding rate.
+func TickerChannels(assets []string) []string {
+	var tickers []string
+	for _, asset := range assets {
+		tickers = append(tickers, "ticker:"+asset+":PERPETUAL")
+	}
+
+	return tickers
+}
+
+func (c *Client) SubscribeOrderbooks(conn Subscriber, instruments []string) error {
+	err := conn.Subscribe(OrderbookChannels(instruments))
+	if err != nil {
+		return fmt.Errorf("SubscribeOrderbooks: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) SubscribeIndex(conn Subscriber, assets []string) error {
+	err := conn.Subscribe(IndexChannels(assets))
+	if err != nil {
+		return fmt.Errorf("SubscribeIndex: %v", err)
+	}
+	return nil
+}
+
+// ParseMessage decodes a frame's envelope, Data is left for Orderbook/Index.
+func ParseMessage(raw []byte) (Message, error) {
+	var message Message
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return message, fmt.Errorf("ParseMessage: %v", err)
+	}
+	return message, nil
+}
+
+func (m Message) IsOrderbook() bool { return strings.HasPrefix(m.Channel, "orderbook:") }
+func (m Message) IsIndex() bool     { return strings.HasPrefix(m.Channel, "index:") }
+
+// Asset is the asset of an index channel, e.g. "ETH" for "index:ETH".
+func (m Message) Asset() string { return strings.TrimPrefix(m.Channel, "index:") }
+
+func (m Message) Orderbook() (Orderbook, error) {
+	var orderbook Orderbook
+	err := json.Unmarshal(m.Data, &orderbook)
+	if err != nil {
+		return orderbook, fmt.Errorf("Orderbook: %v: %v", m.Channel, err)
+	}
+	return orderbook, nil
+}
+
+func (m Message) Index() (Index, error) {
+	var index Index
+	err := json.Unmarshal(m.Data, &index)
+	if err != nil {
+		return index, fmt.Errorf("Index: %v: %v", m.Channel, err)
+	}
+	return index, nil
+}
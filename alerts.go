@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ArbAlert is one notification about an ArbTable opportunity.
+type ArbAlert struct {
+	Key     string
+	Message string
+	Table   ArbTable
+}
+
+// Notifier delivers alerts to an external service.
+type Notifier interface {
+	Name() string
+	Notify(alert ArbAlert) error
+}
+
+func postJson(target string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	res, err := http.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%v: %v", target, res.Status)
+	}
+	return nil
+}
+
+type telegramNotifier struct {
+	Token  string
+	ChatId string
+}
+
+func (n telegramNotifier) Name() string { return "telegram" }
+
+func (n telegramNotifier) Notify(alert ArbAlert) error {
+	err := postJson("https://api.telegram.org/bot"+url.PathEscape(n.Token)+"/sendMessage", map[string]string{"chat_id": n.ChatId, "text": alert.Message})
+	if err != nil {
+		return fmt.Errorf("telegramNotifier: sendMessage failed") //the error holds the bot token
+	}
+	return nil
+}
+
+type discordNotifier struct {
+	Url string
+}
+
+func (n discordNotifier) Name() string { return "discord" }
+
+func (n discordNotifier) Notify(alert ArbAlert) error {
+	err := postJson(n.Url, map[string]string{"content": alert.Message})
+	if err != nil {
+		return fmt.Errorf("discordNotifier: webhook failed") //the error holds the webhook url, which is its credential
+	}
+	return nil
+}
+
+// webhookNotifier posts the whole ArbAlert as JSON.
+type webhookNotifier struct {
+	Url string
+}
+
+func (n webhookNotifier) Name() string { return "webhook" }
+
+func (n webhookNotifier) Notify(alert ArbAlert) error {
+	err := postJson(n.Url, alert)
+	if err != nil {
+		return fmt.Errorf("webhookNotifier: %v", err)
+	}
+	return nil
+}
+
+// notifiersFromEnv builds the Telegram (TELEGRAM_BOT_TOKEN / TELEGRAM_CHAT_ID) and Discord (DISCORD_WEBHOOK_URL)
+// notifiers whose credentials are set, plus a generic webhook to webhookUrl unless empty.
+func notifiersFromEnv(webhookUrl string) []Notifier {
+	notifiers := make([]Notifier, 0)
+	if token, chat := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_CHAT_ID"); token != "" && chat != "" {
+		notifiers = append(notifiers, telegramNotifier{Token: token, ChatId: chat})
+	}
+	if discord := os.Getenv("DISCORD_WEBHOOK_URL"); discord != "" {
+		notifiers = append(notifiers, discordNotifier{Url: discord})
+	}
+	if webhookUrl != "" {
+		notifiers = append(notifiers, webhookNotifier{Url: webhookUrl})
+	}
+	return notifiers
+}
+
+// ArbAlerter notifies when an opportunity's AbsProfit reaches MinProfit or its Apy reaches MinApy (0 disables either
+// threshold), following the lifecycle events of ArbEvents. An opportunity alerts once in its life, the first time it
+// qualifies, a later opportunity of the same strike only after Cooldown since the last alert, and no more than
+// MaxPerMinute alerts go out a minute across all opportunities.
+type ArbAlerter struct {
+	MinProfit    float64
+	MinApy       float64
+	Cooldown     time.Duration
+	MaxPerMinute int
+	Notifiers    []Notifier
+
+	lastAlerted map[string]time.Time
+	alertedLife map[string]time.Time //by key, when the life last alerted about opened
+	sent        []time.Time          //within the last minute
+}
+
+func newArbAlerter(notifiers []Notifier) *ArbAlerter {
+	return &ArbAlerter{
+		Cooldown:     15 * time.Minute,
+		MaxPerMinute: 10,
+		Notifiers:    notifiers,
+		lastAlerted:  make(map[string]time.Time),
+		alertedLife:  make(map[string]time.Time),
+	}
+}
+
+func (a *ArbAlerter) qualifies(table ArbTable) bool {
+	return (a.MinProfit > 0 && table.AbsProfit >= a.MinProfit) || (a.MinApy > 0 && table.Apy >= a.MinApy)
+}
+
+func arbAlertMessage(key string, table ArbTable) string {
+	return fmt.Sprintf("%v: sell %v on %v @ %v, buy %v on %v @ %v, profit %v (%v%%, apy %v%%), size %v",
+		key, table.BidType, table.BidExchange, table.Bids[0].Price, table.AskType, table.AskExchange, table.Asks[0].Price,
+		strconv.FormatFloat(table.AbsProfit, 'f', 2, 64), strconv.FormatFloat(table.RelProfit, 'f', 2, 64),
+		strconv.FormatFloat(table.Apy, 'f', 1, 64), strconv.FormatFloat(table.SuggestedSize, 'f', 2, 64))
+}
+
+// allow reports whether the rate limit leaves room for another alert at now, and if so counts it.
+func (a *ArbAlerter) allow(now time.Time) bool {
+	recent := a.sent[:0]
+	for _, t := range a.sent {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	a.sent = recent
+	if a.MaxPerMinute > 0 && len(a.sent) >= a.MaxPerMinute {
+		return false
+	}
+	a.sent = append(a.sent, now)
+	return true
+}
+
+func (a *ArbAlerter) handle(event ArbEvent, now time.Time) {
+	key := event.Key
+	if event.Type == "disappear" {
+		delete(a.alertedLife, key)
+		return
+	}
+	table := *event.Life.Last
+	if !a.qualifies(table) {
+		return
+	}
+	if opened, exists := a.alertedLife[key]; exists && opened.Equal(event.Life.Opened) {
+		return //alerted about this life already
+	}
+	if alerted, exists := a.lastAlerted[key]; exists && now.Sub(alerted) < a.Cooldown {
+		return
+	}
+	if !a.allow(now) {
+		slog.Warn("ArbAlerter: rate limited", "key", key, "max_per_minute", a.MaxPerMinute)
+		return
+	}
+	a.lastAlerted[key] = now
+	a.alertedLife[key] = event.Life.Opened
+
+	alert := ArbAlert{Key: key, Message: arbAlertMessage(key, table), Table: table}
+	for _, notifier := range a.Notifiers {
+		err := notifier.Notify(alert)
+		if err != nil {
+			slog.Error("ArbAlerter: notify failed", "notifier", notifier.Name(), "key", key, "err", err)
+		}
+	}
+}
+
+// Loop alerts on lifecycle events as they're published, cooldowns of strikes without an opportunity are dropped
+// every interval.
+func (a *ArbAlerter) Loop(interval time.Duration) {
+	subscriber := ArbEvents.Subscribe(func(ArbEvent) bool { return true })
+	defer ArbEvents.Unsubscribe(subscriber)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-subscriber.updates:
+			a.handle(event, time.Now())
+		case now := <-ticker.C:
+			for key, alerted := range a.lastAlerted {
+				if _, open := a.alertedLife[key]; !open && now.Sub(alerted) >= a.Cooldown {
+					delete(a.lastAlerted, key)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OrderbookSnapshot is an instrument's book as /api/orderbooks and /api/orderbooks/{instrument} serve it.
+type OrderbookSnapshot struct {
+	Instrument  string
+	Bids        map[string][]Order //key: exchange, best first
+	Asks        map[string][]Order
+	LastUpdated float64
+	RestSourced []string               `json:",omitempty"` //exchanges whose side is a REST fallback snapshot
+	Metrics     map[string]BookMetrics `json:",omitempty"` //by exchange, see bookmetrics.go
+}
+
+// orderbookSnapshot limits each exchange's levels to depth, 0 keeps all of them.
+func orderbookSnapshot(instrument string, orderbook OrderbookData, exchange string, depth int) OrderbookSnapshot {
+	trim := func(sides map[string][]Order) map[string][]Order {
+		trimmed := make(map[string][]Order, len(sides))
+		for name, orders := range sides {
+			if exchange != "" && name != exchange {
+				continue
+			}
+			if depth > 0 && len(orders) > depth {
+				orders = orders[:depth]
+			}
+			trimmed[name] = orders
+		}
+		return trimmed
+	}
+	var restSourced []string
+	for name, sourced := range orderbook.RestSourced {
+		if sourced && (exchange == "" || name == exchange) {
+			restSourced = append(restSourced, name)
+		}
+	}
+	sort.Strings(restSourced)
+	var metrics map[string]BookMetrics
+	for name, m := range orderbook.Metrics {
+		if exchange == "" || name == exchange {
+			if metrics == nil {
+				metrics = make(map[string]BookMetrics)
+			}
+			metrics[name] = m
+		}
+	}
+	return OrderbookSnapshot{Instrument: instrument, Bids: trim(orderbook.Bids), Asks: trim(orderbook.Asks), LastUpdated: orderbook.LastUpdated, RestSourced: restSourced,
+		Metrics: metrics}
+}
+
+func writeJson(w http.ResponseWriter, handler string, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error(handler+": json encode error", "err", err)
+	}
+}
+
+func depthParam(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("depth")
+	if raw == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+// orderbooksHandler serves /api/orderbooks, every book sorted by instrument, optionally filtered by ?asset= and
+// ?exchange= and trimmed to ?depth= levels.
+func orderbooksHandler(w http.ResponseWriter, r *http.Request) {
+	depth, err := depthParam(r)
+	if err != nil {
+		http.Error(w, "depth: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	asset, exchange := r.URL.Query().Get("asset"), r.URL.Query().Get("exchange")
+
+	snapshots := make([]OrderbookSnapshot, 0)
+	for instrument, orderbook := range OrderbookContainer.Snapshot() {
+		if asset != "" && !strings.HasPrefix(instrument, asset+"-") {
+			continue
+		}
+		snapshots = append(snapshots, orderbookSnapshot(instrument, orderbook, exchange, depth))
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Instrument < snapshots[j].Instrument })
+
+	writeJson(w, "orderbooksHandler", snapshots)
+}
+
+// orderbookHandler serves /api/orderbooks/{instrument}, e.g. /api/orderbooks/ETH-28JUN24-3000-C?depth=5.
+func orderbookHandler(w http.ResponseWriter, r *http.Request) {
+	depth, err := depthParam(r)
+	if err != nil {
+		http.Error(w, "depth: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	instrument := strings.ToUpper(r.PathValue("instrument"))
+	orderbook, exists := OrderbookContainer.Get(instrument)
+	if !exists {
+		http.Error(w, "no orderbook for "+instrument, http.StatusNotFound)
+		return
+	}
+
+	writeJson(w, "orderbookHandler", orderbookSnapshot(instrument, orderbook, r.URL.Query().Get("exchange"), depth))
+}
+
+// indexApiHandler serves /api/index, index prices by exchange then asset.
+func indexApiHandler(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, "indexApiHandler", map[string]map[string]float64{
+		"aevo":    AevoIndex.Snapshot(),
+		"lyra":    LyraIndex.Snapshot(),
+		"deribit": DeribitIndex.Snapshot(),
+		"okx":     OkxIndex.Snapshot(),
+
+		"binance-options": BinanceOptionsIndex.Snapshot(),
+	})
+}
+
+type ArbSnapshot struct {
+	Key string
+	ArbTable
+}
+
+// arbsHandler serves /api/arbs, open opportunities sorted like the table (?sort=abs or apy), box spreads with
+// ?category=box.
+func arbsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("category") == "box" {
+		BoxContainer.Mu.RLock()
+		boxes := make(map[string]BoxTable, len(BoxContainer.BoxTables))
+		for key, table := range BoxContainer.BoxTables {
+			boxes[key] = *table
+		}
+		BoxContainer.Mu.RUnlock()
+		writeJson(w, "arbsHandler", boxes)
+		return
+	}
+
+	sortBy := arbTableSort(r)
+	arbs := make([]ArbSnapshot, 0)
+	for key, table := range ArbContainer.Snapshot() {
+		arbs = append(arbs, ArbSnapshot{key, table})
+	}
+	sort.Slice(arbs, func(i, j int) bool { return arbs[i].rankValue(sortBy) > arbs[j].rankValue(sortBy) })
+
+	writeJson(w, "arbsHandler", arbs)
+}
@@ -1,63 +1,93 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"math"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"options-ws/decimal"
 )
 
+var MinProfit float64 //minimum AbsProfit for a strike to be listed
+
+var ArbClock = time.Now //time arb passes price expiries at, backtests set it to the capture's time
+
+// findApy annualizes relProfit (percent) over the time actually left until the expiry's settlement, compounding, 0
+// once it has passed.
 func findApy(expiry string, relProfit float64) float64 {
-	ts, err := time.Parse("02Jan06", expiry)
+	expiryTime, err := instrumentExpiry(expiry)
 	if err != nil {
-		log.Printf("findApy: error parsing expiry to timestamp: %v\n\n", err)
+		slog.Error("findApy: error parsing expiry to timestamp", "expiry", expiry, "err", err)
+		return 0.0
+	}
+	years := yearsUntil(expiryTime, ArbClock())
+	if years <= 0 {
 		return 0.0
 	}
-	timestamp := float64(ts.Unix())
-	now := float64(time.Now().Unix())
 
-	apy := math.Pow(1.0+(relProfit/100), 365/math.Ceil((1+timestamp-now)/86400)) * 100
-	// apy := 365/math.Ceil((1+timestamp-now)/86400) * relProfit
+	return (math.Pow(1.0+(relProfit/100), 1/years) - 1) * 100
+}
 
-	return apy
+// parityIndex is the index a parity trade is hedged at: aevo's, or that of the exchange the put leg trades on when it
+// publishes one. Callers hold AevoIndex, LyraIndex, DeribitIndex, OkxIndex and BinanceOptionsIndex.
+func parityIndex(asset string, putExchange string) float64 {
+	if price, exists := LyraIndex.Index[asset]; putExchange == "lyra" && exists {
+		return price
+	}
+	if price, exists := DeribitIndex.Index[asset]; putExchange == "deribit" && exists {
+		return price
+	}
+	if price, exists := OkxIndex.Index[asset]; putExchange == "okx" && exists {
+		return price
+	}
+	if price, exists := BinanceOptionsIndex.Index[asset]; putExchange == "binance-options" && exists {
+		return price
+	}
+	return AevoIndex.Index[asset]
 }
 
+// updateArbTable keeps the more profitable of the two put-call parity violations of a strike in ArbTables, sell call
+// buy put (call bid + strike > put ask + forward) or sell put buy call (put bid + forward > call ask + strike), and
+// removes the strike once neither holds after both legs' taker fees or it can't be ordered (see orderable). The
+// forward is the hedge index times the expiry's forwardBasis. Parity is checked in decimals, the strike, forward and
+// fees rounded to decimal.Places, so a BTC sized strike doesn't blur the premiums' last digits.
 func updateArbTable(asset string, key string, callBids []Order, callAsks []Order, putBids []Order, putAsks []Order, expiry string, strike float64) {
+	basis := forwardBasis(asset, expiry, ArbClock())
+	strikeDecimal := decimal.FromFloat(strike)
+
 	ArbContainer.Mu.Lock()
-	LyraIndex.Mu.Lock()
-	AevoIndex.Mu.Lock()
-	defer LyraIndex.Mu.Unlock()
-	defer AevoIndex.Mu.Unlock()
+	AevoIndex.Mu.RLock() //same order as indexHandler, aevo before lyra
+	LyraIndex.Mu.RLock()
+	DeribitIndex.Mu.RLock()
+	OkxIndex.Mu.RLock()
+	BinanceOptionsIndex.Mu.RLock()
+	defer BinanceOptionsIndex.Mu.RUnlock()
+	defer OkxIndex.Mu.RUnlock()
+	defer DeribitIndex.Mu.RUnlock()
+	defer LyraIndex.Mu.RUnlock()
+	defer AevoIndex.Mu.RUnlock()
 	defer ArbContainer.Mu.Unlock()
 
-	//  abs((index + put) - (strike + call))
-	var absProfit float64
-	var callBid float64
-	var putAsk float64
-	var index float64
-	if len(callBids) > 0 && len(putAsks) > 0 {
-		callBid = callBids[0].Price
-		putAsk = putAsks[0].Price
-
-		index = AevoIndex.Index[asset]
+	var best *ArbTable
+	var bestIndex float64
 
-		_, exists := LyraIndex.Index[asset]
-		if putAsks[0].Exchange == "lyra" && exists {
-			index = LyraIndex.Index[asset]
-		}
-
-		if index <= 0 { //not a good solution, but checking UpdateIndex doesnt work for some reason, maybe add Index variable to orderbooks struct and use that instead of global index
-			return
-		}
+	if len(callBids) > 0 && len(putAsks) > 0 {
+		callBid := callBids[0].Price
+		putAsk := putAsks[0].Price
+		index := parityIndex(asset, putAsks[0].Exchange)
+		forward := index * basis
 
-		absProfit = math.Abs((index + putAsk) - (strike + callBid)) //broken when index is near 0
-		relProfit := absProfit / (index + putAsk + callBid) * 100
-		apy := findApy(expiry, relProfit)
+		fees := takerFees([]Order{callBids[0], putAsks[0]}, index)
+		forwardDecimal, feesDecimal := decimal.FromFloat(forward), decimal.FromFloat(fees)
 
-		if callBid+strike > putAsk+index {
-			ArbContainer.ArbTables[key] = &ArbTable{
+		if index > 0 && callBid+strikeDecimal > putAsk+forwardDecimal+feesDecimal {
+			absProfit := ((callBid + strikeDecimal) - (putAsk + forwardDecimal) - feesDecimal).Float64()
+			margins := arbMargins(callBids[0], "C", putAsks[0], strike, index)
+			relProfit := absProfit / margins.Total() * 100
+			apy := findApy(expiry, relProfit)
+			best = &ArbTable{
 				Asset:       asset,
 				Expiry:      expiry,
 				Strike:      strike,
@@ -67,53 +97,93 @@ func updateArbTable(asset string, key string, callBids []Order, callAsks []Order
 				AskType:     "P",
 				BidExchange: callBids[0].Exchange,
 				AskExchange: putAsks[0].Exchange,
+				Forward:     forward,
+				Fees:        fees,
 				AbsProfit:   absProfit,
+				Margins:     margins,
+				Capital:     margins.Total(),
 				RelProfit:   relProfit,
 				Apy:         apy,
+				ExcessApy:   excessApy(apy),
 			}
+			bestIndex = index
 		}
 	}
 
-	var callAsk float64
-	var putBid float64
 	if len(callAsks) > 0 && len(putBids) > 0 {
-		callAsk = callAsks[0].Price
-		putBid = putBids[0].Price
-		thisProfit := math.Abs((index + putBid) - (strike + callAsk))
-		relProfit := thisProfit / (index + callAsk + putBid) * 100
-		apy := findApy(expiry, relProfit)
-
-		if callAsk+strike < putBid+index && thisProfit > absProfit {
-			ArbContainer.ArbTables[key] = &ArbTable{
-				Asset:       asset,
-				Expiry:      expiry,
-				Strike:      strike,
-				Bids:        putBids,
-				Asks:        callAsks,
-				BidType:     "P",
-				AskType:     "C",
-				BidExchange: putBids[0].Exchange,
-				AskExchange: callAsks[0].Exchange,
-				AbsProfit:   thisProfit,
-				RelProfit:   relProfit,
-				Apy:         apy,
+		callAsk := callAsks[0].Price
+		putBid := putBids[0].Price
+		index := parityIndex(asset, putBids[0].Exchange)
+		forward := index * basis
+
+		fees := takerFees([]Order{putBids[0], callAsks[0]}, index)
+		forwardDecimal, feesDecimal := decimal.FromFloat(forward), decimal.FromFloat(fees)
+
+		if index > 0 && callAsk+strikeDecimal+feesDecimal < putBid+forwardDecimal {
+			absProfit := ((putBid + forwardDecimal) - (callAsk + strikeDecimal) - feesDecimal).Float64()
+			if best == nil || absProfit > best.AbsProfit {
+				margins := arbMargins(putBids[0], "P", callAsks[0], strike, index)
+				relProfit := absProfit / margins.Total() * 100
+				apy := findApy(expiry, relProfit)
+				best = &ArbTable{
+					Asset:       asset,
+					Expiry:      expiry,
+					Strike:      strike,
+					Bids:        putBids,
+					Asks:        callAsks,
+					BidType:     "P",
+					AskType:     "C",
+					BidExchange: putBids[0].Exchange,
+					AskExchange: callAsks[0].Exchange,
+					Forward:     forward,
+					Fees:        fees,
+					AbsProfit:   absProfit,
+					Margins:     margins,
+					Capital:     margins.Total(),
+					RelProfit:   relProfit,
+					Apy:         apy,
+					ExcessApy:   excessApy(apy),
+				}
+				bestIndex = index
 			}
 		}
 	}
+
+	if best != nil && best.AbsProfit >= MinProfit {
+		suggestSize(best, key, bestIndex)
+	}
+	if best == nil || best.AbsProfit < MinProfit || !orderable(key, best) {
+		if _, exists := ArbContainer.ArbTables[key]; exists {
+			publishOpportunityClosed(key)
+		}
+		delete(ArbContainer.ArbTables, key)
+		return
+	}
+
+	best.PostLiquidation = postLiquidationWindow()
+	if previous, exists := ArbContainer.ArbTables[key]; !exists || previous.AbsProfit != best.AbsProfit {
+		publishOpportunity(key, best) //new or changed, not every pass
+	}
+	ArbContainer.ArbTables[key] = best
 }
 
-func findBestOrders(callOrderbook *OrderbookData, putOrderbook *OrderbookData) (callBids []Order, callAsks []Order, putBids []Order, putAsks []Order) {
+// findBestOrders returns the best exchange's levels of each side of the strike key (e.g. "ETH-28JUN24-3000"), leaving
+// out sides stale at now or contradicted by a later print.
+func findBestOrders(key string, callOrderbook *OrderbookData, putOrderbook *OrderbookData, now time.Time) (callBids []Order, callAsks []Order, putBids []Order, putAsks []Order) {
 	callBidExists := false
 	callAskExists := false
 	putBidExists := false
 	putAskExists := false
 
-	bestCallBids := []Order{{Price: -1}}
-	bestPutAsks := []Order{{Price: 100000000}}
-	bestCallAsks := []Order{{Price: 100000000}}
-	bestPutBids := []Order{{Price: -1}}
+	bestCallBids := []Order{{Price: decimal.FromInt(-1)}}
+	bestPutAsks := []Order{{Price: decimal.FromInt(100000000)}}
+	bestCallAsks := []Order{{Price: decimal.FromInt(100000000)}}
+	bestPutBids := []Order{{Price: decimal.FromInt(-1)}}
 
-	for _, bid := range callOrderbook.Bids {
+	for exchange, bid := range callOrderbook.Bids {
+		if bookStale(callOrderbook, exchange, now) || tradedThrough(key+"-C", exchange, bid, true, callOrderbook.Timestamps[exchange]) {
+			continue
+		}
 		// remember to use correct comparison sign based on bid or ask (highest bid lowest ask)
 		if len(bid) > 0 { //need to check if each map entry is nonempty, Exists only stays false if all are empty
 			callBidExists = true
@@ -128,7 +198,10 @@ func findBestOrders(callOrderbook *OrderbookData, putOrderbook *OrderbookData) (
 		bestCallBids = []Order{}
 	}
 
-	for _, ask := range callOrderbook.Asks {
+	for exchange, ask := range callOrderbook.Asks {
+		if bookStale(callOrderbook, exchange, now) || tradedThrough(key+"-C", exchange, ask, false, callOrderbook.Timestamps[exchange]) {
+			continue
+		}
 		if len(ask) > 0 {
 			callAskExists = true
 		} else {
@@ -142,7 +215,10 @@ func findBestOrders(callOrderbook *OrderbookData, putOrderbook *OrderbookData) (
 		bestCallAsks = []Order{}
 	}
 
-	for _, bid := range putOrderbook.Bids {
+	for exchange, bid := range putOrderbook.Bids {
+		if bookStale(putOrderbook, exchange, now) || tradedThrough(key+"-P", exchange, bid, true, putOrderbook.Timestamps[exchange]) {
+			continue
+		}
 		if len(bid) > 0 {
 			putBidExists = true
 		} else {
@@ -156,7 +232,10 @@ func findBestOrders(callOrderbook *OrderbookData, putOrderbook *OrderbookData) (
 		bestPutBids = []Order{}
 	}
 
-	for _, ask := range putOrderbook.Asks {
+	for exchange, ask := range putOrderbook.Asks {
+		if bookStale(putOrderbook, exchange, now) || tradedThrough(key+"-P", exchange, ask, false, putOrderbook.Timestamps[exchange]) {
+			continue
+		}
 		if len(ask) > 0 {
 			putAskExists = true
 		} else {
@@ -173,40 +252,89 @@ func findBestOrders(callOrderbook *OrderbookData, putOrderbook *OrderbookData) (
 	return bestCallBids, bestCallAsks, bestPutBids, bestPutAsks
 }
 
-func updateArbTables(asset string) {
-	for key, orderbook := range Orderbooks {
+// parityStrategy is the put-call parity scanner as a Strategy: each call book is paired with its strike's put book and
+// the strike's opportunity kept in ArbContainer by updateArbTable, strikes of the asset not seen by the end of the pass
+// (expired, trimmed by the memory budget, about to expire) are dropped.
+type parityStrategy struct {
+	Mu      sync.Mutex
+	visited map[string]map[string]bool //key: asset, strikes seen in its current pass
+}
 
-		components := strings.Split(key, "-")
-		expiry := components[1]
-		strike, err := strconv.ParseFloat(components[2], 64)
-		if err != nil {
-			fmt.Printf("updateArbTables: unable to convert strike string to float64: %v\n", err)
-			continue
-		}
-		optionType := components[3]
+func newParityStrategy() Strategy {
+	return &parityStrategy{visited: make(map[string]map[string]bool)}
+}
 
-		var keyTrim string
-		var key2 string
-		if optionType == "C" {
-			var found bool
-			keyTrim, found = strings.CutSuffix(key, "-C")
-			if !found {
-				continue
-			}
-			key2 = keyTrim + "-P"
-		} else {
-			continue
-		}
+func (s *parityStrategy) Name() string {
+	return "parity"
+}
 
-		orderbook2, exists := Orderbooks[key2]
-		if !exists {
-			continue
-		}
+// OnIndex starts the asset's pass, the index is read with the other exchanges' under their locks per strike.
+func (s *parityStrategy) OnIndex(asset string, index float64, now time.Time) {
+	s.Mu.Lock()
+	s.visited[asset] = make(map[string]bool)
+	s.Mu.Unlock()
+}
 
-		bestCallBids, bestCallAsks, bestPutBids, bestPutAsks := findBestOrders(orderbook, orderbook2)
-		// fmt.Printf("%v\n%v\n%v\n%v\n\n", bestCallBids, bestCallAsks, bestPutBids, bestPutAsks)
+func (s *parityStrategy) OnOrderbook(key string, orderbook *OrderbookData, now time.Time) {
+	instrument, err := parseInstrument(key)
+	if err != nil {
+		slog.Error("parityStrategy: unexpected instrument", "instrument", key, "err", err)
+		return
+	}
+	if instrument.Type != "C" {
+		return
+	}
+	expiry := instrument.ExpiryCode()
+	if !tradableExpiry(expiry, now) {
+		return //dropped from ArbTables by Scanned with the strikes that lost a leg
+	}
+	strike := instrument.Strike
+	keyTrim := strings.TrimSuffix(key, "-C") //as the book is keyed, not reformatted
+	key2 := keyTrim + "-P"
+
+	orderbook2, exists := OrderbookContainer.Orderbooks[key2]
+	if !exists || quarantined(key2, now) {
+		return
+	}
+
+	bestCallBids, bestCallAsks, bestPutBids, bestPutAsks := findBestOrders(keyTrim, orderbook, orderbook2, now)
+	if debugEnabled() {
+		slog.Debug("parityStrategy: best orders", "strike", keyTrim, "call_bids", bestCallBids, "call_asks", bestCallAsks, "put_bids", bestPutBids, "put_asks", bestPutAsks)
+	}
 
-		updateArbTable(asset, keyTrim, bestCallBids, bestCallAsks, bestPutBids, bestPutAsks, expiry, strike)
+	updateArbTable(instrument.Asset, keyTrim, bestCallBids, bestCallAsks, bestPutBids, bestPutAsks, expiry, strike)
+	markRestSourcedLegs(keyTrim, orderbook, orderbook2)
+	estimateFillProbability(keyTrim, orderbook, orderbook2, now)
+	scoreBookQuality(keyTrim, orderbook, orderbook2)
+	s.Mu.Lock()
+	if visited, exists := s.visited[instrument.Asset]; exists {
+		visited[keyTrim] = true
+	}
+	s.Mu.Unlock()
+}
+
+func (s *parityStrategy) Scanned(asset string, now time.Time) {
+	s.Mu.Lock()
+	visited := s.visited[asset]
+	delete(s.visited, asset)
+	s.Mu.Unlock()
+
+	ArbContainer.Mu.Lock()
+	for key, table := range ArbContainer.ArbTables {
+		if table.Asset == asset && !visited[key] {
+			delete(ArbContainer.ArbTables, key)
+			publishOpportunityClosed(key)
+		}
+	}
+	trackArbLives(asset, now)
+	ArbContainer.Mu.Unlock()
+}
 
+func (s *parityStrategy) Opportunities() []Opportunity {
+	arbs := ArbContainer.Snapshot()
+	opportunities := make([]Opportunity, 0, len(arbs))
+	for key, table := range arbs {
+		opportunities = append(opportunities, Opportunity{"parity", key, table.Asset, table.AbsProfit, table.Apy, table})
 	}
+	return opportunities
 }
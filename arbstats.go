@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+var ArbStatsHourlyRetention = 7 * 24 * time.Hour
+var ArbStatsDailyRetention = 90 * 24 * time.Hour
+
+type arbExpiryRange struct {
+	Label string
+	Under time.Duration
+}
+
+type arbMoneynessRange struct {
+	Label string
+	Under float64 //strike / forward
+}
+
+var arbExpiryBuckets = []arbExpiryRange{{"0-1d", 24 * time.Hour}, {"1-7d", 7 * 24 * time.Hour}, {"7-30d", 30 * 24 * time.Hour}, {"30-90d", 90 * 24 * time.Hour}, {"90d+", 1<<63 - 1}}
+
+var arbMoneynessBuckets = []arbMoneynessRange{{"<0.8", 0.8}, {"0.8-0.95", 0.95}, {"0.95-1.05", 1.05}, {"1.05-1.2", 1.2}, {"1.2+", 1e300}}
+
+type arbStatsKey struct {
+	Period    time.Time //start of the hour or day, zero when aggregated over all of them
+	Expiry    string    //"" when aggregated over expiries
+	Moneyness string
+}
+
+type arbStatsBucket struct {
+	Count       int
+	TotalProfit float64
+	MaxProfit   float64
+}
+
+func (b *arbStatsBucket) add(count int, total float64, peak float64) {
+	b.Count += count
+	b.TotalProfit += total
+	b.MaxProfit = max(b.MaxProfit, peak)
+}
+
+// ArbStatsContainer counts every opportunity once, when its life closes, in the UTC hour and day it was found in, split
+// by how far its expiry was and its strike's moneyness against the parity forward, with its peak profit.
+type ArbStatsContainer struct {
+	Mu     sync.Mutex
+	Hourly map[arbStatsKey]*arbStatsBucket
+	Daily  map[arbStatsKey]*arbStatsBucket
+	Pruned time.Time
+}
+
+var ArbStats = ArbStatsContainer{Hourly: make(map[arbStatsKey]*arbStatsBucket), Daily: make(map[arbStatsKey]*arbStatsBucket)}
+
+// arbExpiryBucket is the time from found to the opportunity's expiry, "unknown" if it doesn't parse.
+func arbExpiryBucket(table *ArbTable, found time.Time) string {
+	expiry, err := instrumentExpiry(table.Expiry)
+	if err != nil {
+		return "unknown"
+	}
+	for _, bucket := range arbExpiryBuckets {
+		if expiry.Sub(found) < bucket.Under {
+			return bucket.Label
+		}
+	}
+	return "unknown"
+}
+
+func arbMoneynessBucket(table *ArbTable) string {
+	if table.Forward <= 0 {
+		return "unknown"
+	}
+	for _, bucket := range arbMoneynessBuckets {
+		if table.Strike/table.Forward < bucket.Under {
+			return bucket.Label
+		}
+	}
+	return "unknown"
+}
+
+// recordArbStats counts a closed opportunity. The caller holds ArbLives.Mu.
+func recordArbStats(life *arbLife) {
+	expiry, moneyness := arbExpiryBucket(life.Open, life.Opened), arbMoneynessBucket(life.Open)
+	hour, day := life.Opened.UTC().Truncate(time.Hour), life.Opened.UTC().Truncate(24*time.Hour)
+
+	ArbStats.Mu.Lock()
+	defer ArbStats.Mu.Unlock()
+	addArbStats(ArbStats.Hourly, arbStatsKey{hour, expiry, moneyness}, 1, life.PeakProfit, life.PeakProfit)
+	addArbStats(ArbStats.Daily, arbStatsKey{day, expiry, moneyness}, 1, life.PeakProfit, life.PeakProfit)
+	if hour.After(ArbStats.Pruned) {
+		ArbStats.Pruned = hour
+		pruneArbStats(ArbStats.Hourly, hour.Add(-ArbStatsHourlyRetention))
+		pruneArbStats(ArbStats.Daily, day.Add(-ArbStatsDailyRetention))
+	}
+}
+
+func addArbStats(buckets map[arbStatsKey]*arbStatsBucket, key arbStatsKey, count int, total float64, peak float64) {
+	bucket, exists := buckets[key]
+	if !exists {
+		bucket = &arbStatsBucket{}
+		buckets[key] = bucket
+	}
+	bucket.add(count, total, peak)
+}
+
+func pruneArbStats(buckets map[arbStatsKey]*arbStatsBucket, before time.Time) {
+	for key := range buckets {
+		if key.Period.Before(before) {
+			delete(buckets, key)
+		}
+	}
+}
+
+type arbStatsRowJson struct {
+	Period     *time.Time `json:"period,omitempty"`
+	Expiry     string     `json:"expiry,omitempty"`
+	Moneyness  string     `json:"moneyness,omitempty"`
+	Count      int        `json:"count"`
+	MeanProfit float64    `json:"mean_profit"` //of the opportunities' peak profits
+	MaxProfit  float64    `json:"max_profit"`
+}
+
+// arbStatsRows aggregates the buckets of period, "hour", "day" or "all", by the dimensions in by, "expiry" and
+// "moneyness", sorted by period and then the buckets' order. Opportunities still open are counted as of now.
+func arbStatsRows(period string, by []string) []arbStatsRowJson {
+	byExpiry, byMoneyness := slices.Contains(by, "expiry"), slices.Contains(by, "moneyness")
+	rowKey := func(key arbStatsKey) arbStatsKey {
+		switch period {
+		case "hour":
+			key.Period = key.Period.Truncate(time.Hour)
+		case "day":
+			key.Period = key.Period.Truncate(24 * time.Hour)
+		default:
+			key.Period = time.Time{}
+		}
+		if !byExpiry {
+			key.Expiry = ""
+		}
+		if !byMoneyness {
+			key.Moneyness = ""
+		}
+		return key
+	}
+
+	rows := make(map[arbStatsKey]*arbStatsBucket)
+	ArbLives.Mu.Lock()
+	for _, life := range ArbLives.Lives {
+		key := arbStatsKey{life.Opened.UTC(), arbExpiryBucket(life.Open, life.Opened), arbMoneynessBucket(life.Open)}
+		addArbStats(rows, rowKey(key), 1, life.PeakProfit, life.PeakProfit)
+	}
+	ArbLives.Mu.Unlock()
+
+	ArbStats.Mu.Lock()
+	buckets := ArbStats.Hourly
+	if period != "hour" {
+		buckets = ArbStats.Daily //day boundaries are hour boundaries, "all" covers the longer retention
+	}
+	for key, bucket := range buckets {
+		addArbStats(rows, rowKey(key), bucket.Count, bucket.TotalProfit, bucket.MaxProfit)
+	}
+	ArbStats.Mu.Unlock()
+
+	result := make([]arbStatsRowJson, 0, len(rows))
+	for key, bucket := range rows {
+		row := arbStatsRowJson{Expiry: key.Expiry, Moneyness: key.Moneyness, Count: bucket.Count, MeanProfit: bucket.TotalProfit / float64(bucket.Count), MaxProfit: bucket.MaxProfit}
+		if !key.Period.IsZero() {
+			row.Period = &key.Period
+		}
+		result = append(result, row)
+	}
+	expiryOrder := func(label string) int {
+		return slices.IndexFunc(arbExpiryBuckets, func(bucket arbExpiryRange) bool { return bucket.Label == label })
+	}
+	moneynessOrder := func(label string) int {
+		return slices.IndexFunc(arbMoneynessBuckets, func(bucket arbMoneynessRange) bool { return bucket.Label == label })
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Period != nil && !a.Period.Equal(*b.Period) {
+			return a.Period.Before(*b.Period)
+		}
+		if a.Expiry != b.Expiry {
+			return expiryOrder(a.Expiry) < expiryOrder(b.Expiry)
+		}
+		return moneynessOrder(a.Moneyness) < moneynessOrder(b.Moneyness)
+	})
+	return result
+}
+
+// arbStatsHandler serves /api/arb-stats, the opportunities counted by ?period= "hour" (default), "day" or "all", split
+// by ?by=, a comma separated list of "expiry" and "moneyness".
+func arbStatsHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "hour"
+	}
+	if period != "hour" && period != "day" && period != "all" {
+		http.Error(w, "period: not hour, day or all: "+period, http.StatusBadRequest)
+		return
+	}
+	by := make([]string, 0)
+	if raw := r.URL.Query().Get("by"); raw != "" {
+		by = strings.Split(raw, ",")
+	}
+	for _, dimension := range by {
+		if dimension != "expiry" && dimension != "moneyness" {
+			http.Error(w, "by: not expiry or moneyness: "+dimension, http.StatusBadRequest)
+			return
+		}
+	}
+	writeJson(w, "arbStatsHandler", arbStatsRows(period, by))
+}
+
+// printArbStats writes the opportunities by hour, expiry and moneyness to w.
+func printArbStats(w io.Writer) {
+	hours := arbStatsRows("hour", nil)
+	if len(hours) == 0 {
+		fmt.Fprintln(w, "no arb opportunities found")
+		return
+	}
+	format := func(value float64) string { return strconv.FormatFloat(value, 'f', 2, 64) }
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "hour (UTC)\tcount\tmean profit\tmax profit")
+	for _, row := range hours {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", row.Period.Format("2006-01-02 15:04"), row.Count, format(row.MeanProfit), format(row.MaxProfit))
+	}
+	fmt.Fprintln(tw, "\t\t\t")
+	fmt.Fprintln(tw, "expiry\tcount\tmean profit\tmax profit")
+	for _, row := range arbStatsRows("all", []string{"expiry"}) {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", row.Expiry, row.Count, format(row.MeanProfit), format(row.MaxProfit))
+	}
+	fmt.Fprintln(tw, "\t\t\t")
+	fmt.Fprintln(tw, "moneyness (K/F)\tcount\tmean profit\tmax profit")
+	for _, row := range arbStatsRows("all", []string{"moneyness"}) {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", row.Moneyness, row.Count, format(row.MeanProfit), format(row.MaxProfit))
+	}
+	tw.Flush()
+}
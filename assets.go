@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AssetsMu guards Assets once the pipelines run, AssetRouter.Add/Remove write it and other readers use currentAssets.
+var AssetsMu sync.RWMutex
+var assetsChanged = make(chan struct{}) //closed and replaced whenever Assets changes
+
+func currentAssets() []string {
+	AssetsMu.RLock()
+	defer AssetsMu.RUnlock()
+	return slices.Clone(Assets)
+}
+
+// assetsChangedSignal returns a channel that is closed the next time Assets changes, so loops sleeping between
+// subscription refreshes pick up added assets straight away.
+func assetsChangedSignal() <-chan struct{} {
+	AssetsMu.RLock()
+	defer AssetsMu.RUnlock()
+	return assetsChanged
+}
+
+// frameAsset extracts the underlying a frame's channel names, e.g. ETH from "orderbook:ETH-28JUN24-3000-C",
+// "orderbook.ETH-20240628-3000-C.10.10", "spot_feed.ETH", "book.ETH-28JUN24-3000-C.none.10.100ms" or
+// "deribit_price_index.eth_usd" or okx's "books5:ETH-USD-240628-3000-C". Frames without a channel, and deribit's
+// account channels, return "".
+func frameAsset(exchange string, raw []byte) string {
+	channel := Channels.Channel(exchange, raw)
+	if bytes.HasPrefix(channel, []byte("user.")) {
+		return ""
+	}
+	start := bytes.IndexAny(channel, ":.")
+	if start < 0 {
+		return ""
+	}
+	channel = channel[start+1:]
+
+	end := 0
+	for end < len(channel) && (channel[end] >= 'A' && channel[end] <= 'Z' || channel[end] >= 'a' && channel[end] <= 'z') {
+		end++
+	}
+	return strings.ToUpper(string(channel[:end]))
+}
+
+// AssetRouter runs an independent Pipeline per underlying, each with its own workers and arb pass over its asset's
+// tables, so a busy chain doesn't delay another's opportunities. Frames that name no asset (subscription responses,
+// pongs, liquidations) go to Shared, frames of assets not (or no longer) routed are dropped.
+type AssetRouter struct {
+	Mu        sync.RWMutex
+	Pipelines map[string]*Pipeline
+	Shared    *Pipeline
+	Dropped   atomic.Int64 //frames of unrouted assets
+
+	workers   int
+	queueSize int
+}
+
+func newAssetRouter(assets []string, workers int, queueSize int) *AssetRouter {
+	r := &AssetRouter{
+		Pipelines: make(map[string]*Pipeline, len(assets)),
+		Shared:    newScopedPipeline(func() []string { return nil }, nil, 1, queueSize), //no books, no arb pass
+		workers:   workers,
+		queueSize: queueSize,
+	}
+	for _, asset := range assets {
+		r.Pipelines[asset] = newAssetPipeline(asset, workers, queueSize)
+	}
+	return r
+}
+
+func (r *AssetRouter) Submit(exchange string, raw []byte) {
+	r.submit(pipelineFrame{exchange, raw, false, time.Now()})
+}
+
+func (r *AssetRouter) SubmitPooled(exchange string, raw []byte) {
+	r.submit(pipelineFrame{exchange, raw, true, time.Now()})
+}
+
+// submit holds the read lock while queueing so Remove can't close a pipeline a frame is being sent to.
+func (r *AssetRouter) submit(frame pipelineFrame) {
+	asset := frameAsset(frame.Exchange, frame.Raw)
+
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	if asset == "" {
+		r.Shared.submit(frame)
+		return
+	}
+	pipeline, exists := r.Pipelines[asset]
+	if !exists {
+		r.Dropped.Add(1)
+		if frame.Pooled {
+			releaseFrame(frame.Raw)
+		}
+		return
+	}
+	pipeline.submit(frame)
+}
+
+func (r *AssetRouter) Processed() int64 {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	processed := r.Shared.Processed.Load()
+	for _, pipeline := range r.Pipelines {
+		processed += pipeline.Processed.Load()
+	}
+	return processed
+}
+
+type PipelineStatus struct {
+	Processed int64 `json:"processed"`
+	Queued    int   `json:"queued"`
+	Fullest   int   `json:"fullest_shard"`
+	Stalls    int64 `json:"stalls"`
+}
+
+// Status reports each pipeline's backlog keyed by asset, the shared pipeline under "".
+func (r *AssetRouter) Status() map[string]PipelineStatus {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	status := make(map[string]PipelineStatus, len(r.Pipelines)+1)
+	status[""] = pipelineStatus(r.Shared)
+	for asset, pipeline := range r.Pipelines {
+		status[asset] = pipelineStatus(pipeline)
+	}
+	return status
+}
+
+func pipelineStatus(p *Pipeline) PipelineStatus {
+	fullest, total := p.Queued()
+	return PipelineStatus{Processed: p.Processed.Load(), Queued: total, Fullest: fullest, Stalls: p.Stalls.Load()}
+}
+
+// Add starts a pipeline for asset and adds it to Assets, the exchange loops subscribe its chain right away.
+func (r *AssetRouter) Add(asset string) error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	if _, exists := r.Pipelines[asset]; exists {
+		return fmt.Errorf("Add: %v already added", asset)
+	}
+	r.Pipelines[asset] = newAssetPipeline(asset, r.workers, r.queueSize)
+
+	AssetsMu.Lock()
+	Assets = append(Assets, asset)
+	close(assetsChanged)
+	assetsChanged = make(chan struct{})
+	AssetsMu.Unlock()
+
+	slog.Info("AssetRouter: added asset", "asset", asset)
+	return nil
+}
+
+// Remove stops routing asset's frames and drops its books, index prices and opportunities. The exchange loops
+// unsubscribe its channels right away, frames still in flight are counted in Dropped.
+func (r *AssetRouter) Remove(asset string) error {
+	r.Mu.Lock()
+	pipeline, exists := r.Pipelines[asset]
+	if !exists {
+		r.Mu.Unlock()
+		return fmt.Errorf("Remove: %v not added", asset)
+	}
+	delete(r.Pipelines, asset)
+	r.Mu.Unlock()
+	pipeline.Close() //finishes queued frames before the state is cleared below
+
+	AssetsMu.Lock()
+	Assets = slices.DeleteFunc(Assets, func(a string) bool { return a == asset })
+	close(assetsChanged)
+	assetsChanged = make(chan struct{})
+	AssetsMu.Unlock()
+
+	OrderbookContainer.Mu.Lock()
+	for instrument := range OrderbookContainer.Orderbooks {
+		if strings.HasPrefix(instrument, asset+"-") {
+			delete(OrderbookContainer.Orderbooks, instrument)
+		}
+	}
+	OrderbookContainer.Mu.Unlock()
+	for _, index := range []*IndexContainer{&AevoIndex, &LyraIndex, &DeribitIndex, &OkxIndex, &BinanceOptionsIndex} {
+		index.Mu.Lock()
+		delete(index.Index, asset)
+		index.Mu.Unlock()
+	}
+	ArbContainer.Mu.Lock()
+	for key, table := range ArbContainer.ArbTables {
+		if table.Asset == asset {
+			delete(ArbContainer.ArbTables, key)
+		}
+	}
+	trackArbLives(asset, time.Now())
+	ArbContainer.Mu.Unlock()
+	BoxContainer.Mu.Lock()
+	for key, table := range BoxContainer.BoxTables {
+		if table.Asset == asset {
+			delete(BoxContainer.BoxTables, key)
+		}
+	}
+	BoxContainer.Mu.Unlock()
+
+	slog.Info("AssetRouter: removed asset", "asset", asset)
+	return nil
+}
+
+// assetsHandler serves /api/assets: GET lists the scanned assets, POST ?asset=BTC adds one and DELETE ?asset=BTC
+// removes one.
+func (r *AssetRouter) assetsHandler(w http.ResponseWriter, req *http.Request) {
+	asset := strings.ToUpper(strings.TrimSpace(req.URL.Query().Get("asset")))
+	if req.Method != http.MethodGet && asset == "" {
+		http.Error(w, "no asset given", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		err = r.Add(asset)
+	case http.MethodDelete:
+		err = r.Remove(asset)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJson(w, "assetsHandler", currentAssets())
+}
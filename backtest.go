@@ -0,0 +1,301 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+type backtestOpportunity struct {
+	Key        string
+	FirstSeen  time.Time //capture time
+	LastSeen   time.Time
+	Passes     int //arb passes it was open in
+	PeakProfit float64
+	PeakApy    float64
+	Traded     float64 //contracts filled on both legs
+	Realized   float64
+}
+
+// backtestEvent is one recorded update, applied at Time of the recording.
+type backtestEvent struct {
+	Time  time.Time
+	Apply func()
+}
+
+type backtestExecution struct {
+	Key      string
+	Table    ArbTable
+	Detected time.Time
+	Due      time.Time
+}
+
+// captureEvents are a -record capture's frames, fed through the exchange decoders.
+func captureEvents(path string) ([]backtestEvent, error) {
+	frames, err := readCapture(path)
+	if err != nil {
+		return nil, fmt.Errorf("captureEvents: %v", err)
+	}
+	events := make([]backtestEvent, 0, len(frames))
+	for _, frame := range frames {
+		events = append(events, backtestEvent{time.Unix(0, frame.Time), func() { processFrame(frame.Exchange, []byte(frame.Data)) }})
+	}
+	return events, nil
+}
+
+// storeEvents are the orderbook and index ticks persisted between start and end, each tick replacing its exchange's
+// side of the book or index price as recorded.
+func storeEvents(driver string, dsn string, start int64, end int64) ([]backtestEvent, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("storeEvents: %v", err)
+	}
+	defer db.Close()
+
+	events := make([]backtestEvent, 0)
+	rows, err := db.Query(rebind(driver, "SELECT time, exchange, instrument, bids, asks FROM orderbook_ticks WHERE time >= ? AND time < ? ORDER BY time"), start, end)
+	if err != nil {
+		return nil, fmt.Errorf("storeEvents: %v", err)
+	}
+	for rows.Next() {
+		var at int64
+		var exchange, instrument, bidsJson, asksJson string
+		err = rows.Scan(&at, &exchange, &instrument, &bidsJson, &asksJson)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("storeEvents: %v", err)
+		}
+		var bids, asks []Order
+		if json.Unmarshal([]byte(bidsJson), &bids) != nil || json.Unmarshal([]byte(asksJson), &asks) != nil {
+			continue
+		}
+		events = append(events, backtestEvent{time.Unix(0, at), func() { applyBookTick(exchange, instrument, bids, asks, time.Unix(0, at)) }})
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("storeEvents: %v", err)
+	}
+
+	indexes := map[string]*IndexContainer{"aevo": &AevoIndex, "lyra": &LyraIndex, "deribit": &DeribitIndex, "okx": &OkxIndex, "binance-options": &BinanceOptionsIndex}
+	rows, err = db.Query(rebind(driver, "SELECT time, exchange, asset, price FROM index_ticks WHERE time >= ? AND time < ? ORDER BY time"), start, end)
+	if err != nil {
+		return nil, fmt.Errorf("storeEvents: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at int64
+		var exchange, asset string
+		var price float64
+		err = rows.Scan(&at, &exchange, &asset, &price)
+		if err != nil {
+			return nil, fmt.Errorf("storeEvents: %v", err)
+		}
+		if index, exists := indexes[exchange]; exists {
+			events = append(events, backtestEvent{time.Unix(0, at), func() { index.Set(asset, price) }})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("storeEvents: %v", err)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+func applyBookTick(exchange string, instrument string, bids []Order, asks []Order, at time.Time) {
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists {
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[instrument] = orderbook
+	}
+	orderbook.Bids[exchange], orderbook.Asks[exchange] = bids, asks
+	if orderbook.Timestamps == nil {
+		orderbook.Timestamps = make(map[string]time.Time)
+	}
+	orderbook.Timestamps[exchange] = at
+	orderbook.LastUpdated = float64(at.UnixNano())
+}
+
+// backtestCommand runs recorded data, a -record capture or with -from-store the persisted orderbook and index ticks,
+// through the arb engine with an arb pass after each update, the engine's clock following the recording. Every new
+// opportunity is executed as in paper trading, -latency later against the books as recorded by then, and the report
+// lists the opportunities, the fills, the distribution of realized profit per trade and the drawdown of its running
+// total.
+func backtestCommand(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	cfg, configFile := registerConfigFlags(fs)
+	fromStore := fs.Bool("from-store", false, "read the orderbook and index ticks persisted at -store-dsn instead of a capture")
+	from := fs.String("from", "", "with -from-store, RFC 3339 time the ticks start at")
+	to := fs.String("to", "", "with -from-store, RFC 3339 time the ticks end before")
+	latency := fs.Duration("latency", 200*time.Millisecond, "modeled delay from detecting an opportunity to its orders reaching the books")
+	size := fs.Float64("size", 1, "contracts per trade, less when the suggested size is smaller")
+	feeScale := fs.Float64("fee-scale", 1, "multiplier on every exchange's fees, gas and slippage, e.g. 2 to stress fee assumptions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %v backtest [flags] <capture>\n       %v backtest -from-store [flags]\n", os.Args[0], os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	applyConfig(fs, cfg, *configFile)
+	if *fromStore == (fs.NArg() == 1) || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	PaperSize = *size
+	for exchange, fees := range ExchangeFees {
+		fees.Maker, fees.Taker, fees.Settlement = fees.Maker**feeScale, fees.Taker**feeScale, fees.Settlement**feeScale
+		fees.Gas, fees.Slippage = fees.Gas**feeScale, fees.Slippage**feeScale
+		ExchangeFees[exchange] = fees
+	}
+
+	var events []backtestEvent
+	var err error
+	if *fromStore {
+		start, end, boundsErr := timeBounds(*from, *to)
+		if boundsErr != nil {
+			log.Fatalf("backtest: %v", boundsErr)
+		}
+		events, err = storeEvents(cfg.StoreDriver, cfg.StoreDsn, start, end)
+	} else {
+		events, err = captureEvents(fs.Arg(0))
+	}
+	if err != nil {
+		log.Fatalf("backtest: %v", err)
+	}
+
+	var now time.Time
+	ArbClock = func() time.Time { return now }
+	opportunities := make(map[string]*backtestOpportunity)
+	open := make(map[string]bool) //opportunities open after the last pass, each is traded once per lifetime
+	pending := make([]backtestExecution, 0)
+	trades := make([]PaperTrade, 0)
+	for _, event := range events {
+		now = event.Time
+
+		//orders due before this update reach the books as they were
+		remaining := pending[:0]
+		for _, execution := range pending {
+			if execution.Due.After(now) {
+				remaining = append(remaining, execution)
+				continue
+			}
+			trade := paperFillTrade(execution.Key, execution.Table, execution.Detected, execution.Due)
+			trades = append(trades, trade)
+			opportunities[execution.Key].Traded += trade.Size
+			opportunities[execution.Key].Realized += trade.Realized
+		}
+		pending = remaining
+
+		event.Apply()
+		for _, asset := range Assets {
+			runStrategies(asset)
+		}
+
+		arbs := ArbContainer.Snapshot()
+		for key := range open {
+			if _, exists := arbs[key]; !exists {
+				delete(open, key)
+			}
+		}
+		for key, table := range arbs {
+			opportunity, exists := opportunities[key]
+			if !exists {
+				opportunity = &backtestOpportunity{Key: key, FirstSeen: now}
+				opportunities[key] = opportunity
+			}
+			opportunity.LastSeen = now
+			opportunity.Passes++
+			opportunity.PeakProfit = max(opportunity.PeakProfit, table.AbsProfit)
+			opportunity.PeakApy = max(opportunity.PeakApy, table.Apy)
+			if !open[key] {
+				open[key] = true
+				pending = append(pending, backtestExecution{key, table, now, now.Add(*latency)})
+			}
+		}
+	}
+
+	found := make([]*backtestOpportunity, 0, len(opportunities))
+	for _, opportunity := range opportunities {
+		found = append(found, opportunity)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].PeakProfit > found[j].PeakProfit })
+
+	fmt.Printf("%v events, %v opportunities\n", len(events), len(found))
+	fmt.Printf("assumptions: %v latency, %v contracts per trade, fees x%v, limit orders at the detected prices\n\n", *latency,
+		strconv.FormatFloat(*size, 'f', -1, 64), strconv.FormatFloat(*feeScale, 'f', -1, 64))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "key\tfirst seen\topen for\tpasses\tpeak profit\tpeak apy\ttraded\trealized")
+	for _, opportunity := range found {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", opportunity.Key, opportunity.FirstSeen.UTC().Format(time.RFC3339),
+			opportunity.LastSeen.Sub(opportunity.FirstSeen), opportunity.Passes,
+			strconv.FormatFloat(opportunity.PeakProfit, 'f', 2, 64), strconv.FormatFloat(opportunity.PeakApy, 'f', 1, 64),
+			strconv.FormatFloat(opportunity.Traded, 'f', 2, 64), strconv.FormatFloat(opportunity.Realized, 'f', 2, 64))
+	}
+	w.Flush()
+
+	printBacktestTrades(trades, len(pending))
+}
+
+// printBacktestTrades reports the fills, the distribution of realized profit per trade and the largest drawdown of
+// its running total, trades in execution order.
+func printBacktestTrades(trades []PaperTrade, unexecuted int) {
+	var filled, unhedged, wins int
+	var expected, realized float64
+	profits := make([]float64, 0, len(trades))
+	for _, trade := range trades {
+		expected += trade.Expected
+		realized += trade.Realized
+		if trade.Size > 0 {
+			filled++
+			profits = append(profits, trade.Realized)
+			if trade.Realized > 0 {
+				wins++
+			}
+		}
+		if trade.BidFilled != trade.AskFilled {
+			unhedged++
+		}
+	}
+
+	format := func(value float64) string { return strconv.FormatFloat(value, 'f', 2, 64) }
+	fmt.Printf("\n%v trades, %v filled, %v with an unhedged leg, %v still in flight at the end\n", len(trades), filled, unhedged, unexecuted)
+	capture := 0.0
+	if expected != 0 {
+		capture = realized / expected * 100
+	}
+	fmt.Printf("expected %v, realized %v (%v%%)\n", format(expected), format(realized), strconv.FormatFloat(capture, 'f', 1, 64))
+	if len(profits) == 0 {
+		return
+	}
+
+	sorted := append([]float64(nil), profits...)
+	sort.Float64s(sorted)
+	quantile := func(q float64) float64 { return sorted[int(math.Round(q*float64(len(sorted)-1)))] }
+	fmt.Printf("realized per filled trade: mean %v, min %v, p10 %v, p50 %v, p90 %v, max %v, %v%% profitable\n",
+		format(realized/float64(len(profits))), format(sorted[0]), format(quantile(0.1)), format(quantile(0.5)), format(quantile(0.9)),
+		format(sorted[len(sorted)-1]), strconv.FormatFloat(float64(wins)/float64(len(profits))*100, 'f', 1, 64))
+
+	var total, peak, drawdown float64
+	var drawdownAt time.Time
+	for _, trade := range trades {
+		total += trade.Realized
+		peak = max(peak, total)
+		if peak-total > drawdown {
+			drawdown, drawdownAt = peak-total, trade.Executed
+		}
+	}
+	if drawdown > 0 {
+		fmt.Printf("max drawdown %v, at %v\n", format(drawdown), drawdownAt.UTC().Format(time.RFC3339))
+	} else {
+		fmt.Println("max drawdown 0")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// runBenchmark replays a capture file through parse -> store -> arb as fast as possible and reports throughput,
+// allocations, garbage collections and per message latency, then replays it again through parse -> store only.
+func runBenchmark(path string) {
+	frames, err := readCapture(path)
+	if err != nil {
+		log.Fatalf("runBenchmark: %v", err)
+	}
+	if len(frames) == 0 {
+		log.Fatalf("runBenchmark: no frames in %v", path)
+	}
+
+	raws := make([][]byte, len(frames)) //convert up front so string -> []byte allocations aren't counted
+	for i, frame := range frames {
+		raws[i] = []byte(frame.Data)
+	}
+	latencies := make([]time.Duration, len(raws))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for i, raw := range raws {
+		t := time.Now()
+		processFrame(frames[i].Exchange, raw)
+		for _, asset := range Assets {
+			runStrategies(asset)
+			updateBoxTables(asset)
+		}
+		latencies[i] = time.Since(t)
+	}
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	var decodeBefore, decodeAfter runtime.MemStats
+	runtime.GC() //decode only pass, the hot path of the read loop without the arb pass
+	runtime.ReadMemStats(&decodeBefore)
+	decodeStart := time.Now()
+	for i, raw := range raws {
+		processFrame(frames[i].Exchange, raw)
+	}
+	decodeElapsed := time.Since(decodeStart)
+	runtime.ReadMemStats(&decodeAfter)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	n := len(latencies)
+
+	fmt.Printf("Benchmark: %v\n", path)
+	fmt.Printf("messages:      %v\n", n)
+	fmt.Printf("elapsed:       %v\n", elapsed)
+	fmt.Printf("messages/sec:  %.0f\n", float64(n)/elapsed.Seconds())
+	fmt.Printf("allocs/op:     %.1f\n", float64(after.Mallocs-before.Mallocs)/float64(n))
+	fmt.Printf("bytes/op:      %.0f\n", float64(after.TotalAlloc-before.TotalAlloc)/float64(n))
+	fmt.Printf("gc cycles:     %v (%.1f per 1000 messages)\n", after.NumGC-before.NumGC, float64(after.NumGC-before.NumGC)*1000/float64(n))
+	fmt.Printf("gc pause:      %v\n", time.Duration(after.PauseTotalNs-before.PauseTotalNs))
+	fmt.Printf("p50 latency:   %v\n", latencies[n/2])
+	fmt.Printf("p99 latency:   %v\n", latencies[(n*99)/100])
+	fmt.Printf("max latency:   %v\n", latencies[n-1])
+	fmt.Printf("decode msg/s:  %.0f\n", float64(n)/decodeElapsed.Seconds())
+	fmt.Printf("decode allocs: %.1f/op\n", float64(decodeAfter.Mallocs-decodeBefore.Mallocs)/float64(n))
+	fmt.Printf("decode bytes:  %.0f/op\n", float64(decodeAfter.TotalAlloc-decodeBefore.TotalAlloc)/float64(n))
+	fmt.Printf("decode gcs:    %v\n", decodeAfter.NumGC-decodeBefore.NumGC)
+	fmt.Printf("orderbooks:    %v\n", len(OrderbookContainer.Orderbooks))
+	fmt.Printf("arb tables:    %v\n\n", len(ArbContainer.ArbTables))
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/decimal"
+	"options-ws/ratelimit"
+)
+
+var BinanceOptionsHttp string = "https://eapi.binance.com"
+var BinanceOptionsWss string = "wss://nbstream.binance.com/eoptions/ws"
+
+var BinanceOptionsIndex = IndexContainer{Index: make(map[string]float64)}
+
+// BinanceOptionsUnits holds every listed symbol's contract size in the underlying, key: binance symbol. The exchange
+// is "binance-options", "binance" is the futures connection liquidations are read from.
+var BinanceOptionsUnits = struct {
+	Mu    sync.RWMutex
+	Units map[string]float64
+}{Units: make(map[string]float64)}
+
+type binanceOptionSymbol struct {
+	Symbol     string  `json:"symbol"`     //e.g. "ETH-240628-3000-C"
+	Underlying string  `json:"underlying"` //e.g. "ETHUSDT"
+	Unit       float64 `json:"unit"`
+	ExpiryDate int64   `json:"expiryDate"` //unix milliseconds
+}
+
+// binanceOptionsMarkets returns the listed symbols of assets from one exchangeInfo request, it covers every underlying.
+func binanceOptionsMarkets(assets []string) ([]binanceOptionSymbol, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["binance-options"], func() (*http.Request, error) {
+		return http.NewRequest("GET", BinanceOptionsHttp+"/eapi/v1/exchangeInfo", nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("binanceOptionsMarkets: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var info struct {
+		OptionSymbols []binanceOptionSymbol `json:"optionSymbols"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&info)
+	if err != nil {
+		return nil, fmt.Errorf("binanceOptionsMarkets: json decode error: %v", err)
+	}
+
+	symbols := make([]binanceOptionSymbol, 0)
+	for _, symbol := range info.OptionSymbols {
+		for _, asset := range assets {
+			if symbol.Underlying == asset+"USDT" {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols, nil
+}
+
+func binanceUnsubscribeJson(channels []string) []byte {
+	data := struct {
+		Method string   `json:"method"`
+		Params []string `json:"params"`
+		Id     int      `json:"id"`
+	}{"UNSUBSCRIBE", channels, 2}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings and an int always marshals
+	return jsonData
+}
+
+// binanceOptionsChannel names a binance options frame's channel "event:symbol" from its "e" and "s" fields, e.g.
+// "depth:ETH-240628-3000-C", and the index of "ETHUSDT" "index:ETH", so frames route and shard by instrument and
+// asset. Subscription responses return nil.
+func binanceOptionsChannel(raw []byte) []byte {
+	event := binanceEvent(raw)
+	symbol := rawField(raw, `"s":"`)
+	if event == nil || symbol == nil {
+		return nil
+	}
+	if string(event) == "index" {
+		symbol = []byte(strings.TrimSuffix(string(symbol), "USDT"))
+	}
+	return append(append(append(make([]byte, 0, len(event)+len(symbol)+1), event...), ':'), symbol...)
+}
+
+type binanceOptionsExchange struct{}
+
+func (binanceOptionsExchange) Name() string { return "binance-options" }
+
+func (binanceOptionsExchange) FetchMarkets(assets []string) ([]string, error) {
+	symbols, err := binanceOptionsMarkets(assets)
+	if err != nil {
+		return nil, err
+	}
+
+	instruments := make([]string, 0, len(symbols))
+	listings := make([]Listing, 0, len(symbols))
+	units := make(map[string]float64, len(symbols))
+	for _, symbol := range symbols {
+		instruments = append(instruments, symbol.Symbol)
+		units[symbol.Symbol] = symbol.Unit
+		listing, err := newListing("binance-options", symbol.Symbol, time.UnixMilli(symbol.ExpiryDate), "USD")
+		if err == nil {
+			listings = append(listings, listing)
+		}
+	}
+	BinanceOptionsUnits.Mu.Lock()
+	BinanceOptionsUnits.Units = units
+	BinanceOptionsUnits.Mu.Unlock()
+	Matcher.Register("binance-options", listings)
+	return instruments, nil
+}
+
+func (binanceOptionsExchange) OrderbookChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		channels = append(channels, instrument+"@depth10@100ms")
+	}
+	return channels
+}
+
+func (binanceOptionsExchange) IndexChannels(assets []string) []string {
+	channels := []string{}
+	for _, asset := range assets {
+		channels = append(channels, asset+"USDT@index")
+	}
+	return channels
+}
+
+type binanceOptionsDepth struct {
+	Symbol string      `json:"s"`
+	Bids   [][2]string `json:"b"` //[price, contracts]
+	Asks   [][2]string `json:"a"`
+	Time   int64       `json:"T"` //unix milliseconds
+}
+
+type binanceOptionsIndexPrice struct {
+	Symbol string  `json:"s"` //e.g. "ETHUSDT"
+	Price  float64 `json:"p,string"`
+}
+
+// binanceOptionsOrders converts levels to Orders per 1 underlying contracts sorted best first, binance doesn't publish
+// level IVs on the depth stream so Iv is -1.
+func binanceOptionsOrders(levels [][2]string, unit float64, descending bool) ([]Order, error) {
+	orders := make([]Order, 0, len(levels))
+	for _, level := range levels {
+		price, err := decimal.Parse(level[0])
+		if err != nil {
+			return nil, fmt.Errorf("binanceOptionsOrders: %v", err)
+		}
+		amount, err := strconv.ParseFloat(level[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("binanceOptionsOrders: %v", err)
+		}
+		orders = append(orders, Order{price.Mul(1 / unit), amount * unit, -1, "binance-options"})
+	}
+	sortOrders(orders, descending)
+
+	return orders, nil
+}
+
+func binanceOptionsUnit(symbol string) float64 {
+	BinanceOptionsUnits.Mu.RLock()
+	defer BinanceOptionsUnits.Mu.RUnlock()
+	if unit, exists := BinanceOptionsUnits.Units[symbol]; exists && unit > 0 {
+		return unit
+	}
+	return 1
+}
+
+// binanceOptionsNormalizeInstrument converts binance's "ETH-240628-3000-C" to the aevo style "ETH-28JUN24-3000-C"
+// used as Orderbooks key.
+func binanceOptionsNormalizeInstrument(symbol string) (string, error) {
+	instrument, err := normalizeVenueInstrument("binance-options", symbol)
+	if err != nil {
+		return "", fmt.Errorf("binanceOptionsNormalizeInstrument: %v", err)
+	}
+	return instrument, nil
+}
+
+var binanceOptionsDepths = newMessagePool(func(data *binanceOptionsDepth) {
+	*data = binanceOptionsDepth{Bids: data.Bids[:0], Asks: data.Asks[:0]}
+})
+
+func binanceOptionsDecodeDepth(raw []byte) error {
+	data := binanceOptionsDepths.Get()
+	defer binanceOptionsDepths.Put(data)
+	err := json.Unmarshal(raw, data)
+	if err != nil {
+		return err
+	}
+	if len(data.Bids) <= 0 && len(data.Asks) <= 0 {
+		return nil
+	}
+	instrument, err := binanceOptionsNormalizeInstrument(data.Symbol)
+	if err != nil {
+		return err
+	}
+	unit := binanceOptionsUnit(data.Symbol)
+	bids, err := binanceOptionsOrders(data.Bids, unit, true)
+	if err != nil {
+		return err
+	}
+	asks, err := binanceOptionsOrders(data.Asks, unit, false)
+	if err != nil {
+		return err
+	}
+
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists {
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[instrument] = orderbook
+	}
+
+	orderbook.Bids["binance-options"] = bids
+	orderbook.Asks["binance-options"] = asks
+	orderbook.LastUpdated = float64(data.Time)
+	markBookUpdated(orderbook, "binance-options", time.UnixMilli(data.Time))
+	applyDepthLimit(orderbook, "binance-options")
+	orderbook.UpdateCount++
+	publishBookEvent("binance-options", instrument, orderbook.Bids["binance-options"], orderbook.Asks["binance-options"])
+	if debugEnabled() {
+		slog.Debug("binanceOptionsDecodeDepth: book", "instrument", instrument, "bids", bids, "asks", asks)
+	}
+	return nil
+}
+
+func binanceOptionsDecodeIndex(raw []byte) error {
+	var data binanceOptionsIndexPrice
+	err := json.Unmarshal(raw, &data)
+	if err != nil {
+		return err
+	}
+	asset, found := strings.CutSuffix(data.Symbol, "USDT")
+	if found && data.Price > 0 {
+		checkIndexMove("binance-options", asset, data.Price)
+		BinanceOptionsIndex.Set(asset, data.Price)
+		publishIndexEvent("binance-options", asset, data.Price)
+	}
+	return nil
+}
+
+func (binanceOptionsExchange) FetchOrderbook(instrument string) (OrderbookSnapshot, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["binance-options"], func() (*http.Request, error) {
+		return http.NewRequest("GET", BinanceOptionsHttp+"/eapi/v1/depth?symbol="+instrument+"&limit=10", nil)
+	})
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var data struct {
+		Bids [][2]string `json:"bids"`
+		Asks [][2]string `json:"asks"`
+		Time int64       `json:"T"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&data)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: json decode error: %v", err)
+	}
+	normalized, err := binanceOptionsNormalizeInstrument(instrument)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+
+	unit := binanceOptionsUnit(instrument)
+	bids, err := binanceOptionsOrders(data.Bids, unit, true)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+	asks, err := binanceOptionsOrders(data.Asks, unit, false)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+	return OrderbookSnapshot{
+		Instrument:  normalized,
+		Bids:        map[string][]Order{"binance-options": bids},
+		Asks:        map[string][]Order{"binance-options": asks},
+		LastUpdated: float64(data.Time),
+	}, nil
+}
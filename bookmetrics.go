@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+)
+
+var MetricsLevels = 5
+var QualitySpread = 0.05 //relative spread that halves a leg's quality, 0 disables the spread discount
+var QualityDepth = 10.0  //contracts that halve a leg's quality, 0 disables the depth discount
+
+// BookMetrics are the top of book metrics of one exchange's side of a book, recomputed on every update. The
+// microprice is the mid weighted towards the side with less size at the top, where the price is likelier to move, the
+// imbalance the size on the top MetricsLevels levels from -1 (all asks) to 1 (all bids).
+type BookMetrics struct {
+	Spread     float64 `json:"spread"` //0 unless both sides are quoted, as are the others but the depths
+	RelSpread  float64 `json:"rel_spread"`
+	Mid        float64 `json:"mid"`
+	Microprice float64 `json:"microprice"`
+	Imbalance  float64 `json:"imbalance"`
+	BidDepth   float64 `json:"bid_depth"` //contracts on the top MetricsLevels levels
+	AskDepth   float64 `json:"ask_depth"`
+}
+
+// bookMetrics computes the metrics of one exchange's side of a book.
+func bookMetrics(bids []Order, asks []Order) BookMetrics {
+	var metrics BookMetrics
+	for _, order := range bids[:min(len(bids), MetricsLevels)] {
+		metrics.BidDepth += order.Amount
+	}
+	for _, order := range asks[:min(len(asks), MetricsLevels)] {
+		metrics.AskDepth += order.Amount
+	}
+	if metrics.BidDepth+metrics.AskDepth > 0 {
+		metrics.Imbalance = (metrics.BidDepth - metrics.AskDepth) / (metrics.BidDepth + metrics.AskDepth)
+	}
+	if len(bids) == 0 || len(asks) == 0 {
+		return metrics
+	}
+
+	bid, ask := bids[0].Price.Float64(), asks[0].Price.Float64()
+	metrics.Spread, metrics.Mid = ask-bid, (bid+ask)/2
+	if metrics.Mid > 0 {
+		metrics.RelSpread = metrics.Spread / metrics.Mid
+	}
+	metrics.Microprice = metrics.Mid
+	if size := bids[0].Amount + asks[0].Amount; size > 0 {
+		metrics.Microprice = (bid*asks[0].Amount + ask*bids[0].Amount) / size
+	}
+	return metrics
+}
+
+// trackBookMetrics recomputes exchange's metrics in orderbook after an update. Callers hold OrderbookContainer.Mu.
+func trackBookMetrics(orderbook *OrderbookData, exchange string) {
+	if orderbook.Metrics == nil {
+		orderbook.Metrics = make(map[string]BookMetrics)
+	}
+	orderbook.Metrics[exchange] = bookMetrics(orderbook.Bids[exchange], orderbook.Asks[exchange])
+}
+
+// legQuality is how tight and deep exchange's book is for a leg taking the bid (or the ask), 1 without metrics:
+// 1/(1 + relative spread / QualitySpread) times depth/(depth + QualityDepth).
+func legQuality(orderbook *OrderbookData, exchange string, bid bool) float64 {
+	metrics, exists := orderbook.Metrics[exchange]
+	if !exists {
+		return 1
+	}
+	quality := 1.0
+	if QualitySpread > 0 {
+		quality /= 1 + math.Max(metrics.RelSpread, 0)/QualitySpread
+	}
+	depth := metrics.AskDepth
+	if bid {
+		depth = metrics.BidDepth
+	}
+	if QualityDepth > 0 {
+		quality *= depth / (depth + QualityDepth)
+	}
+	return quality
+}
+
+// scoreBookQuality sets the BookQuality of the strike's ArbTable, updateArbTable stores a new table every pass.
+// Callers hold OrderbookContainer.Mu.
+func scoreBookQuality(key string, callOrderbook *OrderbookData, putOrderbook *OrderbookData) {
+	book := func(optionType string) *OrderbookData {
+		if optionType == "C" {
+			return callOrderbook
+		}
+		return putOrderbook
+	}
+
+	ArbContainer.Mu.Lock()
+	defer ArbContainer.Mu.Unlock()
+	table, exists := ArbContainer.ArbTables[key]
+	if !exists {
+		return
+	}
+	table.BookQuality = legQuality(book(table.BidType), table.BidExchange, true) * legQuality(book(table.AskType), table.AskExchange, false)
+}
+
+// bookMetricsHandler serves /api/book-metrics, every book's metrics by instrument then exchange, optionally only those
+// of ?asset= and ?exchange=.
+func bookMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	asset, exchange := strings.ToUpper(r.URL.Query().Get("asset")), r.URL.Query().Get("exchange")
+	response := make(map[string]map[string]BookMetrics)
+	OrderbookContainer.Mu.RLock()
+	for instrument, orderbook := range OrderbookContainer.Orderbooks {
+		if asset != "" && !strings.HasPrefix(instrument, asset+"-") {
+			continue
+		}
+		for name, metrics := range orderbook.Metrics {
+			if exchange != "" && name != exchange {
+				continue
+			}
+			if response[instrument] == nil {
+				response[instrument] = make(map[string]BookMetrics)
+			}
+			response[instrument][name] = metrics
+		}
+	}
+	OrderbookContainer.Mu.RUnlock()
+	writeJson(w, "bookMetricsHandler", response)
+}
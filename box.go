@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BoxTable is a box spread opportunity between two strikes of an expiry. A long box buys the K1 call and K2 put and
+// sells the K1 put and K2 call for Cost, a short box does the opposite, and either pays out K2 - K1 at expiry.
+type BoxTable struct {
+	Asset   string
+	Expiry  string
+	Strike1 float64 //lower strike
+	Strike2 float64
+	Long    bool
+
+	Legs [4]Order //best orders traded: K1 call, K1 put, K2 call, K2 put
+
+	Cost            float64 //net premium paid, negative when received (short box)
+	Fees            float64 //per box, all four legs' taker and settlement fees, already deducted from AbsProfit
+	DiscountedValue float64 //(K2 - K1) discounted to today at BoxRate
+	AbsProfit       float64
+	RelProfit       float64 //AbsProfit / Capital * 100
+	Apy             float64
+	ExcessApy       float64 //Apy over the risk-free rate
+	Capital         float64 //premium paid for a long box, the payout owed at expiry for a short box
+}
+
+type BoxTablesContainer struct {
+	Mu        sync.RWMutex
+	BoxTables map[string]*BoxTable //key: e.g. "ETH-02JAN06-3000-3200"
+}
+
+var BoxContainer = BoxTablesContainer{BoxTables: make(map[string]*BoxTable)}
+
+var BoxRate float64 = -1 //annual rate, as a fraction, box payouts are discounted at, negative is the risk-free rate
+
+type boxStrike struct {
+	Strike                               float64
+	CallBids, CallAsks, PutBids, PutAsks []Order
+}
+
+// boxOpportunity prices both directions of the box between two strikes and returns the more profitable one, nil
+// unless it makes at least MinProfit after fees.
+func boxOpportunity(asset string, expiry string, low boxStrike, high boxStrike, discount float64, years float64, index float64) *BoxTable {
+	var best *BoxTable
+	value := (high.Strike - low.Strike) * discount
+
+	if len(low.CallAsks) > 0 && len(low.PutBids) > 0 && len(high.CallBids) > 0 && len(high.PutAsks) > 0 {
+		legs := [4]Order{low.CallAsks[0], low.PutBids[0], high.CallBids[0], high.PutAsks[0]}
+		cost := (legs[0].Price - legs[1].Price - legs[2].Price + legs[3].Price).Float64()
+		fees := takerFees(legs[:], index)
+		if cost > 0 && value > cost+fees {
+			best = &BoxTable{
+				Long:      true,
+				Legs:      legs,
+				Cost:      cost,
+				Fees:      fees,
+				AbsProfit: value - cost - fees,
+				Capital:   cost,
+			}
+		}
+	}
+
+	if len(low.CallBids) > 0 && len(low.PutAsks) > 0 && len(high.CallAsks) > 0 && len(high.PutBids) > 0 {
+		legs := [4]Order{low.CallBids[0], low.PutAsks[0], high.CallAsks[0], high.PutBids[0]}
+		cost := (legs[1].Price - legs[0].Price + legs[2].Price - legs[3].Price).Float64()
+		fees := takerFees(legs[:], index)
+		if absProfit := -cost - value - fees; absProfit > 0 && (best == nil || absProfit > best.AbsProfit) {
+			best = &BoxTable{
+				Legs:      legs,
+				Cost:      cost,
+				Fees:      fees,
+				AbsProfit: absProfit,
+				Capital:   high.Strike - low.Strike,
+			}
+		}
+	}
+
+	if best == nil || best.AbsProfit < MinProfit {
+		return nil
+	}
+
+	best.Asset, best.Expiry, best.Strike1, best.Strike2 = asset, expiry, low.Strike, high.Strike
+	best.DiscountedValue = value
+	best.RelProfit = best.AbsProfit / best.Capital * 100
+	best.Apy = findApy(expiry, best.RelProfit)
+	best.ExcessApy = excessApy(best.Apy)
+	if debugEnabled() {
+		slog.Debug("boxOpportunity", "asset", asset, "expiry", expiry, "k1", low.Strike, "k2", high.Strike, "long", best.Long, "cost", best.Cost, "value", value, "years", years)
+	}
+	return best
+}
+
+// updateBoxTables replaces the asset's BoxTables with the box spreads of every pair of strikes of each expiry whose
+// net cost deviates from the discounted strike difference by at least MinProfit.
+func updateBoxTables(asset string) {
+	now := ArbClock()
+	expiries := make(map[string][]boxStrike)
+	index, _ := AevoIndex.Get(asset) //fees are charged on the index notional
+
+	OrderbookContainer.Mu.RLock()
+	for key, callOrderbook := range OrderbookContainer.Orderbooks {
+		keyTrim, found := strings.CutSuffix(key, "-C")
+		components := strings.Split(key, "-")
+		if !found || len(components) != 4 || components[0] != asset {
+			continue
+		}
+		putOrderbook, exists := OrderbookContainer.Orderbooks[keyTrim+"-P"]
+		if !exists {
+			continue
+		}
+		strike, err := strconv.ParseFloat(components[2], 64)
+		if err != nil {
+			continue
+		}
+
+		callBids, callAsks, putBids, putAsks := findBestOrders(keyTrim, callOrderbook, putOrderbook, now)
+		expiries[components[1]] = append(expiries[components[1]], boxStrike{strike, callBids, callAsks, putBids, putAsks})
+	}
+	OrderbookContainer.Mu.RUnlock()
+
+	tables := make(map[string]*BoxTable)
+	for expiry, strikes := range expiries {
+		if !tradableExpiry(expiry, now) {
+			continue
+		}
+		expiryTime, err := instrumentExpiry(expiry)
+		if err != nil {
+			slog.Error("updateBoxTables: error parsing expiry", "expiry", expiry, "err", err)
+			continue
+		}
+		years := math.Max(yearsUntil(expiryTime, now), 0)
+		rate := BoxRate
+		if rate < 0 {
+			rate = riskFreeRate()
+		}
+		discount := math.Exp(-rate * years)
+
+		sort.Slice(strikes, func(i, j int) bool { return strikes[i].Strike < strikes[j].Strike })
+		for i := range strikes {
+			for j := i + 1; j < len(strikes); j++ {
+				if table := boxOpportunity(asset, expiry, strikes[i], strikes[j], discount, years, index); table != nil {
+					tables[fmt.Sprintf("%v-%v-%v-%v", asset, expiry, strikes[i].Strike, strikes[j].Strike)] = table
+				}
+			}
+		}
+	}
+
+	BoxContainer.Mu.Lock()
+	defer BoxContainer.Mu.Unlock()
+	for key, table := range BoxContainer.BoxTables {
+		if table.Asset == asset {
+			delete(BoxContainer.BoxTables, key)
+		}
+	}
+	for key, table := range tables {
+		BoxContainer.BoxTables[key] = table
+	}
+}
+
+// boxTableHandler renders the box spread table for the htmx page, sorted by Apy.
+func boxTableHandler(w http.ResponseWriter, r *http.Request) {
+	BoxContainer.Mu.RLock()
+	tables := make([]*BoxTable, 0, len(BoxContainer.BoxTables))
+	for _, table := range BoxContainer.BoxTables {
+		tables = append(tables, table)
+	}
+	BoxContainer.Mu.RUnlock()
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Apy > tables[j].Apy })
+
+	responseStr := ""
+	for _, table := range tables {
+		direction := "short"
+		if table.Long {
+			direction = "long"
+		}
+		responseStr += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s/%s/%s/%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			table.Expiry,
+			strconv.FormatFloat(table.Strike1, 'f', 0, 64),
+			strconv.FormatFloat(table.Strike2, 'f', 0, 64),
+			direction,
+			table.Legs[0].Exchange, table.Legs[1].Exchange, table.Legs[2].Exchange, table.Legs[3].Exchange,
+			strconv.FormatFloat(table.Cost, 'f', 3, 64),
+			strconv.FormatFloat(table.DiscountedValue, 'f', 3, 64),
+			strconv.FormatFloat(table.AbsProfit, 'f', 3, 64),
+			strconv.FormatFloat(table.RelProfit, 'f', 3, 64),
+			strconv.FormatFloat(table.Apy, 'f', 3, 64),
+			strconv.FormatFloat(table.Capital, 'f', 0, 64),
+		)
+	}
+
+	fmt.Fprint(w, responseStr)
+}
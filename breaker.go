@@ -0,0 +1,147 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var BreakerIndexJump = 0.1 //fraction of the previous index, 0 disables
+var BreakerCrossedAfter = 5 * time.Second
+var BreakerMaxIv = 10.0 //1000%, 0 disables
+var BreakerCooldown = time.Minute
+
+type Quarantine struct {
+	Key      string    `json:"key"` //an asset or an instrument
+	Exchange string    `json:"exchange"`
+	Reason   string    `json:"reason"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Trips    int       `json:"trips"` //checks that found it anomalous, the first included
+}
+
+// BreakerContainer holds what data no market produces has quarantined: an asset whose index jumped, an instrument whose
+// book stayed crossed or quoted an implausible IV. Quarantined instruments are left out of the arb pass, the watchlist,
+// dislocation and vol alerts and the quoting engine's fair values until BreakerCooldown after the last anomaly.
+type BreakerContainer struct {
+	Mu          sync.Mutex
+	Quarantined map[string]*Quarantine //key: asset or instrument
+	Indexes     map[string]float64     //last index by exchange + " " + asset
+}
+
+var Breaker = BreakerContainer{Quarantined: make(map[string]*Quarantine), Indexes: make(map[string]float64)}
+
+// tripBreaker quarantines key until BreakerCooldown after now, extending a quarantine already in place.
+func tripBreaker(key string, exchange string, reason string, now time.Time) {
+	Breaker.Mu.Lock()
+	defer Breaker.Mu.Unlock()
+	quarantine, exists := Breaker.Quarantined[key]
+	if exists && now.Before(quarantine.Until) {
+		quarantine.Until = now.Add(BreakerCooldown)
+		quarantine.Trips++
+		return
+	}
+	for lifted, quarantine := range Breaker.Quarantined { //kept a further cooldown for /api/quarantine
+		if now.Sub(quarantine.Until) > BreakerCooldown {
+			delete(Breaker.Quarantined, lifted)
+		}
+	}
+	Breaker.Quarantined[key] = &Quarantine{key, exchange, reason, now, now.Add(BreakerCooldown), 1}
+	slog.Warn("BREAKER: quarantined", "key", key, "exchange", exchange, "reason", reason, "until", now.Add(BreakerCooldown))
+}
+
+// checkIndexMove quarantines asset when exchange's index moved more than BreakerIndexJump since its last update.
+func checkIndexMove(exchange string, asset string, price float64) {
+	if BreakerIndexJump <= 0 {
+		return
+	}
+	key := exchange + " " + asset
+	Breaker.Mu.Lock()
+	previous := Breaker.Indexes[key]
+	Breaker.Indexes[key] = price
+	Breaker.Mu.Unlock()
+
+	if previous > 0 && math.Abs(price/previous-1) > BreakerIndexJump {
+		tripBreaker(asset, exchange, "index jumped", ArbClock())
+	}
+}
+
+// trackCrossed stamps when exchange's side of orderbook crossed, its best bid above its best ask, clearing it once
+// uncrossed. Callers hold OrderbookContainer.Mu.
+func trackCrossed(orderbook *OrderbookData, exchange string, exchangeTime time.Time) {
+	bids, asks := orderbook.Bids[exchange], orderbook.Asks[exchange]
+	if len(bids) == 0 || len(asks) == 0 || bids[0].Price <= asks[0].Price {
+		delete(orderbook.CrossedSince, exchange)
+		return
+	}
+	if orderbook.CrossedSince == nil {
+		orderbook.CrossedSince = make(map[string]time.Time)
+	}
+	if _, exists := orderbook.CrossedSince[exchange]; !exists {
+		orderbook.CrossedSince[exchange] = exchangeTime
+	}
+}
+
+// implausibleIv reports whether an order's IV is outside [0, BreakerMaxIv], -1 is no IV.
+func implausibleIv(orders []Order) bool {
+	if BreakerMaxIv <= 0 || len(orders) == 0 || orders[0].Iv == -1 {
+		return false
+	}
+	return orders[0].Iv < 0 || orders[0].Iv > BreakerMaxIv
+}
+
+// checkBooks quarantines the books of asset that stayed crossed or quote an implausible IV at now, at the start of
+// every arb pass of asset. Callers hold OrderbookContainer.Mu.
+func checkBooks(asset string, now time.Time) {
+	for instrument, orderbook := range OrderbookContainer.Orderbooks {
+		if !strings.HasPrefix(instrument, asset+"-") {
+			continue
+		}
+		for exchange, since := range orderbook.CrossedSince {
+			if BreakerCrossedAfter > 0 && now.Sub(since) >= BreakerCrossedAfter {
+				tripBreaker(instrument, exchange, "crossed book", now)
+			}
+		}
+		for _, sides := range []map[string][]Order{orderbook.Bids, orderbook.Asks} {
+			for exchange, orders := range sides {
+				if implausibleIv(orders) {
+					tripBreaker(instrument, exchange, "implausible iv", now)
+				}
+			}
+		}
+	}
+}
+
+// quarantined reports whether instrument, or its asset, is quarantined at now.
+func quarantined(instrument string, now time.Time) bool {
+	Breaker.Mu.Lock()
+	defer Breaker.Mu.Unlock()
+	if len(Breaker.Quarantined) == 0 {
+		return false
+	}
+	if quarantine, exists := Breaker.Quarantined[instrument]; exists && now.Before(quarantine.Until) {
+		return true
+	}
+	quarantine, exists := Breaker.Quarantined[instrumentAsset(instrument)]
+	return exists && now.Before(quarantine.Until)
+}
+
+// quarantineHandler serves /api/quarantine, the quarantines in place and those lifted within the last BreakerCooldown,
+// newest first.
+func quarantineHandler(w http.ResponseWriter, r *http.Request) {
+	now := ArbClock()
+	Breaker.Mu.Lock()
+	quarantines := make([]Quarantine, 0, len(Breaker.Quarantined))
+	for _, quarantine := range Breaker.Quarantined {
+		if now.Sub(quarantine.Until) <= BreakerCooldown {
+			quarantines = append(quarantines, *quarantine)
+		}
+	}
+	Breaker.Mu.Unlock()
+	sort.Slice(quarantines, func(i, j int) bool { return quarantines[i].Since.After(quarantines[j].Since) })
+	writeJson(w, "quarantineHandler", quarantines)
+}
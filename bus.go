@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"options-ws/feedpb"
+)
+
+// Bus publishes messages to subjects of a broker.
+type Bus interface {
+	Publish(subject string, data []byte) error
+	Separator() string //between subject tokens
+	Close() error
+}
+
+type natsBus struct {
+	conn *nats.Conn
+}
+
+func (b natsBus) Publish(subject string, data []byte) error { return b.conn.Publish(subject, data) }
+func (b natsBus) Separator() string                         { return "." }
+func (b natsBus) Close() error                              { return b.conn.Drain() }
+
+type redisBus struct {
+	client *redis.Client
+}
+
+func (b redisBus) Publish(subject string, data []byte) error {
+	return b.client.Publish(context.Background(), subject, data).Err()
+}
+func (b redisBus) Separator() string { return ":" }
+func (b redisBus) Close() error      { return b.client.Close() }
+
+// openBus connects to the broker of a "nats://" or "redis://" (or "rediss://") url.
+func openBus(rawUrl string) (Bus, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("openBus: %v", err)
+	}
+	switch parsed.Scheme {
+	case "nats", "tls":
+		conn, err := nats.Connect(rawUrl, nats.Name("options-ws"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, fmt.Errorf("openBus: %v", err)
+		}
+		return natsBus{conn}, nil
+	case "redis", "rediss":
+		options, err := redis.ParseURL(rawUrl)
+		if err != nil {
+			return nil, fmt.Errorf("openBus: %v", err)
+		}
+		client := redis.NewClient(options)
+		err = client.Ping(context.Background()).Err()
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("openBus: %v", err)
+		}
+		return redisBus{client}, nil
+	}
+	return nil, fmt.Errorf("openBus: unsupported scheme %v, nats or redis", parsed.Scheme)
+}
+
+// busSubject joins prefix and tokens with the bus's separator, separators within a token (a fractional strike on
+// NATS) are replaced by "_".
+func busSubject(bus Bus, prefix string, tokens ...string) string {
+	separator := bus.Separator()
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(token, separator, "_")
+	}
+	return prefix + separator + strings.Join(tokens, separator)
+}
+
+// busLoop forwards feed updates to bus until ctx ends, encoding "json" or "proto", one message per update on
+// "<prefix>.orderbook.<exchange>.<instrument>", "<prefix>.index.<exchange>.<asset>" and "<prefix>.arb.<key>". Updates
+// the bus can't take in time are dropped.
+func busLoop(ctx context.Context, bus Bus, prefix string, encoding string) {
+	books := BookFeed.Subscribe(func(*feedpb.OrderbookUpdate) bool { return true })
+	index := IndexFeed.Subscribe(func(*feedpb.IndexUpdate) bool { return true })
+	arbs := ArbFeed.Subscribe(func(*feedpb.ArbUpdate) bool { return true })
+	defer func() {
+		dropped := BookFeed.Unsubscribe(books) + IndexFeed.Unsubscribe(index) + ArbFeed.Unsubscribe(arbs)
+		slog.Info("busLoop: stopped", "dropped", dropped)
+	}()
+
+	marshal := proto.Marshal
+	if encoding == "json" {
+		marshal = protojson.MarshalOptions{UseProtoNames: true}.Marshal
+	}
+	publish := func(subject string, message proto.Message) {
+		data, err := marshal(message)
+		if err != nil {
+			slog.Error("busLoop: encode error", "subject", subject, "err", err)
+			return
+		}
+		err = bus.Publish(subject, data)
+		if err != nil {
+			slog.Warn("busLoop: publish failed", "subject", subject, "err", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update := <-books.updates:
+			publish(busSubject(bus, prefix, "orderbook", update.Exchange, update.Instrument), update)
+		case update := <-index.updates:
+			publish(busSubject(bus, prefix, "index", update.Exchange, update.Asset), update)
+		case update := <-arbs.updates:
+			publish(busSubject(bus, prefix, "arb", update.Key), update)
+		}
+	}
+}
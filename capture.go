@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// CapturedFrame is one raw websocket frame as received from an exchange, stored one per line (JSONL) in capture files.
+type CapturedFrame struct {
+	Time     int64  `json:"time"` // unix nanoseconds at receipt
+	Exchange string `json:"exchange"`
+	Data     string `json:"data"`
+}
+
+func readCapture(path string) ([]CapturedFrame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("readCapture: open error: %v", err)
+	}
+	defer file.Close()
+
+	frames := make([]CapturedFrame, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) //orderbook frames can be much larger than the default 64KB token size
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var frame CapturedFrame
+		err = json.Unmarshal(scanner.Bytes(), &frame)
+		if err != nil {
+			slog.Warn("readCapture: skipping malformed line", "line", line, "err", err)
+			continue
+		}
+		frames = append(frames, frame)
+	}
+	if err = scanner.Err(); err != nil {
+		return frames, fmt.Errorf("readCapture: scan error: %v", err)
+	}
+
+	return frames, nil
+}
+
+// processFrame runs a raw frame through the decoder registered in Channels for its exchange and channel and into
+// Orderbooks/Index.
+func processFrame(exchange string, raw []byte) {
+	Channels.Decode(exchange, raw)
+}
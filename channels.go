@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChannelDecoder decodes a frame of one channel type and applies it, the error is a malformed frame.
+type ChannelDecoder func(raw []byte) error
+
+type channelRoute struct {
+	Prefix string
+	Decode ChannelDecoder
+}
+
+// ChannelRegistry maps an exchange's channel prefixes to their decoders. Frames without a channel (subscription
+// responses, pongs) go to observeAck, frames of a channel without a decoder are counted and logged once per channel type
+// with a sample, so a feed adding a channel neither breaks decoding nor floods the log.
+type ChannelRegistry struct {
+	Mu        sync.RWMutex
+	routes    map[string][]channelRoute          //by exchange, longest prefix first
+	channelOf map[string]func(raw []byte) []byte //exchanges whose frames don't carry a "channel" field
+	unknown   map[string]*unknownChannel         //key: exchange + " " + channel type
+}
+
+type unknownChannel struct {
+	Exchange string `json:"exchange"`
+	Channel  string `json:"channel"` //first one seen of its type
+	Frames   int64  `json:"frames"`
+	Sample   string `json:"sample"`
+}
+
+const unknownSampleSize = 512
+
+// Channels is the registry processFrame decodes with. A new channel type is one Register call (or line below) away.
+var Channels = newChannelRegistry(map[string][]channelRoute{
+	"aevo": {
+		{"orderbook:", aevoDecodeOrderbook},
+		{"index:", aevoDecodeIndex},
+		{"ticker:", aevoDecodeTicker},
+		{"trades:", aevoDecodeTrade},
+		{"subscribe", aevoDecodeSubscribed("aevo")},
+	},
+	"aevo-private": {
+		{"fills", aevoDecodeFill},
+		{"positions", aevoDecodePositions},
+		{"orders", aevoDecodeOrders},
+		{"subscribe", aevoDecodeSubscribed("aevo-private")},
+	},
+	"lyra": {
+		{"orderbook.", lyraDecodeOrderbook},
+		{"spot_feed.", lyraDecodeSpotFeed},
+		{"ticker.", lyraDecodeTicker},
+	},
+	"deribit": {
+		{"book.", deribitDecodeOrderbook},
+		{"deribit_price_index.", deribitDecodeIndex},
+		{"trades.", deribitDecodeTrades},
+		{"ticker.", deribitDecodeTicker},
+		{"user.changes.", deribitDecodeChanges},
+	},
+	"okx": {
+		{"books5:", okxDecodeOrderbook},
+		{"index-tickers:", okxDecodeIndex},
+	},
+	"binance-options": {
+		{"depth:", binanceOptionsDecodeDepth},
+		{"index:", binanceOptionsDecodeIndex},
+	},
+	"binance": {
+		{"forceOrder", binanceDecodeForceOrder},
+	},
+}, map[string]func(raw []byte) []byte{
+	"okx":             okxChannel,
+	"binance-options": binanceOptionsChannel,
+	"binance":         binanceEvent,
+})
+
+func newChannelRegistry(routes map[string][]channelRoute, channelOf map[string]func(raw []byte) []byte) *ChannelRegistry {
+	r := &ChannelRegistry{routes: make(map[string][]channelRoute), channelOf: channelOf, unknown: make(map[string]*unknownChannel)}
+	for exchange, exchangeRoutes := range routes {
+		for _, route := range exchangeRoutes {
+			r.add(exchange, route)
+		}
+	}
+	return r
+}
+
+// Register adds the decoder of an exchange's channels starting with prefix, replacing one registered for the same
+// prefix.
+func (r *ChannelRegistry) Register(exchange string, prefix string, decode ChannelDecoder) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.add(exchange, channelRoute{prefix, decode})
+}
+
+func (r *ChannelRegistry) add(exchange string, route channelRoute) {
+	routes := r.routes[exchange]
+	for i := range routes {
+		if routes[i].Prefix == route.Prefix {
+			routes[i] = route
+			return
+		}
+	}
+	routes = append(routes, route)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].Prefix) > len(routes[j].Prefix) }) //"ticker:ETH" before "ticker:"
+	r.routes[exchange] = routes
+}
+
+// Channel extracts a frame's channel name the way its exchange's frames carry it, nil for frames without one.
+func (r *ChannelRegistry) Channel(exchange string, raw []byte) []byte {
+	r.Mu.RLock()
+	channelOf := r.channelOf[exchange]
+	r.Mu.RUnlock()
+	if channelOf == nil {
+		return frameChannel(raw)
+	}
+	return channelOf(raw)
+}
+
+// Decode runs a frame through the decoder of its channel.
+func (r *ChannelRegistry) Decode(exchange string, raw []byte) {
+	channel := r.Channel(exchange, raw)
+	if channel == nil {
+		observeAck(exchange, raw)
+		return
+	}
+	r.Mu.RLock()
+	var decode ChannelDecoder
+	for _, route := range r.routes[exchange] {
+		if bytes.HasPrefix(channel, []byte(route.Prefix)) {
+			decode = route.Decode
+			break
+		}
+	}
+	r.Mu.RUnlock()
+
+	if decode == nil {
+		r.recordUnknown(exchange, string(channel), raw)
+		return
+	}
+	err := decode(raw)
+	if err != nil {
+		slog.Error("Decode: json decode error", "exchange", exchange, "channel", string(channel), "err", err)
+		return
+	}
+	Subscriptions.Confirm(exchange, channel)
+}
+
+// channelType is a channel's name up to its parameters, e.g. "trades" of "trades:ETH-28JUN24-3000-C" or
+// "trades.ETH-20240628-3000-C", so an unknown channel is reported once rather than per instrument.
+func channelType(channel string) string {
+	if i := strings.IndexAny(channel, ":."); i >= 0 {
+		return channel[:i]
+	}
+	return channel
+}
+
+func (r *ChannelRegistry) recordUnknown(exchange string, channel string, raw []byte) {
+	key := exchange + " " + channelType(channel)
+
+	r.Mu.Lock()
+	unknown, seen := r.unknown[key]
+	if !seen {
+		sample := raw[:min(len(raw), unknownSampleSize)]
+		unknown = &unknownChannel{Exchange: exchange, Channel: channel, Sample: string(sample)}
+		r.unknown[key] = unknown
+	}
+	unknown.Frames++
+	r.Mu.Unlock()
+
+	if !seen {
+		slog.Warn("Decode: no decoder for channel, ignoring its frames", "exchange", exchange, "channel", channel, "sample", unknown.Sample)
+	}
+}
+
+// Unknown returns the channel types seen without a decoder.
+func (r *ChannelRegistry) Unknown() []unknownChannel {
+	r.Mu.RLock()
+	defer r.Mu.RUnlock()
+	unknown := make([]unknownChannel, 0, len(r.unknown))
+	for _, channel := range r.unknown {
+		unknown = append(unknown, *channel)
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Exchange+unknown[i].Channel < unknown[j].Exchange+unknown[j].Channel
+	})
+	return unknown
+}
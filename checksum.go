@@ -0,0 +1,55 @@
+package main
+
+import (
+	"hash/crc32"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+var VerifyChecksums = true
+
+const checksumDepth = 100 //levels per side the exchanges' checksums cover
+
+// bookChecksum is the CRC32 (IEEE) of up to depth levels per side, interleaved best first as
+// "bidPrice:bidAmount:askPrice:askAmount:..." with numbers in their shortest decimal form.
+func bookChecksum(bids []Order, asks []Order, depth int) uint32 {
+	fields := make([]string, 0, 4*depth)
+	format := func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) }
+	for i := 0; i < depth && (i < len(bids) || i < len(asks)); i++ {
+		if i < len(bids) {
+			fields = append(fields, bids[i].Price.String(), format(bids[i].Amount))
+		}
+		if i < len(asks) {
+			fields = append(fields, asks[i].Price.String(), format(asks[i].Amount))
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(strings.Join(fields, ":")))
+}
+
+// verifyChecksum checks an exchange's side of orderbook against the checksum it sent, which is "" if the message
+// had none. On a mismatch, a dropped or misapplied update, the side is cleared and a snapshot requested. Books
+// trimmed by a depth limit can't match and aren't checked. Callers hold OrderbookContainer.Mu.
+func verifyChecksum(orderbook *OrderbookData, exchange string, instrument string, channel string, checksum string) bool {
+	if !VerifyChecksums || checksum == "" || orderbook.DepthLimit > 0 {
+		return true
+	}
+	expected, err := strconv.ParseUint(checksum, 10, 32)
+	if err != nil {
+		slog.Warn("verifyChecksum: unparseable checksum", "exchange", exchange, "instrument", instrument, "checksum", checksum)
+		return true
+	}
+
+	actual := bookChecksum(orderbook.Bids[exchange], orderbook.Asks[exchange], checksumDepth)
+	if actual == uint32(expected) {
+		return true
+	}
+
+	slog.Warn("verifyChecksum: checksum mismatch, requesting snapshot", "exchange", exchange, "instrument", instrument, "expected", expected, "actual", actual)
+	delete(orderbook.Bids, exchange)
+	delete(orderbook.Asks, exchange)
+	delete(orderbook.Sequences, exchange)
+	recordChecksumMismatch(exchange, channel)
+	requestSnapshot(exchange, channel)
+	return false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"options-ws/config"
+	"options-ws/ratelimit"
+)
+
+type command struct {
+	Run   func(args []string)
+	Usage string
+}
+
+// commands are the binary's subcommands, each with its own flags (options-ws <command> -h). A first argument that is
+// a flag runs "run", so options-ws -assets ETH,BTC works as it always has.
+var commands = map[string]command{
+	"run":      {runCommand, "stream the exchanges into the arb engine and serve the UI and API (default)"},
+	"markets":  {marketsCommand, "list the instruments each exchange lists for the assets"},
+	"snapshot": {snapshotCommand, "fetch every instrument's REST orderbook once and print the books as JSON"},
+	"replay":   {replayCommand, "feed a -record capture through the pipeline, serving the UI and API as run does"},
+	"backtest": {backtestCommand, "run a capture through the arb engine as fast as possible and report the opportunities"},
+	"export":   {exportCommand, "write a persisted table, e.g. the opportunities' lifetimes, to CSV or Parquet"},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %v <command> [flags]\n\ncommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9v %v\n", name, commands[name].Usage)
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
+	}
+	command, exists := commands[name]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	command.Run(args)
+}
+
+// registerConfigFlags registers the config.Config flags and -config on fs, every command takes them.
+func registerConfigFlags(fs *flag.FlagSet) (*config.Config, *string) {
+	cfg := config.Default()
+	cfg.RegisterFlags(fs)
+	configFile := fs.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "YAML config file, its settings are overridden by "+config.EnvPrefix+"* environment variables and flags")
+	return &cfg, configFile
+}
+
+// applyConfig resolves cfg from the config file, environment and the flags parsed into fs and applies the settings
+// shared by every command: assets, profit threshold, fees, logging and exchange urls.
+func applyConfig(fs *flag.FlagSet, cfg *config.Config, configFile string) {
+	err := cfg.Resolve(fs, configFile)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	Assets = cfg.Assets
+	setTickerAssets(cfg.TickerAssets)
+	StrikeRange, MaxExpiry = cfg.StrikeRange, cfg.MaxExpiry
+	MinProfit = cfg.MinProfit
+	ExchangeFees = cfg.Fees
+	err = setupLogging(cfg.LogLevel, cfg.LogFormat, os.Stderr)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	SubscribeBatchSize = cfg.SubscribeBatchSize
+	WssCompression, WssInflateBinary = parseCompressionMode(cfg.WssCompression), cfg.WssInflateBinary
+	WssConnections = cfg.WssConnections
+	if cfg.Connections != nil {
+		WssExchangeConnections = cfg.Connections
+	}
+	AevoClient.HttpUrl, AevoClient.WssUrl = cfg.AevoHttp, cfg.AevoWss
+	AevoClient.Http.Timeout = cfg.HttpTimeout
+	http.DefaultClient.Timeout = cfg.HttpTimeout //lyra and deribit requests
+	LyraHttp, LyraWss = cfg.LyraHttp, cfg.LyraWss
+	DeribitHttp, DeribitWss = cfg.DeribitHttp, cfg.DeribitWss
+	OkxHttp, OkxWss = cfg.OkxHttp, cfg.OkxWss
+	BinanceOptionsHttp, BinanceOptionsWss = cfg.BinanceOptionsHttp, cfg.BinanceOptionsWss
+	for exchange, limit := range cfg.RateLimits {
+		if limit.Rate > 0 {
+			VenueLimiters[exchange] = ratelimit.New(limit.Rate, limit.Burst)
+		}
+	}
+	AevoClient.Limiter = VenueLimiters["aevo"]
+}
+
+// configuredExchanges returns the option exchanges of cfg.Exchanges in a fixed order.
+func configuredExchanges(cfg *config.Config) []Exchange {
+	exchanges := make([]Exchange, 0)
+	for _, exchange := range []Exchange{aevoExchange{}, lyraExchange{}, deribitExchange{}, okxExchange{}, binanceOptionsExchange{}} {
+		if cfg.HasExchange(exchange.Name()) {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	return exchanges
+}
+
+// marketsCommand prints the instruments of every configured exchange, one "exchange instrument" line each in the
+// exchange's own naming.
+func marketsCommand(args []string) {
+	fs := flag.NewFlagSet("markets", flag.ExitOnError)
+	cfg, configFile := registerConfigFlags(fs)
+	fs.Parse(args)
+	applyConfig(fs, cfg, *configFile)
+
+	for _, exchange := range configuredExchanges(cfg) {
+		instruments, err := exchange.FetchMarkets(Assets)
+		if err != nil {
+			log.Fatalf("%v: %v", exchange.Name(), err)
+		}
+		sort.Strings(instruments)
+		for _, instrument := range instruments {
+			fmt.Printf("%v %v\n", exchange.Name(), instrument)
+		}
+	}
+}
+
+// snapshotCommand fetches the REST book of every listed instrument once, -concurrency at a time per exchange, and
+// prints them merged across exchanges, sorted by instrument.
+func snapshotCommand(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	cfg, configFile := registerConfigFlags(fs)
+	depth := fs.Int("depth", 0, "levels kept per exchange and side (0 keeps all)")
+	concurrency := fs.Int("concurrency", 8, "book requests in flight per exchange, the venue rate limits pace them further")
+	fs.Parse(args)
+	applyConfig(fs, cfg, *configFile)
+
+	snapshot, err := fetchMarketSnapshot(configuredExchanges(cfg), Assets, listedInstruments, *concurrency)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	for exchange, errors := range snapshot.Errors {
+		log.Printf("%v: %v books failed to fetch", exchange, errors)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(snapshot.Merged(*depth))
+	if err != nil {
+		log.Fatalf("snapshot: %v", err)
+	}
+}
+
+// replayCommand is run with the capture, its last argument, given as -replay, e.g. options-ws replay -replay-speed 10
+// capture.jsonl. Every run flag applies.
+func replayCommand(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[len(args)-1], "-") {
+		fmt.Fprintf(os.Stderr, "usage: %v replay [run flags] <capture>\n", os.Args[0])
+		os.Exit(2)
+	}
+	runCommand(append([]string{"-replay", args[len(args)-1]}, args[:len(args)-1]...))
+}
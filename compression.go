@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"nhooyr.io/websocket"
+)
+
+var WssCompression = websocket.CompressionDisabled //permessage-deflate, inflated by the library
+var WssInflateBinary = true                        //inflate gzip, zlib or raw deflate binary frames before the pipeline
+
+// parseCompressionMode parses a wss_compression setting, already validated by the config package.
+func parseCompressionMode(mode string) websocket.CompressionMode {
+	switch mode {
+	case "context-takeover":
+		return websocket.CompressionContextTakeover
+	case "no-context-takeover":
+		return websocket.CompressionNoContextTakeover
+	}
+	return websocket.CompressionDisabled
+}
+
+// inflateFrame returns the JSON of a binary frame read by wssRead into a pooled buffer, releasing raw when it was
+// compressed. On an error raw is released as well.
+func inflateFrame(raw []byte) ([]byte, error) {
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' {
+		return raw, nil
+	}
+
+	var reader io.ReadCloser
+	var err error
+	switch {
+	case len(raw) >= 2 && raw[0] == 0x1f && raw[1] == 0x8b:
+		reader, err = gzip.NewReader(bytes.NewReader(raw))
+	case len(raw) >= 2 && raw[0]&0x0f == 8 && (uint16(raw[0])<<8|uint16(raw[1]))%31 == 0:
+		reader, err = zlib.NewReader(bytes.NewReader(raw))
+	default:
+		reader = flate.NewReader(bytes.NewReader(raw))
+	}
+	if err != nil {
+		releaseFrame(raw)
+		return nil, fmt.Errorf("inflateFrame: %v", err)
+	}
+	defer reader.Close()
+
+	inflated, err := readFrame(acquireFrame(), reader)
+	releaseFrame(raw)
+	if err != nil {
+		releaseFrame(inflated)
+		return nil, fmt.Errorf("inflateFrame: %v", err)
+	}
+	return inflated, nil
+}
@@ -0,0 +1,356 @@
+// Package config holds the deployment settings of options-ws: underlyings, exchanges and their endpoints, thresholds,
+// logging and the HTTP listen address. Settings come from, in increasing precedence, the defaults, a YAML file,
+// OPTIONS_WS_* environment variables and command line flags.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const EnvPrefix = "OPTIONS_WS_"
+
+// EnvName is the environment variable of a setting's flag, e.g. OPTIONS_WS_MIN_PROFIT for -min-profit.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+type Config struct {
+	Assets             []string             `yaml:"assets"`        //underlyings whose chains are subscribed and scanned
+	Exchanges          []string             `yaml:"exchanges"`     //option venues to stream, of "aevo", "lyra" (alias "derive"), "deribit", "okx", "binance-options"
+	TickerAssets       []string             `yaml:"ticker_assets"` //of Assets, subscribed as best bid/ask tickers instead of full books
+	StrikeRange        float64              `yaml:"strike_range"`  //fraction of the index strikes are subscribed within, 0 subscribes every strike
+	MaxExpiry          time.Duration        `yaml:"max_expiry"`    //0 subscribes every expiry
+	MinProfit          float64              `yaml:"min_profit"`
+	LogLevel           string               `yaml:"log_level"`  //"debug", "info", "warn" or "error"
+	LogFormat          string               `yaml:"log_format"` //"text" or "json"
+	Listen             string               `yaml:"listen"`
+	GrpcListen         string               `yaml:"grpc_listen"`          //empty disables the gRPC feed
+	SubscribeBatchSize int                  `yaml:"subscribe_batch_size"` //channels per subscribe message
+	WssCompression     string               `yaml:"wss_compression"`      //permessage-deflate: "disabled", "context-takeover" or "no-context-takeover"
+	WssInflateBinary   bool                 `yaml:"wss_inflate_binary"`   //decompress gzip, zlib and deflate binary frames
+	WssConnections     int                  `yaml:"wss_connections"`      //connections each exchange's channels are spread over
+	HttpTimeout        time.Duration        `yaml:"http_timeout"`
+	AevoHttp           string               `yaml:"aevo_http"`
+	AevoWss            string               `yaml:"aevo_wss"`
+	LyraHttp           string               `yaml:"lyra_http"`
+	LyraWss            string               `yaml:"lyra_wss"`
+	DeribitHttp        string               `yaml:"deribit_http"`
+	DeribitWss         string               `yaml:"deribit_wss"`
+	OkxHttp            string               `yaml:"okx_http"`
+	OkxWss             string               `yaml:"okx_wss"`
+	BinanceOptionsHttp string               `yaml:"binance_options_http"`
+	BinanceOptionsWss  string               `yaml:"binance_options_wss"`
+	StoreDriver        string               `yaml:"store_driver"` //"sqlite" or "postgres"
+	StoreDsn           string               `yaml:"store_dsn"`    //empty disables persistence
+	StoreQueue         int                  `yaml:"store_queue"`
+	BusUrl             string               `yaml:"bus_url"`      //"nats://..." or "redis://...", empty disables the bus bridge
+	BusPrefix          string               `yaml:"bus_prefix"`   //first subject token
+	BusEncoding        string               `yaml:"bus_encoding"` //"json" or "proto"
+	Fees               map[string]Fees      `yaml:"fees"`         //per exchange, file only
+	RateLimits         map[string]RateLimit `yaml:"rate_limits"`  //per exchange, file only
+	Connections        map[string]int       `yaml:"connections"`  //per exchange overrides of WssConnections, file only
+	Outputs            []Output             `yaml:"outputs"`      //sinks updates and opportunities are written to, none by default
+}
+
+// Output is a sink events are written to as they're published: "stdout" and "file" in a human readable line format,
+// "jsonl" as a JSON object a line in a file per UTC day. Files are rotated once they'd grow past MaxSize, the MaxFiles
+// newest rotated ones kept next to the current file (path.1 being the newest), and a jsonl sink keeps MaxFiles days.
+type Output struct {
+	Type     string   `yaml:"type"`      //"stdout", "file" or "jsonl"
+	Path     string   `yaml:"path"`      //file: the file written, jsonl: the directory of the daily files
+	Events   []string `yaml:"events"`    //of "books", "indexes" and "opportunities", only opportunities if empty
+	MaxSize  int64    `yaml:"max_size"`  //bytes, 0 never rotates on size
+	MaxFiles int      `yaml:"max_files"` //0 keeps them all
+}
+
+var OutputEvents = []string{"books", "indexes", "opportunities"}
+
+// RateLimit is an exchange's request budget shared by REST requests and websocket subscription messages: Rate a
+// second on average with bursts of up to Burst. A Rate of 0 is unlimited.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Fees is an exchange's option fee schedule. Trading and settlement fees are fractions of the index notional per
+// contract, capped at PremiumCap of the option's price, Gas is USD per order and Slippage a fraction of price assumed
+// lost per fill.
+type Fees struct {
+	Maker      float64 `yaml:"maker"`
+	Taker      float64 `yaml:"taker"`
+	Settlement float64 `yaml:"settlement"`
+	PremiumCap float64 `yaml:"premium_cap"` //0 is uncapped
+	Gas        float64 `yaml:"gas"`
+	Slippage   float64 `yaml:"slippage"`
+}
+
+func Default() Config {
+	return Config{
+		Assets:             []string{"ETH"},
+		Exchanges:          []string{"aevo", "lyra"},
+		LogLevel:           "info",
+		LogFormat:          "text",
+		Listen:             ":8080",
+		SubscribeBatchSize: 20,
+		WssCompression:     "disabled",
+		WssInflateBinary:   true,
+		WssConnections:     1,
+		HttpTimeout:        10 * time.Second,
+		AevoHttp:           "https://api.aevo.xyz",
+		AevoWss:            "wss://ws.aevo.xyz",
+		LyraHttp:           "https://api.lyra.finance",
+		LyraWss:            "wss://api.lyra.finance/ws",
+		DeribitHttp:        "https://www.deribit.com/api/v2",
+		DeribitWss:         "wss://www.deribit.com/ws/api/v2",
+		OkxHttp:            "https://www.okx.com",
+		OkxWss:             "wss://ws.okx.com:8443/ws/v5/public",
+		BinanceOptionsHttp: "https://eapi.binance.com",
+		BinanceOptionsWss:  "wss://nbstream.binance.com/eoptions/ws",
+		StoreDriver:        "sqlite",
+		StoreQueue:         65536,
+		BusPrefix:          "options",
+		BusEncoding:        "json",
+		Fees: map[string]Fees{ //published schedules at the time of writing
+			"aevo":    {Maker: 0.0003, Taker: 0.0005, Settlement: 0.00015, PremiumCap: 0.125},
+			"lyra":    {Maker: 0.0001, Taker: 0.0003, Settlement: 0.00015, PremiumCap: 0.125, Gas: 0.1},
+			"deribit": {Maker: 0.0003, Taker: 0.0003, Settlement: 0.00015, PremiumCap: 0.125},
+			"okx":     {Maker: 0.0002, Taker: 0.0003, Settlement: 0.0002, PremiumCap: 0.125},
+
+			"binance-options": {Maker: 0.0002, Taker: 0.0003, Settlement: 0.00015, PremiumCap: 0.1},
+		},
+		RateLimits: map[string]RateLimit{ //below the public limits, leaving room for other clients of the same IP
+			"aevo":    {Rate: 10, Burst: 20},
+			"lyra":    {Rate: 5, Burst: 10},
+			"deribit": {Rate: 15, Burst: 50},
+			"okx":     {Rate: 1, Burst: 20}, //subscribe requests are limited to 480 an hour per connection
+
+			"binance-options": {Rate: 5, Burst: 10}, //10 websocket messages a second
+		},
+	}
+}
+
+// HasExchange reports whether exchange is one of the configured Exchanges.
+func (c *Config) HasExchange(exchange string) bool {
+	for _, name := range c.Exchanges {
+		if name == exchange {
+			return true
+		}
+	}
+	return false
+}
+
+// listValue is a comma separated []string flag.
+type listValue struct{ list *[]string }
+
+func (v listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.list = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.list = append(*v.list, item)
+		}
+	}
+	return nil
+}
+
+// outputsValue is a comma separated list of "stdout", "file:<path>" and "jsonl:<dir>" outputs, each writing
+// opportunities without size limits, the YAML file configures the rest.
+type outputsValue struct{ outputs *[]Output }
+
+func (v outputsValue) String() string {
+	if v.outputs == nil {
+		return ""
+	}
+	specs := make([]string, len(*v.outputs))
+	for i, output := range *v.outputs {
+		specs[i] = output.Type
+		if output.Path != "" {
+			specs[i] += ":" + output.Path
+		}
+	}
+	return strings.Join(specs, ",")
+}
+
+func (v outputsValue) Set(s string) error {
+	*v.outputs = nil
+	for _, spec := range strings.Split(s, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		outputType, path, _ := strings.Cut(spec, ":")
+		*v.outputs = append(*v.outputs, Output{Type: outputType, Path: path})
+	}
+	return nil
+}
+
+// RegisterFlags defines a flag for every setting on fs, writing into c. Call Resolve after fs is parsed.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(listValue{&c.Assets}, "assets", "comma separated underlyings to subscribe and scan, e.g. ETH,BTC")
+	fs.Var(listValue{&c.Exchanges}, "exchanges", "comma separated option exchanges to stream, of aevo, lyra (or derive), deribit, okx and binance-options")
+	fs.Var(listValue{&c.TickerAssets}, "ticker-assets", "comma separated assets to subscribe tickers (best bid/ask and greeks) of instead of full books, lighter for large chains")
+	fs.Float64Var(&c.StrikeRange, "strike-range", c.StrikeRange, "only subscribe strikes within this fraction of the index, e.g. 0.3 for ±30%, following the index as it moves (0 subscribes every strike)")
+	fs.DurationVar(&c.MaxExpiry, "max-expiry", c.MaxExpiry, "only subscribe expiries settling within this long, e.g. 1440h (0 subscribes every expiry)")
+	fs.Float64Var(&c.MinProfit, "min-profit", c.MinProfit, "minimum absolute profit per contract for an opportunity to be listed")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log format: text or json")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "HTTP listen address")
+	fs.StringVar(&c.GrpcListen, "grpc-listen", c.GrpcListen, "gRPC streaming feed listen address, e.g. :9090 (empty disables)")
+	fs.IntVar(&c.SubscribeBatchSize, "subscribe-batch-size", c.SubscribeBatchSize, "channels per websocket subscribe message")
+	fs.StringVar(&c.WssCompression, "wss-compression", c.WssCompression, "websocket permessage-deflate: disabled, context-takeover (best ratio, 32KB window per connection) or no-context-takeover")
+	fs.BoolVar(&c.WssInflateBinary, "wss-inflate-binary", c.WssInflateBinary, "decompress gzip, zlib and deflate compressed binary websocket frames")
+	fs.IntVar(&c.WssConnections, "wss-connections", c.WssConnections, "websocket connections each exchange's channels are spread over, for venues limiting subscriptions per connection")
+	fs.DurationVar(&c.HttpTimeout, "http-timeout", c.HttpTimeout, "timeout of exchange REST requests")
+	fs.StringVar(&c.AevoHttp, "aevo-http", c.AevoHttp, "aevo REST url")
+	fs.StringVar(&c.AevoWss, "aevo-wss", c.AevoWss, "aevo websocket url")
+	fs.StringVar(&c.LyraHttp, "lyra-http", c.LyraHttp, "lyra REST url")
+	fs.StringVar(&c.LyraWss, "lyra-wss", c.LyraWss, "lyra websocket url")
+	fs.StringVar(&c.DeribitHttp, "deribit-http", c.DeribitHttp, "deribit REST url")
+	fs.StringVar(&c.DeribitWss, "deribit-wss", c.DeribitWss, "deribit websocket url")
+	fs.StringVar(&c.OkxHttp, "okx-http", c.OkxHttp, "okx REST url")
+	fs.StringVar(&c.OkxWss, "okx-wss", c.OkxWss, "okx public websocket url")
+	fs.StringVar(&c.BinanceOptionsHttp, "binance-options-http", c.BinanceOptionsHttp, "binance european options REST url")
+	fs.StringVar(&c.BinanceOptionsWss, "binance-options-wss", c.BinanceOptionsWss, "binance european options websocket url")
+	fs.StringVar(&c.StoreDriver, "store-driver", c.StoreDriver, "database orderbook, index and opportunity ticks are written to: sqlite or postgres")
+	fs.StringVar(&c.StoreDsn, "store-dsn", c.StoreDsn, "database DSN, a file path for sqlite (empty disables persistence)")
+	fs.IntVar(&c.StoreQueue, "store-queue", c.StoreQueue, "records queued for the database before new ones are dropped")
+	fs.StringVar(&c.BusUrl, "bus-url", c.BusUrl, "NATS (nats://) or Redis (redis://) url orderbook, index and arb updates are published to (empty disables)")
+	fs.StringVar(&c.BusPrefix, "bus-prefix", c.BusPrefix, "first token of the bus subjects or channels")
+	fs.StringVar(&c.BusEncoding, "bus-encoding", c.BusEncoding, "bus message encoding: json or proto")
+	fs.Var(outputsValue{&c.Outputs}, "outputs", "comma separated sinks opportunities are written to: stdout, file:<path> (rotated, see the config file) or jsonl:<dir> (a file per UTC day)")
+}
+
+// Resolve rebuilds c, whose flags were registered on the parsed fs, from the defaults, the YAML file at path (skipped
+// if empty), the environment and finally the flags given on the command line.
+func (c *Config) Resolve(fs *flag.FlagSet, path string) error {
+	given := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = f.Value.String() })
+
+	*c = Default() //the registered flags point into c, so setting them below writes the fields
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Resolve: %v", err)
+		}
+		err = yaml.Unmarshal(raw, c)
+		if err != nil {
+			return fmt.Errorf("Resolve: %v: %v", path, err)
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, set := os.LookupEnv(EnvName(f.Name))
+		if !set || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("Resolve: %v: %v", EnvName(f.Name), setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, value := range given {
+		err = fs.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("Resolve: -%v: %v", name, err)
+		}
+	}
+
+	return c.validate()
+}
+
+func (c *Config) validate() error {
+	if len(c.Assets) == 0 {
+		return fmt.Errorf("validate: no assets")
+	}
+	if c.StrikeRange < 0 {
+		return fmt.Errorf("validate: negative strike range: %v", c.StrikeRange)
+	}
+	if c.MaxExpiry < 0 {
+		return fmt.Errorf("validate: negative max expiry: %v", c.MaxExpiry)
+	}
+	for i, exchange := range c.Exchanges {
+		if exchange == "derive" { //lyra's new name, same API
+			c.Exchanges[i] = "lyra"
+			continue
+		}
+		if exchange != "aevo" && exchange != "lyra" && exchange != "deribit" && exchange != "okx" && exchange != "binance-options" {
+			return fmt.Errorf("validate: unknown exchange: %v", exchange)
+		}
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("validate: unknown log level: %v", c.LogLevel)
+	}
+	if c.WssConnections < 1 {
+		return fmt.Errorf("validate: wss connections below 1: %v", c.WssConnections)
+	}
+	for exchange, n := range c.Connections {
+		if n < 1 {
+			return fmt.Errorf("validate: %v connections below 1: %v", exchange, n)
+		}
+	}
+	switch c.WssCompression {
+	case "disabled", "context-takeover", "no-context-takeover":
+	default:
+		return fmt.Errorf("validate: unknown wss compression: %v", c.WssCompression)
+	}
+	if c.StoreDriver != "sqlite" && c.StoreDriver != "postgres" {
+		return fmt.Errorf("validate: unknown store driver: %v", c.StoreDriver)
+	}
+	if c.BusEncoding != "json" && c.BusEncoding != "proto" {
+		return fmt.Errorf("validate: unknown bus encoding: %v", c.BusEncoding)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("validate: unknown log format: %v", c.LogFormat)
+	}
+	for exchange, fees := range c.Fees {
+		if fees.Maker < 0 || fees.Taker < 0 || fees.Settlement < 0 || fees.PremiumCap < 0 || fees.Gas < 0 || fees.Slippage < 0 {
+			return fmt.Errorf("validate: negative fee for %v", exchange)
+		}
+	}
+	for exchange, limit := range c.RateLimits {
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return fmt.Errorf("validate: negative rate limit for %v", exchange)
+		}
+	}
+	for _, output := range c.Outputs {
+		switch output.Type {
+		case "stdout":
+		case "file", "jsonl":
+			if output.Path == "" {
+				return fmt.Errorf("validate: %v output without a path", output.Type)
+			}
+		default:
+			return fmt.Errorf("validate: unknown output type: %v", output.Type)
+		}
+		for _, event := range output.Events {
+			if !slices.Contains(OutputEvents, event) {
+				return fmt.Errorf("validate: unknown output event: %v", event)
+			}
+		}
+		if output.MaxSize < 0 || output.MaxFiles < 0 {
+			return fmt.Errorf("validate: negative %v output limit", output.Type)
+		}
+	}
+	if c.SubscribeBatchSize < 1 {
+		return fmt.Errorf("validate: subscribe batch size %v < 1", c.SubscribeBatchSize)
+	}
+	return nil
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nhooyr.io/websocket"
+	"options-ws/ratelimit"
+)
+
+var SubscribeBatchSize = 20 //channels per subscribe message
+
+// WssConn is a websocket connection to one exchange that remembers its subscribed channels, which lets it swap the
+// underlying connection for a new one (forced disconnects, dropped connections, scheduled rotation) without the
+// caller noticing. Frames from every underlying connection are delivered on Frames.
+type WssConn struct {
+	Exchange      string
+	Shard         int //index among the exchange's connections, see sharding.go
+	Url           string
+	MaxAge        time.Duration //rotate connections older than this, 0 disables
+	MinBackoff    time.Duration //first reconnect delay after a dropped connection, doubled per failed attempt
+	MaxBackoff    time.Duration
+	PingInterval  time.Duration             //heartbeat interval, 0 disables pings and the stale watchdog
+	PingJson      []byte                    //application level ping, nil sends websocket protocol pings instead
+	StaleAfter    time.Duration             //replace the connection when nothing was read for this long, 0 disables
+	Compression   websocket.CompressionMode //permessage-deflate offered when dialing, used if the exchange accepts it
+	InflateBinary bool                      //decompress gzip, zlib and deflate binary frames, see compression.go
+	Limiter       *ratelimit.Limiter        //paces subscribe and unsubscribe messages, shared with the exchange's REST requests
+	Frames        chan []byte
+	subscribeJson func(channels []string) []byte
+
+	// UnsubscribeJson builds the exchange's unsubscribe message, Resubscribe sends it before subscribing again so the
+	// exchange starts the channels over with a snapshot. nil resubscribes without unsubscribing first.
+	UnsubscribeJson func(channels []string) []byte
+
+	// AuthJson builds the login message of private feeds, written first on every connection, replacements included.
+	// Called per connection so signed logins carry a fresh timestamp and nonce. nil for public feeds.
+	AuthJson func() []byte
+
+	// CancelOnDisconnectJson arms the venue's cancel on disconnect, written after AuthJson on every connection so the
+	// exchange cancels the account's orders if it drops. nil where the venue has none, see deadman.go.
+	CancelOnDisconnectJson []byte
+
+	// DisarmCancelOnDisconnectJson is written on a connection rotation replaces before it's closed, the orders outlive
+	// the swap since the replacement armed its own. nil with CancelOnDisconnectJson.
+	DisarmCancelOnDisconnectJson []byte
+
+	Mu         sync.Mutex
+	current    *wssSession
+	channels   []string
+	known      map[string]bool
+	Reconnects int //connections replaced after a drop or close, rotation not counted
+	Stale      int //connections the watchdog gave up on
+}
+
+type wssSession struct {
+	Ctx        context.Context
+	Conn       *websocket.Conn
+	Cancel     context.CancelFunc
+	Started    time.Time
+	Subscribed map[string]bool //channels sent (or being sent) on this connection, guarded by WssConn.Mu
+	LastRead   atomic.Int64    //unix nanoseconds of the last frame (pongs included) read from this connection
+}
+
+// close codes exchanges use for scheduled maintenance or load shedding, a replacement connection is opened on these
+var goingAwayCodes = map[websocket.StatusCode]bool{
+	websocket.StatusGoingAway:      true,
+	websocket.StatusServiceRestart: true,
+	websocket.StatusTryAgainLater:  true,
+}
+
+func newWssConn(exchange string, url string, subscribeJson func(channels []string) []byte) *WssConn {
+	return &WssConn{
+		Exchange:      exchange,
+		Url:           url,
+		MinBackoff:    time.Second,
+		MaxBackoff:    time.Minute,
+		Compression:   WssCompression,
+		InflateBinary: WssInflateBinary,
+		Frames:        make(chan []byte, 1024),
+		subscribeJson: subscribeJson,
+		known:         make(map[string]bool),
+	}
+}
+
+// Connect dials the first connection and starts reading from it.
+func (c *WssConn) Connect() error {
+	session, err := dialSession(c.Url, c.Compression)
+	if err != nil {
+		return err
+	}
+
+	err = c.authenticate(session)
+	if err != nil {
+		session.Conn.CloseNow()
+		session.Cancel()
+		return err
+	}
+
+	c.Mu.Lock()
+	c.current = session
+	c.Mu.Unlock()
+
+	go c.readSession(session)
+	go c.heartbeat(session)
+	Subscriptions.ResetBatches(c.Exchange)
+	if c.MaxAge > 0 {
+		go c.rotateLoop()
+	}
+
+	return nil
+}
+
+func (c *WssConn) Close() {
+	c.Mu.Lock()
+	session := c.current
+	c.current = nil
+	c.Mu.Unlock()
+
+	if session != nil {
+		session.Conn.Close(websocket.StatusNormalClosure, "")
+		session.Cancel()
+	}
+}
+
+// Subscribe records channels for replay on replacement connections and sends the ones not already subscribed on the
+// current connection in batches, so repeated calls for the same channels are no-ops.
+func (c *WssConn) Subscribe(channels []string) error {
+	c.Mu.Lock()
+	for _, channel := range channels {
+		if !c.known[channel] {
+			c.known[channel] = true
+			c.channels = append(c.channels, channel)
+		}
+	}
+	session := c.current
+	c.Mu.Unlock()
+
+	if session == nil {
+		return errors.New("Subscribe: not connected")
+	}
+
+	return c.writeSubscriptions(session, channels)
+}
+
+// Resubscribe sends channels' subscriptions again on the current connection, e.g. to get a fresh orderbook snapshot
+// after a sequence gap.
+func (c *WssConn) Resubscribe(channels []string) error {
+	c.Mu.Lock()
+	session := c.current
+	c.Mu.Unlock()
+	if session == nil {
+		return errors.New("Resubscribe: not connected")
+	}
+
+	if c.UnsubscribeJson != nil {
+		err := session.Conn.Write(session.Ctx, websocket.MessageText, c.UnsubscribeJson(channels))
+		if err != nil {
+			return fmt.Errorf("Resubscribe: %v: write error: %v", c.Exchange, err)
+		}
+	}
+	c.Mu.Lock()
+	for _, channel := range channels {
+		delete(session.Subscribed, channel)
+	}
+	c.Mu.Unlock()
+
+	return c.Subscribe(channels)
+}
+
+// Unsubscribe forgets channels, so replacement connections don't replay them, and unsubscribes them on the current
+// connection in batches when the exchange has an UnsubscribeJson. Channels whose unsubscribe write fails stay sent on
+// the connection, Reconcile retries them.
+func (c *WssConn) Unsubscribe(channels []string) error {
+	c.Mu.Lock()
+	removed := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		if c.known[channel] {
+			delete(c.known, channel)
+			removed[channel] = true
+		}
+	}
+	c.channels = slices.DeleteFunc(c.channels, func(channel string) bool { return removed[channel] })
+	Subscriptions.Forget(c.Exchange, channels)
+	session := c.current
+	if session != nil && c.UnsubscribeJson == nil {
+		for channel := range removed {
+			delete(session.Subscribed, channel)
+		}
+	}
+	c.Mu.Unlock()
+
+	if session == nil || c.UnsubscribeJson == nil {
+		return nil
+	}
+	return c.writeUnsubscriptions(session, channels)
+}
+
+func (c *WssConn) writeUnsubscriptions(session *wssSession, channels []string) error {
+	for i := 0; i < len(channels); i += SubscribeBatchSize {
+		end := min(i+SubscribeBatchSize, len(channels))
+		err := c.Limiter.Wait(session.Ctx)
+		if err != nil {
+			return fmt.Errorf("writeUnsubscriptions: %v: %v", c.Exchange, err)
+		}
+		err = session.Conn.Write(session.Ctx, websocket.MessageText, c.UnsubscribeJson(channels[i:end]))
+		if err != nil {
+			return fmt.Errorf("writeUnsubscriptions: %v: write error: %v", c.Exchange, err)
+		}
+		c.Mu.Lock()
+		for _, channel := range channels[i:end] {
+			if !c.known[channel] { //unless subscribed again meanwhile
+				delete(session.Subscribed, channel)
+			}
+		}
+		c.Mu.Unlock()
+	}
+
+	return nil
+}
+
+// SubscriptionDiff compares the channels wanted on the connection with those sent on its current one: missing were
+// never sent (their write failed, or the connection was replaced before the replay finished), stray were sent and are
+// no longer wanted (their unsubscribe write failed).
+func (c *WssConn) SubscriptionDiff() (desired int, missing []string, stray []string) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	if c.current == nil {
+		return len(c.channels), append([]string(nil), c.channels...), nil
+	}
+	for _, channel := range c.channels {
+		if !c.current.Subscribed[channel] {
+			missing = append(missing, channel)
+		}
+	}
+	for channel := range c.current.Subscribed {
+		if !c.known[channel] {
+			stray = append(stray, channel)
+		}
+	}
+	return len(c.channels), missing, stray
+}
+
+// Reconcile brings the current connection in line with the wanted channels, subscribing the missing and
+// unsubscribing the stray ones of SubscriptionDiff.
+func (c *WssConn) Reconcile() error {
+	_, missing, stray := c.SubscriptionDiff()
+	c.Mu.Lock()
+	session := c.current
+	c.Mu.Unlock()
+	if session == nil || (len(missing) == 0 && len(stray) == 0) {
+		return nil
+	}
+
+	slog.Info("Reconcile: subscriptions out of line", "exchange", c.Exchange, "shard", c.Shard, "missing", len(missing), "stray", len(stray))
+	err := c.writeSubscriptions(session, missing)
+	if err != nil {
+		return fmt.Errorf("Reconcile: %v", err)
+	}
+	if len(stray) > 0 && c.UnsubscribeJson != nil {
+		err = c.writeUnsubscriptions(session, stray)
+		if err != nil {
+			return fmt.Errorf("Reconcile: %v", err)
+		}
+	}
+	return nil
+}
+
+// reconcileLoop reconciles every connection's subscriptions every interval.
+func reconcileLoop(conns []*WssConn, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		for _, c := range conns {
+			err := c.Reconcile()
+			if err != nil {
+				slog.Warn("reconcileLoop: reconcile failed", "err", err)
+			}
+		}
+	}
+}
+
+// Subscribed returns the number of channels requested and the number sent on the current connection.
+func (c *WssConn) Subscribed() (int, int) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.current == nil {
+		return len(c.channels), 0
+	}
+	return len(c.channels), len(c.current.Subscribed)
+}
+
+func (c *WssConn) writeSubscriptions(session *wssSession, channels []string) error {
+	c.Mu.Lock()
+	pending := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if !session.Subscribed[channel] {
+			session.Subscribed[channel] = true //claimed before writing so concurrent calls don't send it twice
+			pending = append(pending, channel)
+		}
+	}
+	c.Mu.Unlock()
+	channels = pending
+
+	for i := 0; i < len(channels); i += SubscribeBatchSize {
+		end := min(i+SubscribeBatchSize, len(channels))
+
+		err := c.Limiter.Wait(session.Ctx)
+		if err == nil {
+			err = session.Conn.Write(session.Ctx, websocket.MessageText, c.subscribeJson(channels[i:end]))
+		}
+		if err == nil {
+			Subscriptions.Sent(c, channels[i:end])
+		}
+		if err != nil {
+			c.Mu.Lock()
+			for _, channel := range channels[i:] {
+				delete(session.Subscribed, channel)
+			}
+			c.Mu.Unlock()
+			return fmt.Errorf("writeSubscriptions: %v: write error: %v", c.Exchange, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *WssConn) readSession(session *wssSession) {
+	for {
+		messageType, raw, err := wssRead(session.Ctx, session.Conn)
+		if err == nil {
+			session.LastRead.Store(time.Now().UnixNano())
+			if messageType == websocket.MessageBinary && c.InflateBinary {
+				raw, err = inflateFrame(raw)
+				if err != nil {
+					slog.Warn("readSession: undecodable binary frame", "exchange", c.Exchange, "err", err)
+					continue
+				}
+			}
+			c.Frames <- raw
+			continue
+		}
+
+		c.Mu.Lock()
+		replaced := c.current != session
+		c.Mu.Unlock()
+		if replaced || session.Ctx.Err() != nil {
+			return
+		}
+
+		if goingAwayCodes[websocket.CloseStatus(err)] {
+			slog.Info("readSession: exchange closed the connection, replacing", "exchange", c.Exchange, "status", websocket.CloseStatus(err))
+		} else {
+			slog.Warn("readSession: read error, reconnecting", "exchange", c.Exchange, "err", err)
+		}
+		c.reconnect(session)
+		return
+	}
+}
+
+// reconnect replaces a dead connection, retrying the dial with exponential backoff and jitter until it succeeds or
+// the connection is closed or replaced elsewhere.
+func (c *WssConn) reconnect(old *wssSession) {
+	backoff := c.MinBackoff
+	for attempt := 1; ; attempt++ {
+		session, err := dialSession(c.Url, c.Compression)
+		if err == nil {
+			if c.swap(old, session) {
+				c.Mu.Lock()
+				c.Reconnects++
+				c.Mu.Unlock()
+			}
+			return
+		}
+
+		c.Mu.Lock()
+		abandoned := c.current != old
+		c.Mu.Unlock()
+		if abandoned {
+			return
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)) //jitter so reconnects after an outage don't all land at once
+		slog.Warn("reconnect: attempt failed", "exchange", c.Exchange, "attempt", attempt, "retry_in", wait.Round(time.Millisecond), "err", err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, c.MaxBackoff)
+	}
+}
+
+// replace opens a new connection in one attempt and swaps it in, a failed dial leaves the old connection in place.
+func (c *WssConn) replace(old *wssSession) {
+	session, err := dialSession(c.Url, c.Compression)
+	if err != nil {
+		slog.Warn("replace: dial failed", "exchange", c.Exchange, "err", err)
+		return
+	}
+	c.swap(old, session)
+}
+
+// swap points new subscriptions at session, replays existing subscriptions on it and only then drops the old
+// connection, so on scheduled rotation both deliver frames during the cutover. Returns false, closing session, if old
+// was already closed or replaced.
+func (c *WssConn) swap(old *wssSession, session *wssSession) bool {
+	c.Mu.Lock()
+	if c.current != old {
+		c.Mu.Unlock()
+		session.Conn.CloseNow()
+		session.Cancel()
+		return false
+	}
+	c.current = session
+	channels := append([]string(nil), c.channels...)
+	c.Mu.Unlock()
+
+	go c.readSession(session)
+	go c.heartbeat(session)
+
+	err := c.authenticate(session)
+	if err != nil {
+		slog.Error("swap: auth failed", "exchange", c.Exchange, "err", err)
+	}
+	err = c.writeSubscriptions(session, channels)
+	if err != nil {
+		slog.Error("swap: resubscribe failed", "err", err)
+	}
+	slog.Info("swap: resubscribed on new connection", "exchange", c.Exchange, "channels", len(channels))
+
+	if c.DisarmCancelOnDisconnectJson != nil {
+		err = old.Conn.Write(old.Ctx, websocket.MessageText, c.DisarmCancelOnDisconnectJson)
+		if err != nil {
+			slog.Warn("swap: cancel on disconnect disarm failed", "exchange", c.Exchange, "err", err)
+		}
+	}
+	old.Conn.Close(websocket.StatusNormalClosure, "")
+	old.Cancel()
+	return true
+}
+
+func (c *WssConn) authenticate(session *wssSession) error {
+	if c.AuthJson == nil {
+		return nil
+	}
+	err := session.Conn.Write(session.Ctx, websocket.MessageText, c.AuthJson())
+	if err != nil {
+		return fmt.Errorf("authenticate: %v: write error: %v", c.Exchange, err)
+	}
+	if c.CancelOnDisconnectJson != nil {
+		err = session.Conn.Write(session.Ctx, websocket.MessageText, c.CancelOnDisconnectJson)
+		if err != nil {
+			return fmt.Errorf("authenticate: %v: cancel on disconnect write error: %v", c.Exchange, err)
+		}
+	}
+	return nil
+}
+
+// Silent is how long nothing, not even a pong, was read on the current connection, growing while it's being
+// reconnected. 0 once closed.
+func (c *WssConn) Silent(now time.Time) time.Duration {
+	c.Mu.Lock()
+	session := c.current
+	c.Mu.Unlock()
+	if session == nil {
+		return 0
+	}
+	return now.Sub(time.Unix(0, session.LastRead.Load()))
+}
+
+// heartbeat pings a connection every PingInterval until it's closed or replaced, exchanges drop connections they see
+// as idle. If nothing, not even a pong, was read for StaleAfter the connection is closed, which readSession treats as
+// a dropped connection and reconnects, instead of waiting on a half open connection forever.
+func (c *WssConn) heartbeat(session *wssSession) {
+	if c.PingInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-session.Ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if silent := time.Since(time.Unix(0, session.LastRead.Load())); c.StaleAfter > 0 && silent > c.StaleAfter {
+			slog.Warn("heartbeat: connection stale, reconnecting", "exchange", c.Exchange, "silent", silent.Round(time.Second))
+			c.Mu.Lock()
+			c.Stale++
+			c.Mu.Unlock()
+			session.Conn.CloseNow()
+			return
+		}
+
+		if c.PingJson != nil {
+			err := session.Conn.Write(session.Ctx, websocket.MessageText, c.PingJson)
+			if err != nil {
+				slog.Warn("heartbeat: write error", "exchange", c.Exchange, "err", err)
+			}
+			continue
+		}
+		go func() { //Ping blocks until the pong or the context's end, a missing pong shows up in LastRead
+			ctx, cancel := context.WithTimeout(session.Ctx, c.PingInterval)
+			defer cancel()
+			err := session.Conn.Ping(ctx)
+			if err == nil {
+				session.LastRead.Store(time.Now().UnixNano())
+			}
+		}()
+	}
+}
+
+func (c *WssConn) rotateLoop() {
+	for {
+		c.Mu.Lock()
+		session := c.current
+		c.Mu.Unlock()
+		if session == nil {
+			return
+		}
+
+		wait := c.MaxAge - time.Since(session.Started)
+		if wait > 0 {
+			time.Sleep(wait)
+			continue
+		}
+
+		slog.Info("rotateLoop: connection reached max age, replacing", "exchange", c.Exchange, "max_age", c.MaxAge)
+		c.replace(session)
+		time.Sleep(time.Second) //avoid spinning if the replacement dial failed
+	}
+}
+
+func dialSession(url string, compression websocket.CompressionMode) (*wssSession, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c, res, err := websocket.Dial(ctx, url, &websocket.DialOptions{CompressionMode: compression})
+	if err != nil {
+		cancel()
+		err = fmt.Errorf("dialSession: dial error: %w", err)
+		if res != nil && res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusRequestTimeout {
+			return nil, permanent(err) //the handshake was rejected, e.g. a wrong url or a banned client
+		}
+		return nil, err
+	}
+	slog.Debug("dialSession: connected", "url", url, "status", res.Status, "header", res.Header)
+
+	session := &wssSession{Ctx: ctx, Conn: c, Cancel: cancel, Started: time.Now(), Subscribed: make(map[string]bool)}
+	session.LastRead.Store(session.Started.UnixNano())
+	return session, nil
+}
+
+// ResyncConns are the connections requestSnapshot resubscribes on, by exchange.
+var ResyncConns = struct {
+	Mu        sync.Mutex
+	Conns     map[string]*ShardedConn
+	Requested map[string]time.Time //exchange + " " + channel -> last resubscribe
+}{Conns: make(map[string]*ShardedConn), Requested: make(map[string]time.Time)}
+
+// requestSnapshot resubscribes a channel whose book can't be trusted (updates without a snapshot, out of order
+// updates) so the exchange sends a new snapshot. It's called from the decoders and doesn't block them, repeated
+// requests for a channel within resyncInterval are dropped while the first is in flight.
+func requestSnapshot(exchange string, channel string) {
+	const resyncInterval = 5 * time.Second
+
+	ResyncConns.Mu.Lock()
+	c := ResyncConns.Conns[exchange]
+	key := exchange + " " + channel
+	if c == nil || time.Since(ResyncConns.Requested[key]) < resyncInterval {
+		ResyncConns.Mu.Unlock()
+		return
+	}
+	ResyncConns.Requested[key] = time.Now()
+	ResyncConns.Mu.Unlock()
+
+	recordResync(exchange, channel)
+	go func() {
+		err := c.Resubscribe([]string{channel})
+		if err != nil {
+			slog.Error("requestSnapshot: resubscribe failed", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+type connMessage struct {
+	Conn    int //order the server accepted the connection in
+	Message string
+}
+
+// messageServer accepts websockets and reports every message read on them.
+func messageServer(t *testing.T) (*httptest.Server, chan connMessage) {
+	messages := make(chan connMessage, 64)
+	var accepted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn := int(accepted.Add(1))
+		for {
+			_, data, err := c.Read(context.Background())
+			if err != nil {
+				messages <- connMessage{conn, "closed"}
+				return
+			}
+			messages <- connMessage{conn, string(data)}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, messages
+}
+
+func nextMessage(t *testing.T, messages chan connMessage) connMessage {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message within 5s")
+		return connMessage{}
+	}
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	server, messages := messageServer(t)
+	c := newWssConn("test", "ws"+strings.TrimPrefix(server.URL, "http"), func(channels []string) []byte { return []byte("subscribe") })
+	c.AuthJson = func() []byte { return []byte("auth") }
+	c.CancelOnDisconnectJson, c.DisarmCancelOnDisconnectJson = []byte("arm"), []byte("disarm")
+	err := c.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	for _, want := range []connMessage{{1, "auth"}, {1, "arm"}} {
+		if got := nextMessage(t, messages); got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	//rotation arms the replacement and disarms the old connection before closing it, each read in order
+	c.Mu.Lock()
+	old := c.current
+	c.Mu.Unlock()
+	c.replace(old)
+	got := map[int][]string{}
+	for i := 0; i < 4; i++ {
+		message := nextMessage(t, messages)
+		got[message.Conn] = append(got[message.Conn], message.Message)
+	}
+	if want := []string{"disarm", "closed"}; !slices.Equal(got[1], want) {
+		t.Errorf("old connection read %v, want %v", got[1], want)
+	}
+	if want := []string{"auth", "arm"}; !slices.Equal(got[2], want) {
+		t.Errorf("replacement read %v, want %v", got[2], want)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RelativeValue is the ATM IV ratio of two underlyings at one tenor against its own history, a ratio ZScore standard
+// deviations from its mean is a candidate for selling the rich underlying's vol against buying the cheap one's.
+type RelativeValue struct {
+	Pair      string //e.g. "ETH/BTC"
+	Expiry    string
+	IvA       float64 //vol points
+	IvB       float64
+	Ratio     float64
+	Mean      float64
+	StdDev    float64
+	ZScore    float64
+	Samples   int
+	Candidate bool
+}
+
+type PairCorrelation struct {
+	Pair        string
+	Correlation float64 //of aevo index log returns over the correlation window
+	Samples     int
+}
+
+// CrossAsset keeps per pair and tenor IV ratio history for every pair of Assets.
+type CrossAsset struct {
+	ZScore            float64       //abs z-score at which a ratio is flagged
+	MinSamples        int           //history needed before flagging
+	History           time.Duration //ratio history kept per tenor
+	CorrelationWindow time.Duration
+
+	Mu           sync.Mutex
+	Ratios       map[string]*SampleRing //key: pair + " " + expiry
+	Latest       []RelativeValue
+	Correlations []PairCorrelation
+	lastAlerted  map[string]time.Time
+}
+
+var CrossAssetRv = CrossAsset{
+	ZScore:            2.5,
+	MinSamples:        30,
+	History:           24 * time.Hour,
+	CorrelationWindow: time.Hour,
+	Ratios:            make(map[string]*SampleRing),
+	lastAlerted:       make(map[string]time.Time),
+}
+
+func meanStdDev(samples []Sample) (float64, float64) {
+	if len(samples) < 2 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, sample := range samples {
+		mean += sample.Value
+	}
+	mean /= float64(len(samples))
+	variance := 0.0
+	for _, sample := range samples {
+		variance += (sample.Value - mean) * (sample.Value - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(samples)-1))
+}
+
+// indexReturnCorrelation correlates log returns of two aevo index histories, pairing samples recorded in the same
+// indexHistoryLoop pass.
+func indexReturnCorrelation(assetA string, assetB string, since time.Time) (float64, int) {
+	samplesA := indexSamples("aevo", assetA, since)
+	byTime := make(map[int64]float64, len(samplesA))
+	for _, sample := range samplesA {
+		byTime[sample.Time.UnixNano()] = sample.Value
+	}
+
+	var returnsA, returnsB []float64
+	var prevA, prevB float64
+	for _, sample := range indexSamples("aevo", assetB, since) {
+		a, exists := byTime[sample.Time.UnixNano()]
+		if !exists || a <= 0 || sample.Value <= 0 {
+			continue
+		}
+		if prevA > 0 {
+			returnsA = append(returnsA, math.Log(a/prevA))
+			returnsB = append(returnsB, math.Log(sample.Value/prevB))
+		}
+		prevA, prevB = a, sample.Value
+	}
+	if len(returnsA) < 3 {
+		return 0, len(returnsA)
+	}
+
+	meanA, meanB := 0.0, 0.0
+	for i := range returnsA {
+		meanA += returnsA[i]
+		meanB += returnsB[i]
+	}
+	meanA /= float64(len(returnsA))
+	meanB /= float64(len(returnsB))
+
+	covariance, varianceA, varianceB := 0.0, 0.0, 0.0
+	for i := range returnsA {
+		covariance += (returnsA[i] - meanA) * (returnsB[i] - meanB)
+		varianceA += (returnsA[i] - meanA) * (returnsA[i] - meanA)
+		varianceB += (returnsB[i] - meanB) * (returnsB[i] - meanB)
+	}
+	if varianceA == 0 || varianceB == 0 {
+		return 0, len(returnsA)
+	}
+	return covariance / math.Sqrt(varianceA*varianceB), len(returnsA)
+}
+
+func (c *CrossAsset) check(now time.Time, interval time.Duration) {
+	index := AevoIndex.Snapshot()
+	assets := currentAssets()
+
+	ivs := make(map[string]map[string]float64, len(assets))
+	for _, asset := range assets {
+		if index[asset] > 0 {
+			ivs[asset] = atmIvs(asset, index[asset])
+		}
+	}
+
+	var latest []RelativeValue
+	var correlations []PairCorrelation
+	for i, assetA := range assets {
+		for _, assetB := range assets[i+1:] {
+			pair := assetA + "/" + assetB
+			correlation, samples := indexReturnCorrelation(assetA, assetB, now.Add(-c.CorrelationWindow))
+			correlations = append(correlations, PairCorrelation{pair, correlation, samples})
+
+			for expiry, ivA := range ivs[assetA] {
+				ivB, exists := ivs[assetB][expiry]
+				if !exists || ivB <= 0 {
+					continue
+				}
+				latest = append(latest, c.record(now, interval, pair, expiry, ivA, ivB))
+			}
+		}
+	}
+	sort.Slice(latest, func(i, j int) bool { return math.Abs(latest[i].ZScore) > math.Abs(latest[j].ZScore) })
+
+	c.Mu.Lock()
+	c.Latest = latest
+	c.Correlations = correlations
+	c.Mu.Unlock()
+}
+
+func (c *CrossAsset) record(now time.Time, interval time.Duration, pair string, expiry string, ivA float64, ivB float64) RelativeValue {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	rv := RelativeValue{Pair: pair, Expiry: expiry, IvA: ivA, IvB: ivB, Ratio: ivA / ivB}
+	key := pair + " " + expiry
+	ring, exists := c.Ratios[key]
+	if !exists {
+		ring = newSampleRing(int(c.History/interval) + 1)
+		c.Ratios[key] = ring
+	}
+	history := ring.Since(now.Add(-c.History)) //scored against history before this sample
+	ring.Add(Sample{now, rv.Ratio})
+
+	rv.Samples = len(history)
+	rv.Mean, rv.StdDev = meanStdDev(history)
+	if rv.StdDev > 0 {
+		rv.ZScore = (rv.Ratio - rv.Mean) / rv.StdDev
+	}
+	rv.Candidate = rv.Samples >= c.MinSamples && math.Abs(rv.ZScore) >= c.ZScore
+
+	if rv.Candidate && now.Sub(c.lastAlerted[key]) > time.Hour {
+		slog.Warn("RV ALERT: ATM IV ratio far from its mean", "pair", pair, "expiry", expiry, "ratio", rv.Ratio, "zscore", rv.ZScore, "mean", rv.Mean, "iv_a", ivA, "iv_b", ivB)
+		c.lastAlerted[key] = now
+	}
+
+	return rv
+}
+
+func (c *CrossAsset) Loop(interval time.Duration) {
+	for {
+		c.check(time.Now(), interval)
+		time.Sleep(interval)
+	}
+}
+
+func relativeValueHandler(w http.ResponseWriter, r *http.Request) {
+	CrossAssetRv.Mu.Lock()
+	response := struct {
+		RelativeValue []RelativeValue
+		Correlations  []PairCorrelation
+	}{CrossAssetRv.Latest, CrossAssetRv.Correlations}
+	CrossAssetRv.Mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		slog.Error("relativeValueHandler: json encode error", "err", err)
+	}
+}
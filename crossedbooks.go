@@ -0,0 +1,221 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var CrossedBookHistory = 1000 //closed crossings kept for /api/crossed-books
+
+// CrossedBook is an instrument whose best bid is above its best ask (crossed) or at it (locked). Within one exchange's
+// book it's almost always bad data, across exchanges a mispricing of the instrument itself. It's followed from the scan
+// it appeared in to the scan it was gone in, so durations are as fine as the scan interval.
+type CrossedBook struct {
+	Instrument  string    `json:"instrument"`
+	Kind        string    `json:"kind"`  //"crossed" or "locked"
+	Scope       string    `json:"scope"` //"venue", one exchange's own book, or "cross-venue"
+	BidExchange string    `json:"bid_exchange"`
+	AskExchange string    `json:"ask_exchange"`
+	Bid         float64   `json:"bid"`
+	Ask         float64   `json:"ask"`
+	Size        float64   `json:"size"` //the smaller of the two best levels
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Closed      time.Time `json:"-"`     //zero while open
+	Scans       int       `json:"scans"` //scans it was seen in
+}
+
+func (c *CrossedBook) Duration() time.Duration {
+	if c.Closed.IsZero() {
+		return c.LastSeen.Sub(c.FirstSeen)
+	}
+	return c.Closed.Sub(c.FirstSeen)
+}
+
+type CrossedBooksContainer struct {
+	Mu     sync.Mutex
+	Open   map[string]*CrossedBook //key: instrument, scope, kind and exchanges
+	Closed []CrossedBook           //the last CrossedBookHistory, oldest first
+}
+
+var CrossedBooks = CrossedBooksContainer{Open: make(map[string]*CrossedBook)}
+
+// findCrossedBooks returns the crossings of orderbook at now: each exchange's own book, and the widest pair of one
+// exchange's bid over another's ask. Stale sides are left out.
+func findCrossedBooks(instrument string, orderbook *OrderbookData, now time.Time) []CrossedBook {
+	crossings := make([]CrossedBook, 0)
+	crossing := func(bidExchange string, bid Order, askExchange string, ask Order) CrossedBook {
+		c := CrossedBook{Instrument: instrument, Kind: "crossed", Scope: "cross-venue", BidExchange: bidExchange, AskExchange: askExchange,
+			Bid: bid.Price.Float64(), Ask: ask.Price.Float64(), Size: min(bid.Amount, ask.Amount)}
+		if bid.Price == ask.Price {
+			c.Kind = "locked"
+		}
+		if bidExchange == askExchange {
+			c.Scope = "venue"
+		}
+		return c
+	}
+
+	var best *CrossedBook
+	for bidExchange, bids := range orderbook.Bids {
+		if len(bids) == 0 || bookStale(orderbook, bidExchange, now) {
+			continue
+		}
+		for askExchange, asks := range orderbook.Asks {
+			if len(asks) == 0 || bids[0].Price < asks[0].Price || bookStale(orderbook, askExchange, now) {
+				continue
+			}
+			c := crossing(bidExchange, bids[0], askExchange, asks[0])
+			if c.Scope == "venue" {
+				crossings = append(crossings, c)
+			} else if best == nil || c.Bid-c.Ask > best.Bid-best.Ask {
+				best = &c
+			}
+		}
+	}
+	if best != nil {
+		crossings = append(crossings, *best)
+	}
+	return crossings
+}
+
+func crossedBookKey(c CrossedBook) string {
+	return c.Instrument + " " + c.Scope + " " + c.Kind + " " + c.BidExchange + " " + c.AskExchange
+}
+
+// scanCrossedBooks opens a crossing for every crossed or locked book found at now, updates those still there and
+// closes the rest.
+func scanCrossedBooks(now time.Time) {
+	found := make(map[string]CrossedBook)
+	OrderbookContainer.Mu.RLock()
+	for instrument, orderbook := range OrderbookContainer.Orderbooks {
+		for _, c := range findCrossedBooks(instrument, orderbook, now) {
+			found[crossedBookKey(c)] = c
+		}
+	}
+	OrderbookContainer.Mu.RUnlock()
+
+	CrossedBooks.Mu.Lock()
+	defer CrossedBooks.Mu.Unlock()
+	for key, c := range found {
+		open, exists := CrossedBooks.Open[key]
+		if !exists {
+			c.FirstSeen = now
+			open = &c
+			CrossedBooks.Open[key] = open
+			slog.Warn("CROSSED BOOK", "instrument", c.Instrument, "kind", c.Kind, "scope", c.Scope, "bid", c.Bid, "bid_exchange", c.BidExchange,
+				"ask", c.Ask, "ask_exchange", c.AskExchange)
+		} else {
+			open.Bid, open.Ask, open.Size = c.Bid, c.Ask, c.Size
+		}
+		open.LastSeen = now
+		open.Scans++
+	}
+	for key, open := range CrossedBooks.Open {
+		if _, exists := found[key]; exists {
+			continue
+		}
+		open.Closed = now
+		slog.Info("crossed book cleared", "instrument", open.Instrument, "kind", open.Kind, "scope", open.Scope, "lasted", open.Duration())
+		CrossedBooks.Closed = append(CrossedBooks.Closed, *open)
+		delete(CrossedBooks.Open, key)
+	}
+	if excess := len(CrossedBooks.Closed) - CrossedBookHistory; excess > 0 {
+		CrossedBooks.Closed = append(CrossedBooks.Closed[:0], CrossedBooks.Closed[excess:]...)
+	}
+}
+
+func crossedBookLoop(interval time.Duration) {
+	for {
+		scanCrossedBooks(time.Now())
+		time.Sleep(interval)
+	}
+}
+
+type crossedBookJson struct {
+	CrossedBook
+	Closed     *time.Time `json:"closed,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+}
+
+func crossedBookResponse(c CrossedBook) crossedBookJson {
+	response := crossedBookJson{CrossedBook: c, DurationMs: c.Duration().Milliseconds()}
+	if !c.Closed.IsZero() {
+		response.Closed = &c.Closed
+	}
+	return response
+}
+
+type crossedBookStatsJson struct {
+	Count         int   `json:"count"` //closed, in the history
+	MeanMs        int64 `json:"mean_ms"`
+	MaxMs         int64 `json:"max_ms"`
+	OpenCount     int   `json:"open"`
+	LongestOpenMs int64 `json:"longest_open_ms"`
+	totalMs       int64
+}
+
+type crossedBooksJson struct {
+	Open   []crossedBookJson               `json:"open"`
+	Closed []crossedBookJson               `json:"closed"` //newest first
+	Stats  map[string]crossedBookStatsJson `json:"stats"`  //key: scope + " " + kind
+}
+
+// crossedBooksHandler serves /api/crossed-books, the open crossings longest first, the last ?limit= (default 100)
+// closed ones and duration statistics by scope and kind, optionally only ?scope= "venue" or "cross-venue".
+func crossedBooksHandler(w http.ResponseWriter, r *http.Request) {
+	scope := r.URL.Query().Get("scope")
+	if scope != "" && scope != "venue" && scope != "cross-venue" {
+		http.Error(w, "scope: not venue or cross-venue: "+scope, http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, "limit: not a non-negative integer: "+raw, http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	response := crossedBooksJson{Open: make([]crossedBookJson, 0), Closed: make([]crossedBookJson, 0), Stats: make(map[string]crossedBookStatsJson)}
+	CrossedBooks.Mu.Lock()
+	for _, c := range CrossedBooks.Open {
+		if scope != "" && c.Scope != scope {
+			continue
+		}
+		response.Open = append(response.Open, crossedBookResponse(*c))
+		stats := response.Stats[c.Scope+" "+c.Kind]
+		stats.OpenCount++
+		stats.LongestOpenMs = max(stats.LongestOpenMs, c.Duration().Milliseconds())
+		response.Stats[c.Scope+" "+c.Kind] = stats
+	}
+	for i := len(CrossedBooks.Closed) - 1; i >= 0; i-- {
+		c := CrossedBooks.Closed[i]
+		if scope != "" && c.Scope != scope {
+			continue
+		}
+		if len(response.Closed) < limit {
+			response.Closed = append(response.Closed, crossedBookResponse(c))
+		}
+		stats := response.Stats[c.Scope+" "+c.Kind]
+		stats.Count++
+		stats.totalMs += c.Duration().Milliseconds()
+		stats.MaxMs = max(stats.MaxMs, c.Duration().Milliseconds())
+		response.Stats[c.Scope+" "+c.Kind] = stats
+	}
+	CrossedBooks.Mu.Unlock()
+	for key, stats := range response.Stats {
+		if stats.Count > 0 {
+			stats.MeanMs = stats.totalMs / int64(stats.Count)
+			response.Stats[key] = stats
+		}
+	}
+	sort.Slice(response.Open, func(i, j int) bool { return response.Open[i].DurationMs > response.Open[j].DurationMs })
+	writeJson(w, "crossedBooksHandler", response)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var CancelStaleAfter = 10 * time.Second //0 disables cancelling on stale feeds
+
+var FeedsStale atomic.Bool //the switch is tripped, set until every feed is back
+
+// tradingEnabled reports whether orders can be placed, and so need cancelling.
+func tradingEnabled() bool {
+	return AevoClient.Signer != nil && AevoClient.Credentials != nil
+}
+
+// cancelAllOrders cancels the account's open orders, all at once or, if that request fails, the tracked ones one by
+// one. Cancelled orders are dropped from Portfolio.Orders, the private feed may not be there to report them.
+func cancelAllOrders(reason string) {
+	if !tradingEnabled() {
+		return
+	}
+
+	Portfolio.Mu.Lock()
+	tracked := make(map[string]OpenOrder)
+	for key, order := range Portfolio.Orders {
+		if order.Exchange == "aevo" {
+			tracked[key] = order
+		}
+	}
+	Portfolio.Mu.Unlock()
+
+	cancelled := make(map[string]bool)
+	ids, err := AevoClient.CancelAll()
+	if err == nil {
+		slog.Warn("cancelAllOrders: cancelled every open order", "reason", reason, "cancelled", len(ids), "tracked", len(tracked))
+		for key := range tracked {
+			cancelled[key] = true
+		}
+	} else {
+		slog.Error("cancelAllOrders: cancel all failed, cancelling tracked orders", "reason", reason, "err", err)
+		for key, order := range tracked {
+			err := AevoClient.CancelOrder(order.OrderId)
+			if err != nil {
+				slog.Error("cancelAllOrders: cancel failed", "order_id", order.OrderId, "instrument", order.Instrument, "err", err)
+				continue
+			}
+			cancelled[key] = true
+		}
+	}
+
+	Portfolio.Mu.Lock()
+	for key := range cancelled {
+		delete(Portfolio.Orders, key)
+	}
+	Portfolio.Mu.Unlock()
+}
+
+// deadManLoop cancels every open order when one of conns has been silent for CancelStaleAfter, a resting order the
+// process can't manage could fill one leg of an arb with nothing to hedge the other. It trips once per stale episode.
+func deadManLoop(conns []*WssConn, interval time.Duration) {
+	for {
+		now := time.Now()
+		var stale *WssConn
+		var silent time.Duration
+		for _, c := range conns {
+			if s := c.Silent(now); s > CancelStaleAfter && s > silent {
+				stale, silent = c, s
+			}
+		}
+
+		tripped := FeedsStale.Load()
+		switch {
+		case stale != nil && !tripped:
+			slog.Warn("deadManLoop: feed stale, cancelling open orders", "exchange", stale.Exchange, "shard", stale.Shard, "silent", silent.Round(time.Second))
+			FeedsStale.Store(true)
+			cancelAllOrders("stale " + stale.Exchange + " feed")
+		case stale == nil && tripped:
+			slog.Info("deadManLoop: feeds back, rearmed")
+			FeedsStale.Store(false)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,170 @@
+// Package decimal is fixed-point arithmetic for prices: a Decimal is an int64 count of 1e-8 units, so prices parsed
+// from the exchanges' decimal strings are held exactly and their sums, differences and comparisons don't accumulate
+// float rounding, a BTC strike of 65000 plus a premium of 0.1 is 65000.1 and not 65000.100000000006. Values are added,
+// subtracted and compared with the usual operators, multiplied by an integer constant with *, anything else goes
+// through Mul or Float64. Prices up to about 92 billion fit.
+package decimal
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const Places = 8 //decimal places held, smaller digits are rounded half away from zero
+
+const scale = 100_000_000
+
+type Decimal int64
+
+const One Decimal = scale
+
+// FromInt is n as a Decimal.
+func FromInt(n int64) Decimal {
+	return Decimal(n * scale)
+}
+
+// FromFloat rounds f to the nearest unit, prices converted from another currency (a coin quoted premium times the
+// index) or computed in float.
+func FromFloat(f float64) Decimal {
+	return Decimal(math.Round(f * scale))
+}
+
+// Parse parses a decimal string ("65000.1", "-0.05", "1e-4") exactly when it has at most Places decimals, rounding
+// otherwise.
+func Parse(s string) (Decimal, error) {
+	if strings.ContainsAny(s, "eEnN") { //exponents, Inf and NaN go through float
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) >= math.MaxInt64/scale {
+			return 0, fmt.Errorf("Parse: not a decimal: %q", s)
+		}
+		return FromFloat(f), nil
+	}
+
+	digits := s
+	negative := false
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		negative = digits[0] == '-'
+		digits = digits[1:]
+	}
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("Parse: not a decimal: %q", s)
+	}
+
+	var units uint64
+	for _, c := range whole {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("Parse: not a decimal: %q", s)
+		}
+		units = units*10 + uint64(c-'0')
+		if units > math.MaxInt64/scale {
+			return 0, fmt.Errorf("Parse: out of range: %q", s)
+		}
+	}
+	units *= scale
+	place := uint64(scale / 10)
+	for i, c := range fraction {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("Parse: not a decimal: %q", s)
+		}
+		if i == Places {
+			if c >= '5' {
+				units++
+			}
+			break
+		}
+		units += uint64(c-'0') * place
+		place /= 10
+	}
+	if units > math.MaxInt64 {
+		return 0, fmt.Errorf("Parse: out of range: %q", s)
+	}
+
+	if negative {
+		return -Decimal(units), nil
+	}
+	return Decimal(units), nil
+}
+
+// Floor rounds d down to a multiple of step, d itself when step isn't positive.
+func (d Decimal) Floor(step Decimal) Decimal {
+	if step <= 0 {
+		return d
+	}
+	floor := d / step * step
+	if floor > d { //division truncates towards zero
+		floor -= step
+	}
+	return floor
+}
+
+// Ceil rounds d up to a multiple of step, d itself when step isn't positive.
+func (d Decimal) Ceil(step Decimal) Decimal {
+	if step <= 0 {
+		return d
+	}
+	ceil := d / step * step
+	if ceil < d {
+		ceil += step
+	}
+	return ceil
+}
+
+// Multiple reports whether d is a multiple of step, always when step isn't positive.
+func (d Decimal) Multiple(step Decimal) bool {
+	return step <= 0 || d%step == 0
+}
+
+func (d Decimal) Float64() float64 {
+	return float64(d) / scale
+}
+
+// Mul is d times f rounded to the nearest unit.
+func (d Decimal) Mul(f float64) Decimal {
+	return FromFloat(d.Float64() * f)
+}
+
+// String formats d with as few decimals as it needs.
+func (d Decimal) String() string {
+	units := int64(d)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+	abs := uint64(units)
+	if units < 0 {
+		abs = uint64(-units)
+	}
+
+	whole := strconv.FormatUint(abs/scale, 10)
+	fraction := abs % scale
+	if fraction == 0 {
+		return sign + whole
+	}
+	digits := strconv.FormatUint(fraction+scale, 10)[1:] //zero padded to Places
+	return sign + whole + "." + strings.TrimRight(digits, "0")
+}
+
+// MarshalJSON writes d as a JSON number, what a float64 price was written as.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a string holding one.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	value, err := Parse(s)
+	if err != nil {
+		return fmt.Errorf("Decimal: %v", err)
+	}
+	*d = value
+	return nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"options-ws/decimal"
+	"options-ws/ratelimit"
+)
+
+var DeribitHttp string = "https://www.deribit.com/api/v2"
+var DeribitWss string = "wss://www.deribit.com/ws/api/v2"
+
+var DeribitIndex = IndexContainer{Index: make(map[string]float64)}
+
+type deribitInstrument struct {
+	InstrumentName      string `json:"instrument_name"`
+	IsActive            bool   `json:"is_active"`
+	ExpirationTimestamp int64  `json:"expiration_timestamp"` //unix milliseconds
+	SettlementCurrency  string `json:"settlement_currency"`  //the asset for inverse options, "USDC" for linear ones
+}
+
+func deribitMarkets(asset string) ([]deribitInstrument, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["deribit"], func() (*http.Request, error) {
+		return http.NewRequest("GET", DeribitHttp+"/public/get_instruments?currency="+asset+"&kind=option&expired=false", nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deribitMarkets: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var markets struct {
+		Result []deribitInstrument `json:"result"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&markets)
+	if err != nil {
+		return nil, fmt.Errorf("deribitMarkets: json decode error: %v", err)
+	}
+
+	return markets.Result, nil
+}
+
+// deribitSubscribeJson subscribes with private/subscribe when an account channel is among channels, it takes public
+// channels as well on a logged in connection.
+func deribitSubscribeJson(channels []string) []byte {
+	data := struct {
+		JsonRpc string              `json:"jsonrpc"`
+		Id      int                 `json:"id"`
+		Method  string              `json:"method"`
+		Params  map[string][]string `json:"params"`
+	}{
+		"2.0",
+		3,
+		deribitMethod("subscribe", channels),
+		map[string][]string{"channels": channels},
+	}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
+	return jsonData
+}
+
+func deribitUnsubscribeJson(channels []string) []byte {
+	data := struct {
+		JsonRpc string              `json:"jsonrpc"`
+		Id      int                 `json:"id"`
+		Method  string              `json:"method"`
+		Params  map[string][]string `json:"params"`
+	}{"2.0", 5, deribitMethod("unsubscribe", channels), map[string][]string{"channels": channels}}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
+	return jsonData
+}
+
+func deribitMethod(method string, channels []string) string {
+	for _, channel := range channels {
+		if strings.HasPrefix(channel, "user.") {
+			return "private/" + method
+		}
+	}
+	return "public/" + method
+}
+
+// deribitPingJson calls public/test, deribit's no-op method, as a heartbeat.
+var deribitPingJson = []byte(`{"jsonrpc":"2.0","id":4,"method":"public/test"}`)
+
+// deribitNormalizeInstrument converts deribit's "ETH-5JUL24-3000-C" (no leading zero on the day) to the aevo style
+// "ETH-05JUL24-3000-C" used as Orderbooks key.
+func deribitNormalizeInstrument(deribitInstrument string) (string, error) {
+	instrument, err := normalizeVenueInstrument("deribit", deribitInstrument)
+	if err != nil {
+		return "", fmt.Errorf("deribitNormalizeInstrument: %v", err)
+	}
+	return instrument, nil
+}
+
+func deribitOrderbookChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		channels = append(channels, "book."+instrument+".none.10.100ms")
+	}
+
+	return channels
+}
+
+func deribitTradeChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		channels = append(channels, "trades."+instrument+".100ms")
+	}
+
+	return channels
+}
+
+func deribitIndexChannels(assets []string) []string {
+	channels := []string{}
+	for _, asset := range assets {
+		channels = append(channels, "deribit_price_index."+strings.ToLower(asset)+"_usd")
+	}
+
+	return channels
+}
+
+type deribitExchange struct{}
+
+func (deribitExchange) Name() string { return "deribit" }
+
+func (deribitExchange) FetchMarkets(assets []string) ([]string, error) {
+	instruments := make([]string, 0)
+	listings := make([]Listing, 0)
+	for _, asset := range assets {
+		markets, err := deribitMarkets(asset)
+		if err != nil {
+			return nil, err
+		}
+		for _, market := range markets {
+			if !market.IsActive {
+				continue
+			}
+			instruments = append(instruments, market.InstrumentName)
+			settlement := "USD"
+			if market.SettlementCurrency == asset {
+				settlement = "coin"
+			}
+			listing, err := newListing("deribit", market.InstrumentName, time.UnixMilli(market.ExpirationTimestamp), settlement)
+			if err == nil {
+				listings = append(listings, listing)
+			}
+		}
+	}
+
+	Matcher.Register("deribit", listings)
+	return instruments, nil
+}
+
+func (deribitExchange) OrderbookChannels(instruments []string) []string {
+	return deribitOrderbookChannels(instruments)
+}
+
+func (deribitExchange) TickerChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		channels = append(channels, "ticker."+instrument+".100ms")
+	}
+	return channels
+}
+
+func (deribitExchange) TradeChannels(instruments []string) []string {
+	return deribitTradeChannels(instruments)
+}
+
+func (deribitExchange) IndexChannels(assets []string) []string {
+	return deribitIndexChannels(assets)
+}
+
+type deribitOrderbook struct {
+	InstrumentName string       `json:"instrument_name"`
+	Bids           [][2]float64 `json:"bids"` //[price, amount], price in the underlying
+	Asks           [][2]float64 `json:"asks"`
+	Timestamp      float64      `json:"timestamp"` //unix milliseconds
+}
+
+type deribitIndexPrice struct {
+	IndexName string  `json:"index_name"` //e.g. "eth_usd"
+	Price     float64 `json:"price"`
+}
+
+// deribitRestOrderbook is the result of /public/get_order_book, which carries the index its prices convert at.
+type deribitRestOrderbook struct {
+	deribitOrderbook
+	IndexPrice float64 `json:"index_price"`
+}
+
+type deribitOrderbookMessage struct {
+	Params struct {
+		Channel string           `json:"channel"`
+		Data    deribitOrderbook `json:"data"`
+	} `json:"params"`
+}
+
+type deribitIndexMessage struct {
+	Params struct {
+		Channel string            `json:"channel"`
+		Data    deribitIndexPrice `json:"data"`
+	} `json:"params"`
+}
+
+// deribitOrders converts levels quoted in the underlying to USD Orders sorted best first. Deribit doesn't publish
+// level IVs on the book channel so Iv is -1.
+func deribitOrders(levels [][2]float64, index float64, descending bool) []Order {
+	orders := make([]Order, len(levels))
+	for i, level := range levels {
+		orders[i] = Order{decimal.FromFloat(level[0] * index), level[1], -1, "deribit"}
+	}
+	sortOrders(orders, descending)
+
+	return orders
+}
+
+func deribitUpdateOrderbooks(data deribitOrderbook) {
+	if len(data.Bids) <= 0 && len(data.Asks) <= 0 {
+		return
+	}
+
+	instrument, err := deribitNormalizeInstrument(data.InstrumentName)
+	if err != nil {
+		slog.Error("deribitUpdateOrderbooks: unexpected instrument", "err", err)
+		return
+	}
+
+	index, exists := DeribitIndex.Get(instrumentAsset(instrument))
+	if !exists { //prices can't be converted to USD until the first index update
+		return
+	}
+
+	bids := deribitOrders(data.Bids, index, true)
+	asks := deribitOrders(data.Asks, index, false)
+
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists {
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[instrument] = orderbook
+	}
+
+	orderbook.Bids["deribit"] = bids
+	orderbook.Asks["deribit"] = asks
+	orderbook.LastUpdated = data.Timestamp
+	markBookUpdated(orderbook, "deribit", time.UnixMilli(int64(data.Timestamp)))
+	applyDepthLimit(orderbook, "deribit")
+	orderbook.UpdateCount++
+	publishBookEvent("deribit", instrument, orderbook.Bids["deribit"], orderbook.Asks["deribit"])
+	if debugEnabled() {
+		slog.Debug("deribitUpdateOrderbooks: book", "instrument", instrument, "bids", orderbook.Bids["deribit"], "asks", orderbook.Asks["deribit"])
+	}
+}
+
+func deribitUpdateIndex(data deribitIndexPrice) {
+	asset, found := strings.CutSuffix(data.IndexName, "_usd")
+	if found && data.Price > 0 {
+		checkIndexMove("deribit", strings.ToUpper(asset), data.Price)
+		DeribitIndex.Set(strings.ToUpper(asset), data.Price)
+		publishIndexEvent("deribit", strings.ToUpper(asset), data.Price)
+	}
+}
+
+var deribitOrderbookMessages = newMessagePool(func(message *deribitOrderbookMessage) {
+	bids, asks := message.Params.Data.Bids[:0], message.Params.Data.Asks[:0]
+	*message = deribitOrderbookMessage{}
+	message.Params.Data.Bids, message.Params.Data.Asks = bids, asks
+})
+
+func deribitDecodeOrderbook(raw []byte) error {
+	message := deribitOrderbookMessages.Get()
+	defer deribitOrderbookMessages.Put(message)
+	err := json.Unmarshal(raw, message)
+	if err != nil {
+		return err
+	}
+	deribitUpdateOrderbooks(message.Params.Data)
+	return nil
+}
+
+func deribitDecodeIndex(raw []byte) error {
+	var message deribitIndexMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	deribitUpdateIndex(message.Params.Data)
+	return nil
+}
+
+func (deribitExchange) FetchOrderbook(instrument string) (OrderbookSnapshot, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["deribit"], func() (*http.Request, error) {
+		return http.NewRequest("GET", DeribitHttp+"/public/get_order_book?instrument_name="+instrument+"&depth=10", nil)
+	})
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Result deribitRestOrderbook `json:"result"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: json decode error: %v", err)
+	}
+	normalized, err := deribitNormalizeInstrument(instrument)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+
+	data := response.Result
+	return OrderbookSnapshot{
+		Instrument:  normalized,
+		Bids:        map[string][]Order{"deribit": deribitOrders(data.Bids, data.IndexPrice, true)},
+		Asks:        map[string][]Order{"deribit": deribitOrders(data.Asks, data.IndexPrice, false)},
+		LastUpdated: data.Timestamp,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"options-ws/aevo"
+)
+
+// PrivateStreamer is an Exchange whose account channels are subscribed on its market data connections once they're
+// logged in, PrivateChannels is empty without credentials. Every connection logs in afresh, replacements after a drop
+// or rotation before their subscriptions are replayed, and a private subscription rejected because it beat the login
+// is resubscribed like any unconfirmed channel.
+type PrivateStreamer interface {
+	PrivateChannels() []string
+	AuthJson() []byte //signed anew for every connection
+	CancelOnDisconnectJson(enabled bool) []byte
+}
+
+type DeribitCredentials struct {
+	ClientId     string
+	ClientSecret string
+}
+
+var DeribitAccount *DeribitCredentials //nil disables the account feed
+
+// deribitCredentialsFromEnv reads DERIBIT_CLIENT_ID / DERIBIT_CLIENT_SECRET, ok is false unless both are set.
+func deribitCredentialsFromEnv() (DeribitCredentials, bool) {
+	credentials := DeribitCredentials{os.Getenv("DERIBIT_CLIENT_ID"), os.Getenv("DERIBIT_CLIENT_SECRET")}
+	return credentials, credentials.ClientId != "" && credentials.ClientSecret != ""
+}
+
+const deribitAuthId = 6 //public/auth's request id, observeAck reports the login's outcome by it
+
+// deribitAuthJson signs timestamp, nonce and an empty data string with the client secret (grant_type
+// client_signature), so the secret itself never goes over the wire.
+func deribitAuthJson(credentials DeribitCredentials, now time.Time) []byte {
+	var raw [8]byte
+	rand.Read(raw[:])
+	nonce := hex.EncodeToString(raw[:])
+	timestamp := now.UnixMilli()
+
+	mac := hmac.New(sha256.New, []byte(credentials.ClientSecret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n"))
+
+	type params struct {
+		GrantType string `json:"grant_type"`
+		ClientId  string `json:"client_id"`
+		Timestamp int64  `json:"timestamp"`
+		Signature string `json:"signature"`
+		Nonce     string `json:"nonce"`
+		Data      string `json:"data"`
+	}
+	data := struct {
+		JsonRpc string `json:"jsonrpc"`
+		Id      int    `json:"id"`
+		Method  string `json:"method"`
+		Params  params `json:"params"`
+	}{"2.0", deribitAuthId, "public/auth", params{"client_signature", credentials.ClientId, timestamp, hex.EncodeToString(mac.Sum(nil)), nonce, ""}}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings and ints always marshals
+	return jsonData
+}
+
+func (deribitExchange) PrivateChannels() []string {
+	if DeribitAccount == nil {
+		return nil
+	}
+	return []string{"user.changes.option.any.raw"}
+}
+
+func (deribitExchange) AuthJson() []byte {
+	return deribitAuthJson(*DeribitAccount, time.Now())
+}
+
+// CancelOnDisconnectJson enables (or disables) cancel on disconnect for the connection it's sent on, deribit cancels
+// the account's orders once it drops.
+func (deribitExchange) CancelOnDisconnectJson(enabled bool) []byte {
+	if enabled {
+		return []byte(`{"jsonrpc":"2.0","id":7,"method":"private/enable_cancel_on_disconnect","params":{"scope":"connection"}}`)
+	}
+	return []byte(`{"jsonrpc":"2.0","id":8,"method":"private/disable_cancel_on_disconnect","params":{"scope":"connection"}}`)
+}
+
+type deribitUserTrade struct {
+	TradeId        string  `json:"trade_id"`
+	OrderId        string  `json:"order_id"`
+	InstrumentName string  `json:"instrument_name"`
+	Direction      string  `json:"direction"`
+	Price          float64 `json:"price"` //in the underlying
+	Amount         float64 `json:"amount"`
+	Fee            float64 `json:"fee"`
+	IndexPrice     float64 `json:"index_price"`
+	Timestamp      int64   `json:"timestamp"` //unix milliseconds
+}
+
+type deribitUserOrder struct {
+	OrderId        string          `json:"order_id"`
+	InstrumentName string          `json:"instrument_name"`
+	Direction      string          `json:"direction"`
+	Price          json.RawMessage `json:"price"` //"market_price" for market orders
+	Amount         float64         `json:"amount"`
+	FilledAmount   float64         `json:"filled_amount"`
+	OrderState     string          `json:"order_state"`
+}
+
+type deribitPosition struct {
+	InstrumentName string  `json:"instrument_name"`
+	Size           float64 `json:"size"` //signed, negative is short
+	AveragePrice   float64 `json:"average_price"`
+	MarkPrice      float64 `json:"mark_price"`
+	IndexPrice     float64 `json:"index_price"`
+	Delta          float64 `json:"delta"` //of the whole position
+	Gamma          float64 `json:"gamma"`
+	Vega           float64 `json:"vega"`
+	Theta          float64 `json:"theta"`
+}
+
+type deribitChangesMessage struct {
+	Params struct {
+		Channel string `json:"channel"`
+		Data    struct {
+			Trades    []deribitUserTrade `json:"trades"`
+			Orders    []deribitUserOrder `json:"orders"`
+			Positions []deribitPosition  `json:"positions"`
+		} `json:"data"`
+	} `json:"params"`
+}
+
+// deribitDecodeChanges applies a user.changes message, the account's trades, orders and positions, to the portfolio.
+// Positions are known once they change.
+func deribitDecodeChanges(raw []byte) error {
+	var message deribitChangesMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	data := message.Params.Data
+
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+	for _, trade := range data.Trades {
+		deribitRecordFill(trade)
+	}
+	deribitUpdateOrders(data.Orders)
+	deribitUpdatePositions(data.Positions)
+	Portfolio.Streamed = time.Now()
+	return nil
+}
+
+// deribitRecordFill records a fill, its position comes with the same message. The caller holds Portfolio.Mu.
+func deribitRecordFill(trade deribitUserTrade) {
+	instrument, err := deribitNormalizeInstrument(trade.InstrumentName)
+	if err != nil {
+		slog.Error("deribitRecordFill: unexpected instrument", "err", err)
+		return
+	}
+	slog.Info("deribitRecordFill: fill", "instrument", instrument, "side", trade.Direction, "amount", trade.Amount, "price", trade.Price*trade.IndexPrice)
+
+	Portfolio.Fills = append(Portfolio.Fills, Fill{"deribit", trade.TradeId, trade.OrderId, instrument, trade.Direction, trade.Price * trade.IndexPrice,
+		trade.Amount, trade.Fee * trade.IndexPrice, time.UnixMilli(trade.Timestamp)})
+	if len(Portfolio.Fills) > maxFills {
+		Portfolio.Fills = Portfolio.Fills[len(Portfolio.Fills)-maxFills:]
+	}
+}
+
+// deribitUpdateOrders adds or updates orders, dropping the ones no longer open. The caller holds Portfolio.Mu.
+func deribitUpdateOrders(orders []deribitUserOrder) {
+	for _, o := range orders {
+		key := "deribit " + o.OrderId
+		if o.OrderState != "open" && o.OrderState != "untriggered" {
+			delete(Portfolio.Orders, key)
+			continue
+		}
+		instrument, err := deribitNormalizeInstrument(o.InstrumentName)
+		if err != nil {
+			slog.Error("deribitUpdateOrders: unexpected instrument", "err", err)
+			continue
+		}
+		price, _ := strconv.ParseFloat(string(o.Price), 64)
+		index, _ := DeribitIndex.Get(instrumentAsset(instrument))
+		Portfolio.Orders[key] = OpenOrder{"deribit", o.OrderId, instrument, o.Direction, price * index, o.Amount, o.FilledAmount}
+	}
+}
+
+// deribitUpdatePositions replaces the changed positions, closed ones are dropped. The caller holds Portfolio.Mu.
+func deribitUpdatePositions(positions []deribitPosition) {
+	for _, p := range positions {
+		instrument, err := deribitNormalizeInstrument(p.InstrumentName)
+		if err != nil {
+			slog.Error("deribitUpdatePositions: unexpected instrument", "err", err)
+			continue
+		}
+		key := "deribit " + instrument
+		if p.Size == 0 {
+			delete(Portfolio.Positions, key)
+			continue
+		}
+		greeks := aevo.Greeks{Delta: p.Delta / p.Size, Gamma: p.Gamma / p.Size, Vega: p.Vega / p.Size, Theta: p.Theta / p.Size}
+		Portfolio.Positions[key] = &Position{"deribit", instrument, p.Size, p.AveragePrice * p.IndexPrice, p.MarkPrice * p.IndexPrice, greeks}
+	}
+}
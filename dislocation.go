@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+)
+
+type MarkPrice struct {
+	Price   float64
+	Updated time.Time
+}
+
+type MarksContainer struct {
+	Mu    sync.RWMutex
+	Marks map[string]MarkPrice //key: instrument
+}
+
+// AevoMarks holds aevo mark prices from the ticker feed, seeded and refreshed by the markets endpoint.
+var AevoMarks = MarksContainer{Marks: make(map[string]MarkPrice)}
+
+type Dislocation struct {
+	Instrument string
+	Kind       string //"above ask", "below bid", "far from mid" or "far from model"
+	Mark       float64
+	Bid        float64 //aevo best bid, 0 if none
+	Ask        float64 //aevo best ask, 0 if none
+	Mid        float64 //cross exchange mid, 0 if not two sided
+	Model      float64 //Black-Scholes value at the fitted IV surface, 0 without a fit
+	Deviation  float64 //percent of mark vs the violated reference
+	FirstSeen  time.Time
+}
+
+type DislocationsContainer struct {
+	Mu           sync.Mutex
+	Dislocations map[string]*Dislocation //key: instrument
+}
+
+var DislocationContainer = DislocationsContainer{Dislocations: make(map[string]*Dislocation)}
+
+var MarkDeviation float64 = 10             //percent from cross exchange mid before a mark is flagged
+var ModelDeviation float64 = 20            //percent from the model value before a mark is flagged, 0 disables
+var MarkMaxAge time.Duration = time.Minute //marks not updated for this long aren't checked
+
+func aevoUpdateMarks(markets []aevo.Market) {
+	AevoMarks.Mu.Lock()
+	defer AevoMarks.Mu.Unlock()
+
+	now := time.Now()
+	for _, market := range markets {
+		if market.MarkPrice > 0 {
+			AevoMarks.Marks[market.InstrumentName] = MarkPrice{market.MarkPrice, now}
+		}
+	}
+}
+
+// aevoUpdateMark records an option's mark from its ticker, updated is the ticker's timestamp.
+func aevoUpdateMark(instrument string, mark float64, updated time.Time) {
+	if mark <= 0 {
+		return
+	}
+	AevoMarks.Mu.Lock()
+	defer AevoMarks.Mu.Unlock()
+	if updated.After(AevoMarks.Marks[instrument].Updated) {
+		AevoMarks.Marks[instrument] = MarkPrice{mark, updated}
+	}
+}
+
+// modelValue prices instrument with Black-Scholes at the surface's fitted IV, 0 if it isn't fitted there.
+func modelValue(instrument string, surface *IvSurface, now time.Time) float64 {
+	option, err := parseInstrument(instrument)
+	if err != nil || surface == nil {
+		return 0
+	}
+	years := yearsUntil(option.Expiry, now)
+	iv, ok := surface.Iv(option.Strike, years)
+	if !ok || iv <= 0 {
+		return 0
+	}
+	return blackScholes(option.Type, surface.Spot, option.Strike, years, iv/100, 0).Price
+}
+
+// findDislocation checks a mark against the aevo top of book (a mark outside it is likely stale, and margin and
+// liquidations are computed from it), against the cross exchange mid (a quoting opportunity if the book is wide) and
+// against our model value, 0 if there's none.
+func findDislocation(instrument string, mark float64, model float64, orderbook *OrderbookData) *Dislocation {
+	d := &Dislocation{Instrument: instrument, Mark: mark, Model: model}
+	if bids := orderbook.Bids["aevo"]; len(bids) > 0 {
+		d.Bid = bids[0].Price.Float64()
+	}
+	if asks := orderbook.Asks["aevo"]; len(asks) > 0 {
+		d.Ask = asks[0].Price.Float64()
+	}
+
+	bestBid, bestAsk := 0.0, math.Inf(1)
+	for _, bids := range orderbook.Bids {
+		if len(bids) > 0 {
+			bestBid = math.Max(bestBid, bids[0].Price.Float64())
+		}
+	}
+	for _, asks := range orderbook.Asks {
+		if len(asks) > 0 {
+			bestAsk = math.Min(bestAsk, asks[0].Price.Float64())
+		}
+	}
+	if bestBid > 0 && !math.IsInf(bestAsk, 1) {
+		d.Mid = (bestBid + bestAsk) / 2
+	}
+
+	switch {
+	case d.Ask > 0 && mark > d.Ask:
+		d.Kind = "above ask"
+		d.Deviation = (mark - d.Ask) / d.Ask * 100
+	case d.Bid > 0 && mark < d.Bid:
+		d.Kind = "below bid"
+		d.Deviation = (mark - d.Bid) / d.Bid * 100
+	case d.Mid > 0 && math.Abs(mark-d.Mid)/d.Mid*100 > MarkDeviation:
+		d.Kind = "far from mid"
+		d.Deviation = (mark - d.Mid) / d.Mid * 100
+	case ModelDeviation > 0 && model > 0 && math.Abs(mark-model)/model*100 > ModelDeviation:
+		d.Kind = "far from model"
+		d.Deviation = (mark - model) / model * 100
+	default:
+		return nil
+	}
+
+	return d
+}
+
+func scanDislocations(now time.Time) {
+	AevoMarks.Mu.RLock()
+	marks := make(map[string]float64, len(AevoMarks.Marks))
+	for instrument, mark := range AevoMarks.Marks {
+		if now.Sub(mark.Updated) <= MarkMaxAge {
+			marks[instrument] = mark.Price
+		}
+	}
+	AevoMarks.Mu.RUnlock()
+
+	surfaces := make(map[string]*IvSurface) //nil when the asset's can't be built
+	for instrument := range marks {
+		asset := instrumentAsset(instrument)
+		if _, exists := surfaces[asset]; !exists {
+			surfaces[asset], _ = buildSurface(asset, now)
+		}
+	}
+
+	found := make(map[string]*Dislocation)
+	OrderbookContainer.Mu.RLock()
+	for instrument, mark := range marks {
+		orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+		if !exists || quarantined(instrument, ArbClock()) {
+			continue
+		}
+		model := modelValue(instrument, surfaces[instrumentAsset(instrument)], now)
+		if d := findDislocation(instrument, mark, model, orderbook); d != nil {
+			found[instrument] = d
+		}
+	}
+	OrderbookContainer.Mu.RUnlock()
+
+	DislocationContainer.Mu.Lock()
+	defer DislocationContainer.Mu.Unlock()
+	for instrument, d := range found {
+		previous, exists := DislocationContainer.Dislocations[instrument]
+		if exists && previous.Kind == d.Kind {
+			d.FirstSeen = previous.FirstSeen
+		} else {
+			d.FirstSeen = now
+			slog.Warn("scanDislocations: mark dislocated", "instrument", instrument, "mark", d.Mark, "kind", d.Kind, "bid", d.Bid, "ask", d.Ask, "mid", d.Mid, "model", d.Model, "deviation_pct", d.Deviation)
+		}
+	}
+	DislocationContainer.Dislocations = found
+}
+
+func dislocationLoop(interval time.Duration) {
+	for {
+		scanDislocations(time.Now())
+		time.Sleep(interval)
+	}
+}
+
+func dislocationsHandler(w http.ResponseWriter, r *http.Request) {
+	DislocationContainer.Mu.Lock()
+	dislocations := make([]Dislocation, 0, len(DislocationContainer.Dislocations))
+	for _, d := range DislocationContainer.Dislocations {
+		dislocations = append(dislocations, *d)
+	}
+	DislocationContainer.Mu.Unlock()
+	sort.Slice(dislocations, func(i, j int) bool {
+		return math.Abs(dislocations[i].Deviation) > math.Abs(dislocations[j].Deviation)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(dislocations)
+	if err != nil {
+		slog.Error("dislocationsHandler: json encode error", "err", err)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// scanExpr is a compiled scan expression, an instrument matches when it's non zero.
+type scanExpr func(vars map[string]float64) float64
+
+var scanVariableDocs = map[string]string{
+	"expiry":     "days to expiry",
+	"strike":     "strike",
+	"call":       "1 for calls, 0 for puts",
+	"put":        "1 for puts, 0 for calls",
+	"delta":      "exchange delta",
+	"gamma":      "exchange gamma",
+	"theta":      "exchange theta",
+	"vega":       "exchange vega",
+	"iv":         "exchange mark iv, vol points",
+	"fitted_iv":  "iv of the fitted surface at the strike and expiry, vol points (exchange mark iv where there's no fit)",
+	"iv_bid":     "iv of the best aevo bid, vol points",
+	"iv_ask":     "iv of the best aevo ask, vol points",
+	"rv":         "24h index realized vol, vol points",
+	"iv_rv":      "iv - rv",
+	"theta_vega": "|theta| / vega",
+	"bid":        "best aevo bid",
+	"ask":        "best aevo ask",
+	"spread":     "aevo spread, percent of mid",
+	"oi":         "open interest",
+	"oi_change":  "open interest change since UTC midnight",
+	"index":      "aevo index",
+}
+
+func scanVariables(row ScreenerRow, index float64, fittedIv float64) map[string]float64 {
+	call, put := 0.0, 1.0
+	if row.OptionType == "C" {
+		call, put = 1, 0
+	}
+
+	return map[string]float64{
+		"expiry":     row.Days,
+		"strike":     row.Strike,
+		"call":       call,
+		"put":        put,
+		"delta":      row.Delta,
+		"gamma":      row.Gamma,
+		"theta":      row.Theta,
+		"vega":       row.Vega,
+		"iv":         row.Iv,
+		"fitted_iv":  fittedIv,
+		"iv_bid":     row.IvBid,
+		"iv_ask":     row.IvAsk,
+		"rv":         row.RealizedVol,
+		"iv_rv":      row.IvRvSpread,
+		"theta_vega": row.ThetaVega,
+		"bid":        row.Bid,
+		"ask":        row.Ask,
+		"spread":     row.SpreadPct,
+		"oi":         row.OpenInterest,
+		"oi_change":  row.OiChangeDay,
+		"index":      index,
+	}
+}
+
+type scanToken struct {
+	Kind  string //"num", "ident", "op", "eof"
+	Text  string
+	Value float64
+	Pos   int
+}
+
+func lexScan(src string) ([]scanToken, error) {
+	tokens := make([]scanToken, 0)
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			value, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at %v: %v", start, src[start:i])
+			}
+			if i < len(src) && (src[i] == 'd' || src[i] == 'h') {
+				if src[i] == 'h' {
+					value /= 24
+				}
+				i++
+			}
+			tokens = append(tokens, scanToken{"num", src[start:i], value, start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, scanToken{"ident", src[start:i], 0, start})
+		default:
+			op := src[i : i+1]
+			if i+1 < len(src) {
+				if two := src[i : i+2]; two == "&&" || two == "||" || two == "<=" || two == ">=" || two == "==" || two == "!=" {
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/<>()|!&&||<=>===!=", op) {
+				return nil, fmt.Errorf("unexpected character at %v: %q", i, op)
+			}
+			tokens = append(tokens, scanToken{"op", op, 0, i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, scanToken{"eof", "", 0, len(src)}), nil
+}
+
+type scanParser struct {
+	tokens []scanToken
+	pos    int
+}
+
+func (p *scanParser) peek() scanToken { return p.tokens[p.pos] }
+
+func (p *scanParser) next() scanToken {
+	t := p.tokens[p.pos]
+	if t.Kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+var scanPrecedence = map[string]int{"||": 1, "&&": 2, "==": 3, "!=": 3, "<": 4, "<=": 4, ">": 4, ">=": 4, "+": 5, "-": 5, "*": 6, "/": 6}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func binaryScanExpr(op string, left scanExpr, right scanExpr) scanExpr {
+	switch op {
+	case "||":
+		return func(v map[string]float64) float64 { return boolValue(left(v) != 0 || right(v) != 0) }
+	case "&&":
+		return func(v map[string]float64) float64 { return boolValue(left(v) != 0 && right(v) != 0) }
+	case "==":
+		return func(v map[string]float64) float64 { return boolValue(left(v) == right(v)) }
+	case "!=":
+		return func(v map[string]float64) float64 { return boolValue(left(v) != right(v)) }
+	case "<":
+		return func(v map[string]float64) float64 { return boolValue(left(v) < right(v)) }
+	case "<=":
+		return func(v map[string]float64) float64 { return boolValue(left(v) <= right(v)) }
+	case ">":
+		return func(v map[string]float64) float64 { return boolValue(left(v) > right(v)) }
+	case ">=":
+		return func(v map[string]float64) float64 { return boolValue(left(v) >= right(v)) }
+	case "+":
+		return func(v map[string]float64) float64 { return left(v) + right(v) }
+	case "-":
+		return func(v map[string]float64) float64 { return left(v) - right(v) }
+	case "*":
+		return func(v map[string]float64) float64 { return left(v) * right(v) }
+	default:
+		return func(v map[string]float64) float64 { return left(v) / right(v) }
+	}
+}
+
+// parseExpr is precedence climbing over the binary operators. Inside |...| a "|" closes the abs rather than
+// starting "||", so abs bodies are parsed with inAbs set to stop there.
+func (p *scanParser) parseExpr(minPrecedence int, inAbs bool) (scanExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		precedence, isBinary := scanPrecedence[t.Text]
+		if t.Kind != "op" || !isBinary || precedence < minPrecedence || (inAbs && t.Text == "|") {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseExpr(precedence+1, inAbs)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryScanExpr(t.Text, left, right)
+	}
+}
+
+func (p *scanParser) parseUnary() (scanExpr, error) {
+	t := p.next()
+	switch {
+	case t.Kind == "num":
+		value := t.Value
+		return func(map[string]float64) float64 { return value }, nil
+	case t.Kind == "ident":
+		if _, known := scanVariableDocs[t.Text]; !known {
+			return nil, fmt.Errorf("unknown variable at %v: %v", t.Pos, t.Text)
+		}
+		name := t.Text
+		return func(v map[string]float64) float64 { return v[name] }, nil
+	case t.Text == "-":
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v map[string]float64) float64 { return -inner(v) }, nil
+	case t.Text == "!":
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v map[string]float64) float64 { return boolValue(inner(v) == 0) }, nil
+	case t.Text == "(":
+		inner, err := p.parseExpr(1, false)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.Text != ")" {
+			return nil, fmt.Errorf("expected ) at %v", closing.Pos)
+		}
+		return inner, nil
+	case t.Text == "|":
+		inner, err := p.parseExpr(1, true)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.Text != "|" {
+			return nil, fmt.Errorf("expected | at %v", closing.Pos)
+		}
+		return func(v map[string]float64) float64 { return math.Abs(inner(v)) }, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q at %v", t.Text, t.Pos)
+}
+
+// compileScan compiles an expression over scanVariables, e.g. "expiry < 14d && |delta| < 0.3 && iv_bid > fitted_iv
+// + 5". A d or h suffix converts a number to days, comparisons and logic operators yield 1 or 0.
+func compileScan(src string) (scanExpr, error) {
+	tokens, err := lexScan(src)
+	if err != nil {
+		return nil, fmt.Errorf("compileScan: %v", err)
+	}
+
+	p := &scanParser{tokens: tokens}
+	expr, err := p.parseExpr(1, false)
+	if err != nil {
+		return nil, fmt.Errorf("compileScan: %v", err)
+	}
+	if t := p.peek(); t.Kind != "eof" {
+		return nil, fmt.Errorf("compileScan: unexpected %q at %v", t.Text, t.Pos)
+	}
+
+	return expr, nil
+}
+
+type Scan struct {
+	Name   string
+	Source string
+	expr   scanExpr
+}
+
+type ScansContainer struct {
+	Mu    sync.Mutex
+	Scans []Scan
+}
+
+var Scans = ScansContainer{}
+
+// loadScans reads "name: expression" lines, blank lines and lines starting with # are skipped.
+func loadScans(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("loadScans: open error: %v", err)
+	}
+	defer file.Close()
+
+	scans := make([]Scan, 0)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, source, found := strings.Cut(text, ":")
+		if !found {
+			return fmt.Errorf("loadScans: line %v: expected name: expression", line)
+		}
+		expr, err := compileScan(strings.TrimSpace(source))
+		if err != nil {
+			return fmt.Errorf("loadScans: line %v: %v", line, err)
+		}
+		scans = append(scans, Scan{strings.TrimSpace(name), strings.TrimSpace(source), expr})
+	}
+
+	Scans.Mu.Lock()
+	Scans.Scans = scans
+	Scans.Mu.Unlock()
+
+	return scanner.Err()
+}
+
+func runScan(expr scanExpr) []ScreenerRow {
+	now := time.Now()
+	matched := make([]ScreenerRow, 0)
+	surfaces := make(map[string]*IvSurface) //nil when the asset's can't be built
+	for _, row := range screenerRows(now) {
+		asset := instrumentAsset(row.Instrument)
+		index, _ := AevoIndex.Get(asset)
+		if _, exists := surfaces[asset]; !exists {
+			surfaces[asset], _ = buildSurface(asset, now)
+		}
+		fittedIv := row.Iv
+		if surface := surfaces[asset]; surface != nil {
+			if iv, ok := surface.Iv(row.Strike, row.Days/365); ok {
+				fittedIv = iv
+			}
+		}
+		if expr(scanVariables(row, index, fittedIv)) != 0 {
+			matched = append(matched, row)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Instrument < matched[j].Instrument })
+
+	return matched
+}
+
+type scanResult struct {
+	Name    string
+	Source  string
+	Matches []ScreenerRow
+}
+
+// scansHandler serves /api/scans: ?q=<expression> runs an ad hoc scan, ?name=<scan> one configured scan, and without
+// parameters every configured scan. ?vars lists the available variables.
+func scansHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	results := make([]scanResult, 0)
+
+	switch {
+	case query.Has("vars"):
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scanVariableDocs)
+		return
+	case query.Get("q") != "":
+		expr, err := compileScan(query.Get("q"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results = append(results, scanResult{"", query.Get("q"), runScan(expr)})
+	default:
+		Scans.Mu.Lock()
+		scans := append([]Scan(nil), Scans.Scans...)
+		Scans.Mu.Unlock()
+		for _, scan := range scans {
+			if name := query.Get("name"); name == "" || name == scan.Name {
+				results = append(results, scanResult{scan.Name, scan.Source, runScan(scan.expr)})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(results)
+	if err != nil {
+		slog.Error("scansHandler: json encode error", "err", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+var EventQueueSize = 4096 //events buffered per internal subscriber
+
+type BookEvent struct {
+	Exchange   string
+	Instrument string
+	Bids       []Order //the exchange's side after the update, best first
+	Asks       []Order
+	Time       time.Time
+}
+
+type IndexEvent struct {
+	Exchange string
+	Asset    string
+	Price    float64
+	Time     time.Time
+}
+
+// OpportunityEvent is an opportunity found or changed by an arb pass, Table zero when it Closed.
+type OpportunityEvent struct {
+	Key    string
+	Table  ArbTable
+	Closed bool
+	Time   time.Time
+}
+
+// The event bus's topics, decoders publish every book side and index price they apply, the arb pass the opportunities
+// it finds, changes or closes. Each subscriber takes what its filter selects through a bounded queue that drops what it
+// can't keep up with, publishing is skipped while a topic has none. The order book store isn't a subscriber, the
+// decoders apply deltas to it directly since sequence and checksum checks need the book as of the last update.
+var BookEvents feedTopic[BookEvent]
+var IndexEvents feedTopic[IndexEvent]
+var OpportunityEvents feedTopic[OpportunityEvent]
+
+// BookChanges carries the instrument of every book update, a wake-up for subscribers like the arb pass that read the
+// store rather than the levels and so don't need them copied.
+var BookChanges feedTopic[string]
+
+// publishBookEvent publishes an exchange's side of an instrument's book after an update, its levels copied for
+// BookEvents since the stored ones change with the next.
+func publishBookEvent(exchange string, instrument string, bids []Order, asks []Order) {
+	if BookChanges.Active() {
+		BookChanges.Publish(instrument)
+	}
+	if !BookEvents.Active() {
+		return
+	}
+	BookEvents.Publish(BookEvent{exchange, instrument, slices.Clone(bids), slices.Clone(asks), time.Now()})
+}
+
+func publishIndexEvent(exchange string, asset string, price float64) {
+	if !IndexEvents.Active() {
+		return
+	}
+	IndexEvents.Publish(IndexEvent{exchange, asset, price, time.Now()})
+}
+
+// publishOpportunity publishes a new or changed opportunity, the arb pass calls it on changes and not every pass.
+func publishOpportunity(key string, table *ArbTable) {
+	if !OpportunityEvents.Active() {
+		return
+	}
+	event := OpportunityEvent{Key: key, Table: *table, Time: time.Now()}
+	event.Table.Bids, event.Table.Asks = slices.Clone(table.Bids), slices.Clone(table.Asks)
+	OpportunityEvents.Publish(event)
+}
+
+func publishOpportunityClosed(key string) {
+	if !OpportunityEvents.Active() {
+		return
+	}
+	OpportunityEvents.Publish(OpportunityEvent{Key: key, Closed: true, Time: time.Now()})
+}
+
+// subscribeAll subscribes to every event of topic with an EventQueueSize queue.
+func subscribeAll[T any](topic *feedTopic[T]) *feedSubscriber[T] {
+	return topic.SubscribeQueue(func(T) bool { return true }, EventQueueSize)
+}
+
+// bookEventsHandler streams an instrument's book updates, ?instrument= and optionally ?exchange=, as server-sent
+// "orderbook" events until the client goes away.
+func bookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	instrument, exchange := r.URL.Query().Get("instrument"), r.URL.Query().Get("exchange")
+	if instrument == "" {
+		http.Error(w, "no instrument given", http.StatusBadRequest)
+		return
+	}
+	subscriber := BookEvents.SubscribeQueue(func(event BookEvent) bool {
+		return event.Instrument == instrument && (exchange == "" || event.Exchange == exchange)
+	}, EventQueueSize)
+	defer BookEvents.Unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-subscriber.updates:
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Error("bookEventsHandler: json encode error", "err", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: orderbook\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"options-ws/ratelimit"
+)
+
+// Exchange is an options venue whose books are fed into the shared store. Each exchange keeps its own side of an
+// instrument's orderbook (OrderbookData.Bids/Asks keyed by exchange name), instruments are normalized to the aevo style
+// "ETH-28JUN24-3000-C" so books of the same option line up across exchanges.
+type Exchange interface {
+	Name() string
+	// FetchMarkets returns the exchange's live option instruments (in its own naming) of assets, updating any market
+	// data the exchange keeps on the side, e.g. order limits and marks.
+	FetchMarkets(assets []string) ([]string, error)
+	OrderbookChannels(instruments []string) []string
+	IndexChannels(assets []string) []string
+}
+
+// BookFetcher is an Exchange with a REST orderbook endpoint, FetchOrderbook takes an instrument in the exchange's
+// naming and returns the book under the normalized name.
+type BookFetcher interface {
+	FetchOrderbook(instrument string) (OrderbookSnapshot, error)
+}
+
+// VenueLimiters pace each exchange's REST requests and subscription messages together, key: exchange. Exchanges
+// without one aren't limited.
+var VenueLimiters = make(map[string]*ratelimit.Limiter)
+
+var MarketsRefresh = 10 * time.Minute //interval exchangeReqLoop refetches the listed instruments at
+
+// diffChannels returns the channels of current that weren't in previous and those of previous no longer in current.
+func diffChannels(previous map[string]bool, current []string) (map[string]bool, []string, []string) {
+	next := make(map[string]bool, len(current))
+	added := make([]string, 0)
+	for _, channel := range current {
+		next[channel] = true
+		if !previous[channel] {
+			added = append(added, channel)
+		}
+	}
+	removed := make([]string, 0)
+	for channel := range previous {
+		if !next[channel] {
+			removed = append(removed, channel)
+		}
+	}
+	return next, added, removed
+}
+
+// exchangeReqLoop refetches an exchange's markets every MarketsRefresh, and as soon as an asset is added or removed,
+// subscribing the books of newly listed instruments and the index of new assets and unsubscribing those that expired,
+// were delisted or whose asset was removed. Subscriptions already sent are skipped by WssConn. Instruments outside the
+// strike and expiry filters are left out, the lists are rebuilt when strikeFilterLoop signals the index moved, and
+// instruments added or dropped at runtime are kept in or left out, see overrides.go.
+func exchangeReqLoop(exchange Exchange, c *ShardedConn) {
+	orderbooks, indexes := make(map[string]bool), make(map[string]bool)
+	for {
+		changed := assetsChangedSignal()
+		refilter := strikeFilterSignal()
+		overridden := SubscriptionOverrides.Signal()
+		assets := currentAssets()
+		instruments, err := exchange.FetchMarkets(assets)
+		if err != nil { //a network blip shouldn't take the process down, retry sooner than the usual refresh
+			slog.Error("exchangeReqLoop: request failed", "exchange", exchange.Name(), "err", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+
+		fetched := len(instruments)
+		instruments = applySubscriptionOverrides(exchange.Name(), instruments, filterInstruments(exchange.Name(), instruments, time.Now()))
+
+		var listed, delisted []string
+		booked, ticked := splitTickerInstruments(exchange, instruments)
+		channels := exchange.OrderbookChannels(booked)
+		if len(ticked) > 0 {
+			channels = append(channels, exchange.(TickerStreamer).TickerChannels(ticked)...) //unsubscribed with the books
+		}
+		if streamer, ok := exchange.(TradeStreamer); ok && SubscribeTrades {
+			channels = append(channels, streamer.TradeChannels(instruments)...)
+		}
+		orderbooks, listed, delisted = diffChannels(orderbooks, channels)
+		RestFallback.Register(exchange, booked)
+		slog.Info("exchangeReqLoop: fetched markets", "exchange", exchange.Name(), "instruments", fetched, "filtered", fetched-len(instruments), "listed", len(listed), "delisted", len(delisted))
+		err = c.Subscribe(channels) //all of them, sends ones whose subscription failed before as well
+		if err != nil {
+			slog.Error("exchangeReqLoop: subscribe failed", "exchange", exchange.Name(), "err", err) //subscriptions are replayed when the connection is replaced
+		}
+		err = c.Unsubscribe(delisted)
+		if err != nil {
+			slog.Error("exchangeReqLoop: unsubscribe failed", "exchange", exchange.Name(), "err", err)
+		}
+		if len(listed) > 0 || len(delisted) > 0 {
+			c.logShards()
+		}
+
+		var removed []string
+		channels = exchange.IndexChannels(assets)
+		indexes, _, removed = diffChannels(indexes, channels)
+		err = c.Subscribe(channels)
+		if err != nil {
+			slog.Error("exchangeReqLoop: request failed", "exchange", exchange.Name(), "err", err)
+		}
+		err = c.Unsubscribe(removed)
+		if err != nil {
+			slog.Error("exchangeReqLoop: unsubscribe failed", "exchange", exchange.Name(), "err", err)
+		}
+
+		select {
+		case <-time.After(MarketsRefresh):
+		case <-changed:
+		case <-refilter:
+		case <-overridden:
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+)
+
+var LegPolicy = "hedge"
+var LegTimeout = 5 * time.Second
+var ChaseAttempts = 2
+var HedgeSlippage = 0.005 //perpetual limit prices away from its mark, to cross the spread
+
+// LegPolicies handle legs filling different amounts: "chase" reprices the lagging legs at their best level, up to
+// ChaseAttempts times, "unwind" closes what the leading legs filled beyond the least filled one and "hedge" offsets
+// the fills' net delta with the perpetual.
+var LegPolicies = []string{"chase", "hedge", "unwind"}
+
+type ExecutionOrder struct {
+	Leg          int     `json:"leg"`     //index into Execution.Legs, -1 for a hedge
+	Purpose      string  `json:"purpose"` //"entry", "chase", "unwind" or "hedge"
+	Instrument   string  `json:"instrument"`
+	Side         string  `json:"side"`
+	Amount       float64 `json:"amount"`
+	Limit        float64 `json:"limit_price"`
+	OrderId      string  `json:"order_id,omitempty"`
+	Filled       float64 `json:"filled"`
+	Error        string  `json:"error,omitempty"`
+	instrumentId int64   //0 looks the option up
+}
+
+type ExecutionLeg struct {
+	Instrument   string  `json:"instrument"`
+	Side         string  `json:"side"`
+	Amount       float64 `json:"amount"`
+	Filled       float64 `json:"filled"` //entry and chase fills less unwind fills
+	instrumentId int64
+}
+
+type Execution struct {
+	Id        int              `json:"id"`
+	Key       string           `json:"key"`
+	Strategy  string           `json:"strategy"`
+	Policy    string           `json:"policy"`
+	Started   time.Time        `json:"started"`
+	Finished  time.Time        `json:"finished"` //zero while running
+	Legs      []ExecutionLeg   `json:"legs"`
+	Orders    []ExecutionOrder `json:"orders"`
+	LegRisk   float64          `json:"leg_risk"`  //contracts the most filled leg was ahead of the least after the entry orders
+	LegDelta  float64          `json:"leg_delta"` //net delta of the entry fills
+	Matched   float64          `json:"matched"`   //contracts filled on every leg after the policy
+	Unmatched float64          `json:"unmatched"` //LegRisk after the policy
+	Residual  float64          `json:"residual"`  //net delta of every fill after the policy
+	Error     string           `json:"error,omitempty"`
+}
+
+type ExecutionsContainer struct {
+	Mu         sync.Mutex
+	Executions []*Execution           //latest last, at most maxExecutions
+	running    map[string]bool        //keys being executed
+	perpetuals map[string]aevo.Market //key: asset
+	nextId     int
+}
+
+const maxExecutions = 100
+
+var Executions = ExecutionsContainer{running: make(map[string]bool), perpetuals: make(map[string]aevo.Market)}
+
+// aevoPerpetual is asset's perpetual market, fetched once and its steps added to InstrumentLimitsContainer.
+func aevoPerpetual(asset string) (aevo.Market, error) {
+	Executions.Mu.Lock()
+	market, exists := Executions.perpetuals[asset]
+	Executions.Mu.Unlock()
+	if exists {
+		return market, nil
+	}
+
+	market, err := AevoClient.Perpetual(asset)
+	if err != nil {
+		return market, fmt.Errorf("aevoPerpetual: %v", err)
+	}
+	aevoUpdateLimits([]aevo.Market{market})
+	Executions.Mu.Lock()
+	Executions.perpetuals[asset] = market
+	Executions.Mu.Unlock()
+	return market, nil
+}
+
+// bestPrice is a marketable limit for buying or selling instrument on aevo: the best opposite level of an option, the
+// perpetual's mark HedgeSlippage away.
+func bestPrice(instrument string, buy bool) (float64, error) {
+	if asset, perpetual := strings.CutSuffix(instrument, "-PERP"); perpetual {
+		AevoPerps.Mu.RLock()
+		perp, exists := AevoPerps.Perps[asset]
+		AevoPerps.Mu.RUnlock()
+		if !exists || perp.Mark <= 0 {
+			return 0, fmt.Errorf("bestPrice: no %v mark", instrument)
+		}
+		if buy {
+			return perp.Mark * (1 + HedgeSlippage), nil
+		}
+		return perp.Mark * (1 - HedgeSlippage), nil
+	}
+
+	orderbook, exists := OrderbookContainer.Get(instrument)
+	levels := orderbook.Bids["aevo"]
+	if buy {
+		levels = orderbook.Asks["aevo"]
+	}
+	if !exists || len(levels) == 0 {
+		return 0, fmt.Errorf("bestPrice: no aevo %v levels", instrument)
+	}
+	return levels[0].Price.Float64(), nil
+}
+
+// orderFilled is what an aevo order filled, from its fills and its filled amount while open. The caller holds
+// Portfolio.Mu.
+func orderFilled(orderId string) float64 {
+	filled := 0.0
+	for _, fill := range Portfolio.Fills {
+		if fill.Exchange == "aevo" && fill.OrderId == orderId {
+			filled += fill.Amount
+		}
+	}
+	if order, open := Portfolio.Orders["aevo "+orderId]; open {
+		filled = max(filled, order.Filled)
+	}
+	return filled
+}
+
+// executeOrders places orders concurrently, waits up to LegTimeout for them to fill and cancels what's left, setting
+// each order's Filled. Orders that couldn't be placed have their Error set.
+func executeOrders(orders []*ExecutionOrder) {
+	var wg sync.WaitGroup
+	for _, order := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := aevo.OrderRequest{InstrumentId: order.instrumentId, IsBuy: order.Side == "buy", Amount: order.Amount, LimitPrice: order.Limit}
+			placed, err := aevoPlaceOrder(order.Instrument, request)
+			if err != nil {
+				order.Error = err.Error()
+				return
+			}
+			order.OrderId, order.Amount, order.Limit = placed.OrderId, placed.Amount, placed.Price
+			if placed.OrderStatus == "dry_run" {
+				order.Error = "dry run, signed but not sent"
+			}
+		}()
+	}
+	wg.Wait()
+
+	live := make([]*ExecutionOrder, 0, len(orders))
+	for _, order := range orders {
+		if order.Error == "" {
+			live = append(live, order)
+		}
+	}
+	update := func() bool {
+		Portfolio.Mu.Lock()
+		defer Portfolio.Mu.Unlock()
+		done := true
+		for _, order := range live {
+			order.Filled = orderFilled(order.OrderId)
+			done = done && order.Amount-order.Filled < 1e-9
+		}
+		return done
+	}
+	deadline := time.Now().Add(LegTimeout)
+	for !update() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, order := range live {
+		Portfolio.Mu.Lock()
+		_, open := Portfolio.Orders["aevo "+order.OrderId]
+		Portfolio.Mu.Unlock()
+		if !open {
+			continue
+		}
+		err := AevoClient.CancelOrder(order.OrderId)
+		if err != nil {
+			order.Error = err.Error()
+			continue
+		}
+		Portfolio.Mu.Lock()
+		delete(Portfolio.Orders, "aevo "+order.OrderId)
+		Portfolio.Mu.Unlock()
+	}
+	update() //fills that came in while cancelling
+}
+
+// record adds orders to the execution, their fills to the legs they were placed for.
+func (e *Execution) record(orders []*ExecutionOrder) {
+	for _, order := range orders {
+		e.Orders = append(e.Orders, *order)
+		if order.Leg < 0 {
+			continue
+		}
+		if order.Side == e.Legs[order.Leg].Side {
+			e.Legs[order.Leg].Filled += order.Filled
+		} else {
+			e.Legs[order.Leg].Filled -= order.Filled
+		}
+	}
+}
+
+// filledRange is the least and most filled legs' contracts.
+func (e *Execution) filledRange() (float64, float64) {
+	least, most := math.Inf(1), math.Inf(-1)
+	for _, leg := range e.Legs {
+		least, most = min(least, leg.Filled), max(most, leg.Filled)
+	}
+	return least, most
+}
+
+// netDelta is the delta of the execution's fills, of the entry orders only with entries set, one per perpetual
+// contract.
+func (e *Execution) netDelta(entries bool, now time.Time) float64 {
+	delta := 0.0
+	for _, order := range e.Orders {
+		if entries && order.Purpose != "entry" {
+			continue
+		}
+		perContract := 1.0
+		if !strings.HasSuffix(order.Instrument, "-PERP") {
+			greeks, _ := instrumentGreeks(order.Instrument, now)
+			perContract = greeks.Delta
+		}
+		if order.Side == "sell" {
+			perContract = -perContract
+		}
+		delta += order.Filled * perContract
+	}
+	return delta
+}
+
+// repairOrder is an order of amount on a leg at its best price, its Error set when there's none.
+func (e *Execution) repairOrder(leg int, purpose string, side string, amount float64) *ExecutionOrder {
+	order := &ExecutionOrder{Leg: leg, Purpose: purpose, Instrument: e.Legs[leg].Instrument, Side: side, Amount: amount, instrumentId: e.Legs[leg].instrumentId}
+	limit, err := bestPrice(order.Instrument, side == "buy")
+	if err != nil {
+		order.Error = err.Error()
+	}
+	order.Limit = limit
+	return order
+}
+
+// applyPolicy runs LegPolicy on the legs' unmatched contracts.
+func (e *Execution) applyPolicy(perp aevo.Market) {
+	opposite := map[string]string{"buy": "sell", "sell": "buy"}
+	place := func(orders []*ExecutionOrder) {
+		live := make([]*ExecutionOrder, 0, len(orders))
+		for _, order := range orders {
+			if order.Error == "" {
+				live = append(live, order)
+			}
+		}
+		executeOrders(live)
+		e.record(orders)
+	}
+
+	switch e.Policy {
+	case "chase":
+		for attempt := 0; attempt < ChaseAttempts; attempt++ {
+			least, most := e.filledRange()
+			if most-least < 1e-9 {
+				break
+			}
+			orders := make([]*ExecutionOrder, 0, len(e.Legs))
+			for i, leg := range e.Legs {
+				if behind := most - leg.Filled; behind > 0 {
+					orders = append(orders, e.repairOrder(i, "chase", leg.Side, behind))
+				}
+			}
+			place(orders)
+		}
+	case "unwind":
+		least, _ := e.filledRange()
+		orders := make([]*ExecutionOrder, 0, len(e.Legs))
+		for i, leg := range e.Legs {
+			if ahead := leg.Filled - least; ahead > 0 {
+				orders = append(orders, e.repairOrder(i, "unwind", opposite[leg.Side], ahead))
+			}
+		}
+		place(orders)
+	case "hedge":
+		delta := e.netDelta(false, time.Now())
+		amount := roundAmount("aevo", perp.InstrumentName, math.Abs(delta))
+		if amount <= 0 {
+			break
+		}
+		side := "buy"
+		if delta > 0 {
+			side = "sell"
+		}
+		order := &ExecutionOrder{Leg: -1, Purpose: "hedge", Instrument: perp.InstrumentName, Side: side, Amount: amount, instrumentId: perp.InstrumentId}
+		limit, err := bestPrice(order.Instrument, side == "buy")
+		if err != nil {
+			order.Error = err.Error()
+		}
+		order.Limit = limit
+		place([]*ExecutionOrder{order})
+	}
+}
+
+// runExecution executes the opportunity table on e.Key as its ticket's option legs and a perpetual hedge, placed on
+// aevo concurrently, then runs LegPolicy on the leg risk they left. It returns e as it finished.
+func runExecution(e Execution, table ArbTable) Execution {
+	if table.BidExchange != "aevo" || table.AskExchange != "aevo" {
+		e.Error = fmt.Sprintf("runExecution: legs on %v and %v, only aevo orders can be placed", table.BidExchange, table.AskExchange)
+		return e
+	}
+	perp, err := aevoPerpetual(table.Asset)
+	if err != nil {
+		e.Error = fmt.Sprintf("runExecution: %v", err)
+		return e
+	}
+	ticket := tradeTicket(e.Key, table)
+	e.Strategy = ticket.Strategy
+	if ticket.Size <= 0 {
+		e.Error = "runExecution: no size to execute"
+		return e
+	}
+
+	entries := make([]*ExecutionOrder, 0, len(ticket.Legs))
+	for i, ticketLeg := range ticket.Legs {
+		leg := ExecutionLeg{Instrument: ticketLeg.Instrument, Side: ticketLeg.Action, Amount: ticket.Size}
+		limit := ticketLeg.Limit
+		if ticketLeg.Type == "future" { //hedged with the perpetual
+			leg.Instrument, leg.instrumentId = perp.InstrumentName, perp.InstrumentId
+			limit, err = bestPrice(leg.Instrument, leg.Side == "buy")
+			if err != nil {
+				e.Error = fmt.Sprintf("runExecution: %v", err)
+				return e
+			}
+		}
+		e.Legs = append(e.Legs, leg)
+		entries = append(entries, &ExecutionOrder{Leg: i, Purpose: "entry", Instrument: leg.Instrument, Side: leg.Side, Amount: leg.Amount, Limit: limit, instrumentId: leg.instrumentId})
+	}
+
+	executeOrders(entries)
+	e.record(entries)
+	for _, order := range entries {
+		if order.OrderId == "" || order.Error != "" {
+			e.Error = fmt.Sprintf("runExecution: %v %v: %v", order.Side, order.Instrument, order.Error)
+		}
+	}
+	now := time.Now()
+	least, most := e.filledRange()
+	e.LegRisk, e.LegDelta = most-least, e.netDelta(true, now)
+	if e.LegRisk > 0 {
+		slog.Warn("runExecution: legs filled unevenly", "key", e.Key, "leg_risk", e.LegRisk, "leg_delta", e.LegDelta, "policy", e.Policy)
+		e.applyPolicy(perp)
+	}
+
+	least, most = e.filledRange()
+	e.Matched, e.Unmatched, e.Residual = least, most-least, e.netDelta(false, time.Now())
+	slog.Info("runExecution: executed", "key", e.Key, "matched", e.Matched, "leg_risk", e.LegRisk, "unmatched", e.Unmatched, "residual_delta", e.Residual)
+	return e
+}
+
+// startExecution starts executing the open opportunity on key, one execution per key at a time.
+func startExecution(key string) (Execution, error) {
+	table, exists := ArbContainer.Snapshot()[key]
+	if !exists {
+		return Execution{}, fmt.Errorf("startExecution: no open opportunity on %v", key)
+	}
+
+	Executions.Mu.Lock()
+	defer Executions.Mu.Unlock()
+	if Executions.running[key] {
+		return Execution{}, fmt.Errorf("startExecution: %v is already being executed", key)
+	}
+	Executions.running[key] = true
+	Executions.nextId++
+	execution := &Execution{Id: Executions.nextId, Key: key, Policy: LegPolicy, Started: time.Now()}
+	Executions.Executions = append(Executions.Executions, execution)
+	if len(Executions.Executions) > maxExecutions {
+		Executions.Executions = Executions.Executions[len(Executions.Executions)-maxExecutions:]
+	}
+
+	go func(e Execution) {
+		e = runExecution(e, table)
+		e.Finished = time.Now()
+		Executions.Mu.Lock()
+		*execution = e
+		delete(Executions.running, key)
+		Executions.Mu.Unlock()
+	}(*execution)
+	return *execution, nil
+}
+
+// TradingToken, from OPTIONS_WS_TRADING_TOKEN, is the bearer token requests that trade must carry. Without one the
+// trading endpoints are read only, and only served on a loopback listen address.
+var TradingToken = os.Getenv("OPTIONS_WS_TRADING_TOKEN")
+
+// loopbackAddress reports whether listen, a host:port, only accepts local connections.
+func loopbackAddress(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil || host == "" {
+		return false //":8080" listens on every interface
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// tradingAuth requires TradingToken on every request to handler but GETs, refusing them all without one. Loopback
+// listeners included: any page the operator's browser opens can post to localhost, but can't set Authorization
+// cross-origin.
+func tradingAuth(handler http.HandlerFunc) http.HandlerFunc {
+	expected := []byte("Bearer " + TradingToken)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && (TradingToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// registerTradingHandler serves handler at pattern behind tradingAuth, unless there's no TradingToken and listen
+// isn't a loopback address, anyone reaching the port could read the account's executions then.
+func registerTradingHandler(listen string, pattern string, handler http.HandlerFunc) {
+	if TradingToken == "" && !loopbackAddress(listen) {
+		slog.Warn("trading endpoint not served: set OPTIONS_WS_TRADING_TOKEN or listen on a loopback address", "path", pattern, "listen", listen)
+		return
+	}
+	if TradingToken == "" {
+		slog.Warn("trading endpoint read only: set OPTIONS_WS_TRADING_TOKEN to trade", "path", pattern)
+	}
+	http.HandleFunc(pattern, tradingAuth(handler))
+}
+
+// executionsHandler serves /api/executions: GET lists the recent executions, latest first, POST ?key= (e.g.
+// ETH-28JUN24-3000) executes the open opportunity on a strike.
+func executionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		Executions.Mu.Lock()
+		executions := make([]Execution, 0, len(Executions.Executions))
+		for i := len(Executions.Executions) - 1; i >= 0; i-- {
+			executions = append(executions, *Executions.Executions[i])
+		}
+		Executions.Mu.Unlock()
+		writeJson(w, "executionsHandler", executions)
+	case http.MethodPost:
+		execution, err := startExecution(r.URL.Query().Get("key"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJson(w, "executionsHandler", execution)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
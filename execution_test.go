@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTradingAuth(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		method        string
+		authorization string
+		origin        string
+		want          int
+	}{
+		{name: "get without token", method: http.MethodGet, want: http.StatusOK},
+		{name: "post without token", method: http.MethodPost, want: http.StatusUnauthorized},
+		{name: "cross-origin post without token", method: http.MethodPost, origin: "https://evil.example", want: http.StatusUnauthorized},
+		{name: "post with empty bearer and no token", method: http.MethodPost, authorization: "Bearer ", want: http.StatusUnauthorized},
+		{name: "get with token", token: "secret", method: http.MethodGet, want: http.StatusOK},
+		{name: "post missing authorization", token: "secret", method: http.MethodPost, want: http.StatusUnauthorized},
+		{name: "post wrong token", token: "secret", method: http.MethodPost, authorization: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "post with token", token: "secret", method: http.MethodPost, authorization: "Bearer secret", want: http.StatusOK},
+	}
+
+	defer func(token string) { TradingToken = token }(TradingToken)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			TradingToken = test.token
+			handler := tradingAuth(func(w http.ResponseWriter, r *http.Request) {})
+			r := httptest.NewRequest(test.method, "/api/executions?key=ETH-28JUN24-3000", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != test.want {
+				t.Errorf("status = %v, want %v", w.Code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var MinTimeToExpiry time.Duration //options expiring sooner than this aren't scanned for opportunities
+
+// tradableExpiry reports whether an "02JAN06" expiry is at least MinTimeToExpiry away, unparseable expiries aren't.
+func tradableExpiry(expiry string, now time.Time) bool {
+	expiryTime, err := instrumentExpiry(expiry)
+	if err != nil {
+		return false
+	}
+	return expiryTime.Sub(now) >= MinTimeToExpiry && expiryTime.After(now)
+}
+
+// pruneExpired drops the books, opportunities and box spreads of instruments past their settlement time. Their
+// channels are unsubscribed by the next markets refresh, frames arriving until then recreate the books, which are
+// dropped again here.
+func pruneExpired(now time.Time) {
+	expired := func(expiry string) bool {
+		expiryTime, err := instrumentExpiry(expiry)
+		return err == nil && !expiryTime.After(now)
+	}
+
+	books := 0
+	OrderbookContainer.Mu.Lock()
+	for instrument := range OrderbookContainer.Orderbooks {
+		components := strings.Split(instrument, "-")
+		if len(components) == 4 && expired(components[1]) {
+			delete(OrderbookContainer.Orderbooks, instrument)
+			books++
+		}
+	}
+	OrderbookContainer.Mu.Unlock()
+
+	ArbContainer.Mu.Lock()
+	for key, table := range ArbContainer.ArbTables {
+		if expired(table.Expiry) {
+			delete(ArbContainer.ArbTables, key)
+		}
+	}
+	ArbContainer.Mu.Unlock()
+
+	BoxContainer.Mu.Lock()
+	for key, table := range BoxContainer.BoxTables {
+		if expired(table.Expiry) {
+			delete(BoxContainer.BoxTables, key)
+		}
+	}
+	BoxContainer.Mu.Unlock()
+
+	if books > 0 {
+		slog.Info("pruneExpired: dropped expired orderbooks", "orderbooks", books)
+	}
+}
+
+func expiryLoop(interval time.Duration) {
+	for {
+		pruneExpired(time.Now())
+		time.Sleep(interval)
+	}
+}
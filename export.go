@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// exportColumn is a persisted column and the Go type it's scanned into, from its SQL type in tickTables.
+type exportColumn struct {
+	Name string
+	Kind string //"int", "float", "string" or "bool"
+}
+
+func exportColumns(schema string) []exportColumn {
+	columns := make([]exportColumn, 0)
+	for _, definition := range strings.Split(schema, ", ") {
+		name, sqlType, _ := strings.Cut(definition, " ")
+		kind := "float"
+		switch sqlType {
+		case "BIGINT":
+			kind = "int"
+		case "TEXT":
+			kind = "string"
+		case "BOOLEAN":
+			kind = "bool"
+		}
+		columns = append(columns, exportColumn{name, kind})
+	}
+	return columns
+}
+
+// exportCommand writes a persisted table to a CSV or Parquet file for offline analysis, e.g. in pandas with
+// pd.read_parquet("lifetimes.parquet"). Times are unix nanoseconds, Parquet types the time and closed columns as
+// timestamps.
+func exportCommand(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cfg, configFile := registerConfigFlags(fs)
+	table := fs.String("table", "arb_lifetimes", "table to export: arb_lifetimes, arb_opportunities, orderbook_ticks or index_ticks")
+	format := fs.String("format", "csv", "output format: csv or parquet")
+	out := fs.String("out", "-", "output file, - writes to stdout")
+	from := fs.String("from", "", "RFC 3339 time rows start at (empty exports from the first)")
+	to := fs.String("to", "", "RFC 3339 time rows end before (empty exports to the last)")
+	fs.Parse(args)
+	applyConfig(fs, cfg, *configFile)
+	if cfg.StoreDsn == "" {
+		log.Fatalf("export: no -store-dsn")
+	}
+
+	var columns []exportColumn
+	for _, tickTable := range tickTables {
+		if tickTable.Name == *table {
+			columns = exportColumns(tickTable.Schema)
+		}
+	}
+	if columns == nil {
+		log.Fatalf("export: unknown table %v", *table)
+	}
+	if *format != "csv" && *format != "parquet" {
+		log.Fatalf("export: unknown format %v", *format)
+	}
+
+	start, end, err := timeBounds(*from, *to)
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+
+	db, err := sql.Open(cfg.StoreDriver, cfg.StoreDsn)
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+	defer db.Close()
+	rows, err := db.Query(rebind(cfg.StoreDriver, "SELECT * FROM "+*table+" WHERE time >= ? AND time < ? ORDER BY time"), start, end)
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+	defer rows.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("export: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	var exported int
+	if *format == "csv" {
+		exported, err = exportCsv(w, columns, rows)
+	} else {
+		exported, err = exportParquet(w, columns, rows)
+	}
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "exported %v rows of %v\n", exported, *table)
+}
+
+// timeBounds parses optional RFC 3339 from and to times into unix nanoseconds, open ends span everything.
+func timeBounds(from string, to string) (int64, int64, error) {
+	start, end := int64(0), int64(1<<63-1)
+	for _, bound := range []struct {
+		Value string
+		Into  *int64
+	}{{from, &start}, {to, &end}} {
+		if bound.Value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.Value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("timeBounds: %v", err)
+		}
+		*bound.Into = t.UnixNano()
+	}
+	return start, end, nil
+}
+
+// rebind numbers a query's ? placeholders $1, $2, ... for postgres.
+func rebind(driver string, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+	for n := 1; strings.Contains(query, "?"); n++ {
+		query = strings.Replace(query, "?", "$"+strconv.Itoa(n), 1)
+	}
+	return query
+}
+
+// scanRow scans the current row into values of the columns' kinds.
+func scanRow(rows *sql.Rows, columns []exportColumn) ([]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	targets := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column.Kind {
+		case "int":
+			targets[i] = new(int64)
+		case "string":
+			targets[i] = new(string)
+		case "bool":
+			targets[i] = new(bool)
+		default:
+			targets[i] = new(float64)
+		}
+	}
+	err := rows.Scan(targets...)
+	if err != nil {
+		return nil, fmt.Errorf("scanRow: %v", err)
+	}
+	for i, target := range targets {
+		switch target := target.(type) {
+		case *int64:
+			values[i] = *target
+		case *string:
+			values[i] = *target
+		case *bool:
+			values[i] = *target
+		case *float64:
+			values[i] = *target
+		}
+	}
+	return values, nil
+}
+
+func exportCsv(w io.Writer, columns []exportColumn, rows *sql.Rows) (int, error) {
+	writer := csv.NewWriter(w)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.Name
+	}
+	writer.Write(record)
+
+	exported := 0
+	for rows.Next() {
+		values, err := scanRow(rows, columns)
+		if err != nil {
+			return exported, fmt.Errorf("exportCsv: %v", err)
+		}
+		for i, value := range values {
+			switch value := value.(type) {
+			case int64:
+				record[i] = strconv.FormatInt(value, 10)
+			case float64:
+				record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+			case bool:
+				record[i] = strconv.FormatBool(value)
+			case string:
+				record[i] = value
+			}
+		}
+		writer.Write(record)
+		exported++
+	}
+	writer.Flush()
+	if err := rows.Err(); err != nil {
+		return exported, fmt.Errorf("exportCsv: %v", err)
+	}
+	if err := writer.Error(); err != nil {
+		return exported, fmt.Errorf("exportCsv: %v", err)
+	}
+	return exported, nil
+}
+
+func exportParquet(w io.Writer, columns []exportColumn, rows *sql.Rows) (int, error) {
+	group := make(parquet.Group)
+	for _, column := range columns {
+		var node parquet.Node
+		switch {
+		case column.Name == "time" || column.Name == "closed":
+			node = parquet.Timestamp(parquet.Nanosecond)
+		case column.Kind == "int":
+			node = parquet.Int(64)
+		case column.Kind == "string":
+			node = parquet.String()
+		case column.Kind == "bool":
+			node = parquet.Leaf(parquet.BooleanType)
+		default:
+			node = parquet.Leaf(parquet.DoubleType)
+		}
+		group[column.Name] = parquet.Compressed(node, &parquet.Snappy)
+	}
+	schema := parquet.NewSchema("options_ws", group)
+	indexes := make([]int, len(columns)) //the schema orders its columns by name
+	for i, column := range columns {
+		leaf, _ := schema.Lookup(column.Name)
+		indexes[i] = leaf.ColumnIndex
+	}
+
+	writer := parquet.NewWriter(w, schema)
+	batch := make([]parquet.Row, 0, 1024)
+	exported := 0
+	for rows.Next() {
+		values, err := scanRow(rows, columns)
+		if err != nil {
+			return exported, fmt.Errorf("exportParquet: %v", err)
+		}
+		row := make(parquet.Row, len(columns))
+		for i, value := range values {
+			row[indexes[i]] = parquet.ValueOf(value).Level(0, 0, indexes[i])
+		}
+		batch = append(batch, row)
+		if len(batch) == cap(batch) {
+			_, err = writer.WriteRows(batch)
+			if err != nil {
+				return exported, fmt.Errorf("exportParquet: %v", err)
+			}
+			exported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return exported, fmt.Errorf("exportParquet: %v", err)
+	}
+	_, err := writer.WriteRows(batch)
+	if err != nil {
+		return exported, fmt.Errorf("exportParquet: %v", err)
+	}
+	exported += len(batch)
+	err = writer.Close()
+	if err != nil {
+		return exported, fmt.Errorf("exportParquet: %v", err)
+	}
+	return exported, nil
+}
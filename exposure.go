@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type exposureLeg struct {
+	Instrument string  //store naming, or the asset alone for an index hedge
+	Amount     float64 //signed contracts
+}
+
+// GreeksExposure is the net greeks of a set of legs in one underlying and expiry, option legs valued with
+// instrumentGreeks and underlying legs (perps and hedges) one delta per unit under the "PERP" expiry.
+type GreeksExposure struct {
+	Asset     string  `json:"asset"`
+	Expiry    string  `json:"expiry"` //"PERP" for underlying legs, "" on an asset's total
+	Legs      int     `json:"legs"`
+	Contracts float64 `json:"contracts"` //net signed
+	Delta     float64 `json:"delta"`
+	Gamma     float64 `json:"gamma"`
+	Vega      float64 `json:"vega"`
+	Theta     float64 `json:"theta"`
+	Unpriced  int     `json:"unpriced"` //option legs without greeks, left out of the sums
+}
+
+func positionExposureLegs() []exposureLeg {
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+	legs := make([]exposureLeg, 0, len(Portfolio.Positions))
+	for _, position := range Portfolio.Positions {
+		legs = append(legs, exposureLeg{position.Instrument, position.Amount})
+	}
+	return legs
+}
+
+func paperExposureLegs() []exposureLeg {
+	Paper.Mu.Lock()
+	defer Paper.Mu.Unlock()
+	legs := make([]exposureLeg, 0, len(Paper.Positions))
+	for key, amount := range Paper.Positions {
+		_, instrument, _ := strings.Cut(key, " ")
+		legs = append(legs, exposureLeg{instrument, amount})
+	}
+	return legs
+}
+
+// quoteExposureLegs are the legs of every open opportunity at its SuggestedSize: short the bid leg, long the ask leg
+// and long the index when selling the call, short it when selling the put.
+func quoteExposureLegs() []exposureLeg {
+	legs := make([]exposureLeg, 0)
+	for key, table := range ArbContainer.Snapshot() {
+		size := table.SuggestedSize
+		hedge := size
+		if table.BidType == "P" {
+			hedge = -size
+		}
+		legs = append(legs, exposureLeg{key + "-" + table.BidType, -size}, exposureLeg{key + "-" + table.AskType, size}, exposureLeg{table.Asset, hedge})
+	}
+	return legs
+}
+
+// aggregateExposure sums legs' greeks by asset and expiry at now, each asset's total (Expiry "") before its expiries in
+// expiry order.
+func aggregateExposure(legs []exposureLeg, now time.Time) []GreeksExposure {
+	buckets := make(map[[2]string]*GreeksExposure)
+	expiries := make(map[[2]string]time.Time)
+	add := func(asset string, expiry string, at time.Time) *GreeksExposure {
+		key := [2]string{asset, expiry}
+		bucket, exists := buckets[key]
+		if !exists {
+			bucket = &GreeksExposure{Asset: asset, Expiry: expiry}
+			buckets[key] = bucket
+			expiries[key] = at
+		}
+		return bucket
+	}
+
+	for _, leg := range legs {
+		if leg.Amount == 0 {
+			continue
+		}
+		option, err := parseInstrument(leg.Instrument)
+		var expiry string
+		var at time.Time
+		var delta, gamma, vega, theta float64
+		priced := true
+		if err != nil { //an underlying: a perp ("ETH-PERP") or an index hedge ("ETH")
+			asset, _, _ := strings.Cut(leg.Instrument, "-")
+			option.Asset, expiry, at = asset, "PERP", time.Time{}
+			delta = leg.Amount
+		} else {
+			expiry, at = option.ExpiryCode(), option.Expiry
+			greeks, source := instrumentGreeks(leg.Instrument, now)
+			priced = source != ""
+			delta, gamma, vega, theta = greeks.Delta*leg.Amount, greeks.Gamma*leg.Amount, greeks.Vega*leg.Amount, greeks.Theta*leg.Amount
+		}
+
+		for _, bucket := range []*GreeksExposure{add(option.Asset, "", time.Time{}), add(option.Asset, expiry, at)} {
+			bucket.Legs++
+			bucket.Contracts += leg.Amount
+			if !priced {
+				bucket.Unpriced++
+				continue
+			}
+			bucket.Delta += delta
+			bucket.Gamma += gamma
+			bucket.Vega += vega
+			bucket.Theta += theta
+		}
+	}
+
+	exposure := make([]GreeksExposure, 0, len(buckets))
+	for _, bucket := range buckets {
+		exposure = append(exposure, *bucket)
+	}
+	sort.Slice(exposure, func(i, j int) bool {
+		a, b := exposure[i], exposure[j]
+		if a.Asset != b.Asset {
+			return a.Asset < b.Asset
+		}
+		if (a.Expiry == "") != (b.Expiry == "") {
+			return a.Expiry == ""
+		}
+		return expiries[[2]string{a.Asset, a.Expiry}].Before(expiries[[2]string{b.Asset, b.Expiry}])
+	})
+	return exposure
+}
+
+// exposureRequest aggregates the legs of ?source=: "positions" (the default), "paper" or "quotes".
+func exposureRequest(r *http.Request) ([]GreeksExposure, error) {
+	var legs []exposureLeg
+	switch source := r.URL.Query().Get("source"); source {
+	case "", "positions":
+		legs = positionExposureLegs()
+	case "paper":
+		legs = paperExposureLegs()
+	case "quotes":
+		legs = quoteExposureLegs()
+	default:
+		return nil, fmt.Errorf("source: not positions, paper or quotes: %v", source)
+	}
+	return aggregateExposure(legs, time.Now()), nil
+}
+
+// exposureHandler serves /api/exposure, greeks by underlying and expiry of ?source=.
+func exposureHandler(w http.ResponseWriter, r *http.Request) {
+	exposure, err := exposureRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, "exposureHandler", exposure)
+}
+
+func serveExposure(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/exposure.html"))
+	tmpl.Execute(w, nil)
+}
+
+// exposureTableHandler renders exposure rows for the htmx table on /exposure, asset totals in bold.
+func exposureTableHandler(w http.ResponseWriter, r *http.Request) {
+	exposure, err := exposureRequest(r)
+	if err != nil {
+		fmt.Fprintf(w, `<tr><td colspan="9">%s</td></tr>`, template.HTMLEscapeString(err.Error()))
+		return
+	}
+
+	responseStr := ""
+	for _, row := range exposure {
+		expiry, style := row.Expiry, ""
+		if expiry == "" {
+			expiry, style = "total", ` style="font-weight: bold"`
+		}
+		responseStr += fmt.Sprintf(`<tr%s><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td></tr>`,
+			style, row.Asset, expiry, row.Legs,
+			strconv.FormatFloat(row.Contracts, 'f', 2, 64),
+			strconv.FormatFloat(row.Delta, 'f', 3, 64),
+			strconv.FormatFloat(row.Gamma, 'f', 5, 64),
+			strconv.FormatFloat(row.Vega, 'f', 2, 64),
+			strconv.FormatFloat(row.Theta, 'f', 2, 64),
+			row.Unpriced,
+		)
+	}
+	fmt.Fprint(w, responseStr)
+}
@@ -0,0 +1,215 @@
+// Normalized feed served by the gRPC streaming API, prices and amounts per 1 underlying contract in USD as in the
+// store.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: feed.proto
+
+package feedpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Feed_StreamOrderbooks_FullMethodName = "/optionsws.feed.Feed/StreamOrderbooks"
+	Feed_StreamArbs_FullMethodName       = "/optionsws.feed.Feed/StreamArbs"
+	Feed_StreamIndex_FullMethodName      = "/optionsws.feed.Feed/StreamIndex"
+)
+
+// FeedClient is the client API for Feed service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FeedClient interface {
+	// StreamOrderbooks streams every exchange's book of the requested instruments after each update.
+	StreamOrderbooks(ctx context.Context, in *StreamOrderbooksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OrderbookUpdate], error)
+	// StreamArbs streams opportunities as they open or change, and once with closed set when they close.
+	StreamArbs(ctx context.Context, in *StreamArbsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ArbUpdate], error)
+	// StreamIndex streams every exchange's index prices of the requested assets.
+	StreamIndex(ctx context.Context, in *StreamIndexRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[IndexUpdate], error)
+}
+
+type feedClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFeedClient(cc grpc.ClientConnInterface) FeedClient {
+	return &feedClient{cc}
+}
+
+func (c *feedClient) StreamOrderbooks(ctx context.Context, in *StreamOrderbooksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[OrderbookUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Feed_ServiceDesc.Streams[0], Feed_StreamOrderbooks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamOrderbooksRequest, OrderbookUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Feed_StreamOrderbooksClient = grpc.ServerStreamingClient[OrderbookUpdate]
+
+func (c *feedClient) StreamArbs(ctx context.Context, in *StreamArbsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ArbUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Feed_ServiceDesc.Streams[1], Feed_StreamArbs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamArbsRequest, ArbUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Feed_StreamArbsClient = grpc.ServerStreamingClient[ArbUpdate]
+
+func (c *feedClient) StreamIndex(ctx context.Context, in *StreamIndexRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[IndexUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Feed_ServiceDesc.Streams[2], Feed_StreamIndex_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamIndexRequest, IndexUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Feed_StreamIndexClient = grpc.ServerStreamingClient[IndexUpdate]
+
+// FeedServer is the server API for Feed service.
+// All implementations must embed UnimplementedFeedServer
+// for forward compatibility.
+type FeedServer interface {
+	// StreamOrderbooks streams every exchange's book of the requested instruments after each update.
+	StreamOrderbooks(*StreamOrderbooksRequest, grpc.ServerStreamingServer[OrderbookUpdate]) error
+	// StreamArbs streams opportunities as they open or change, and once with closed set when they close.
+	StreamArbs(*StreamArbsRequest, grpc.ServerStreamingServer[ArbUpdate]) error
+	// StreamIndex streams every exchange's index prices of the requested assets.
+	StreamIndex(*StreamIndexRequest, grpc.ServerStreamingServer[IndexUpdate]) error
+	mustEmbedUnimplementedFeedServer()
+}
+
+// UnimplementedFeedServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFeedServer struct{}
+
+func (UnimplementedFeedServer) StreamOrderbooks(*StreamOrderbooksRequest, grpc.ServerStreamingServer[OrderbookUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamOrderbooks not implemented")
+}
+func (UnimplementedFeedServer) StreamArbs(*StreamArbsRequest, grpc.ServerStreamingServer[ArbUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamArbs not implemented")
+}
+func (UnimplementedFeedServer) StreamIndex(*StreamIndexRequest, grpc.ServerStreamingServer[IndexUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamIndex not implemented")
+}
+func (UnimplementedFeedServer) mustEmbedUnimplementedFeedServer() {}
+func (UnimplementedFeedServer) testEmbeddedByValue()              {}
+
+// UnsafeFeedServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FeedServer will
+// result in compilation errors.
+type UnsafeFeedServer interface {
+	mustEmbedUnimplementedFeedServer()
+}
+
+func RegisterFeedServer(s grpc.ServiceRegistrar, srv FeedServer) {
+	// If the following call pancis, it indicates UnimplementedFeedServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Feed_ServiceDesc, srv)
+}
+
+func _Feed_StreamOrderbooks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamOrderbooksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FeedServer).StreamOrderbooks(m, &grpc.GenericServerStream[StreamOrderbooksRequest, OrderbookUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Feed_StreamOrderbooksServer = grpc.ServerStreamingServer[OrderbookUpdate]
+
+func _Feed_StreamArbs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamArbsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FeedServer).StreamArbs(m, &grpc.GenericServerStream[StreamArbsRequest, ArbUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Feed_StreamArbsServer = grpc.ServerStreamingServer[ArbUpdate]
+
+func _Feed_StreamIndex_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamIndexRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FeedServer).StreamIndex(m, &grpc.GenericServerStream[StreamIndexRequest, IndexUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Feed_StreamIndexServer = grpc.ServerStreamingServer[IndexUpdate]
+
+// Feed_ServiceDesc is the grpc.ServiceDesc for Feed service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Feed_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "optionsws.feed.Feed",
+	HandlerType: (*FeedServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamOrderbooks",
+			Handler:       _Feed_StreamOrderbooks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamArbs",
+			Handler:       _Feed_StreamArbs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamIndex",
+			Handler:       _Feed_StreamIndex_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "feed.proto",
+}
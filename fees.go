@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+
+	"options-ws/config"
+)
+
+var ExchangeFees map[string]config.Fees //exchanges without an entry trade free
+
+// tradeFee is the per contract cost of filling one option at price on exchange and holding it to settlement: the
+// maker or taker fee plus the settlement fee, each capped at PremiumCap of price, plus gas and slippage.
+func tradeFee(exchange string, price float64, index float64, taker bool) float64 {
+	fees, exists := ExchangeFees[exchange]
+	if !exists {
+		return 0
+	}
+
+	rate := fees.Maker
+	if taker {
+		rate = fees.Taker
+	}
+	trading, settlement := rate*index, fees.Settlement*index
+	if fees.PremiumCap > 0 {
+		trading = math.Min(trading, fees.PremiumCap*price)
+		settlement = math.Min(settlement, fees.PremiumCap*price)
+	}
+
+	return trading + settlement + fees.Gas + fees.Slippage*price
+}
+
+// takerFees is the per contract cost of crossing the spread on every order, as arb legs do.
+func takerFees(orders []Order, index float64) float64 {
+	total := 0.0
+	for _, order := range orders {
+		total += tradeFee(order.Exchange, order.Price.Float64(), index, true)
+	}
+	return total
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"time"
+
+	"options-ws/decimal"
+)
+
+var FillLatency = 200 * time.Millisecond //orders arrive this long after an opportunity is found, 0 disables the discount
+var FillMinSamples = 5
+
+const quoteLifetimes = 32
+
+// quoteLife follows one exchange's best price on one side of a book.
+type quoteLife struct {
+	Price     decimal.Decimal
+	Since     time.Time //zero while the side is empty
+	Lifetimes [quoteLifetimes]time.Duration
+	Count     int //lifetimes recorded, the ring holds the last quoteLifetimes
+}
+
+type quoteSide struct {
+	Exchange string
+	Bid      bool
+}
+
+// trackQuoteLives records the end of exchange's best bid and ask in orderbook when their price changed with the
+// message stamped at exchangeTime. Callers hold OrderbookContainer.Mu.
+func trackQuoteLives(orderbook *OrderbookData, exchange string, exchangeTime time.Time) {
+	if orderbook.QuoteLives == nil {
+		orderbook.QuoteLives = make(map[quoteSide]*quoteLife)
+	}
+	trackQuoteLife(orderbook, quoteSide{exchange, true}, orderbook.Bids[exchange], exchangeTime)
+	trackQuoteLife(orderbook, quoteSide{exchange, false}, orderbook.Asks[exchange], exchangeTime)
+}
+
+func trackQuoteLife(orderbook *OrderbookData, side quoteSide, levels []Order, exchangeTime time.Time) {
+	life, exists := orderbook.QuoteLives[side]
+	if !exists {
+		life = &quoteLife{}
+		orderbook.QuoteLives[side] = life
+	}
+	if len(levels) > 0 && !life.Since.IsZero() && levels[0].Price == life.Price {
+		return
+	}
+	if !life.Since.IsZero() && exchangeTime.After(life.Since) {
+		life.Lifetimes[life.Count%quoteLifetimes] = exchangeTime.Sub(life.Since)
+		life.Count++
+	}
+	life.Price, life.Since = 0, time.Time{}
+	if len(levels) > 0 {
+		life.Price, life.Since = levels[0].Price, exchangeTime
+	}
+}
+
+// survival is the chance the quote, shown since Since, is still shown latency after now: the share of the recorded
+// lifetimes past its age that also lived past age+latency, plus one on both sides so an old quote counts as durable.
+func (life *quoteLife) survival(now time.Time, latency time.Duration) float64 {
+	if life.Count < FillMinSamples || life.Since.IsZero() {
+		return 1
+	}
+	age := max(now.Sub(life.Since), 0)
+	older, surviving := 1, 1
+	for _, lifetime := range life.Lifetimes[:min(life.Count, quoteLifetimes)] {
+		if lifetime > age {
+			older++
+		}
+		if lifetime > age+latency {
+			surviving++
+		}
+	}
+	return float64(surviving) / float64(older)
+}
+
+// quoteSurvival is the chance exchange's best bid or ask in orderbook survives FillLatency, 1 without enough history.
+func quoteSurvival(orderbook *OrderbookData, exchange string, bid bool, now time.Time) float64 {
+	life, exists := orderbook.QuoteLives[quoteSide{exchange, bid}]
+	if FillLatency <= 0 || !exists {
+		return 1
+	}
+	return life.survival(now, FillLatency)
+}
+
+// estimateFillProbability sets the FillProbability of the strike's ArbTable at now, the product of its legs' survivals
+// as they move independently, and its ExpectedProfit, AbsProfit discounted by it. updateArbTable stores a new table
+// every pass. Callers hold OrderbookContainer.Mu.
+func estimateFillProbability(key string, callOrderbook *OrderbookData, putOrderbook *OrderbookData, now time.Time) {
+	book := func(optionType string) *OrderbookData {
+		if optionType == "C" {
+			return callOrderbook
+		}
+		return putOrderbook
+	}
+
+	ArbContainer.Mu.Lock()
+	defer ArbContainer.Mu.Unlock()
+	table, exists := ArbContainer.ArbTables[key]
+	if !exists {
+		return
+	}
+	table.FillProbability = quoteSurvival(book(table.BidType), table.BidExchange, true, now) * quoteSurvival(book(table.AskType), table.AskExchange, false, now)
+	table.ExpectedProfit = table.AbsProfit * table.FillProbability
+}
+
+// rankValue is what opportunities are ranked by: ExpectedProfit when sortBy is "abs", Apy discounted by
+// FillProbability otherwise, either discounted by BookQuality.
+func (table *ArbTable) rankValue(sortBy string) float64 {
+	if sortBy == "abs" {
+		return table.ExpectedProfit * table.BookQuality
+	}
+	return table.Apy * table.FillProbability * table.BookQuality
+}
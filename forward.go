@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+)
+
+// UseForward prices put-call parity (call - put = forward - strike) against the forward of each expiry instead of
+// the spot index, false prices it against the index as before.
+var UseForward = true
+
+type PerpTicker struct {
+	Mark    float64
+	Index   float64
+	Funding float64 //per hour
+	Updated time.Time
+}
+
+type PerpsContainer struct {
+	Mu    sync.RWMutex
+	Perps map[string]PerpTicker //key: asset
+}
+
+var AevoPerps = PerpsContainer{Perps: make(map[string]PerpTicker)}
+
+// AevoForwards holds ForwardPrice / IndexPrice of aevo's option markets, key: asset and expiry, e.g. "ETH-28JUN24".
+var AevoForwards = IndexContainer{Index: make(map[string]float64)}
+
+var perpStale = 5 * time.Minute //funding older than this isn't used for the basis
+
+func aevoUpdateForwards(markets []aevo.Market) {
+	AevoForwards.Mu.Lock()
+	defer AevoForwards.Mu.Unlock()
+
+	for _, market := range markets {
+		components := strings.Split(market.InstrumentName, "-")
+		if len(components) != 4 || market.ForwardPrice <= 0 || market.IndexPrice <= 0 {
+			continue
+		}
+		AevoForwards.Index[components[0]+"-"+components[1]] = market.ForwardPrice / market.IndexPrice
+	}
+}
+
+func aevoUpdateTickers(channel string, data aevo.Tickers) {
+	asset := strings.Split(strings.TrimPrefix(channel, "ticker:"), ":")[0]
+	for _, ticker := range data.Tickers {
+		if ticker.InstrumentType == "OPTION" {
+			aevoApplyTicker(ticker, data.Timestamp)
+			continue
+		}
+		if ticker.InstrumentType != "PERPETUAL" || ticker.Mark.Price <= 0 {
+			continue
+		}
+		AevoPerps.Mu.Lock()
+		AevoPerps.Perps[asset] = PerpTicker{Mark: ticker.Mark.Price, Index: ticker.IndexPrice, Funding: ticker.FundingRate, Updated: time.Now()}
+		AevoPerps.Mu.Unlock()
+	}
+}
+
+// forwardBasis is the multiplier from the index to the forward of asset's expiry: aevo's forward over index as of the
+// last markets fetch, or else the perpetual's funding rate carried to expiry. 1 without forward data or with UseForward
+// off.
+func forwardBasis(asset string, expiry string, now time.Time) float64 {
+	if !UseForward {
+		return 1
+	}
+
+	AevoForwards.Mu.RLock()
+	basis, exists := AevoForwards.Index[asset+"-"+expiry]
+	AevoForwards.Mu.RUnlock()
+	if exists {
+		return basis
+	}
+
+	funding, exists := annualFunding(asset, now)
+	if !exists {
+		return 1
+	}
+	expiryTime, err := instrumentExpiry(expiry)
+	if err != nil {
+		return 1
+	}
+	return math.Exp(funding * yearsUntil(expiryTime, now))
+}
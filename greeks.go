@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"options-ws/aevo"
+)
+
+var GreeksMaxAge = 15 * time.Minute //exchange greeks older than this are replaced by model greeks
+var GreeksTolerance = 0.05          //delta difference between exchange and model greeks flagged as a mismatch
+
+// modelGreeks prices an instrument ("ETH-28JUN24-3000-C") with Black-Scholes at spot and iv (a fraction), in the
+// exchange greek conventions, ok is false for names that aren't options.
+func modelGreeks(instrument string, spot float64, iv float64, now time.Time) (aevo.Greeks, float64, bool) {
+	option, err := parseInstrument(instrument)
+	if err != nil {
+		return aevo.Greeks{}, 0, false
+	}
+
+	result := blackScholes(option.Type, spot, option.Strike, yearsUntil(option.Expiry, now), iv, 0)
+	return aevo.Greeks{Delta: result.Delta, Gamma: result.Gamma, Theta: result.Theta, Rho: result.Rho, Vega: result.Vega, Iv: iv}, result.Price, true
+}
+
+// bookIv is the mid of the best aevo bid and ask IVs of an instrument, or whichever side exists, 0 without a book.
+func bookIv(instrument string) float64 {
+	orderbook, exists := OrderbookContainer.Get(instrument)
+	if !exists {
+		return 0
+	}
+
+	var ivs []float64
+	if bids := orderbook.Bids["aevo"]; len(bids) > 0 && bids[0].Iv > 0 {
+		ivs = append(ivs, bids[0].Iv)
+	}
+	if asks := orderbook.Asks["aevo"]; len(asks) > 0 && asks[0].Iv > 0 {
+		ivs = append(ivs, asks[0].Iv)
+	}
+	if len(ivs) == 0 {
+		return 0
+	}
+	return (ivs[0] + ivs[len(ivs)-1]) / 2
+}
+
+// instrumentGreeks returns the exchange's greeks of an instrument while they're fresh, otherwise greeks priced locally
+// from the aevo index and the exchange's last IV, or the book's IV when the exchange has none. source is "exchange",
+// "model" or "" when neither is available.
+func instrumentGreeks(instrument string, now time.Time) (aevo.Greeks, string) {
+	AevoMarketList.Mu.Lock()
+	market, exists := AevoMarketList.Markets[instrument]
+	fresh := now.Sub(AevoMarketList.Updated) <= GreeksMaxAge
+	AevoMarketList.Mu.Unlock()
+
+	if exists && fresh && market.Greeks.Iv > 0 && market.Greeks.Delta != 0 {
+		return market.Greeks, "exchange"
+	}
+
+	iv := market.Greeks.Iv
+	if iv <= 0 {
+		iv = bookIv(instrument)
+	}
+	asset := strings.Split(instrument, "-")[0]
+	spot, spotExists := AevoIndex.Get(asset)
+	if iv <= 0 || !spotExists {
+		return market.Greeks, ""
+	}
+
+	greeks, _, ok := modelGreeks(instrument, spot, iv, now)
+	if !ok {
+		return market.Greeks, ""
+	}
+	return greeks, "model"
+}
+
+type greeksCheckJson struct {
+	Instrument  string      `json:"instrument"`
+	Exchange    aevo.Greeks `json:"exchange"`
+	Model       aevo.Greeks `json:"model"`
+	ModelPrice  float64     `json:"model_price"`
+	MarkPrice   float64     `json:"mark_price"`
+	DeltaDiff   float64     `json:"delta_diff"` //exchange - model
+	VegaDiffPct float64     `json:"vega_diff_pct"`
+	Mismatch    bool        `json:"mismatch"`
+}
+
+// greeksCheck reprices every aevo market at the exchange's own IV and index to cross check its greeks, a mismatch is a
+// delta off by more than GreeksTolerance, likely stale greeks.
+func greeksCheck(now time.Time) []greeksCheckJson {
+	AevoMarketList.Mu.Lock()
+	markets := make([]aevo.Market, 0, len(AevoMarketList.Markets))
+	for _, market := range AevoMarketList.Markets {
+		markets = append(markets, market)
+	}
+	AevoMarketList.Mu.Unlock()
+
+	checks := make([]greeksCheckJson, 0, len(markets))
+	for _, market := range markets {
+		spot, exists := AevoIndex.Get(market.UnderlyingAsset)
+		if !exists || market.Greeks.Iv <= 0 {
+			continue
+		}
+		model, price, ok := modelGreeks(market.InstrumentName, spot, market.Greeks.Iv, now)
+		if !ok {
+			continue
+		}
+
+		check := greeksCheckJson{
+			Instrument: market.InstrumentName,
+			Exchange:   market.Greeks,
+			Model:      model,
+			ModelPrice: price,
+			MarkPrice:  market.MarkPrice,
+			DeltaDiff:  market.Greeks.Delta - model.Delta,
+		}
+		if model.Vega != 0 {
+			check.VegaDiffPct = (market.Greeks.Vega - model.Vega) / model.Vega * 100
+		}
+		check.Mismatch = math.Abs(check.DeltaDiff) > GreeksTolerance
+		checks = append(checks, check)
+	}
+
+	sort.Slice(checks, func(i, j int) bool { return math.Abs(checks[i].DeltaDiff) > math.Abs(checks[j].DeltaDiff) })
+	return checks
+}
+
+// greeksHandler serves /api/greeks, the exchange vs model cross check, ?mismatch=1 lists mismatches only.
+func greeksHandler(w http.ResponseWriter, r *http.Request) {
+	checks := greeksCheck(time.Now())
+	if r.URL.Query().Get("mismatch") == "1" {
+		mismatches := make([]greeksCheckJson, 0)
+		for _, check := range checks {
+			if check.Mismatch {
+				mismatches = append(mismatches, check)
+			}
+		}
+		checks = mismatches
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(checks)
+	if err != nil {
+		slog.Error("greeksHandler: json encode error", "err", err)
+	}
+}
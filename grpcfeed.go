@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"options-ws/feedpb"
+)
+
+var GrpcQueueSize = 1024 //updates buffered per stream
+
+type feedSubscriber[T any] struct {
+	updates chan T
+	filter  func(T) bool
+	dropped int
+}
+
+// feedTopic fans updates of one kind out to the streams subscribed to it.
+type feedTopic[T any] struct {
+	Mu          sync.Mutex
+	Subscribers map[*feedSubscriber[T]]struct{}
+}
+
+func (t *feedTopic[T]) Subscribe(filter func(T) bool) *feedSubscriber[T] {
+	return t.SubscribeQueue(filter, GrpcQueueSize)
+}
+
+// SubscribeQueue subscribes to the updates filter selects, buffering up to size of them.
+func (t *feedTopic[T]) SubscribeQueue(filter func(T) bool, size int) *feedSubscriber[T] {
+	subscriber := &feedSubscriber[T]{updates: make(chan T, size), filter: filter}
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	if t.Subscribers == nil {
+		t.Subscribers = make(map[*feedSubscriber[T]]struct{})
+	}
+	t.Subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+// Unsubscribe removes subscriber and returns the number of updates dropped for it.
+func (t *feedTopic[T]) Unsubscribe(subscriber *feedSubscriber[T]) int {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	delete(t.Subscribers, subscriber)
+	return subscriber.dropped
+}
+
+// Active reports whether any stream is subscribed, publishers skip building updates when none is.
+func (t *feedTopic[T]) Active() bool {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	return len(t.Subscribers) > 0
+}
+
+func (t *feedTopic[T]) Publish(update T) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	for subscriber := range t.Subscribers {
+		if !subscriber.filter(update) {
+			continue
+		}
+		select {
+		case subscriber.updates <- update:
+		default:
+			subscriber.dropped++
+		}
+	}
+}
+
+var BookFeed feedTopic[*feedpb.OrderbookUpdate]
+var ArbFeed feedTopic[*feedpb.ArbUpdate]
+var IndexFeed feedTopic[*feedpb.IndexUpdate]
+
+func feedLevels(orders []Order) []*feedpb.Level {
+	levels := make([]*feedpb.Level, len(orders))
+	for i, order := range orders {
+		levels[i] = &feedpb.Level{Price: order.Price.Float64(), Amount: order.Amount, Iv: order.Iv}
+	}
+	return levels
+}
+
+func feedArb(key string, table *ArbTable, now time.Time) *feedpb.ArbUpdate {
+	return &feedpb.ArbUpdate{
+		Key:           key,
+		Asset:         table.Asset,
+		Expiry:        table.Expiry,
+		Strike:        table.Strike,
+		BidExchange:   table.BidExchange,
+		BidType:       table.BidType,
+		Bid:           table.Bids[0].Price.Float64(),
+		AskExchange:   table.AskExchange,
+		AskType:       table.AskType,
+		Ask:           table.Asks[0].Price.Float64(),
+		AbsProfit:     table.AbsProfit,
+		Capital:       table.Capital,
+		RelProfit:     table.RelProfit,
+		Apy:           table.Apy,
+		SuggestedSize: table.SuggestedSize,
+		TimeNs:        now.UnixNano(),
+	}
+}
+
+// feedLoop converts the event bus's updates to the feed's messages until ctx ends, for the gRPC streams and the bus
+// bridge.
+func feedLoop(ctx context.Context) {
+	books, index, opportunities := subscribeAll(&BookEvents), subscribeAll(&IndexEvents), subscribeAll(&OpportunityEvents)
+	defer func() {
+		dropped := BookEvents.Unsubscribe(books) + IndexEvents.Unsubscribe(index) + OpportunityEvents.Unsubscribe(opportunities)
+		slog.Info("feedLoop: stopped", "dropped", dropped)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-books.updates:
+			if BookFeed.Active() {
+				BookFeed.Publish(&feedpb.OrderbookUpdate{Instrument: event.Instrument, Exchange: event.Exchange, Bids: feedLevels(event.Bids), Asks: feedLevels(event.Asks), TimeNs: event.Time.UnixNano()})
+			}
+		case event := <-index.updates:
+			if IndexFeed.Active() {
+				IndexFeed.Publish(&feedpb.IndexUpdate{Exchange: event.Exchange, Asset: event.Asset, Price: event.Price, TimeNs: event.Time.UnixNano()})
+			}
+		case event := <-opportunities.updates:
+			if !ArbFeed.Active() {
+				continue
+			}
+			if event.Closed {
+				ArbFeed.Publish(&feedpb.ArbUpdate{Key: event.Key, Closed: true, TimeNs: event.Time.UnixNano()})
+				continue
+			}
+			ArbFeed.Publish(feedArb(event.Key, &event.Table, event.Time))
+		}
+	}
+}
+
+// stringSet is a membership test of values, true for everything when values is empty.
+func stringSet(values []string) func(string) bool {
+	if len(values) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return func(value string) bool { return set[value] }
+}
+
+// streamFeed sends initial, the current state, then the subscriber's updates to send until ctx ends or a send fails.
+// Updates a slow stream doesn't take in time are dropped rather than holding up the decoders.
+func streamFeed[T any](ctx context.Context, name string, topic *feedTopic[T], subscriber *feedSubscriber[T], initial []T, send func(T) error) error {
+	defer func() {
+		if dropped := topic.Unsubscribe(subscriber); dropped > 0 {
+			slog.Warn("streamFeed: slow consumer, updates dropped", "stream", name, "dropped", dropped)
+		}
+	}()
+
+	for _, update := range initial {
+		err := send(update)
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update := <-subscriber.updates:
+			err := send(update)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type feedServer struct {
+	feedpb.UnimplementedFeedServer
+}
+
+func (feedServer) StreamOrderbooks(req *feedpb.StreamOrderbooksRequest, stream feedpb.Feed_StreamOrderbooksServer) error {
+	instruments, exchanges := stringSet(req.Instruments), stringSet(req.Exchanges)
+	subscriber := BookFeed.Subscribe(func(update *feedpb.OrderbookUpdate) bool {
+		return instruments(update.Instrument) && exchanges(update.Exchange)
+	})
+
+	now := time.Now().UnixNano()
+	initial := make([]*feedpb.OrderbookUpdate, 0)
+	for instrument, orderbook := range OrderbookContainer.Snapshot() {
+		if !instruments(instrument) {
+			continue
+		}
+		for exchange := range orderbook.Bids {
+			if exchanges(exchange) {
+				initial = append(initial, &feedpb.OrderbookUpdate{Instrument: instrument, Exchange: exchange, Bids: feedLevels(orderbook.Bids[exchange]), Asks: feedLevels(orderbook.Asks[exchange]), TimeNs: now})
+			}
+		}
+	}
+	return streamFeed(stream.Context(), "orderbooks", &BookFeed, subscriber, initial, stream.Send)
+}
+
+func (feedServer) StreamArbs(req *feedpb.StreamArbsRequest, stream feedpb.Feed_StreamArbsServer) error {
+	assets := stringSet(req.Assets)
+	subscriber := ArbFeed.Subscribe(func(update *feedpb.ArbUpdate) bool {
+		return update.Closed || (assets(update.Asset) && update.Apy >= req.MinApy) //closes aren't filtered, their asset isn't set
+	})
+
+	now := time.Now()
+	initial := make([]*feedpb.ArbUpdate, 0)
+	for key, table := range ArbContainer.Snapshot() {
+		if assets(table.Asset) && table.Apy >= req.MinApy {
+			initial = append(initial, feedArb(key, &table, now))
+		}
+	}
+	return streamFeed(stream.Context(), "arbs", &ArbFeed, subscriber, initial, stream.Send)
+}
+
+func (feedServer) StreamIndex(req *feedpb.StreamIndexRequest, stream feedpb.Feed_StreamIndexServer) error {
+	assets := stringSet(req.Assets)
+	subscriber := IndexFeed.Subscribe(func(update *feedpb.IndexUpdate) bool { return assets(update.Asset) })
+
+	now := time.Now().UnixNano()
+	initial := make([]*feedpb.IndexUpdate, 0)
+	for exchange, index := range map[string]*IndexContainer{"aevo": &AevoIndex, "lyra": &LyraIndex, "deribit": &DeribitIndex, "okx": &OkxIndex, "binance-options": &BinanceOptionsIndex} {
+		for asset, price := range index.Snapshot() {
+			if assets(asset) {
+				initial = append(initial, &feedpb.IndexUpdate{Exchange: exchange, Asset: asset, Price: price, TimeNs: now})
+			}
+		}
+	}
+	return streamFeed(stream.Context(), "index", &IndexFeed, subscriber, initial, stream.Send)
+}
+
+// serveGrpcFeed serves the feed on listen until ctx ends.
+func serveGrpcFeed(ctx context.Context, listen string) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("serveGrpcFeed: %v", err)
+	}
+	server := grpc.NewServer()
+	feedpb.RegisterFeedServer(server, feedServer{})
+	go func() {
+		<-ctx.Done()
+		server.Stop() //streams never end on their own, a graceful stop would wait for the clients
+	}()
+
+	slog.Info("gRPC feed starting", "listen", listen)
+	return server.Serve(listener)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// SampleRing is a fixed capacity ring buffer of samples, oldest overwritten first.
+type SampleRing struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func newSampleRing(capacity int) *SampleRing {
+	return &SampleRing{samples: make([]Sample, capacity)}
+}
+
+func (r *SampleRing) Add(sample Sample) {
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *SampleRing) Len() int {
+	if r.full {
+		return len(r.samples)
+	}
+	return r.next
+}
+
+// at returns the i-th oldest sample.
+func (r *SampleRing) at(i int) Sample {
+	if !r.full {
+		return r.samples[i]
+	}
+	return r.samples[(r.next+i)%len(r.samples)]
+}
+
+// Since returns samples newer than t in chronological order, walking back from the newest so recent windows of a
+// large ring stay cheap.
+func (r *SampleRing) Since(t time.Time) []Sample {
+	n := r.Len()
+	first := n
+	for first > 0 && r.at(first-1).Time.After(t) {
+		first--
+	}
+
+	samples := make([]Sample, 0, n-first)
+	for i := first; i < n; i++ {
+		samples = append(samples, r.at(i))
+	}
+	return samples
+}
+
+type IndexHistoryContainer struct {
+	Mu      sync.Mutex
+	History map[string]*SampleRing //key: exchange + " " + asset
+}
+
+const indexHistorySamples = 24 * 60 * 60 //a day at one sample per second
+
+var IndexHistory = IndexHistoryContainer{History: make(map[string]*SampleRing)}
+
+func recordIndexSamples(exchange string, index *IndexContainer, now time.Time) {
+	prices := index.Snapshot()
+
+	IndexHistory.Mu.Lock()
+	defer IndexHistory.Mu.Unlock()
+	for asset, price := range prices {
+		key := exchange + " " + asset
+		ring, exists := IndexHistory.History[key]
+		if !exists {
+			ring = newSampleRing(indexHistorySamples)
+			IndexHistory.History[key] = ring
+		}
+		ring.Add(Sample{now, price})
+	}
+}
+
+// indexHistoryLoop samples every exchange's index once a second.
+func indexHistoryLoop() {
+	for {
+		now := time.Now()
+		recordIndexSamples("aevo", &AevoIndex, now)
+		recordIndexSamples("lyra", &LyraIndex, now)
+		recordIndexSamples("deribit", &DeribitIndex, now)
+		recordIndexSamples("okx", &OkxIndex, now)
+		recordIndexSamples("binance-options", &BinanceOptionsIndex, now)
+		time.Sleep(time.Second)
+	}
+}
+
+func indexSamples(exchange string, asset string, since time.Time) []Sample {
+	IndexHistory.Mu.Lock()
+	defer IndexHistory.Mu.Unlock()
+
+	ring, exists := IndexHistory.History[exchange+" "+asset]
+	if !exists {
+		return nil
+	}
+	return ring.Since(since)
+}
+
+// realizedVol is the annualized standard deviation of log returns between samples, 0 with fewer than 3 samples.
+func realizedVol(samples []Sample) float64 {
+	if len(samples) < 3 {
+		return 0
+	}
+
+	returns := make([]float64, 0, len(samples)-1)
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1].Value > 0 && samples[i].Value > 0 {
+			returns = append(returns, math.Log(samples[i].Value/samples[i-1].Value))
+		}
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+
+	interval := samples[len(samples)-1].Time.Sub(samples[0].Time).Seconds() / float64(len(returns))
+	if interval <= 0 {
+		return 0
+	}
+	return math.Sqrt(variance * (365 * 24 * 60 * 60 / interval))
+}
@@ -0,0 +1,56 @@
+package main
+
+import "math"
+
+// OptionMarginModel is an exchange's initial margin per short option contract, the form aevo and deribit publish:
+// max(Base * spot - OTM amount, Floor * spot) + mark for calls, max(Base * spot - OTM amount, Floor * strike) + mark
+// for puts.
+type OptionMarginModel struct {
+	Base  float64
+	Floor float64
+}
+
+// OptionMarginModels by exchange, exchanges without one are margined like aevo.
+var OptionMarginModels = map[string]OptionMarginModel{
+	"aevo":    {0.15, 0.1},
+	"deribit": {0.15, 0.1},
+}
+
+var HedgeMarginRate float64 = 0.1 //margin posted per contract of perpetual hedge as a fraction of the index
+
+// shortOptionMargin is the initial margin of selling one contract on exchange at mark.
+func shortOptionMargin(exchange string, optionType string, strike float64, spot float64, mark float64) float64 {
+	model, exists := OptionMarginModels[exchange]
+	if !exists {
+		model = OptionMarginModels["aevo"]
+	}
+
+	otm := math.Max(strike-spot, 0)
+	floor := model.Floor * spot
+	if optionType == "P" {
+		otm = math.Max(spot-strike, 0)
+		floor = model.Floor * strike
+	}
+	return math.Max(model.Base*spot-otm, floor) + mark
+}
+
+// LegMargins are the initial margins an opportunity locks per contract, their Total the capital Apy is computed on.
+type LegMargins struct {
+	Short float64 //the option sold
+	Long  float64 //the option bought, its premium
+	Hedge float64 //the perpetual hedge
+}
+
+func (m LegMargins) Total() float64 {
+	return m.Short + m.Long + m.Hedge
+}
+
+// arbMargins margins a parity opportunity selling short (of shortType) and buying long, the sold price standing in
+// for the mark.
+func arbMargins(short Order, shortType string, long Order, strike float64, index float64) LegMargins {
+	return LegMargins{
+		Short: shortOptionMargin(short.Exchange, shortType, strike, index, short.Price.Float64()),
+		Long:  long.Price.Float64(),
+		Hedge: HedgeMarginRate * index,
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Instrument is a parsed option name. The store keys books by its aevo style String, "ETH-28JUN24-3000-C", other
+// venues name the same option with their own expiry format, parseVenueInstrument and VenueName map between them.
+type Instrument struct {
+	Asset  string
+	Expiry time.Time //08:00 UTC settlement
+	Strike float64
+	Type   string //"C" or "P"
+}
+
+// instrumentExpiryLayouts are the venues' expiry formats, month names parse case insensitively.
+var instrumentExpiryLayouts = map[string]string{
+	"aevo":    "02Jan06",  //"28JUN24"
+	"deribit": "2Jan06",   //"5JUL24", no leading zero on the day
+	"lyra":    "20060102", //"20240628"
+	"okx":     "060102",   //"240628", the settlement currency between asset and expiry: "ETH-USD-240628-3000-C"
+
+	"binance-options": "060102", //"ETH-240628-3000-C"
+}
+
+// parseInstrument parses an aevo style name, the naming of the store.
+func parseInstrument(name string) (Instrument, error) {
+	return parseVenueInstrument("aevo", name)
+}
+
+// parseVenueInstrument parses an option name in exchange's naming, validating every component.
+func parseVenueInstrument(exchange string, name string) (Instrument, error) {
+	layout, exists := instrumentExpiryLayouts[exchange]
+	if !exists {
+		return Instrument{}, fmt.Errorf("parseVenueInstrument: no naming scheme for exchange %v", exchange)
+	}
+	parts := strings.Split(name, "-")
+	if exchange == "okx" && len(parts) == 5 && parts[1] == "USD" {
+		parts = append(parts[:1:1], parts[2:]...)
+	}
+	if len(parts) != 4 {
+		return Instrument{}, fmt.Errorf("parseVenueInstrument: not an option: %v", name)
+	}
+
+	asset := parts[0]
+	if asset == "" || strings.ToUpper(asset) != asset {
+		return Instrument{}, fmt.Errorf("parseVenueInstrument: bad asset in %v", name)
+	}
+	expiry, err := time.Parse(layout, parts[1])
+	if err != nil {
+		return Instrument{}, fmt.Errorf("parseVenueInstrument: bad expiry in %v: %v", name, err)
+	}
+	strike, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || strike <= 0 {
+		return Instrument{}, fmt.Errorf("parseVenueInstrument: bad strike in %v", name)
+	}
+	if parts[3] != "C" && parts[3] != "P" {
+		return Instrument{}, fmt.Errorf("parseVenueInstrument: bad option type in %v", name)
+	}
+	return Instrument{asset, expiry.Add(8 * time.Hour), strike, parts[3]}, nil
+}
+
+// instrumentAsset is the asset of an aevo style name, without parsing the rest of it.
+func instrumentAsset(name string) string {
+	asset, _, _ := strings.Cut(name, "-")
+	return asset
+}
+
+// ExpiryCode is the aevo style expiry component, e.g. "28JUN24", as ArbTable.Expiry holds it.
+func (i Instrument) ExpiryCode() string {
+	return strings.ToUpper(i.Expiry.Format("02Jan06"))
+}
+
+// Key is the name without the option type, e.g. "ETH-28JUN24-3000", the strike's call and put share it.
+func (i Instrument) Key() string {
+	return i.Asset + "-" + i.ExpiryCode() + "-" + strconv.FormatFloat(i.Strike, 'f', -1, 64)
+}
+
+func (i Instrument) String() string {
+	return i.Key() + "-" + i.Type
+}
+
+// VenueName is the instrument in exchange's naming, e.g. "ETH-20240628-3000-C" on lyra, the aevo name for exchanges
+// without a naming scheme.
+func (i Instrument) VenueName(exchange string) string {
+	layout, exists := instrumentExpiryLayouts[exchange]
+	if !exists {
+		return i.String()
+	}
+	asset := i.Asset
+	if exchange == "okx" {
+		asset += "-USD"
+	}
+	return asset + "-" + strings.ToUpper(i.Expiry.Format(layout)) + "-" + strconv.FormatFloat(i.Strike, 'f', -1, 64) + "-" + i.Type
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+var MaxProcessingLatency = 250 * time.Millisecond //0 disables the warnings
+
+const latencyWarnEvery = time.Minute
+
+// latencyBuckets are the histograms' upper bounds, latencies above the last one fall into an overflow bucket.
+var latencyBuckets = [...]time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	2 * time.Second, 5 * time.Second,
+}
+
+// latencyHistogram counts a channel's processing latencies, from its frames being read to them being applied, or an
+// exchange's feed latencies net of its clock offset.
+type latencyHistogram struct {
+	Counts  [len(latencyBuckets) + 1]int64
+	Samples int64
+	Sum     time.Duration
+	Max     time.Duration
+}
+
+func (h *latencyHistogram) Add(latency time.Duration) {
+	latency = max(latency, 0)
+	bucket := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+	h.Counts[bucket]++
+	h.Samples++
+	h.Sum += latency
+	h.Max = max(h.Max, latency)
+}
+
+// Quantile is the upper bound of the bucket the q quantile falls into, Max for the overflow bucket.
+func (h *latencyHistogram) Quantile(q float64) time.Duration {
+	if h.Samples == 0 {
+		return 0
+	}
+	rank := int64(q * float64(h.Samples))
+	seen := int64(0)
+	for bucket, count := range h.Counts {
+		seen += count
+		if seen > rank && bucket < len(latencyBuckets) {
+			return min(latencyBuckets[bucket], h.Max)
+		}
+	}
+	return h.Max
+}
+
+type latencyBucketJson struct {
+	LeMs  float64 `json:"le_ms"` //upper bound, -1 for the overflow bucket
+	Count int64   `json:"count"`
+}
+
+type latencyHistogramJson struct {
+	Samples int64               `json:"samples"`
+	MeanMs  float64             `json:"mean_ms"`
+	P50Ms   float64             `json:"p50_ms"`
+	P90Ms   float64             `json:"p90_ms"`
+	P99Ms   float64             `json:"p99_ms"`
+	MaxMs   float64             `json:"max_ms"`
+	Buckets []latencyBucketJson `json:"buckets"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (h *latencyHistogram) json() latencyHistogramJson {
+	histogram := latencyHistogramJson{
+		Samples: h.Samples,
+		P50Ms:   milliseconds(h.Quantile(0.5)),
+		P90Ms:   milliseconds(h.Quantile(0.9)),
+		P99Ms:   milliseconds(h.Quantile(0.99)),
+		MaxMs:   milliseconds(h.Max),
+		Buckets: make([]latencyBucketJson, len(h.Counts)),
+	}
+	if h.Samples > 0 {
+		histogram.MeanMs = milliseconds(h.Sum) / float64(h.Samples)
+	}
+	for bucket, count := range h.Counts {
+		histogram.Buckets[bucket] = latencyBucketJson{-1, count}
+		if bucket < len(latencyBuckets) {
+			histogram.Buckets[bucket].LeMs = milliseconds(latencyBuckets[bucket])
+		}
+	}
+	return histogram
+}
+
+// warnSlowProcessing logs a channel's processing latency over MaxProcessingLatency.
+func warnSlowProcessing(exchange string, channel string, latency time.Duration) {
+	slog.Warn("recordChannelUpdate: processing latency over bound", "exchange", exchange, "channel", channel, "latency", latency, "bound", MaxProcessingLatency)
+}
+
+type channelLatencyJson struct {
+	Exchange   string               `json:"exchange"`
+	Channel    string               `json:"channel"`
+	Processing latencyHistogramJson `json:"processing"`
+}
+
+type exchangeLatencyJson struct {
+	ClockOffsetMs float64              `json:"clock_offset_ms"` //estimated, see latency.go
+	Feed          latencyHistogramJson `json:"feed"`            //net of the clock offset
+}
+
+// latencyHandler serves /api/latency, each exchange's clock offset and feed latency histogram and each channel's
+// processing latency histogram, slowest p99 first, of one exchange with ?exchange=. An offset below zero means the
+// exchange's clock runs ahead of ours.
+func latencyHandler(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("exchange")
+
+	exchanges := make(map[string]exchangeLatencyJson)
+	LagContainer.Mu.Lock()
+	for exchange, lag := range LagContainer.Lags {
+		if filter == "" || exchange == filter {
+			exchanges[exchange] = exchangeLatencyJson{milliseconds(lag.Offset), lag.Feed.json()}
+		}
+	}
+	LagContainer.Mu.Unlock()
+
+	channels := make([]channelLatencyJson, 0)
+	StatsContainer.Mu.Lock()
+	for _, stats := range StatsContainer.Stats {
+		if (filter == "" || stats.Exchange == filter) && stats.Processing.Samples > 0 {
+			channels = append(channels, channelLatencyJson{stats.Exchange, stats.Channel, stats.Processing.json()})
+		}
+	}
+	StatsContainer.Mu.Unlock()
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Processing.P99Ms > channels[j].Processing.P99Ms })
+
+	writeJson(w, "latencyHandler", struct {
+		MaxProcessingMs float64                        `json:"max_processing_ms"`
+		Exchanges       map[string]exchangeLatencyJson `json:"exchanges"`
+		Channels        []channelLatencyJson           `json:"channels"`
+	}{milliseconds(MaxProcessingLatency), exchanges, channels})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// arbLife is one opportunity from the arb pass it was found in to the pass it was gone in, arb_opportunities has its
+// changes in between.
+type arbLife struct {
+	Key        string
+	Opened     time.Time
+	LastSeen   time.Time
+	Closed     time.Time //zero while open
+	Open       *ArbTable //as first found
+	Last       *ArbTable
+	PeakProfit float64
+	PeakApy    float64
+	Passes     int //arb passes it was open in
+	Updates    int //passes its profit changed in
+}
+
+type ArbLivesContainer struct {
+	Mu     sync.Mutex
+	Lives  map[string]*arbLife //open, key: ArbTables key
+	Closed []*arbLife          //the last ArbLifeHistory closed, oldest first
+}
+
+var ArbLives = ArbLivesContainer{Lives: make(map[string]*arbLife)}
+
+// ArbPersistAfter is how long an opportunity has to stay open to count as persisted, long enough to act on rather
+// than a blip between two book updates.
+var ArbPersistAfter = time.Second
+
+var ArbLifeHistory = 1000 //closed lives kept for /api/arb-lifetimes
+
+// ArbEvent is a change in an opportunity's life published on ArbEvents, Life a copy as of the event.
+type ArbEvent struct {
+	Type string //"appear", "update" or "disappear"
+	Key  string
+	Time time.Time
+	Life arbLife
+}
+
+var ArbEvents feedTopic[ArbEvent]
+
+func publishArbEvent(eventType string, life *arbLife, now time.Time) {
+	if !ArbEvents.Active() {
+		return
+	}
+	ArbEvents.Publish(ArbEvent{Type: eventType, Key: life.Key, Time: now, Life: *life})
+}
+
+// trackArbLives opens a life for every new opportunity of asset, updates those still open and closes those of asset
+// that are gone, after an arb pass at now. The caller holds ArbContainer.Mu.
+func trackArbLives(asset string, now time.Time) {
+	ArbLives.Mu.Lock()
+	defer ArbLives.Mu.Unlock()
+	for key, table := range ArbContainer.ArbTables {
+		if table.Asset != asset {
+			continue
+		}
+		life, exists := ArbLives.Lives[key]
+		eventType := ""
+		if !exists {
+			life = &arbLife{Key: key, Opened: now, Open: table}
+			ArbLives.Lives[key] = life
+			eventType = "appear"
+		} else if table.AbsProfit != life.Last.AbsProfit {
+			life.Updates++
+			eventType = "update"
+		}
+		life.LastSeen, life.Last = now, table
+		life.Passes++
+		life.PeakProfit = max(life.PeakProfit, table.AbsProfit)
+		life.PeakApy = max(life.PeakApy, table.Apy)
+		if eventType != "" {
+			publishArbEvent(eventType, life, now)
+		}
+	}
+
+	for key, life := range ArbLives.Lives {
+		if life.Open.Asset != asset {
+			continue
+		}
+		if _, exists := ArbContainer.ArbTables[key]; !exists {
+			closeArbLife(life, now, false)
+			delete(ArbLives.Lives, key)
+		}
+	}
+}
+
+// closeArbLife moves life to the history and records it. The caller holds ArbLives.Mu.
+func closeArbLife(life *arbLife, now time.Time, openAtExit bool) {
+	life.Closed = now
+	publishArbEvent("disappear", life, now)
+	ArbLives.Closed = append(ArbLives.Closed, life)
+	recordArbStats(life)
+	if excess := len(ArbLives.Closed) - ArbLifeHistory; excess > 0 {
+		ArbLives.Closed = append(ArbLives.Closed[:0], ArbLives.Closed[excess:]...)
+	}
+	if Ticks != nil {
+		recordArbLife(life.Key, life, now, openAtExit)
+	}
+}
+
+// closeArbLives closes the opportunities still open at shutdown at now, recorded flagged open_at_exit, their
+// lifetimes are lower bounds.
+func closeArbLives(now time.Time) {
+	ArbLives.Mu.Lock()
+	defer ArbLives.Mu.Unlock()
+	for key, life := range ArbLives.Lives {
+		closeArbLife(life, now, true)
+		delete(ArbLives.Lives, key)
+	}
+}
+
+func recordArbLife(key string, life *arbLife, closed time.Time, openAtExit bool) {
+	lifetime := closed.Sub(life.Opened)
+	open := life.Open
+	Ticks.Enqueue("arb_lifetimes", life.Opened.UnixNano(), closed.UnixNano(), float64(lifetime)/float64(time.Millisecond), key,
+		open.Asset, open.Expiry, open.Strike, open.BidExchange, open.BidType, open.Bids[0].Price.Float64(), open.AskExchange, open.AskType,
+		open.Asks[0].Price.Float64(), open.AbsProfit, life.PeakProfit, life.Last.AbsProfit, life.PeakApy, open.ExecutableSize,
+		open.SuggestedSize, life.Passes, life.Updates, lifetime >= ArbPersistAfter, openAtExit)
+}
+
+type arbLifeJson struct {
+	Key         string     `json:"key"`
+	Opened      time.Time  `json:"first_seen"`
+	LastSeen    time.Time  `json:"last_seen"`
+	Closed      *time.Time `json:"disappeared,omitempty"`
+	LifetimeMs  float64    `json:"lifetime_ms"` //until now for open lives
+	OpenProfit  float64    `json:"open_profit"`
+	LastProfit  float64    `json:"last_profit"`
+	PeakProfit  float64    `json:"peak_profit"`
+	PeakApy     float64    `json:"peak_apy"`
+	BidExchange string     `json:"bid_exchange"`
+	AskExchange string     `json:"ask_exchange"`
+	Passes      int        `json:"passes"`
+	Updates     int        `json:"updates"`
+	Persisted   bool       `json:"persisted"` //open for at least ArbPersistAfter
+}
+
+func (life *arbLife) json(now time.Time) arbLifeJson {
+	end := now
+	var closed *time.Time
+	if !life.Closed.IsZero() {
+		end = life.Closed
+		closed = &life.Closed
+	}
+	lifetime := end.Sub(life.Opened)
+	return arbLifeJson{life.Key, life.Opened, life.LastSeen, closed, float64(lifetime) / float64(time.Millisecond),
+		life.Open.AbsProfit, life.Last.AbsProfit, life.PeakProfit, life.PeakApy, life.Last.BidExchange, life.Last.AskExchange,
+		life.Passes, life.Updates, lifetime >= ArbPersistAfter}
+}
+
+type arbLifeStatsJson struct {
+	Closed          int     `json:"closed"` //in the history
+	Persisted       int     `json:"persisted"`
+	PersistedPct    float64 `json:"persisted_pct"`
+	MedianMs        float64 `json:"median_lifetime_ms"`
+	P90Ms           float64 `json:"p90_lifetime_ms"`
+	MeanPeakProfit  float64 `json:"mean_peak_profit"`
+	MeanPeakDecline float64 `json:"mean_peak_decline"` //peak less last profit, how much an opportunity fades before it's gone
+}
+
+func arbLifeStats(closed []arbLifeJson) arbLifeStatsJson {
+	stats := arbLifeStatsJson{Closed: len(closed)}
+	if len(closed) == 0 {
+		return stats
+	}
+	lifetimes := make([]float64, len(closed))
+	for i, life := range closed {
+		lifetimes[i] = life.LifetimeMs
+		if life.Persisted {
+			stats.Persisted++
+		}
+		stats.MeanPeakProfit += life.PeakProfit / float64(len(closed))
+		stats.MeanPeakDecline += (life.PeakProfit - life.LastProfit) / float64(len(closed))
+	}
+	sort.Float64s(lifetimes)
+	stats.PersistedPct = float64(stats.Persisted) / float64(len(closed)) * 100
+	stats.MedianMs = lifetimes[len(lifetimes)/2]
+	stats.P90Ms = lifetimes[len(lifetimes)*9/10]
+	return stats
+}
+
+// arbLifetimesHandler serves /api/arb-lifetimes, the open opportunities, the last ?limit= (default 100) closed ones
+// newest first and persistence statistics over the whole history, of one asset with ?asset=.
+func arbLifetimesHandler(w http.ResponseWriter, r *http.Request) {
+	asset := r.URL.Query().Get("asset")
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "limit: not a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	now := time.Now()
+
+	open := make([]arbLifeJson, 0)
+	closed := make([]arbLifeJson, 0)
+	ArbLives.Mu.Lock()
+	for _, life := range ArbLives.Lives {
+		if asset == "" || life.Open.Asset == asset {
+			open = append(open, life.json(now))
+		}
+	}
+	for i := len(ArbLives.Closed) - 1; i >= 0; i-- {
+		if life := ArbLives.Closed[i]; asset == "" || life.Open.Asset == asset {
+			closed = append(closed, life.json(now))
+		}
+	}
+	ArbLives.Mu.Unlock()
+	sort.Slice(open, func(i, j int) bool { return open[i].Opened.Before(open[j].Opened) })
+
+	writeJson(w, "arbLifetimesHandler", struct {
+		Open   []arbLifeJson    `json:"open"`
+		Recent []arbLifeJson    `json:"recent"`
+		Stats  arbLifeStatsJson `json:"stats"`
+	}{open, closed[:min(limit, len(closed))], arbLifeStats(closed)})
+}
+
+// arbEventsHandler streams lifecycle events as server-sent "appear", "update" and "disappear" events with the life as
+// JSON data, of one asset with ?asset=, until the client goes away.
+func arbEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	asset := r.URL.Query().Get("asset")
+
+	subscriber := ArbEvents.Subscribe(func(event ArbEvent) bool { return asset == "" || event.Life.Open.Asset == asset })
+	defer ArbEvents.Unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-subscriber.updates:
+			data, _ := json.Marshal(event.Life.json(event.Time)) //plain numbers, strings and times
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
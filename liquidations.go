@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const BinanceFuturesWss string = "wss://fstream.binance.com/ws"
+
+// LiquidationsContainer tracks binance USD-M futures force orders, aevo has no public liquidation channel.
+type LiquidationsContainer struct {
+	Mu              sync.Mutex
+	Notional        *SampleRing //USD notional per force order
+	WindowUntil     time.Time   //end of the current post-liquidation window
+	BaselineSpread  float64     //median relative spread (%) before the burst
+	BurstSpread     float64     //widest median relative spread seen during the window
+	LastBurstVolume float64
+}
+
+var Liquidations = LiquidationsContainer{Notional: newSampleRing(10000)}
+
+var LiquidationBurst float64 = 1000000                //USD notional within a minute that counts as a burst
+var LiquidationWindow time.Duration = 5 * time.Minute //how long after a burst opportunities are tagged
+
+func binanceSubscribeJson(channels []string) []byte {
+	data := struct {
+		Method string   `json:"method"`
+		Params []string `json:"params"`
+		Id     int      `json:"id"`
+	}{
+		"SUBSCRIBE",
+		channels,
+		1,
+	}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings and an int always marshals
+
+	return jsonData
+}
+
+func binanceLiquidationChannels(assets []string) []string {
+	channels := []string{}
+	for _, asset := range assets {
+		channels = append(channels, strings.ToLower(asset)+"usdt@forceOrder")
+	}
+
+	return channels
+}
+
+// binanceEvent is the event type of a binance stream frame, e.g. "forceOrder", the registry's channel for binance.
+func binanceEvent(raw []byte) []byte {
+	key := []byte(`"e":"`)
+	start := bytes.Index(raw, key)
+	if start < 0 {
+		return nil
+	}
+	start += len(key)
+	end := bytes.IndexByte(raw[start:], '"')
+	if end < 0 {
+		return nil
+	}
+	return raw[start : start+end]
+}
+
+func binanceDecodeForceOrder(raw []byte) error {
+	var res struct {
+		Order struct {
+			Symbol       string  `json:"s"`
+			Side         string  `json:"S"`
+			AveragePrice float64 `json:"ap,string"`
+			FilledAmount float64 `json:"z,string"`
+			TradeTime    int64   `json:"T"`
+		} `json:"o"`
+	}
+	err := json.Unmarshal(raw, &res)
+	if err != nil {
+		return err
+	}
+
+	notional := res.Order.AveragePrice * res.Order.FilledAmount
+	Liquidations.Mu.Lock()
+	Liquidations.Notional.Add(Sample{time.UnixMilli(res.Order.TradeTime), notional})
+	Liquidations.Mu.Unlock()
+	return nil
+}
+
+// medianRelativeSpread is the median (ask - bid) / mid in percent over all two sided aevo books.
+func medianRelativeSpread() float64 {
+	OrderbookContainer.Mu.RLock()
+	spreads := make([]float64, 0, len(OrderbookContainer.Orderbooks))
+	for _, orderbook := range OrderbookContainer.Orderbooks {
+		bids, asks := orderbook.Bids["aevo"], orderbook.Asks["aevo"]
+		if len(bids) == 0 || len(asks) == 0 {
+			continue
+		}
+		mid := (bids[0].Price + asks[0].Price).Float64() / 2
+		if mid > 0 {
+			spreads = append(spreads, (asks[0].Price-bids[0].Price).Float64()/mid*100)
+		}
+	}
+	OrderbookContainer.Mu.RUnlock()
+
+	if len(spreads) == 0 {
+		return 0
+	}
+	sort.Float64s(spreads)
+	return spreads[len(spreads)/2]
+}
+
+func postLiquidationWindow() bool {
+	Liquidations.Mu.Lock()
+	defer Liquidations.Mu.Unlock()
+	return time.Now().Before(Liquidations.WindowUntil)
+}
+
+// liquidationLoop opens a post-liquidation window whenever the last minute's force order notional exceeds
+// LiquidationBurst, and logs how option spreads moved relative to before the burst when the window closes.
+func liquidationLoop() {
+	baseline := 0.0
+	for {
+		now := time.Now()
+		spread := medianRelativeSpread()
+
+		volume := 0.0
+		Liquidations.Mu.Lock()
+		for _, sample := range Liquidations.Notional.Since(now.Add(-time.Minute)) {
+			volume += sample.Value
+		}
+
+		inWindow := now.Before(Liquidations.WindowUntil)
+		switch {
+		case volume >= LiquidationBurst:
+			if !inWindow {
+				Liquidations.BaselineSpread = baseline
+				Liquidations.BurstSpread = spread
+				slog.Warn("LIQUIDATION BURST", "usd_last_minute", volume, "median_spread_pct", spread, "baseline_spread_pct", baseline)
+			}
+			Liquidations.WindowUntil = now.Add(LiquidationWindow)
+			Liquidations.LastBurstVolume = volume
+		case inWindow:
+			Liquidations.BurstSpread = math.Max(Liquidations.BurstSpread, spread)
+		case !Liquidations.WindowUntil.IsZero():
+			slog.Info("LIQUIDATION BURST: window closed", "peak_spread_pct", Liquidations.BurstSpread, "baseline_spread_pct", Liquidations.BaselineSpread, "spread_pct", spread)
+			Liquidations.WindowUntil = time.Time{}
+		default:
+			if spread > 0 {
+				baseline = spread
+			}
+		}
+		Liquidations.Mu.Unlock()
+
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// setupLogging installs the default slog logger at level ("debug", "info", "warn" or "error") in format ("text" or
+// "json") writing to w, stderr unless the terminal is taken by -tui. The standard log package writes through it too,
+// at info.
+func setupLogging(level string, format string, w io.Writer) error {
+	var logLevel slog.Level
+	err := logLevel.UnmarshalText([]byte(level))
+	if err != nil {
+		return fmt.Errorf("setupLogging: %v", err)
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("setupLogging: unknown log format: %v", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// debugEnabled guards debug logs of whole books, so their arguments aren't built on the hot path unless they're
+// written.
+func debugEnabled() bool {
+	return slog.Default().Enabled(context.Background(), slog.LevelDebug)
+}
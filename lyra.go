@@ -1,78 +1,103 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"reflect"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
-	"nhooyr.io/websocket"
+	"options-ws/decimal"
+	"options-ws/ratelimit"
 )
 
-func lyraMarkets(asset string) map[string]interface{} {
-	url := LyraHttp + "/public/get_instruments"
+// lyraMarket is an instrument of /public/get_instruments, which Derive (lyra's rebrand) still serves under the lyra
+// hosts.
+type lyraMarket struct {
+	InstrumentName string          `json:"instrument_name"` //e.g. "ETH-20240628-3000-C"
+	IsActive       bool            `json:"is_active"`
+	MaximumAmount  float64         `json:"maximum_amount,string"`
+	MinimumAmount  float64         `json:"minimum_amount,string"`
+	TickSize       decimal.Decimal `json:"tick_size"` //sent as a string
+	AmountStep     decimal.Decimal `json:"amount_step"`
+	OptionDetails  *struct {
+		Expiry     int64  `json:"expiry"` //unix seconds
+		OptionType string `json:"option_type"`
+	} `json:"option_details"`
+}
 
-	payload := strings.NewReader(fmt.Sprintf("{\"expired\":false,\"instrument_type\":\"option\",\"currency\":\"%v\"}", asset))
+type lyraMarketsResponse struct {
+	Result []lyraMarket `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
 
-	req, _ := http.NewRequest("POST", url, payload)
+func lyraMarkets(asset string) ([]lyraMarket, error) {
+	url := LyraHttp + "/public/get_instruments"
 
-	req.Header.Add("accept", "application/json")
-	req.Header.Add("content-type", "application/json")
+	payload := fmt.Sprintf("{\"expired\":false,\"instrument_type\":\"option\",\"currency\":\"%v\"}", asset)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["lyra"], func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("content-type", "application/json")
+		return req, nil
+	})
 	if err != nil {
-		log.Fatalf("lyraMarkets: request error: %v", err)
+		return nil, fmt.Errorf("lyraMarkets: request error: %v", err)
 	}
 
 	defer res.Body.Close()
 
-	var markets map[string]interface{}
+	var markets lyraMarketsResponse
 
 	decoder := json.NewDecoder(res.Body)
 	err = decoder.Decode(&markets)
 	if err != nil {
-		log.Fatalf("markets json decode error: %v", err)
+		return nil, fmt.Errorf("lyraMarkets: json decode error: %v", err)
+	}
+	if markets.Error != nil {
+		return nil, fmt.Errorf("lyraMarkets: %v: %v", markets.Error.Code, markets.Error.Message)
 	}
 
-	return markets
+	return markets.Result, nil
 }
 
-func lyraInstruments(markets map[string]interface{}) []string {
+// lyraInstruments returns the active options among markets, lyra lists instruments a while before they trade.
+func lyraInstruments(markets []lyraMarket) []string {
 	var instruments []string
-	result, ok := markets["result"].([]interface{})
-	if !ok {
-		log.Printf("lyraInstruments: unable to convert markets['result'] to []interface{}")
-		return instruments
-	}
-
-	var instrument string
-	var market map[string]interface{}
-	for _, item := range result {
-		market = item.(map[string]interface{})
-		instrument = market["instrument_name"].(string)
-
-		instruments = append(instruments, instrument)
+	for _, market := range markets {
+		if !market.IsActive || market.OptionDetails == nil {
+			continue
+		}
+		instruments = append(instruments, market.InstrumentName)
 	}
 
 	return instruments
 }
 
-func lyraOrderbookJson(instruments []string) []byte {
-	params := make(map[string][]string)
-	params["channels"] = []string{}
-
-	var param string
-	for _, instrument := range instruments {
-		param = "orderbook." + instrument + ".10.10"
-		params["channels"] = append(params["channels"], param)
+// lyraListings are the active options of markets with their expiry times, lyra settles in USDC.
+func lyraListings(markets []lyraMarket) []Listing {
+	listings := make([]Listing, 0, len(markets))
+	for _, market := range markets {
+		if !market.IsActive || market.OptionDetails == nil {
+			continue
+		}
+		listing, err := newListing("lyra", market.InstrumentName, time.Unix(market.OptionDetails.Expiry, 0), "USD")
+		if err == nil {
+			listings = append(listings, listing)
+		}
 	}
+	return listings
+}
 
+func lyraSubscribeJson(channels []string) []byte {
 	data := struct {
 		Id     string              `json:"id"`
 		Method string              `json:"method"`
@@ -80,217 +105,265 @@ func lyraOrderbookJson(instruments []string) []byte {
 	}{
 		"2",
 		"subscribe",
-		params,
+		map[string][]string{"channels": channels},
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Fatalf("orderbook json marshal error: %v", err)
-	}
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
 
 	return jsonData
 }
 
-func lyraIndexJson(assets []string) []byte {
-	params := make(map[string][]string)
-	params["channels"] = []string{}
-
-	var param string
-	for _, asset := range assets {
-		param = "spot_feed." + asset
-		params["channels"] = append(params["channels"], param)
-	}
-
+func lyraUnsubscribeJson(channels []string) []byte {
 	data := struct {
 		Id     string              `json:"id"`
 		Method string              `json:"method"`
 		Params map[string][]string `json:"params"`
-	}{
-		"2",
-		"subscribe",
-		params,
-	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Fatalf("orderbook json marshal error: %v", err)
-	}
+	}{"3", "unsubscribe", map[string][]string{"channels": channels}}
 
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
 	return jsonData
 }
 
-func lyraWssReqOrderbook(instruments []string, ctx context.Context, c *websocket.Conn) {
-	var data []byte
-	for i := 0; true; i += 20 {
-		if i+20 < len(instruments) {
-			data = lyraOrderbookJson(instruments[i : i+20])
-		} else {
-			data = lyraOrderbookJson(instruments[i:])
-		}
+// lyraNormalizeInstrument converts lyra's "ETH-20240628-3000-C" to the aevo style "ETH-28JUN24-3000-C" used as
+// Orderbooks key.
+func lyraNormalizeInstrument(lyraInstrument string) (string, error) {
+	instrument, err := normalizeVenueInstrument("lyra", lyraInstrument)
+	if err != nil {
+		return "", fmt.Errorf("lyraNormalizeInstrument: %v", err)
+	}
+	return instrument, nil
+}
 
-		// fmt.Printf("subscribe: %v\n\n", string(data))
-		err := c.Write(ctx, 1, data)
-		if err != nil {
-			log.Fatalf("Write error: %v\n", err)
+func lyraOrderbookChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		if normalized, err := lyraNormalizeInstrument(instrument); err == nil && isWatched(normalized) {
+			channels = append(channels, "orderbook."+instrument+".10.100") //full depth for the watchlist
+			continue
 		}
+		channels = append(channels, "orderbook."+instrument+".10.10")
+	}
 
-		if i+20 > len(instruments) {
-			break
-		}
+	return channels
+}
 
-		time.Sleep(100 * time.Millisecond)
+func lyraIndexChannels(assets []string) []string {
+	channels := []string{}
+	for _, asset := range assets {
+		channels = append(channels, "spot_feed."+asset)
 	}
+
+	return channels
 }
 
-func lyraWssReqIndex(assets []string, ctx context.Context, c *websocket.Conn) {
-	data := lyraIndexJson(assets)
-	fmt.Printf("subscribe: %v\n\n", string(data))
+// lyraLevel is one [price, amount] orderbook level, sent as an array of number strings.
+type lyraLevel struct {
+	Price  decimal.Decimal
+	Amount float64
+}
 
-	err := c.Write(ctx, 1, data)
+func (l *lyraLevel) UnmarshalJSON(data []byte) error {
+	var price decimal.Decimal
+	var values [1]float64
+	err := parseNumberStrings(data, &price, values[:])
 	if err != nil {
-		log.Fatalf("Write error: %v\n", err)
+		return err
 	}
+	*l = lyraLevel{price, values[0]}
+	return nil
 }
 
-func lyraUpdateOrderbooks(data map[string]interface{}) {
-	lyraInstrument, ok := data["instrument_name"].(string)
-	bidsRaw, bidsOk := data["bids"].([]interface{})
-	asksRaw, asksOk := data["asks"].([]interface{})
-	timestamp, timeOk := data["timestamp"].(float64)
-	if (!ok || !timeOk) || !(bidsOk || asksOk) {
-		log.Printf("lyraUpdateOrderbooks: unable to convert field: response: %+v", data)
-		return
-	}
+type lyraOrderbook struct {
+	InstrumentName string      `json:"instrument_name"`
+	Bids           []lyraLevel `json:"bids"`
+	Asks           []lyraLevel `json:"asks"`
+	Timestamp      float64     `json:"timestamp"` //unix milliseconds
+}
 
-	if len(bidsRaw) <= 0 && len(asksRaw) <= 0 {
-		return
+type lyraSpotFeed struct {
+	Feeds map[string]struct {
+		Price float64 `json:"price,string"`
+	} `json:"feeds"`
+}
+
+// lyraOrderbookMessage and lyraSpotFeedMessage are the "subscription" notifications of the two channel types.
+type lyraOrderbookMessage struct {
+	Params struct {
+		Channel string        `json:"channel"`
+		Data    lyraOrderbook `json:"data"`
+	} `json:"params"`
+}
+
+type lyraSpotFeedMessage struct {
+	Params struct {
+		Channel string       `json:"channel"`
+		Data    lyraSpotFeed `json:"data"`
+	} `json:"params"`
+}
+
+// lyraOrders converts decoded levels to Orders sorted best first, lyra doesn't publish level IVs so Iv is -1.
+func lyraOrders(levels []lyraLevel, descending bool) []Order {
+	orders := make([]Order, len(levels))
+	for i, level := range levels {
+		orders[i] = Order{level.Price, level.Amount, -1, "lyra"}
 	}
+	sortOrders(orders, descending)
 
-	bids, bidsErr := unpackOrders(bidsRaw, "lyra")
-	asks, asksErr := unpackOrders(asksRaw, "lyra")
-	if bidsErr != nil && asksErr != nil {
-		log.Printf("unpackOrders error: \n%v\n", bidsErr)
-		log.Printf("%v\n", asksErr)
+	return orders
+}
+
+func lyraUpdateOrderbooks(data lyraOrderbook) {
+	if len(data.Bids) <= 0 && len(data.Asks) <= 0 {
 		return
 	}
 
-	instrumentParts := strings.Split(lyraInstrument, "-")
-	expiryTs, err := time.Parse("20060102", instrumentParts[1])
+	instrument, err := lyraNormalizeInstrument(data.InstrumentName)
 	if err != nil {
-		log.Printf("lyraUpdateOrderbooks: time.Parse error: %v\n\n", err)
-	}
-	expiry := strings.ToUpper(expiryTs.Format("02Jan06"))
-	instrument := instrumentParts[0] + "-" + expiry + "-" + instrumentParts[2] + "-" + instrumentParts[3]
-
-	_, exists := Orderbooks[instrument]
-
-	if exists {
-		Orderbooks[instrument].Bids["lyra"] = bids
-		Orderbooks[instrument].Asks["lyra"] = asks
-		Orderbooks[instrument].LastUpdated = timestamp
-	} else {
-		Orderbooks[instrument] = &OrderbookData{}
-		Orderbooks[instrument].Bids = make(map[string][]Order)
-		Orderbooks[instrument].Asks = make(map[string][]Order)
-		// Orderbooks[instrument].Bids["lyra"] = make([]Order, 0)
-		// Orderbooks[instrument].Asks["lyra"] = make([]Order, 0)
-
-		Orderbooks[instrument].Bids["lyra"] = bids
-		Orderbooks[instrument].Asks["lyra"] = asks
-		Orderbooks[instrument].LastUpdated = timestamp
+		slog.Error("lyraUpdateOrderbooks: unexpected instrument", "err", err)
+		return
 	}
 
-	sort.Slice(Orderbooks[instrument].Bids["lyra"], func(i, j int) bool {
-		return Orderbooks[instrument].Bids["lyra"][i].Price > Orderbooks[instrument].Bids["lyra"][j].Price
-	})
-	sort.Slice(Orderbooks[instrument].Asks["lyra"], func(i, j int) bool {
-		return Orderbooks[instrument].Asks["lyra"][i].Price < Orderbooks[instrument].Asks["lyra"][j].Price
-	})
-	// fmt.Printf("%v: %+v\n\n", instrument, Orderbooks[instrument])
-}
+	bids := lyraOrders(data.Bids, true)
+	asks := lyraOrders(data.Asks, false)
 
-func lyraUpdateIndex(data map[string]interface{}) {
-	LyraIndex.Mu.Lock()
-	defer LyraIndex.Mu.Unlock()
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
 
-	feeds, ok := data["feeds"].(map[string]interface{})
-	if !ok {
-		log.Printf("lyraUpdateIndex: unable to convert data['feeds'] to map[string]interface{}: %+v\n\n", data)
-		return
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists {
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[instrument] = orderbook
 	}
 
-	var feed map[string]interface{}
-	for key, value := range feeds {
-		feed, ok = value.(map[string]interface{})
-		priceStr, ok2 := feed["price"].(string)
-		if !ok || !ok2 {
-			log.Printf("lyraUpdateIndex: unable to convert value to map[string]interface{} or feed['price'] to float64:\n value, type: %+v, %+v\n feed['price']: %+v, %+v\n\n", value, reflect.TypeOf(value), feed["price"], reflect.TypeOf(feed["price"]))
-			continue
-		}
-
-		price, err := strconv.ParseFloat(priceStr, 64)
-		if err != nil {
-			log.Printf("lyraUpdateIndex: strconvParseFloat error: %v\n\n", err)
-		}
+	orderbook.Bids["lyra"] = bids
+	orderbook.Asks["lyra"] = asks
+	orderbook.LastUpdated = data.Timestamp
+	markBookUpdated(orderbook, "lyra", time.UnixMilli(int64(data.Timestamp)))
+	applyDepthLimit(orderbook, "lyra")
+	orderbook.UpdateCount++
+	publishBookEvent("lyra", instrument, orderbook.Bids["lyra"], orderbook.Asks["lyra"])
+	if debugEnabled() {
+		slog.Debug("lyraUpdateOrderbooks: book", "instrument", instrument, "bids", orderbook.Bids["lyra"], "asks", orderbook.Asks["lyra"])
+	}
+}
 
-		if price > 0 { //flawed check
-			LyraIndex.Index[key] = price
+func lyraUpdateIndex(data lyraSpotFeed) {
+	for asset, feed := range data.Feeds {
+		if feed.Price > 0 { //flawed check
+			checkIndexMove("lyra", asset, feed.Price)
+			LyraIndex.Set(asset, feed.Price)
+			publishIndexEvent("lyra", asset, feed.Price)
 		}
-
 	}
 }
 
-func lyraWssRead(ctx context.Context, c *websocket.Conn) {
-	var res map[string]interface{}
-	raw, err := wssRead(ctx, c)
+var lyraOrderbookMessages = newMessagePool(func(message *lyraOrderbookMessage) {
+	bids, asks := message.Params.Data.Bids[:0], message.Params.Data.Asks[:0]
+	*message = lyraOrderbookMessage{}
+	message.Params.Data.Bids, message.Params.Data.Asks = bids, asks
+})
+
+func lyraDecodeOrderbook(raw []byte) error {
+	message := lyraOrderbookMessages.Get()
+	defer lyraOrderbookMessages.Put(message)
+	err := json.Unmarshal(raw, message)
 	if err != nil {
-		log.Printf("lyraWssRead: %v\n(response): %v\n\n", err, string(raw))
-		return
+		return err
 	}
+	lyraUpdateOrderbooks(message.Params.Data)
+	return nil
+}
 
-	err = json.Unmarshal(raw, &res)
+func lyraDecodeSpotFeed(raw []byte) error {
+	var message lyraSpotFeedMessage
+	err := json.Unmarshal(raw, &message)
 	if err != nil {
-		log.Printf("lyraWssRead: error unmarshaling orderbookRaw: %v\n(response): %v\n\n", err, string(raw))
-		return
+		return err
 	}
+	lyraUpdateIndex(message.Params.Data)
+	return nil
+}
 
-	params, ok := res["params"].(map[string]interface{})
-	if !ok {
-		log.Printf("lyraWssRead: unable to convert res['params'] to map[string]interface{}: (raw response): %v\n\n", string(raw))
-		return
-	}
+type lyraExchange struct{}
 
-	data, ok := params["data"].(map[string]interface{})
-	channel, chanOk := params["channel"].(string)
-	if !ok || !chanOk {
-		log.Printf("lyraWssRead: unable to convert params['data'] to map[string]interface{} or params['channel'] to string: (raw response): %v\n dataOk: %v\nchannelOk: %v\n\n", string(raw), ok, chanOk)
-		return
-	}
-	// fmt.Printf("%+v\n\n", res)
+func (lyraExchange) Name() string { return "lyra" }
 
-	if strings.Contains(channel, "orderbook") {
-		lyraUpdateOrderbooks(data)
+func (lyraExchange) FetchMarkets(assets []string) ([]string, error) {
+	instruments := make([]string, 0)
+	listings := make([]Listing, 0)
+	for _, asset := range assets {
+		markets, err := lyraMarkets(asset)
+		if err != nil {
+			return nil, err
+		}
+		instruments = append(instruments, lyraInstruments(markets)...)
+		listings = append(listings, lyraListings(markets)...)
+		lyraUpdateLimits(markets)
 	}
-	if strings.Contains(channel, "spot_feed") {
-		lyraUpdateIndex(data)
 
-		// fmt.Printf("Lyra index: %v\n\n", LyraIndex["ETH"])
+	Matcher.Register("lyra", listings)
+	return instruments, nil
+}
+
+func (lyraExchange) OrderbookChannels(instruments []string) []string {
+	return lyraOrderbookChannels(instruments)
+}
+
+func (lyraExchange) TickerChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		channels = append(channels, "ticker."+instrument+".100")
 	}
+	return channels
+}
 
+func (lyraExchange) IndexChannels(assets []string) []string {
+	return lyraIndexChannels(assets)
 }
 
-func lyraWssReqLoop(ctx context.Context, c *websocket.Conn) {
-	for {
-		assets := []string{"ETH"}
-		markets := lyraMarkets("ETH")
-		instruments := lyraInstruments(markets)
-		fmt.Printf("Lyra number of instruments: %v\n\n", len(instruments))
+// lyraTicker is the result of /public/get_ticker, lyra has no REST book so a snapshot is the top of book only.
+type lyraTicker struct {
+	BestBidPrice  decimal.Decimal `json:"best_bid_price"` //sent as a string
+	BestBidAmount float64         `json:"best_bid_amount,string"`
+	BestAskPrice  decimal.Decimal `json:"best_ask_price"`
+	BestAskAmount float64         `json:"best_ask_amount,string"`
+	Timestamp     float64         `json:"timestamp"` //unix milliseconds
+}
 
-		lyraWssReqOrderbook(instruments, ctx, c)
-		log.Printf("Requested Lyra Orderbooks")
-		lyraWssReqIndex(assets, ctx, c)
-		log.Printf("Requested Lyra Index")
+func (lyraExchange) FetchOrderbook(instrument string) (OrderbookSnapshot, error) {
+	payload := fmt.Sprintf("{\"instrument_name\":\"%v\"}", instrument)
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["lyra"], func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", LyraHttp+"/public/get_ticker", strings.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("content-type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Result lyraTicker `json:"result"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: json decode error: %v", err)
+	}
+	normalized, err := lyraNormalizeInstrument(instrument)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
 
-		time.Sleep(time.Minute * 10)
+	ticker := response.Result
+	snapshot := OrderbookSnapshot{Instrument: normalized, Bids: map[string][]Order{"lyra": {}}, Asks: map[string][]Order{"lyra": {}}, LastUpdated: ticker.Timestamp}
+	if ticker.BestBidAmount > 0 {
+		snapshot.Bids["lyra"] = []Order{{ticker.BestBidPrice, ticker.BestBidAmount, -1, "lyra"}}
+	}
+	if ticker.BestAskAmount > 0 {
+		snapshot.Asks["lyra"] = []Order{{ticker.BestAskPrice, ticker.BestAskAmount, -1, "lyra"}}
 	}
+	return snapshot, nil
 }
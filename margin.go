@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// Stress set the margin model and stress tests run over, percent spot shocks and vol point shifts.
+var StressSpotShocks = []float64{-30, -20, -10, 10, 20, 30}
+var StressVolShifts = []float64{-20, 0, 20}
+
+var AccountEquity float64          //account equity stress tests are run against
+var MaintenanceRate float64 = 0.01 //maintenance margin per contract as a fraction of spot, on top of the worst stress loss
+
+type StressResult struct {
+	SpotShock float64 //percent
+	VolShift  float64 //vol points
+	Pnl       float64
+	Equity    float64 //equity after the move
+	Margin    float64 //margin requirement recomputed at the moved spot and vol
+	Usage     float64 //margin / equity, 1 or more is liquidation
+}
+
+type StressReport struct {
+	Equity      float64
+	Margin      float64 //requirement now
+	Usage       float64
+	Worst       StressResult //highest usage scenario
+	Scenarios   []StressResult
+	Liquidation bool
+	Warning     string
+}
+
+// marginRequirement is a risk based portfolio margin: the worst loss over the stress set plus MaintenanceRate of
+// its asset's spot per gross contract.
+func marginRequirement(legs []ScenarioLeg, spots map[string]float64) float64 {
+	worst := 0.0
+	gross := 0.0
+	for _, result := range runScenarios(legs, spots, StressSpotShocks, StressVolShifts) {
+		worst = math.Min(worst, result.Pnl)
+	}
+	for _, leg := range legs {
+		gross += math.Abs(leg.Amount) * spots[instrumentAsset(leg.Instrument)]
+	}
+
+	return -worst + MaintenanceRate*gross
+}
+
+// stressTest moves spot and vol through the stress set and recomputes the margin requirement from each moved state, a
+// position that is fine now can still breach margin after a move with vol and gamma working against it.
+func stressTest(legs []ScenarioLeg, spots map[string]float64, equity float64) StressReport {
+	report := StressReport{Equity: equity, Margin: marginRequirement(legs, spots)}
+	report.Usage = report.Margin / equity
+	report.Worst.Usage = -1
+
+	for _, result := range runScenarios(legs, spots, StressSpotShocks, StressVolShifts) {
+		moved := make([]ScenarioLeg, len(legs))
+		for i, leg := range legs {
+			moved[i] = leg
+			moved[i].Iv = math.Max(leg.Iv+result.VolShift/100, 0.01)
+		}
+
+		stressed := StressResult{SpotShock: result.SpotShock, VolShift: result.VolShift, Pnl: result.Pnl}
+		stressed.Equity = equity + result.Pnl
+		stressed.Margin = marginRequirement(moved, result.Spots)
+		stressed.Usage = math.MaxFloat64 //equity wiped out, Inf doesn't encode to json
+		if stressed.Equity > 0 {
+			stressed.Usage = stressed.Margin / stressed.Equity
+		}
+		report.Scenarios = append(report.Scenarios, stressed)
+
+		if stressed.Usage > report.Worst.Usage {
+			report.Worst = stressed
+		}
+	}
+
+	if report.Worst.Usage >= 1 {
+		report.Liquidation = true
+		report.Warning = fmt.Sprintf("margin usage reaches %.0f%% at %+g%% spot / %+g vol", report.Worst.Usage*100, report.Worst.SpotShock, report.Worst.VolShift)
+	}
+
+	return report
+}
+
+// stressHandler stress tests the portfolio, plus ?arb=<key>&size=<contracts> of a prospective trade when given (size
+// defaults to the opportunity's suggested size).
+func stressHandler(w http.ResponseWriter, r *http.Request) {
+	if AccountEquity <= 0 {
+		http.Error(w, "stressHandler: no account equity configured", http.StatusBadRequest)
+		return
+	}
+
+	legs, err := portfolioLegs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := r.URL.Query().Get("arb")
+	if key != "" {
+		candidate, err := arbLegs(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		size := 1.0
+		if table, exists := ArbContainer.Get(key); exists { //may have closed since arbLegs
+			size = table.SuggestedSize
+		}
+		if sizeStr := r.URL.Query().Get("size"); sizeStr != "" {
+			size, err = strconv.ParseFloat(sizeStr, 64)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		for i := range candidate {
+			candidate[i].Amount *= size
+		}
+		legs = append(legs, candidate...)
+	}
+
+	spots, err := legSpots(legs)
+	if err != nil {
+		http.Error(w, "stressHandler: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	report := stressTest(legs, spots, AccountEquity)
+	if report.Liquidation && key != "" {
+		slog.Warn("stressHandler: trade risks liquidation under stress", "key", key, "warning", report.Warning)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		slog.Error("stressHandler: json encode error", "err", err)
+	}
+}
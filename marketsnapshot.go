@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var SnapshotConcurrency = 8 //requests in flight per exchange
+
+type venueSnapshot struct {
+	Exchange  string
+	Snapshot  OrderbookSnapshot
+	FetchedAt time.Time
+}
+
+// MarketSnapshot is the REST book of every instrument the exchanges list. Applied, its sides are REST sourced like the
+// fallback's and never replace a side the websocket updated since they were fetched, so -warm-start lets the arb
+// engine price every strike before the websocket snapshots are all in.
+type MarketSnapshot struct {
+	Books   []venueSnapshot
+	Fetched map[string]int //by exchange
+	Errors  map[string]int
+	Took    time.Duration
+}
+
+// listedInstruments are every instrument of the assets exchange lists.
+func listedInstruments(exchange Exchange, assets []string) ([]string, error) {
+	return exchange.FetchMarkets(assets)
+}
+
+// subscribedInstruments are the listed instruments whose books exchangeReqLoop subscribes, after the strike and
+// expiry filters and overrides.
+func subscribedInstruments(exchange Exchange, assets []string) ([]string, error) {
+	instruments, err := exchange.FetchMarkets(assets)
+	if err != nil {
+		return nil, err
+	}
+	instruments = applySubscriptionOverrides(exchange.Name(), instruments, filterInstruments(exchange.Name(), instruments, time.Now()))
+	booked, _ := splitTickerInstruments(exchange, instruments)
+	return booked, nil
+}
+
+// fetchMarketSnapshot fetches the books of the instruments list returns for each exchange, exchanges without a REST
+// book endpoint are skipped. Books that fail to fetch are logged and counted, an exchange whose markets can't be
+// listed fails the snapshot.
+func fetchMarketSnapshot(exchanges []Exchange, assets []string, list func(Exchange, []string) ([]string, error), concurrency int) (MarketSnapshot, error) {
+	started := time.Now()
+	snapshot := MarketSnapshot{Books: make([]venueSnapshot, 0), Fetched: make(map[string]int), Errors: make(map[string]int)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, len(exchanges))
+
+	for _, exchange := range exchanges {
+		fetcher, ok := exchange.(BookFetcher)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instruments, err := list(exchange, assets)
+			if err != nil {
+				errs <- fmt.Errorf("fetchMarketSnapshot: %v: %v", exchange.Name(), err)
+				return
+			}
+
+			jobs := make(chan string)
+			var workers sync.WaitGroup
+			for range max(concurrency, 1) {
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					for instrument := range jobs {
+						fetchedAt := time.Now()
+						book, err := fetcher.FetchOrderbook(instrument)
+						mu.Lock()
+						if err != nil {
+							snapshot.Errors[exchange.Name()]++
+						} else {
+							snapshot.Fetched[exchange.Name()]++
+							snapshot.Books = append(snapshot.Books, venueSnapshot{exchange.Name(), book, fetchedAt})
+						}
+						mu.Unlock()
+						if err != nil {
+							slog.Warn("fetchMarketSnapshot: fetch failed", "exchange", exchange.Name(), "instrument", instrument, "err", err)
+						}
+					}
+				}()
+			}
+			for _, instrument := range instruments {
+				jobs <- instrument
+			}
+			close(jobs)
+			workers.Wait()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err, failed := <-errs; failed {
+		return MarketSnapshot{}, err
+	}
+	snapshot.Took = time.Since(started)
+	return snapshot, nil
+}
+
+// Merged returns the snapshot's books merged across exchanges, trimmed to depth levels and sorted by instrument.
+func (m *MarketSnapshot) Merged(depth int) []OrderbookSnapshot {
+	books := make(map[string]*OrderbookData)
+	for _, venue := range m.Books {
+		book, exists := books[venue.Snapshot.Instrument]
+		if !exists {
+			book = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+			books[venue.Snapshot.Instrument] = book
+		}
+		for name, orders := range venue.Snapshot.Bids {
+			book.Bids[name] = orders
+		}
+		for name, orders := range venue.Snapshot.Asks {
+			book.Asks[name] = orders
+		}
+		book.LastUpdated = max(book.LastUpdated, venue.Snapshot.LastUpdated)
+	}
+
+	snapshots := make([]OrderbookSnapshot, 0, len(books))
+	for instrument, book := range books {
+		snapshots = append(snapshots, orderbookSnapshot(instrument, *book, "", depth))
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Instrument < snapshots[j].Instrument })
+	return snapshots
+}
+
+// Apply stores the snapshot's books as REST sourced sides and returns how many were applied.
+func (m *MarketSnapshot) Apply() int {
+	applied := 0
+	for _, venue := range m.Books {
+		if applyRestSnapshot(venue.Exchange, venue.Snapshot, venue.FetchedAt) {
+			applied++
+		}
+	}
+	return applied
+}
+
+// warmStartBooks applies a market snapshot of the books exchangeReqLoop subscribes. Instruments held back by -strike-range
+// for want of an index are left to the websocket.
+func warmStartBooks(exchanges []Exchange) {
+	snapshot, err := fetchMarketSnapshot(exchanges, currentAssets(), subscribedInstruments, SnapshotConcurrency)
+	if err != nil {
+		slog.Error("warmStart: market snapshot failed", "err", err)
+		return
+	}
+	applied := snapshot.Apply()
+	slog.Info("warmStart: applied market snapshot", "books", len(snapshot.Books), "applied", applied, "errors", snapshot.Errors, "took", snapshot.Took.Round(time.Millisecond))
+}
+
+type marketSnapshotJson struct {
+	Took    string              `json:"took"`
+	Fetched map[string]int      `json:"fetched"`
+	Errors  map[string]int      `json:"errors"`
+	Applied int                 `json:"applied,omitempty"`
+	Books   []OrderbookSnapshot `json:"books,omitempty"`
+}
+
+var marketSnapshotMu sync.Mutex //one snapshot in flight, they're hundreds of requests
+
+// marketSnapshotHandler serves /api/market-snapshot for exchanges: GET fetches the subscribed instruments' books and
+// returns them merged, trimmed to ?depth= levels, POST fetches and applies them to the books.
+func marketSnapshotHandler(exchanges []Exchange) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		depth, err := depthParam(r)
+		if err != nil {
+			http.Error(w, "depth: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !marketSnapshotMu.TryLock() {
+			http.Error(w, "a market snapshot is already being fetched", http.StatusConflict)
+			return
+		}
+		defer marketSnapshotMu.Unlock()
+
+		snapshot, err := fetchMarketSnapshot(exchanges, currentAssets(), subscribedInstruments, SnapshotConcurrency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		response := marketSnapshotJson{Took: snapshot.Took.Round(time.Millisecond).String(), Fetched: snapshot.Fetched, Errors: snapshot.Errors}
+		if r.Method == http.MethodPost {
+			response.Applied = snapshot.Apply()
+		} else {
+			response.Books = snapshot.Merged(depth)
+		}
+		writeJson(w, "marketSnapshotHandler", response)
+	}
+}
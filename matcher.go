@@ -0,0 +1,186 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Listing is one exchange's instrument, Instrument.Expiry at the exchange's own cut-off when it publishes one.
+type Listing struct {
+	Exchange   string
+	Name       string //in the exchange's naming
+	Instrument Instrument
+	Settlement string //"USD" settled in a stablecoin, "coin" inverse settled in the underlying
+}
+
+// InstrumentMatcher groups listings of the same underlying, option type and strike whose expiries are within
+// ExpiryTolerance (the venues' cut-offs for one expiry date) under one canonical ID, the highest priority venue's name.
+type InstrumentMatcher struct {
+	Mu      sync.RWMutex
+	Groups  map[string][]Listing //key: canonical ID
+	byVenue map[string]string    //key: exchange + " " + name
+}
+
+var Matcher = InstrumentMatcher{Groups: make(map[string][]Listing), byVenue: make(map[string]string)}
+
+var ExpiryTolerance = 12 * time.Hour //less than a day, dailies of consecutive days are different expiries
+
+// matchPriority orders the venues whose names a group is identified by, venues not listed come last.
+var matchPriority = []string{"aevo", "lyra", "deribit", "okx", "binance-options"}
+
+func venuePriority(exchange string) int {
+	for i, name := range matchPriority {
+		if name == exchange {
+			return i
+		}
+	}
+	return len(matchPriority)
+}
+
+// newListing parses name in exchange's naming, replacing the expiry's assumed 08:00 UTC cut-off with expiry when it's
+// known, a zero or unix epoch expiry isn't.
+func newListing(exchange string, name string, expiry time.Time, settlement string) (Listing, error) {
+	instrument, err := parseVenueInstrument(exchange, name)
+	if err != nil {
+		return Listing{}, err
+	}
+	if expiry.Unix() > 0 {
+		instrument.Expiry = expiry.UTC()
+	}
+	return Listing{exchange, name, instrument, settlement}, nil
+}
+
+func matches(a Instrument, b Instrument) bool {
+	return a.Asset == b.Asset && a.Type == b.Type && math.Abs(a.Strike-b.Strike) <= 1e-9*a.Strike &&
+		a.Expiry.Sub(b.Expiry).Abs() <= ExpiryTolerance
+}
+
+// Register replaces exchange's listings with listings and matches them against the other exchanges'.
+func (m *InstrumentMatcher) Register(exchange string, listings []Listing) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	for id, group := range m.Groups {
+		kept := group[:0]
+		for _, listing := range group {
+			if listing.Exchange != exchange {
+				kept = append(kept, listing)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.Groups, id)
+		} else {
+			m.Groups[id] = kept
+		}
+	}
+
+	series := make(map[string][]string) //asset, type and strike -> canonical IDs
+	seriesKey := func(instrument Instrument) string {
+		return instrument.Asset + " " + instrument.Type + " " + strconv.FormatFloat(instrument.Strike, 'f', -1, 64)
+	}
+	for id, group := range m.Groups {
+		key := seriesKey(group[0].Instrument)
+		series[key] = append(series[key], id)
+	}
+
+	for _, listing := range listings {
+		key := seriesKey(listing.Instrument)
+		matched := ""
+		for _, id := range series[key] {
+			if matches(listing.Instrument, m.Groups[id][0].Instrument) {
+				matched = id
+				break
+			}
+		}
+		if matched == "" {
+			id := listing.Instrument.String()
+			m.Groups[id] = []Listing{listing}
+			series[key] = append(series[key], id)
+			continue
+		}
+
+		group := append(m.Groups[matched], listing)
+		sort.SliceStable(group, func(i, j int) bool { return venuePriority(group[i].Exchange) < venuePriority(group[j].Exchange) })
+		id := group[0].Instrument.String()
+		if id != matched { //a higher priority venue names the group
+			delete(m.Groups, matched)
+			ids := series[key]
+			for i := range ids {
+				if ids[i] == matched {
+					ids[i] = id
+				}
+			}
+		}
+		m.Groups[id] = group
+	}
+
+	m.byVenue = make(map[string]string, len(m.byVenue))
+	for id, group := range m.Groups {
+		for _, listing := range group {
+			m.byVenue[listing.Exchange+" "+listing.Name] = id
+		}
+	}
+}
+
+// Canonical returns the canonical ID of an instrument in exchange's naming, false when it isn't registered.
+func (m *InstrumentMatcher) Canonical(exchange string, name string) (string, bool) {
+	var buf [128]byte
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+	id, exists := m.byVenue[string(appendVenueKey(buf[:0], exchange, name))]
+	return id, exists
+}
+
+// normalizeVenueInstrument maps an instrument in exchange's naming to its canonical ID, parsed from the name when
+// it isn't registered.
+func normalizeVenueInstrument(exchange string, name string) (string, error) {
+	if id, exists := Matcher.Canonical(exchange, name); exists {
+		return id, nil
+	}
+	instrument, err := parseVenueInstrument(exchange, name)
+	if err != nil {
+		return "", err
+	}
+	return instrument.String(), nil
+}
+
+type matchedListingJson struct {
+	Exchange   string    `json:"exchange"`
+	Name       string    `json:"name"`
+	Expiry     time.Time `json:"expiry"`
+	Settlement string    `json:"settlement"`
+}
+
+type matchedInstrumentJson struct {
+	Id       string               `json:"id"`
+	Listings []matchedListingJson `json:"listings"`
+}
+
+// instrumentsHandler serves /api/instruments, the canonical instruments with each exchange's listing of them, only
+// those listed on more than one exchange with ?cross=1, of one asset with ?asset=.
+func instrumentsHandler(w http.ResponseWriter, r *http.Request) {
+	cross := r.URL.Query().Get("cross") == "1"
+	asset := strings.ToUpper(r.URL.Query().Get("asset"))
+
+	Matcher.Mu.RLock()
+	instruments := make([]matchedInstrumentJson, 0, len(Matcher.Groups))
+	for id, group := range Matcher.Groups {
+		if (cross && len(group) < 2) || (asset != "" && group[0].Instrument.Asset != asset) {
+			continue
+		}
+		instrument := matchedInstrumentJson{Id: id}
+		for _, listing := range group {
+			instrument.Listings = append(instrument.Listings, matchedListingJson{listing.Exchange, listing.Name, listing.Instrument.Expiry, listing.Settlement})
+		}
+		instruments = append(instruments, instrument)
+	}
+	Matcher.Mu.RUnlock()
+
+	sort.Slice(instruments, func(i, j int) bool { return instruments[i].Id < instruments[j].Id })
+	writeJson(w, "instrumentsHandler", instruments)
+}
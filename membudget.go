@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+const orderSize = int64(unsafe.Sizeof(Order{}))
+const orderbookOverhead = 512 //struct, two small maps and their buckets, map key in OrderbookContainer
+const exchangeEntryOverhead = 64
+
+var MemoryBudget int64 //bytes, 0 disables enforcement
+var lastMemoryCheck time.Time
+var memoryCheckMu sync.Mutex //every asset's pipeline calls enforceMemoryBudget
+
+// orderbookMemory approximates the bytes held by a single orderbook, counting slice capacity rather than length
+// since that is what's actually allocated.
+func orderbookMemory(key string, orderbook *OrderbookData) int64 {
+	size := int64(orderbookOverhead + len(key))
+	for _, orders := range orderbook.Bids {
+		size += exchangeEntryOverhead + int64(cap(orders))*orderSize
+	}
+	for _, orders := range orderbook.Asks {
+		size += exchangeEntryOverhead + int64(cap(orders))*orderSize
+	}
+
+	return size
+}
+
+func orderbooksMemory() int64 {
+	var total int64
+	for key, orderbook := range OrderbookContainer.Orderbooks {
+		total += orderbookMemory(key, orderbook)
+	}
+
+	return total
+}
+
+// applyDepthLimit truncates an exchange's side of the book to the orderbook's DepthLimit, copying so the dropped
+// levels can be garbage collected.
+func applyDepthLimit(orderbook *OrderbookData, exchange string) {
+	if orderbook.DepthLimit <= 0 {
+		return
+	}
+
+	if bids := orderbook.Bids[exchange]; len(bids) > orderbook.DepthLimit {
+		orderbook.Bids[exchange] = append(make([]Order, 0, orderbook.DepthLimit), bids[:orderbook.DepthLimit]...)
+	}
+	if asks := orderbook.Asks[exchange]; len(asks) > orderbook.DepthLimit {
+		orderbook.Asks[exchange] = append(make([]Order, 0, orderbook.DepthLimit), asks[:orderbook.DepthLimit]...)
+	}
+}
+
+// enforceMemoryBudget is called after arb updates. At most once a second it estimates orderbook memory and,
+// once above 90% of MemoryBudget, progressively limits the depth of the least active instruments (fewest updates
+// since the previous check) until the estimate is back under 80%. Depth is never reduced below the top level, which
+// is all the arb engine needs.
+func enforceMemoryBudget() {
+	memoryCheckMu.Lock()
+	if MemoryBudget <= 0 || time.Since(lastMemoryCheck) < time.Second {
+		memoryCheckMu.Unlock()
+		return
+	}
+	lastMemoryCheck = time.Now()
+	memoryCheckMu.Unlock()
+
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	usage := orderbooksMemory()
+	if usage < MemoryBudget*9/10 {
+		resetUpdateCounts()
+		return
+	}
+
+	orderbooks := OrderbookContainer.Orderbooks
+	keys := make([]string, 0, len(orderbooks))
+	for key := range orderbooks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return orderbooks[keys[i]].UpdateCount < orderbooks[keys[j]].UpdateCount })
+
+	target := MemoryBudget * 8 / 10
+	trimmed := 0
+	for _, depth := range []int{10, 5, 1} {
+		for _, key := range keys {
+			if usage <= target {
+				break
+			}
+			orderbook := orderbooks[key]
+			if orderbook.DepthLimit > 0 && orderbook.DepthLimit <= depth {
+				continue
+			}
+
+			before := orderbookMemory(key, orderbook)
+			orderbook.DepthLimit = depth
+			for exchange := range orderbook.Bids {
+				applyDepthLimit(orderbook, exchange)
+			}
+			for exchange := range orderbook.Asks {
+				applyDepthLimit(orderbook, exchange)
+			}
+			usage -= before - orderbookMemory(key, orderbook)
+			trimmed++
+		}
+	}
+
+	slog.Info("enforceMemoryBudget: limited book depth", "usage_kb", usage/1024, "budget_kb", MemoryBudget/1024, "instruments", trimmed)
+	if usage > target {
+		slog.Warn("enforceMemoryBudget: all books at minimum depth and still over budget")
+	}
+	resetUpdateCounts()
+}
+
+func resetUpdateCounts() {
+	for _, orderbook := range OrderbookContainer.Orderbooks {
+		orderbook.UpdateCount = 0
+	}
+}
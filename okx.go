@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/decimal"
+	"options-ws/ratelimit"
+)
+
+var OkxHttp string = "https://www.okx.com"
+var OkxWss string = "wss://ws.okx.com:8443/ws/v5/public"
+
+var OkxIndex = IndexContainer{Index: make(map[string]float64)}
+
+// OkxContracts holds every listed instrument's contract size in the underlying, ctVal * ctMult, key: OKX instrument
+// name. OKX quotes in the underlying per contract, books are converted to USD per 1 underlying like the others.
+var OkxContracts = struct {
+	Mu    sync.RWMutex
+	Sizes map[string]float64
+}{Sizes: make(map[string]float64)}
+
+type okxInstrument struct {
+	InstId  string  `json:"instId"` //e.g. "ETH-USD-240628-3000-C"
+	State   string  `json:"state"`
+	CtVal   float64 `json:"ctVal,string"`
+	CtMult  float64 `json:"ctMult,string"`
+	ExpTime int64   `json:"expTime,string"` //unix milliseconds
+}
+
+func okxMarkets(asset string) ([]okxInstrument, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["okx"], func() (*http.Request, error) {
+		return http.NewRequest("GET", OkxHttp+"/api/v5/public/instruments?instType=OPTION&uly="+asset+"-USD", nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("okxMarkets: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var markets struct {
+		Code string          `json:"code"`
+		Msg  string          `json:"msg"`
+		Data []okxInstrument `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&markets)
+	if err != nil {
+		return nil, fmt.Errorf("okxMarkets: json decode error: %v", err)
+	}
+	if markets.Code != "0" {
+		return nil, fmt.Errorf("okxMarkets: error %v: %v", markets.Code, markets.Msg)
+	}
+
+	return markets.Data, nil
+}
+
+// okxArgs converts channel names in the "channel:instId" form the connection tracks them in, e.g.
+// "books5:ETH-USD-240628-3000-C", to OKX's subscription arguments.
+func okxArgs(channels []string) []map[string]string {
+	args := make([]map[string]string, 0, len(channels))
+	for _, channel := range channels {
+		name, instId, _ := strings.Cut(channel, ":")
+		args = append(args, map[string]string{"channel": name, "instId": instId})
+	}
+	return args
+}
+
+func okxSubscribeJson(channels []string) []byte {
+	data := struct {
+		Op   string              `json:"op"`
+		Args []map[string]string `json:"args"`
+	}{"subscribe", okxArgs(channels)}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
+	return jsonData
+}
+
+func okxUnsubscribeJson(channels []string) []byte {
+	data := struct {
+		Op   string              `json:"op"`
+		Args []map[string]string `json:"args"`
+	}{"unsubscribe", okxArgs(channels)}
+
+	jsonData, _ := json.Marshal(data) //a struct of strings always marshals
+	return jsonData
+}
+
+// okxPingJson is OKX's heartbeat, the bare text "ping" answered with "pong", connections without traffic for 30
+// seconds are closed.
+var okxPingJson = []byte("ping")
+
+// okxChannel names an OKX frame's channel "channel:instId" from its "arg" object, e.g.
+// {"arg":{"channel":"books5","instId":"ETH-USD-240628-3000-C"},"data":[...]}, so frames route and shard by
+// instrument like other exchanges'. Subscription events and pongs return nil.
+func okxChannel(raw []byte) []byte {
+	if !bytes.Contains(raw, []byte(`"data"`)) {
+		return nil
+	}
+	channel := rawField(raw, `"channel":"`)
+	instId := rawField(raw, `"instId":"`)
+	if channel == nil || instId == nil {
+		return nil
+	}
+	return append(append(append(make([]byte, 0, len(channel)+len(instId)+1), channel...), ':'), instId...)
+}
+
+type okxExchange struct{}
+
+func (okxExchange) Name() string { return "okx" }
+
+func (okxExchange) FetchMarkets(assets []string) ([]string, error) {
+	instruments := make([]string, 0)
+	listings := make([]Listing, 0)
+	sizes := make(map[string]float64)
+	for _, asset := range assets {
+		markets, err := okxMarkets(asset)
+		if err != nil {
+			return nil, err
+		}
+		for _, market := range markets {
+			if market.State != "live" {
+				continue
+			}
+			instruments = append(instruments, market.InstId)
+			sizes[market.InstId] = market.CtVal * market.CtMult
+			listing, err := newListing("okx", market.InstId, time.UnixMilli(market.ExpTime), "coin") //coin margined
+			if err == nil {
+				listings = append(listings, listing)
+			}
+		}
+	}
+
+	OkxContracts.Mu.Lock()
+	OkxContracts.Sizes = sizes
+	OkxContracts.Mu.Unlock()
+	Matcher.Register("okx", listings)
+	return instruments, nil
+}
+
+func (okxExchange) OrderbookChannels(instruments []string) []string {
+	channels := []string{}
+	for _, instrument := range instruments {
+		channels = append(channels, "books5:"+instrument) //5 levels, a full snapshot every push
+	}
+	return channels
+}
+
+func (okxExchange) IndexChannels(assets []string) []string {
+	channels := []string{}
+	for _, asset := range assets {
+		channels = append(channels, "index-tickers:"+asset+"-USD")
+	}
+	return channels
+}
+
+type okxOrderbook struct {
+	Bids [][]string `json:"bids"` //[price in the underlying, contracts, deprecated, order count]
+	Asks [][]string `json:"asks"`
+	Ts   int64      `json:"ts,string"` //unix milliseconds
+}
+
+type okxOrderbookMessage struct {
+	Arg struct {
+		InstId string `json:"instId"`
+	} `json:"arg"`
+	Data []okxOrderbook `json:"data"`
+}
+
+type okxIndexMessage struct {
+	Data []struct {
+		InstId string  `json:"instId"` //e.g. "ETH-USD"
+		IdxPx  float64 `json:"idxPx,string"`
+	} `json:"data"`
+}
+
+// okxOrders converts levels to USD Orders per 1 underlying contracts sorted best first, OKX doesn't publish level
+// IVs so Iv is -1.
+func okxOrders(levels [][]string, index float64, contractSize float64, descending bool) ([]Order, error) {
+	orders := make([]Order, 0, len(levels))
+	for _, level := range levels {
+		if len(level) < 2 {
+			return nil, fmt.Errorf("okxOrders: short level %v", level)
+		}
+		price, err := strconv.ParseFloat(level[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("okxOrders: %v", err)
+		}
+		amount, err := strconv.ParseFloat(level[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("okxOrders: %v", err)
+		}
+		orders = append(orders, Order{decimal.FromFloat(price * index), amount * contractSize, -1, "okx"})
+	}
+	sortOrders(orders, descending)
+
+	return orders, nil
+}
+
+func okxUpdateOrderbooks(instId string, data okxOrderbook) error {
+	if len(data.Bids) <= 0 && len(data.Asks) <= 0 {
+		return nil
+	}
+
+	instrument, err := okxNormalizeInstrument(instId)
+	if err != nil {
+		return err
+	}
+	index, exists := OkxIndex.Get(instrumentAsset(instrument))
+	if !exists { //prices can't be converted to USD until the first index update
+		return nil
+	}
+	OkxContracts.Mu.RLock()
+	contractSize, exists := OkxContracts.Sizes[instId]
+	OkxContracts.Mu.RUnlock()
+	if !exists || contractSize <= 0 {
+		return nil
+	}
+
+	bids, err := okxOrders(data.Bids, index, contractSize, true)
+	if err != nil {
+		return err
+	}
+	asks, err := okxOrders(data.Asks, index, contractSize, false)
+	if err != nil {
+		return err
+	}
+
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists {
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[instrument] = orderbook
+	}
+
+	orderbook.Bids["okx"] = bids
+	orderbook.Asks["okx"] = asks
+	orderbook.LastUpdated = float64(data.Ts)
+	markBookUpdated(orderbook, "okx", time.UnixMilli(data.Ts))
+	applyDepthLimit(orderbook, "okx")
+	orderbook.UpdateCount++
+	publishBookEvent("okx", instrument, orderbook.Bids["okx"], orderbook.Asks["okx"])
+	if debugEnabled() {
+		slog.Debug("okxUpdateOrderbooks: book", "instrument", instrument, "bids", orderbook.Bids["okx"], "asks", orderbook.Asks["okx"])
+	}
+	return nil
+}
+
+// okxNormalizeInstrument converts OKX's "ETH-USD-240628-3000-C" to the aevo style "ETH-28JUN24-3000-C" used as
+// Orderbooks key.
+func okxNormalizeInstrument(okxInstrument string) (string, error) {
+	instrument, err := normalizeVenueInstrument("okx", okxInstrument)
+	if err != nil {
+		return "", fmt.Errorf("okxNormalizeInstrument: %v", err)
+	}
+	return instrument, nil
+}
+
+func okxDecodeOrderbook(raw []byte) error {
+	var message okxOrderbookMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	for _, data := range message.Data {
+		err = okxUpdateOrderbooks(message.Arg.InstId, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func okxDecodeIndex(raw []byte) error {
+	var message okxIndexMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	for _, data := range message.Data {
+		asset, found := strings.CutSuffix(data.InstId, "-USD")
+		if found && data.IdxPx > 0 {
+			checkIndexMove("okx", asset, data.IdxPx)
+			OkxIndex.Set(asset, data.IdxPx)
+			publishIndexEvent("okx", asset, data.IdxPx)
+		}
+	}
+	return nil
+}
+
+func (okxExchange) FetchOrderbook(instrument string) (OrderbookSnapshot, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["okx"], func() (*http.Request, error) {
+		return http.NewRequest("GET", OkxHttp+"/api/v5/market/books?instId="+instrument+"&sz=10", nil)
+	})
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Code string         `json:"code"`
+		Msg  string         `json:"msg"`
+		Data []okxOrderbook `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: json decode error: %v", err)
+	}
+	if response.Code != "0" || len(response.Data) == 0 {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: error %v: %v", response.Code, response.Msg)
+	}
+	normalized, err := okxNormalizeInstrument(instrument)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+	index, exists := OkxIndex.Get(strings.Split(normalized, "-")[0])
+	if !exists {
+		index, err = okxFetchIndex(strings.Split(normalized, "-")[0])
+		if err != nil {
+			return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+		}
+	}
+	OkxContracts.Mu.RLock()
+	contractSize, exists := OkxContracts.Sizes[instrument]
+	OkxContracts.Mu.RUnlock()
+	if !exists {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: unknown contract size of %v", instrument)
+	}
+
+	data := response.Data[0]
+	bids, err := okxOrders(data.Bids, index, contractSize, true)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+	asks, err := okxOrders(data.Asks, index, contractSize, false)
+	if err != nil {
+		return OrderbookSnapshot{}, fmt.Errorf("FetchOrderbook: %v", err)
+	}
+	return OrderbookSnapshot{
+		Instrument:  normalized,
+		Bids:        map[string][]Order{"okx": bids},
+		Asks:        map[string][]Order{"okx": asks},
+		LastUpdated: float64(data.Ts),
+	}, nil
+}
+
+// okxFetchIndex gets an asset's index over REST, for snapshots taken before the websocket index arrives.
+func okxFetchIndex(asset string) (float64, error) {
+	res, err := ratelimit.Do(http.DefaultClient, VenueLimiters["okx"], func() (*http.Request, error) {
+		return http.NewRequest("GET", OkxHttp+"/api/v5/market/index-tickers?instId="+asset+"-USD", nil)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("okxFetchIndex: request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response okxIndexMessage
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return 0, fmt.Errorf("okxFetchIndex: json decode error: %v", err)
+	}
+	if len(response.Data) == 0 || response.Data[0].IdxPx <= 0 {
+		return 0, fmt.Errorf("okxFetchIndex: no %v index", asset)
+	}
+	return response.Data[0].IdxPx, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+)
+
+type MarketsContainer struct {
+	Mu      sync.Mutex
+	Markets map[string]aevo.Market //key: instrument
+	Updated time.Time
+}
+
+// AevoMarketList is the latest aevo markets response, refreshed with subscriptions.
+var AevoMarketList = MarketsContainer{Markets: make(map[string]aevo.Market)}
+
+func aevoUpdateMarkets(markets []aevo.Market) {
+	AevoMarketList.Mu.Lock()
+	defer AevoMarketList.Mu.Unlock()
+
+	AevoMarketList.Markets = make(map[string]aevo.Market, len(markets))
+	AevoMarketList.Updated = time.Now()
+	for _, market := range markets {
+		if market.IsActive {
+			AevoMarketList.Markets[market.InstrumentName] = market
+		}
+	}
+}
+
+func aevoActiveInstruments() []string {
+	AevoMarketList.Mu.Lock()
+	defer AevoMarketList.Mu.Unlock()
+
+	instruments := make([]string, 0, len(AevoMarketList.Markets))
+	for instrument := range AevoMarketList.Markets {
+		instruments = append(instruments, instrument)
+	}
+	sort.Strings(instruments)
+
+	return instruments
+}
+
+type OpenInterestContainer struct {
+	Mu      sync.Mutex
+	History map[string]*SampleRing //key: instrument, contracts
+}
+
+const openInterestSamples = 24 * 12 //a day at the default 5 minute refresh
+
+var OpenInterest = OpenInterestContainer{History: make(map[string]*SampleRing)}
+
+func aevoOpenInterest(instrument string) (float64, error) {
+	openInterest, err := AevoClient.OpenInterest(instrument)
+	if err != nil {
+		return 0, fmt.Errorf("aevoOpenInterest: %v: %v", instrument, err)
+	}
+
+	return openInterest, nil
+}
+
+// openInterestLoop refreshes open interest of every active aevo instrument each interval, spacing requests out.
+func openInterestLoop(interval time.Duration) {
+	for {
+		start := time.Now()
+		for _, instrument := range aevoActiveInstruments() {
+			oi, err := aevoOpenInterest(instrument)
+			if err != nil {
+				slog.Warn("openInterestLoop: request failed", "err", err)
+				continue
+			}
+
+			OpenInterest.Mu.Lock()
+			ring, exists := OpenInterest.History[instrument]
+			if !exists {
+				ring = newSampleRing(openInterestSamples)
+				OpenInterest.History[instrument] = ring
+			}
+			ring.Add(Sample{time.Now(), oi})
+			OpenInterest.Mu.Unlock()
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		time.Sleep(max(interval-time.Since(start), time.Second))
+	}
+}
+
+type OpenInterestChange struct {
+	Instrument   string
+	OpenInterest float64
+	Change1h     float64
+	ChangeDay    float64 //since the first sample of the current UTC day
+	Updated      time.Time
+}
+
+func firstSampleSince(ring *SampleRing, since time.Time) (Sample, bool) {
+	samples := ring.Since(since)
+	if len(samples) == 0 {
+		return Sample{}, false
+	}
+	return samples[0], true
+}
+
+// openInterestChanges returns current open interest and its 1h and intraday change, keyed by instrument.
+func openInterestChanges(now time.Time) map[string]OpenInterestChange {
+	dayStart := now.UTC().Truncate(24 * time.Hour)
+
+	OpenInterest.Mu.Lock()
+	defer OpenInterest.Mu.Unlock()
+
+	changes := make(map[string]OpenInterestChange, len(OpenInterest.History))
+	for instrument, ring := range OpenInterest.History {
+		if ring.Len() == 0 {
+			continue
+		}
+		latest := ring.at(ring.Len() - 1)
+		change := OpenInterestChange{Instrument: instrument, OpenInterest: latest.Value, Updated: latest.Time}
+		if first, ok := firstSampleSince(ring, now.Add(-time.Hour)); ok {
+			change.Change1h = latest.Value - first.Value
+		}
+		if first, ok := firstSampleSince(ring, dayStart); ok {
+			change.ChangeDay = latest.Value - first.Value
+		}
+		changes[instrument] = change
+	}
+
+	return changes
+}
+
+func openInterestHandler(w http.ResponseWriter, r *http.Request) {
+	changes := openInterestChanges(time.Now())
+	list := make([]OpenInterestChange, 0, len(changes))
+	for _, change := range changes {
+		list = append(list, change)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].OpenInterest > list[j].OpenInterest })
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(list)
+	if err != nil {
+		slog.Error("openInterestHandler: json encode error", "err", err)
+	}
+}
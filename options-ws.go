@@ -1,48 +1,53 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
-	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"text/template"
 	"time"
 
-	"nhooyr.io/websocket"
+	"options-ws/aevo"
+	"options-ws/decimal"
 )
 
-const AevoHttp string = "https://api.aevo.xyz"
-const AevoWss string = "wss://ws.aevo.xyz"
-const LyraHttp string = "https://api.lyra.finance"
-const LyraWss string = "wss://api.lyra.finance/ws"
-
-type connData struct {
-	Ctx    context.Context
-	Conn   *websocket.Conn
-	Cancel context.CancelFunc
-}
-
-type wssData struct {
-	Op   string   `json:"op"`
-	Data []string `json:"data"`
-}
+var LyraHttp string = "https://api.lyra.finance"
+var LyraWss string = "wss://api.lyra.finance/ws"
 
 type Order struct {
-	Price    float64
+	Price    decimal.Decimal //exact, converted to float64 where it meets models, APIs and the store
 	Amount   float64
 	Iv       float64
 	Exchange string
 }
 
 type OrderbookData struct {
-	Bids        map[string][]Order
-	Asks        map[string][]Order
-	LastUpdated float64
+	Bids         map[string][]Order
+	Asks         map[string][]Order
+	LastUpdated  float64
+	Sequences    map[string]float64       //per exchange last_updated of the last applied delta book message, absent until a snapshot
+	Timestamps   map[string]time.Time     //per exchange timestamp of the last applied message, see markBookUpdated
+	UpdateCount  int                      //updates since the last memory budget check
+	DepthLimit   int                      //max stored levels per exchange and side, 0 is unlimited
+	RestSourced  map[string]bool          //per exchange, the side is a REST snapshot the websocket hasn't updated since, see restfallback.go
+	QuoteLives   map[quoteSide]*quoteLife //per exchange and side, how long its best prices lasted, see fillprob.go
+	CrossedSince map[string]time.Time     //per exchange, when its best bid went above its best ask, see breaker.go
+	Metrics      map[string]BookMetrics   //per exchange, as of its last update, see bookmetrics.go
 }
 
 type ArbTable struct {
@@ -55,141 +60,169 @@ type ArbTable struct {
 	AskType     string
 	BidExchange string
 	AskExchange string
+	Forward     float64 //the parity leg's price, index times forwardBasis
+	Fees        float64 //per contract, both legs' taker and settlement fees, already deducted from AbsProfit
 	AbsProfit   float64
-	RelProfit   float64
+	Margins     LegMargins
+	Capital     float64 //per contract, Margins.Total()
+	RelProfit   float64 //return on margin, AbsProfit / Capital * 100
 	Apy         float64
+	ExcessApy   float64 //Apy over the risk-free rate
+
+	ExecutableSize float64 //contracts executable across book levels while each matched level pair is still profitable
+	VwapProfit     float64 //volume weighted profit per contract over ExecutableSize
+
+	SuggestedSize     float64 //contracts
+	SuggestedNotional float64 //SuggestedSize * index
+	SizeLimit         string  //constraint that bound SuggestedSize: "depth", "order limit" or "margin"
+
+	FillProbability float64 //both legs' best prices still shown after FillLatency, see fillprob.go
+	ExpectedProfit  float64 //AbsProfit * FillProbability
+	BookQuality     float64 //how tight and deep both legs' books are, 0 to 1, see bookmetrics.go
+
+	PostLiquidation bool //found within a post-liquidation window
+	RestSourced     bool //a leg is priced from a REST fallback snapshot, see restfallback.go
+}
+
+type OrderbooksContainer struct {
+	Mu         sync.RWMutex
+	Orderbooks map[string]*OrderbookData //key: e.g. "ETH-02JAN06-3000-C"
 }
 
 type ArbTablesContainer struct {
-	Mu        sync.Mutex
+	Mu        sync.RWMutex
 	ArbTables map[string]*ArbTable
 }
 
 type IndexContainer struct {
-	Mu    sync.Mutex
+	Mu    sync.RWMutex
 	Index map[string]float64
 }
 
 // pointer seems like a bad idea but makes assignment of elements easier
-var Orderbooks = make(map[string]*OrderbookData) //key: e.g. "ETH-02JAN06-3000-C"
+var OrderbookContainer = OrderbooksContainer{Orderbooks: make(map[string]*OrderbookData)}
 var ArbContainer = ArbTablesContainer{ArbTables: make(map[string]*ArbTable)}
 var AevoIndex = IndexContainer{Index: make(map[string]float64)}
 var LyraIndex = IndexContainer{Index: make(map[string]float64)}
 
-func unpackOrders(orders []interface{}, exchange string) ([]Order, error) {
-	unpackedOrders := make([]Order, 0)
-	for _, order := range orders {
-		orderArr, ok := order.([]interface{})
+var Assets = []string{"ETH"} //underlyings whose chains are subscribed and scanned
 
-		if !ok {
-			return unpackedOrders, errors.New("orders not of []interface{} type")
-		}
-		if exchange == "aevo" && len(orderArr) != 3 {
-			return unpackedOrders, errors.New("aevo orders not length 3")
+// parseNumberStrings parses a JSON array of a price and exactly len(values) more number strings, e.g. ["3000.5","1.2"],
+// the price into price and the others into values, without the []interface{} or []string intermediates of json.Unmarshal. Used by the UnmarshalJSON of level types.
+func parseNumberStrings(data []byte, price *decimal.Decimal, values []float64) error {
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '[' || data[len(data)-1] != ']' {
+		return fmt.Errorf("parseNumberStrings: not an array: %s", data)
+	}
+
+	fields := data[1 : len(data)-1]
+	for i := -1; i < len(values); i++ {
+		end := bytes.IndexByte(fields, ',')
+		if end < 0 {
+			end = len(fields)
 		}
-		if exchange == "lyra" && len(orderArr) != 2 {
-			return unpackedOrders, errors.New("lyra orders not length 2")
+		if (end == len(fields)) != (i == len(values)-1) {
+			return fmt.Errorf("parseNumberStrings: expected %v elements: %s", len(values)+1, data)
 		}
 
-		priceStr, priceOk := orderArr[0].(string)
-		amountStr, amountOk := orderArr[1].(string)
-		var ivStr string
-		var ivOk bool
-		if exchange == "aevo" {
-			ivStr, ivOk = orderArr[2].(string)
-		}
-		if exchange == "lyra" {
-			ivStr = "-1"
-			ivOk = true
+		field := bytes.TrimSpace(fields[:end])
+		if len(field) < 2 || field[0] != '"' || field[len(field)-1] != '"' {
+			return fmt.Errorf("parseNumberStrings: element %v not a string: %s", i+1, data)
 		}
-		if !priceOk || !amountOk || !ivOk {
-			return unpackedOrders, errors.New("unable to convert interface{} element to string")
+		if i < 0 {
+			value, err := decimal.Parse(string(field[1 : len(field)-1]))
+			if err != nil {
+				return fmt.Errorf("parseNumberStrings: element 0: %v", err)
+			}
+			*price = value
+		} else {
+			value, err := strconv.ParseFloat(string(field[1:len(field)-1]), 64)
+			if err != nil {
+				return fmt.Errorf("parseNumberStrings: element %v: %v", i+1, err)
+			}
+			values[i] = value
 		}
 
-		price, priceErr := strconv.ParseFloat(priceStr, 64)
-		amount, amountErr := strconv.ParseFloat(amountStr, 64)
-		iv, ivErr := strconv.ParseFloat(ivStr, 64)
-		if priceErr != nil || amountErr != nil || ivErr != nil {
-			log.Printf("%v\n", priceErr)
-			log.Printf("%v\n", amountErr)
-			log.Printf("%v\n", ivErr)
-			return unpackedOrders, errors.New("error converting string to float64")
+		if end < len(fields) {
+			fields = fields[end+1:]
 		}
-
-		unpackedOrders = append(unpackedOrders, Order{price, amount, iv, exchange})
-	}
-
-	return unpackedOrders, nil
-}
-
-func wssRead(ctx context.Context, c *websocket.Conn) ([]byte, error) {
-	_, raw, err := c.Read(ctx)
-	if err != nil {
-		return raw, fmt.Errorf("wssRead: read error: %v\n(response): %v", err, raw)
 	}
 
-	return raw, nil //return error as well?
+	return nil
 }
 
-func wssPingLoop(ctx context.Context, c *websocket.Conn) {
-	data := struct {
-		Id int    `json:"id"`
-		Op string `json:"op"`
-	}{
-		1,
-		"ping",
+// applyOrderDeltas returns orders with deltas applied: a delta replaces the level at its price, or removes it if its
+// Amount is 0, at most limit levels when limit is positive. Both are sorted best first, so they're merged in one pass
+// into a slice allocated once to the resulting depth. orders itself isn't modified, readers may still hold it.
+func applyOrderDeltas(orders []Order, deltas []Order, descending bool, limit int) []Order {
+	better := func(a decimal.Decimal, b decimal.Decimal) bool {
+		if descending {
+			return a > b
+		}
+		return a < b
 	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("wssPingLoop: json marshal error: %v", err)
+	depth := len(orders) + len(deltas)
+	if limit > 0 {
+		depth = min(depth, limit)
 	}
 
-	for {
-		err = c.Write(ctx, 1, jsonData)
-		if err != nil {
-			log.Printf("wssPingLoop: write error: %v\n", err)
+	updated := make([]Order, 0, depth)
+	i := 0
+	for _, delta := range deltas {
+		for ; i < len(orders) && better(orders[i].Price, delta.Price) && len(updated) < depth; i++ {
+			updated = append(updated, orders[i])
+		}
+		for i < len(orders) && orders[i].Price == delta.Price { //replaced or removed
+			i++
+		}
+		if delta.Amount > 0 && len(updated) < depth {
+			updated = append(updated, delta)
 		}
-		log.Printf("Sent ping\n")
-		time.Sleep(time.Minute)
 	}
-}
+	for ; i < len(orders) && len(updated) < depth; i++ {
+		updated = append(updated, orders[i])
+	}
 
-func dialWss(url string) (context.Context, *websocket.Conn, context.CancelFunc) {
-	ctx, cancel := context.WithCancel(context.Background())
+	return updated
+}
 
-	c, res, err := websocket.Dial(ctx, url, nil)
-	if err != nil {
-		log.Fatalf("Dial error: %v", err)
+// sortOrders sorts decoded levels best first, bids descending by price and asks ascending.
+func sortOrders(orders []Order, descending bool) {
+	if descending {
+		slices.SortFunc(orders, func(a Order, b Order) int { return cmp.Compare(b.Price, a.Price) })
+		return
 	}
-	fmt.Printf("%v\n\n", res)
-
-	return ctx, c, cancel
+	slices.SortFunc(orders, func(a Order, b Order) int { return cmp.Compare(a.Price, b.Price) })
 }
 
-func mainEventLoop(connections map[string]connData) {
-	// maxTime := time.Second * 0
-	for {
-		// start := time.Now()
-		aevoWssRead(connections["aevo"].Ctx, connections["aevo"].Conn)
-		lyraWssRead(connections["lyra"].Ctx, connections["lyra"].Conn)
-		updateArbTables("ETH")
-		// duration := time.Since(start)
-		// if duration > maxTime && duration < time.Second*2 {
-		// 	maxTime = duration
-		// }
-		// log.Printf("loop time: %v\nmax time: %v\n\n", duration, maxTime)
+// wssReadLoop hands frames from a connection to the pipeline.
+func wssReadLoop(c *WssConn, pipeline FrameSink) {
+	for raw := range c.Frames {
+		if Recording != nil {
+			Recording.Record(c.Exchange, raw)
+		}
+		pipeline.SubmitPooled(c.Exchange, raw)
 	}
 }
 
 func serveHome(w http.ResponseWriter, r *http.Request) {
 	tmpl := template.Must(template.ParseFiles("templates/index.html"))
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, struct{ Sort string }{arbTableSort(r)})
 }
 
-func arbTableHandler(w http.ResponseWriter, r *http.Request) {
-	ArbContainer.Mu.Lock()
-	defer ArbContainer.Mu.Unlock()
+// arbTableSort is the ?sort= of a table request, "abs" (AbsProfit) or the default "apy".
+func arbTableSort(r *http.Request) string {
+	if r.URL.Query().Get("sort") == "abs" {
+		return "abs"
+	}
+	return "apy"
+}
+
+// renderArbTable renders the rows of the arb table, watchlist strikes pinned to the top and the rest sorted by Apy, or
+// by AbsProfit when sortBy is "abs", both discounted by FillProbability and BookQuality.
+func renderArbTable(sortBy string) string {
+	ArbContainer.Mu.RLock()
+	defer ArbContainer.Mu.RUnlock()
 
 	arbTablesSlice := make([]*ArbTable, len(ArbContainer.ArbTables)) //converting to slice to sort by apy
 	i := 0
@@ -197,33 +230,87 @@ func arbTableHandler(w http.ResponseWriter, r *http.Request) {
 		arbTablesSlice[i] = table
 		i++
 	}
-	sort.Slice(arbTablesSlice, func(i, j int) bool { return arbTablesSlice[i].Apy > arbTablesSlice[j].Apy })
+	watched := make(map[*ArbTable]bool)
+	for key, table := range ArbContainer.ArbTables {
+		watched[table] = isWatched(key)
+	}
+	sort.Slice(arbTablesSlice, func(i, j int) bool {
+		if watched[arbTablesSlice[i]] != watched[arbTablesSlice[j]] { //watchlist pinned to the top
+			return watched[arbTablesSlice[i]]
+		}
+		return arbTablesSlice[i].rankValue(sortBy) > arbTablesSlice[j].rankValue(sortBy)
+	})
 
 	responseStr := ""
 	for _, value := range arbTablesSlice {
-		responseStr += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+		responseStr += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td title="%s">%s</td><td>%s</td></tr>`,
 			value.Expiry,
 			strconv.FormatFloat(value.Strike, 'f', 3, 64),
 			value.BidExchange,
 			value.BidType,
-			strconv.FormatFloat(value.Bids[0].Price, 'f', 3, 64),
+			strconv.FormatFloat(value.Bids[0].Price.Float64(), 'f', 3, 64),
 			value.AskExchange,
 			value.AskType,
-			strconv.FormatFloat(value.Asks[0].Price, 'f', 3, 64),
+			strconv.FormatFloat(value.Asks[0].Price.Float64(), 'f', 3, 64),
 			strconv.FormatFloat(value.AbsProfit, 'f', 3, 64),
+			strconv.FormatFloat(value.Capital, 'f', 2, 64),
 			strconv.FormatFloat(value.RelProfit, 'f', 3, 64),
 			strconv.FormatFloat(value.Apy, 'f', 3, 64),
+			strconv.FormatFloat(value.FillProbability*100, 'f', 0, 64),
+			strconv.FormatFloat(value.ExecutableSize, 'f', 2, 64),
+			strconv.FormatFloat(value.VwapProfit, 'f', 3, 64),
+			value.SizeLimit,
+			strconv.FormatFloat(value.SuggestedSize, 'f', 2, 64),
+			strconv.FormatFloat(value.SuggestedNotional, 'f', 0, 64),
 		)
 	}
 
-	fmt.Fprint(w, responseStr)
+	return responseStr
+}
+
+func arbTableHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, renderArbTable(arbTableSort(r)))
+}
+
+// arbTableEventsHandler streams the rendered arb table as server-sent "arb-table" events once a second until the
+// client goes away, the page swaps each event into the table body with the htmx sse extension.
+func arbTableEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sortBy := arbTableSort(r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		fmt.Fprintf(w, "event: arb-table\ndata: %s\n\n", renderArbTable(sortBy)) //rows are rendered without newlines
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	AevoIndex.Mu.Lock()
-	LyraIndex.Mu.Lock()
-	defer AevoIndex.Mu.Unlock()
-	defer LyraIndex.Mu.Unlock()
+	AevoIndex.Mu.RLock()
+	LyraIndex.Mu.RLock()
+	DeribitIndex.Mu.RLock()
+	OkxIndex.Mu.RLock()
+	BinanceOptionsIndex.Mu.RLock()
+	defer AevoIndex.Mu.RUnlock()
+	defer LyraIndex.Mu.RUnlock()
+	defer DeribitIndex.Mu.RUnlock()
+	defer OkxIndex.Mu.RUnlock()
+	defer BinanceOptionsIndex.Mu.RUnlock()
 	responseStr := ""
 	text := ""
 	for key, value := range AevoIndex.Index {
@@ -236,31 +323,589 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 		text += fmt.Sprintf(`%s: %s &nbsp;&nbsp;&nbsp;`, key, strconv.FormatFloat(value, 'f', 3, 64))
 		responseStr += fmt.Sprintf(`<h3>Lyra:  %s</h3>`, text)
 	}
+
+	text = ""
+	for key, value := range DeribitIndex.Index {
+		text += fmt.Sprintf(`%s: %s &nbsp;&nbsp;&nbsp;`, key, strconv.FormatFloat(value, 'f', 3, 64))
+		responseStr += fmt.Sprintf(`<h3>Deribit:  %s</h3>`, text)
+	}
+
+	text = ""
+	for key, value := range OkxIndex.Index {
+		text += fmt.Sprintf(`%s: %s &nbsp;&nbsp;&nbsp;`, key, strconv.FormatFloat(value, 'f', 3, 64))
+		responseStr += fmt.Sprintf(`<h3>OKX:  %s</h3>`, text)
+	}
+
+	text = ""
+	for key, value := range BinanceOptionsIndex.Index {
+		text += fmt.Sprintf(`%s: %s &nbsp;&nbsp;&nbsp;`, key, strconv.FormatFloat(value, 'f', 3, 64))
+		responseStr += fmt.Sprintf(`<h3>Binance:  %s</h3>`, text)
+	}
 	fmt.Fprint(w, responseStr)
 }
 
-func main() {
-	aevoCtx, aevoConn, aevoCancel := dialWss(AevoWss)
-	lyraCtx, lyraConn, lyraCancel := dialWss(LyraWss)
-	connections := map[string]connData{
-		"aevo": {aevoCtx, aevoConn, aevoCancel},
-		"lyra": {lyraCtx, lyraConn, lyraCancel},
+// runCommand streams the configured exchanges into the arb engine and serves the UI and API, the default command.
+func runCommand(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	cfg, configFile := registerConfigFlags(fs)
+	benchFile := fs.String("bench", "", "replay a capture file as fast as possible and report throughput, then exit")
+	soakDuration := fs.Duration("soak", 0, "run the pipeline against synthetic traffic for this long, then exit")
+	soakRate := fs.Int("soak-rate", 1000, "synthetic messages per second in -soak mode")
+	soakInstruments := fs.Int("soak-instruments", 200, "number of synthetic instruments in -soak mode")
+	availableMargin := fs.Float64("available-margin", 0, "capital available per opportunity for suggested sizes (0 is unlimited)")
+	boxRate := fs.Float64("box-rate", -1, "annual rate box spread payouts are discounted at (negative uses the risk-free rate)")
+	riskFreeRate := fs.Float64("risk-free-rate", 0.05, "annual risk-free rate, as a fraction, excess APYs are computed over")
+	lendingPool := fs.String("lending-pool", "", "DefiLlama yields pool id whose stablecoin supply APY replaces -risk-free-rate (empty disables)")
+	ratesInterval := fs.Duration("rates-interval", time.Hour, "lending pool rate refresh interval")
+	hedgeMarginRate := fs.Float64("hedge-margin-rate", 0.1, "margin locked per contract of perpetual hedge as a fraction of the index")
+	minEdge := fs.Float64("min-edge", 0, "minimum profit per contract for book levels to count towards suggested sizes")
+	quoteInstruments := fs.String("quote", "", "comma separated instruments to keep two sided quotes on (empty disables quoting)")
+	quoteSpread := fs.Float64("quote-spread", 0.02, "quote half spread as a fraction of fair value")
+	quoteSize := fs.Float64("quote-size", 1, "quote size per side in contracts")
+	quoteSkew := fs.Float64("quote-skew", 0.002, "fraction of fair value quotes shift per contract of inventory")
+	quoteMaxInventory := fs.Float64("quote-max-inventory", 10, "per instrument inventory at which a quote side is pulled")
+	volSpikePoints := fs.Float64("vol-spike", 5, "alert when ATM IV of an expiry moves more than this many vol points within -vol-window (0 disables vol alerts)")
+	volDivergencePoints := fs.Float64("vol-divergence", 20, "alert when ATM IV differs from realized vol by more than this many vol points")
+	volWindow := fs.Duration("vol-window", 15*time.Minute, "window for vol spike and realized vol alerts")
+	spotDeviation := fs.Float64("spot-deviation", 0.5, "alert when the aevo index deviates from external CEX spot by more than this percent (0 disables)")
+	markDeviation := fs.Float64("mark-deviation", 10, "flag aevo marks further than this percent from the cross exchange mid")
+	modelDeviation := fs.Float64("model-deviation", 20, "flag aevo marks further than this percent from the model value at the fitted IV surface (0 disables)")
+	markMaxAge := fs.Duration("mark-max-age", time.Minute, "skip aevo marks not updated for this long when looking for dislocations")
+	surfaceTolerance := fs.Float64("surface-tolerance", 5, "vol points a bid above or ask below the fitted IV surface is flagged at")
+	minTimeToExpiry := fs.Duration("min-time-to-expiry", time.Hour, "ignore options expiring sooner than this when scanning for opportunities")
+	marketsRefresh := fs.Duration("markets-refresh", 10*time.Minute, "interval listed instruments are refetched at, subscribing new listings and unsubscribing expired ones")
+	recordFile := fs.String("record", "", "append every received websocket frame with its receipt time to this capture file")
+	replayFile := fs.String("replay", "", "feed this capture file through the pipeline instead of connecting to the exchanges, serving the UI and API as usual")
+	replaySpeed := fs.Float64("replay-speed", 1, "replay speed multiple of the recorded pace (0 is as fast as possible)")
+	liquidations := fs.Bool("liquidations", false, "monitor binance futures liquidations and tag opportunities found after bursts")
+	liquidationBurst := fs.Float64("liquidation-burst", 1000000, "USD liquidated within a minute that counts as a burst")
+	liquidationWindow := fs.Duration("liquidation-window", 5*time.Minute, "how long after a burst opportunities are tagged")
+	seriesInterval := fs.Duration("series-interval", 10*time.Second, "interval instruments' marks and IVs are sampled at for /api/series (0 disables)")
+	seriesRetention := fs.Duration("series-retention", 6*time.Hour, "mark and IV history kept per instrument and exchange")
+	openInterestInterval := fs.Duration("open-interest-interval", 5*time.Minute, "open interest refresh interval (0 disables)")
+	strategies := fs.String("strategies", "parity", "comma separated scanners run by the arb pass, their opportunities are served on /api/opportunities")
+	scansFile := fs.String("scans", "", "file of \"name: expression\" custom scans served on /api/scans")
+	scriptsDir := fs.String("scripts", "", "directory of starlark (*.star) scripts receiving book, index and surface updates")
+	watch := fs.String("watch", "", "comma separated watchlist of instruments (ETH-28JUN24-3000-C) or structures (ETH-28JUN24-3000)")
+	alertMinProfit := fs.Float64("alert-min-profit", 0, "notify when an opportunity's profit per contract reaches this (0 disables)")
+	alertMinApy := fs.Float64("alert-min-apy", 0, "notify when an opportunity's APY reaches this percent (0 disables)")
+	alertCooldown := fs.Duration("alert-cooldown", 15*time.Minute, "minimum time between notifications about the same opportunity")
+	alertRate := fs.Int("alert-rate", 10, "maximum notifications per minute")
+	alertWebhook := fs.String("alert-webhook", "", "url opportunity alerts are POSTed to as JSON, Telegram and Discord are enabled by TELEGRAM_BOT_TOKEN/TELEGRAM_CHAT_ID and DISCORD_WEBHOOK_URL")
+	watchMoveAlert := fs.Float64("watch-move-alert", 5, "alert when a watched instrument's mid moves more than this percent")
+	memBudget := fs.Int64("mem-budget", 0, "approximate orderbook memory budget in MB, least active books are trimmed when exceeded (0 disables)")
+	profileDir := fs.String("profile-dir", "", "periodically write cpu/heap profiles to this directory (empty disables)")
+	profileInterval := fs.Duration("profile-interval", 5*time.Minute, "time between profile snapshots")
+	profileCpuDuration := fs.Duration("profile-cpu-duration", 30*time.Second, "cpu sampling duration of each snapshot")
+	profileKeep := fs.Int("profile-keep", 12, "number of snapshots of each kind kept in -profile-dir")
+	greeksMaxAge := fs.Duration("greeks-max-age", 15*time.Minute, "exchange greeks older than this are replaced by locally priced ones")
+	greeksTolerance := fs.Float64("greeks-tolerance", 0.05, "delta difference between exchange and model greeks /api/greeks flags as a mismatch")
+	maxBookAge := fs.Duration("max-book-age", 5*time.Minute, "leave out exchanges' book sides whose last update is older than this from arb calculations (0 disables)")
+	arbPersistAfter := fs.Duration("arb-persist-after", time.Second, "how long an opportunity has to stay open to be flagged persisted in arb_lifetimes")
+	trades := fs.Bool("trades", false, "subscribe every instrument's trades, served as rolling statistics on /api/trades and used to leave out book sides a later print went through")
+	tradeWindow := fs.Duration("trade-window", 15*time.Minute, "window of the trade statistics")
+	verifyChecksums := fs.Bool("verify-checksums", true, "check books against the checksums exchanges send and resync them on a mismatch")
+	parityForward := fs.Bool("parity-forward", true, "price put-call parity against each expiry's forward (aevo forward or perp funding basis) instead of the spot index")
+	paper := fs.Bool("paper", false, "paper trade: execute every new opportunity against the live books and report realized against expected profit on /api/paper")
+	paperLatency := fs.Duration("paper-latency", 200*time.Millisecond, "modeled delay from detecting an opportunity to its paper orders reaching the books")
+	fillLatency := fs.Duration("fill-latency", 200*time.Millisecond, "delay from detecting an opportunity to orders reaching the books, opportunities are ranked by the chance their quotes last it (0 disables)")
+	metricsLevels := fs.Int("metrics-levels", 5, "book levels per side the depth and imbalance metrics are computed over")
+	qualitySpread := fs.Float64("quality-spread", 0.05, "relative spread that halves a leg's book quality, opportunities are ranked by it (0 disables)")
+	qualityDepth := fs.Float64("quality-depth", 10, "contracts within -metrics-levels that halve a leg's book quality (0 disables)")
+	paperSize := fs.Float64("paper-size", 1, "contracts per paper trade, less when the suggested size is smaller")
+	maxNotional := fs.Float64("max-notional", 0, "largest order placed, in USD index notional, larger ones are sized down (0 disables)")
+	maxContracts := fs.Float64("max-contracts", 0, "most contracts held per instrument, open orders included (0 disables)")
+	maxDelta := fs.Float64("max-delta", 0, "largest absolute portfolio delta orders may bring, in the underlying (0 disables)")
+	maxVega := fs.Float64("max-vega", 0, "largest absolute portfolio vega orders may bring, USD per vol point (0 disables)")
+	aevoPrivate := fs.Bool("aevo-private", true, "stream the aevo account's fills, positions and orders when AEVO_API_KEY and AEVO_API_SECRET are set")
+	aevoMarkets := fs.String("aevo-markets", "per-asset", "how aevo's markets are listed: per-asset, a request per asset, or all, one sweep of every asset's")
+	aevoMarketsPageSize := fs.Int("aevo-markets-page-size", 0, "request aevo's markets this many at a time (0 requests them all at once)")
+	deribitPrivate := fs.Bool("deribit-private", true, "stream the deribit account's fills, positions and orders on the deribit connections when DERIBIT_CLIENT_ID and DERIBIT_CLIENT_SECRET are set")
+	dryRun := fs.Bool("dry-run", true, "sign aevo orders without sending them, -dry-run=false trades for real")
+	legPolicy := fs.String("leg-policy", "hedge", "what executions do with legs that filled unevenly: chase, hedge or unwind")
+	legTimeout := fs.Duration("leg-timeout", 5*time.Second, "how long execution orders rest before what's left is cancelled")
+	chaseAttempts := fs.Int("chase-attempts", 2, "times -leg-policy=chase reprices lagging legs")
+	hedgeSlippage := fs.Float64("hedge-slippage", 0.005, "fraction from the perpetual's mark its execution orders are limited at")
+	cancelStaleAfter := fs.Duration("cancel-stale-after", 10*time.Second, "cancel every open order when a feed received nothing for this long, and on shutdown (0 disables the stale check)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of message processing workers, frames are sharded by instrument")
+	queueSize := fs.Int("queue-size", 1024, "per worker frame queue size")
+	accountEquity := fs.Float64("account-equity", 0, "account equity margin stress tests on /api/stress are run against")
+	stressSpot := fs.String("stress-spot", "-30,-20,-10,10,20,30", "comma separated percent spot shocks of the margin stress set")
+	stressVol := fs.String("stress-vol", "-20,0,20", "comma separated vol point shifts of the margin stress set")
+	maintenanceRate := fs.Float64("maintenance-rate", 0.01, "maintenance margin per contract as a fraction of spot")
+	rvZScore := fs.Float64("rv-zscore", 2.5, "flag cross asset ATM IV ratios this many standard deviations from their mean (needs two or more -assets)")
+	rvHistory := fs.Duration("rv-history", 24*time.Hour, "IV ratio history cross asset z-scores are computed over")
+	rvCorrelationWindow := fs.Duration("rv-correlation-window", time.Hour, "window for the correlation of index returns between assets")
+	wssPingInterval := fs.Duration("wss-ping-interval", 30*time.Second, "websocket heartbeat interval (0 disables heartbeats and the stale watchdog)")
+	restFallbackAfter := fs.Duration("rest-fallback-after", time.Minute, "fetch the REST book of channels whose subscription failed or whose exchange side hasn't updated for this long (0 disables)")
+	restFallbackBatch := fs.Int("rest-fallback-batch", 20, "max REST fallback books fetched per exchange and pass")
+	breakerIndexJump := fs.Float64("breaker-index-jump", 0.1, "quarantine an asset whose index moves more than this fraction in one update (0 disables)")
+	breakerCrossedAfter := fs.Duration("breaker-crossed-after", 5*time.Second, "quarantine an instrument whose book on one exchange stays crossed this long (0 disables)")
+	breakerMaxIv := fs.Float64("breaker-max-iv", 10, "quarantine an instrument whose best bid or ask quotes an IV above this, 10 is 1000% (0 disables)")
+	breakerCooldown := fs.Duration("breaker-cooldown", time.Minute, "how long a quarantine lasts after the last implausible update")
+	warmStart := fs.Bool("warm-start", false, "fetch every subscribed instrument's REST book at startup so arbs are priced before the websocket snapshots are in")
+	snapshotConcurrency := fs.Int("snapshot-concurrency", 8, "REST book requests in flight per exchange for -warm-start and /api/market-snapshot")
+	ackTimeout := fs.Duration("subscribe-ack-timeout", 15*time.Second, "resubscribe channels the exchange hasn't confirmed within this long")
+	subscribeRetries := fs.Int("subscribe-retries", 3, "resubscribe attempts before a channel is reported never confirmed on /api/subscriptions")
+	maxProcessingLatency := fs.Duration("max-processing-latency", 250*time.Millisecond, "warn when a frame takes longer than this from being read to being processed (0 disables)")
+	wssStaleAfter := fs.Duration("wss-stale-after", 90*time.Second, "reconnect a websocket that received nothing for this long (0 disables)")
+	wssMaxAge := fs.Duration("wss-max-age", 0, "proactively replace websocket connections older than this, e.g. ahead of scheduled exchange disconnects (0 disables)")
+	tui := fs.Bool("tui", false, "show a terminal dashboard instead of logging to stderr, the UI and API are served as usual")
+	tuiLog := fs.String("tui-log", "options-ws.log", "file logs are written to in -tui mode")
+	fs.Parse(args)
+
+	applyConfig(fs, cfg, *configFile)
+	var err error
+	if *tui {
+		logFile, err := os.OpenFile(*tuiLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("-tui-log: %v", err)
+		}
+		defer logFile.Close()
+		err = setupLogging(cfg.LogLevel, cfg.LogFormat, logFile)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+	}
+	if cfg.StoreDsn != "" {
+		Ticks, err = openTickStore(cfg.StoreDriver, cfg.StoreDsn, cfg.StoreQueue)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer Ticks.Close()
+		defer func() { closeArbLives(time.Now()) }() //before Close, defers run last in first out
+	}
+	if len(cfg.Outputs) > 0 {
+		sinks, err := openOutputs(cfg.Outputs)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer closeOutputs(sinks)
+	}
+	MemoryBudget = *memBudget * 1024 * 1024
+	AvailableMargin = *availableMargin
+	MinEdge = *minEdge
+	BoxRate = *boxRate
+	RiskFreeRate = *riskFreeRate
+	LendingPool = *lendingPool
+	HedgeMarginRate = *hedgeMarginRate
+	UseForward = *parityForward
+	VerifyChecksums = *verifyChecksums
+	MaxBookAge = *maxBookAge
+	SubscribeTrades = *trades
+	TradeWindow = *tradeWindow
+	ArbPersistAfter = *arbPersistAfter
+	Limits = RiskLimits{*maxNotional, *maxContracts, *maxDelta, *maxVega}
+	PaperLatency = *paperLatency
+	FillLatency = *fillLatency
+	MetricsLevels, QualitySpread, QualityDepth = max(*metricsLevels, 1), *qualitySpread, *qualityDepth
+	PaperSize = *paperSize
+	MarketsRefresh = *marketsRefresh
+	MinTimeToExpiry = *minTimeToExpiry
+	SurfaceTolerance = *surfaceTolerance
+	MarkDeviation, ModelDeviation, MarkMaxAge = *markDeviation, *modelDeviation, *markMaxAge
+	WatchMoveAlert = *watchMoveAlert
+	setWatchlist(strings.Split(*watch, ","))
+	LiquidationBurst = *liquidationBurst
+	LiquidationWindow = *liquidationWindow
+	AccountEquity = *accountEquity
+	MaintenanceRate = *maintenanceRate
+	AckTimeout = *ackTimeout
+	MaxProcessingLatency = *maxProcessingLatency
+	SeriesInterval, SeriesRetention = *seriesInterval, *seriesRetention
+	CancelStaleAfter = *cancelStaleAfter
+	LegPolicy, LegTimeout, ChaseAttempts, HedgeSlippage = *legPolicy, *legTimeout, *chaseAttempts, *hedgeSlippage
+	if !slices.Contains(LegPolicies, LegPolicy) {
+		log.Fatalf("-leg-policy: not one of %v: %v", LegPolicies, LegPolicy)
+	}
+	RestFallbackAfter, RestFallbackBatch = *restFallbackAfter, *restFallbackBatch
+	SnapshotConcurrency = *snapshotConcurrency
+	BreakerIndexJump, BreakerCrossedAfter, BreakerMaxIv, BreakerCooldown = *breakerIndexJump, *breakerCrossedAfter, *breakerMaxIv, *breakerCooldown
+	SubscribeRetries = *subscribeRetries
+	GreeksMaxAge = *greeksMaxAge
+	GreeksTolerance = *greeksTolerance
+	StressSpotShocks, err = parseShocks(*stressSpot, nil)
+	if err != nil {
+		log.Fatalf("-stress-spot: %v", err)
+	}
+	StressVolShifts, err = parseShocks(*stressVol, nil)
+	if err != nil {
+		log.Fatalf("-stress-vol: %v", err)
+	}
+	err = setStrategies(strings.Split(*strategies, ","))
+	if err != nil {
+		log.Fatalf("-strategies: %v", err)
+	}
+	if *profileKeep < 1 {
+		log.Fatalf("-profile-keep: not at least 1: %v", *profileKeep)
+	}
+	if *profileDir != "" {
+		go profileLoop(*profileDir, *profileInterval, *profileCpuDuration, *profileKeep)
+	}
+
+	if *scansFile != "" {
+		err := loadScans(*scansFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	if *scriptsDir != "" {
+		err := loadScripts(*scriptsDir)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	if *benchFile != "" {
+		runBenchmark(*benchFile)
+		return
+	}
+	if *soakDuration > 0 {
+		runSoak(*soakDuration, *soakRate, *soakInstruments, newPipeline(*workers, *queueSize))
+		return
+	}
+
+	AevoClient.DryRun = *dryRun
+	signer, ok, err := aevo.SignerFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if ok {
+		AevoClient.Signer = &signer
+	}
+	if credentials, ok := aevo.CredentialsFromEnv(); ok {
+		AevoClient.Credentials = &credentials
+		err := aevoImportPortfolio(AevoClient) //before market data so pnl and greeks are right from the start
+		if err != nil {
+			slog.Error("aevoImportPortfolio failed", "err", err)
+		}
+	}
+	if *aevoMarkets != "per-asset" && *aevoMarkets != "all" {
+		log.Fatalf("-aevo-markets: not per-asset or all: %v", *aevoMarkets)
+	}
+	AevoMarketsMode, AevoClient.MarketsPageSize = *aevoMarkets, *aevoMarketsPageSize
+	if credentials, ok := deribitCredentialsFromEnv(); ok && *deribitPrivate {
+		DeribitAccount = &credentials
+	}
+
+	//interrupts stop the startup retries and the server, the deferred closes flush the store and connections
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	configureConn := func(c *WssConn) {
+		c.MaxAge = *wssMaxAge
+		c.PingInterval = *wssPingInterval
+		c.StaleAfter = *wssStaleAfter
+	}
+
+	pipeline := newAssetRouter(Assets, *workers, *queueSize)
+	conns := []*WssConn{}
+	if *recordFile != "" {
+		Recording, err = openRecorder(*recordFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer Recording.Close()
+	}
+	if *replayFile != "" {
+		cfg.Exchanges, *liquidations = nil, false //the capture stands in for every connection
+		MaxBookAge = 0                            //its books carry the recorded timestamps
+		go func() {
+			err := replayCapture(*replayFile, *replaySpeed, pipeline)
+			if err != nil {
+				slog.Error("replay failed", "err", err)
+			}
+		}()
+	}
+	exchanges := []struct {
+		Exchange        Exchange
+		Url             string
+		SubscribeJson   func(channels []string) []byte
+		UnsubscribeJson func(channels []string) []byte
+		PingJson        []byte
+	}{
+		{aevoExchange{}, AevoClient.WssUrl, aevo.SubscribeJson, aevo.UnsubscribeJson, aevo.PingJson()},
+		{lyraExchange{}, LyraWss, lyraSubscribeJson, lyraUnsubscribeJson, nil},
+		{deribitExchange{}, DeribitWss, deribitSubscribeJson, deribitUnsubscribeJson, deribitPingJson},
+		{okxExchange{}, OkxWss, okxSubscribeJson, okxUnsubscribeJson, okxPingJson},
+		{binanceOptionsExchange{}, BinanceOptionsWss, binanceSubscribeJson, binanceUnsubscribeJson, nil},
+	}
+	for _, exchange := range exchanges {
+		if !cfg.HasExchange(exchange.Exchange.Name()) {
+			continue
+		}
+		sharded := newShardedConn(exchange.Exchange.Name(), exchange.Url, exchange.SubscribeJson, connectionsFor(exchange.Exchange.Name()))
+		streamer, private := exchange.Exchange.(PrivateStreamer)
+		private = private && len(streamer.PrivateChannels()) > 0
+		for _, c := range sharded.Shards {
+			if private { //every shard, the account channels land on any of them
+				c.AuthJson = streamer.AuthJson
+			}
+			if private && tradingEnabled() {
+				c.CancelOnDisconnectJson, c.DisarmCancelOnDisconnectJson = streamer.CancelOnDisconnectJson(true), streamer.CancelOnDisconnectJson(false)
+			}
+			c.PingJson = exchange.PingJson
+			c.UnsubscribeJson = exchange.UnsubscribeJson
+			c.Limiter = VenueLimiters[c.Exchange]
+			configureConn(c)
+			err := connectSupervised(ctx, c)
+			if ctx.Err() != nil {
+				return //interrupted while connecting
+			}
+			if err != nil {
+				log.Fatalf("%v: %v", c.Exchange, err)
+			}
+			defer c.Close()
+
+			go wssReadLoop(c, pipeline)
+			conns = append(conns, c)
+		}
+		go exchangeReqLoop(exchange.Exchange, sharded)
+		if private {
+			err := sharded.Subscribe(streamer.PrivateChannels())
+			if err != nil {
+				slog.Error("subscribe failed", "exchange", sharded.Exchange, "err", err)
+			}
+		}
+
+		ResyncConns.Mu.Lock()
+		ResyncConns.Conns[sharded.Exchange] = sharded
+		ResyncConns.Mu.Unlock()
+	}
+
+	if AevoClient.Credentials != nil && *aevoPrivate && cfg.HasExchange("aevo") {
+		privateConn := newWssConn("aevo-private", AevoClient.WssUrl, aevo.SubscribeJson)
+		privateConn.AuthJson = func() []byte { return aevo.AuthJson(*AevoClient.Credentials) }
+		if tradingEnabled() { //orders the process placed are cancelled if it dies
+			privateConn.CancelOnDisconnectJson, privateConn.DisarmCancelOnDisconnectJson = aevo.CancelOnDisconnectJson(true), aevo.CancelOnDisconnectJson(false)
+		}
+		privateConn.PingJson = aevo.PingJson()
+		privateConn.Limiter = VenueLimiters["aevo"]
+		configureConn(privateConn)
+		err := connectSupervised(ctx, privateConn)
+		if ctx.Err() != nil {
+			return //interrupted while connecting
+		}
+		if err != nil {
+			log.Fatalf("aevo-private: %v", err)
+		}
+		defer privateConn.Close()
+		go func() { //account state, not market data, so not through the pipeline
+			for raw := range privateConn.Frames {
+				aevoProcessPrivate(raw)
+				releaseFrame(raw)
+			}
+		}()
+
+		err = privateConn.Subscribe(aevo.PrivateChannels)
+		if err != nil {
+			slog.Error("aevo-private: subscribe failed", "err", err)
+		}
+		go aevoAccountLoop(AevoClient, 30*time.Second)
+		conns = append(conns, privateConn)
+	}
+	if tradingEnabled() {
+		registerTradingHandler(cfg.Listen, "/api/executions", executionsHandler)
+	}
+	if tradingEnabled() && CancelStaleAfter > 0 { //the feeds orders are priced from, the liquidations feed isn't one
+		go deadManLoop(slices.Clone(conns), time.Second)
 	}
-	defer aevoCancel()
-	defer aevoConn.Close(websocket.StatusNormalClosure, "")
-	defer aevoConn.CloseNow()
-	defer lyraCancel()
-	defer lyraConn.Close(websocket.StatusNormalClosure, "")
-	defer lyraConn.CloseNow()
 
-	go aevoWssReqLoop(aevoCtx, aevoConn)
-	go lyraWssReqLoop(lyraCtx, lyraConn)
+	if *liquidations {
+		binanceConn := newWssConn("binance", BinanceFuturesWss, binanceSubscribeJson)
+		configureConn(binanceConn)
+		err := connectSupervised(ctx, binanceConn)
+		if ctx.Err() != nil {
+			return //interrupted while connecting
+		}
+		if err != nil {
+			log.Fatalf("binance: %v", err)
+		}
+		defer binanceConn.Close()
+		go wssReadLoop(binanceConn, pipeline)
 
-	go mainEventLoop(connections)
+		err = binanceConn.Subscribe(binanceLiquidationChannels(Assets))
+		if err != nil {
+			slog.Error("binance: subscribe failed", "err", err)
+		}
+		go liquidationLoop()
+		conns = append(conns, binanceConn)
+	}
+
+	if cfg.GrpcListen != "" || cfg.BusUrl != "" {
+		go feedLoop(ctx)
+	}
+	if cfg.GrpcListen != "" {
+		go func() {
+			err := serveGrpcFeed(ctx, cfg.GrpcListen)
+			if err != nil {
+				slog.Error("gRPC feed stopped", "err", err)
+			}
+		}()
+	}
+
+	if cfg.BusUrl != "" {
+		bus, err := openBus(cfg.BusUrl)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer bus.Close()
+		go busLoop(ctx, bus, cfg.BusPrefix, cfg.BusEncoding)
+	}
 
 	http.HandleFunc("/", serveHome)
 	http.HandleFunc("/update-table", arbTableHandler)
+	http.HandleFunc("/events/arb-table", arbTableEventsHandler)
+	http.HandleFunc("/events/orderbook", bookEventsHandler)
+	http.HandleFunc("/update-box-table", boxTableHandler)
 	http.HandleFunc("/update-index", indexHandler)
-	fmt.Println("Server starting on http://localhost:8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	http.HandleFunc("/update-watchlist", watchlistHandler)
+	http.HandleFunc("/api/status", statusHandler(conns, pipeline))
+	http.HandleFunc("/api/assets", pipeline.assetsHandler)
+	http.HandleFunc("/api/orderbooks", orderbooksHandler)
+	http.HandleFunc("/api/orderbooks/{instrument}", orderbookHandler)
+	http.HandleFunc("/api/market-snapshot", marketSnapshotHandler(configuredExchanges(cfg)))
+	http.HandleFunc("/api/index", indexApiHandler)
+	http.HandleFunc("/api/arbs", arbsHandler)
+	http.HandleFunc("/api/tickets", ticketsHandler)
+	http.HandleFunc("/api/opportunities", opportunitiesHandler)
+	http.HandleFunc("/api/arb-lifetimes", arbLifetimesHandler)
+	http.HandleFunc("/api/arb-stats", arbStatsHandler)
+	http.HandleFunc("/api/quarantine", quarantineHandler)
+	http.HandleFunc("/api/crossed-books", crossedBooksHandler)
+	http.HandleFunc("/api/book-metrics", bookMetricsHandler)
+	http.HandleFunc("/events/arbs", arbEventsHandler)
+	http.HandleFunc("/api/trades", tradesHandler)
+	http.HandleFunc("/api/instruments", instrumentsHandler)
+	http.HandleFunc("/api/rates", ratesHandler)
+	http.HandleFunc("/api/subscriptions", subscriptionsHandler(conns))
+	http.HandleFunc("/api/subscriptions/instruments", subscriptionOverridesHandler)
+	http.HandleFunc("/api/latency", latencyHandler)
+	http.HandleFunc("/api/dislocations", dislocationsHandler)
+	http.HandleFunc("/api/open-interest", openInterestHandler)
+	http.HandleFunc("/api/portfolio", portfolioHandler)
+	http.HandleFunc("/api/scenarios", scenariosApiHandler)
+	http.HandleFunc("/scenarios", serveScenarios)
+	http.HandleFunc("/scenario-table", scenarioTableHandler)
+	http.HandleFunc("/api/exposure", exposureHandler)
+	http.HandleFunc("/api/series", seriesHandler)
+	http.HandleFunc("/series", serveSeries)
+	http.HandleFunc("/series-chart", seriesChartHandler)
+	http.HandleFunc("/exposure", serveExposure)
+	http.HandleFunc("/exposure-table", exposureTableHandler)
+	http.HandleFunc("/api/stress", stressHandler)
+	http.HandleFunc("/api/screener", screenerApiHandler)
+	http.HandleFunc("/api/greeks", greeksHandler)
+	http.HandleFunc("/api/scans", scansHandler)
+	http.HandleFunc("/screener", serveScreener)
+	http.HandleFunc("/screener-table", screenerTableHandler)
+	http.HandleFunc("/api/iv-surface", surfaceHandler)
+	http.HandleFunc("/surface", serveSurface)
+	http.HandleFunc("/surface-table", surfaceTableHandler)
+	go indexHistoryLoop()
+	if SeriesInterval > 0 {
+		go seriesLoop(SeriesInterval)
+	}
+	go expiryLoop(time.Minute)
+	if *volSpikePoints > 0 {
+		for _, asset := range Assets {
+			volAlerter := newVolAlerter(asset)
+			volAlerter.SpikePoints = *volSpikePoints
+			volAlerter.DivergencePoints = *volDivergencePoints
+			volAlerter.Window = *volWindow
+			go volAlerter.Loop(time.Second)
+		}
+	}
+	if *spotDeviation > 0 {
+		for _, asset := range Assets {
+			go spotDeviationLoop(asset, *spotDeviation, 10*time.Second)
+		}
+	}
+	if len(Assets) > 1 {
+		CrossAssetRv.ZScore = *rvZScore
+		CrossAssetRv.History = *rvHistory
+		CrossAssetRv.CorrelationWindow = *rvCorrelationWindow
+		go CrossAssetRv.Loop(10 * time.Second)
+		http.HandleFunc("/api/relative-value", relativeValueHandler)
+	}
+	go dislocationLoop(5 * time.Second)
+	go crossedBookLoop(time.Second)
+	go watchAlertLoop(500 * time.Millisecond)
+	if notifiers := notifiersFromEnv(*alertWebhook); len(notifiers) > 0 && (*alertMinProfit > 0 || *alertMinApy > 0) {
+		arbAlerter := newArbAlerter(notifiers)
+		arbAlerter.MinProfit = *alertMinProfit
+		arbAlerter.MinApy = *alertMinApy
+		arbAlerter.Cooldown = *alertCooldown
+		arbAlerter.MaxPerMinute = *alertRate
+		go arbAlerter.Loop(time.Second)
+	}
+	if *scriptsDir != "" {
+		go scriptLoop(time.Second)
+		http.HandleFunc("/api/script-opportunities", scriptOpportunitiesHandler)
+	}
+	if *paper {
+		go paperLoop(100 * time.Millisecond)
+		http.HandleFunc("/api/paper", paperHandler)
+	}
+	if *openInterestInterval > 0 {
+		go openInterestLoop(*openInterestInterval)
+	}
+	if LendingPool != "" {
+		go ratesLoop(*ratesInterval)
+	}
+	go subscriptionLoop(AckTimeout / 3)
+	go reconcileLoop(conns, time.Minute)
+	if RestFallbackAfter > 0 {
+		go restFallbackLoop(RestFallbackAfter / 6)
+	}
+	if *warmStart {
+		go warmStartBooks(configuredExchanges(cfg))
+	}
+	if StrikeRange > 0 {
+		go strikeFilterLoop(10 * time.Second)
+	}
+	if *quoteInstruments != "" {
+		quoting := newQuotingEngine(strings.Split(*quoteInstruments, ","))
+		quoting.HalfSpread = *quoteSpread
+		quoting.Size = *quoteSize
+		quoting.Skew = *quoteSkew
+		quoting.MaxInventory = *quoteMaxInventory
+		quoting.Place = tradingEnabled()
+		Quoting = quoting
+		go quoting.Loop(time.Second)
+		http.HandleFunc("/api/quotes", quoting.quotesHandler)
+	}
+	defer printArbStats(os.Stderr)
+	defer cancelAllOrders("shutdown") //deferred last, so it runs before the connections close
+	slog.Info("Server starting", "listen", cfg.Listen)
+	if *tui {
+		go func() {
+			err := http.ListenAndServe(cfg.Listen, nil)
+			slog.Error("Server stopped", "err", err) //the dashboard keeps running on the streams
+		}()
+		err = runTui(conns, pipeline)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+	server := &http.Server{Addr: cfg.Listen}
+	go func() {
+		<-ctx.Done()
+		slog.Info("Server stopping")
+		server.Shutdown(context.Background())
+	}()
+	err = server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("%v", err)
+	}
+}
+
+// connectSupervised connects c, retrying transient failures with c's reconnect backoff until ctx ends, so an exchange
+// that is briefly unreachable at startup doesn't stop the process. A rejected handshake is returned at once.
+func connectSupervised(ctx context.Context, c *WssConn) error {
+	return supervise(ctx, c.Exchange+" connect", c.MinBackoff, c.MaxBackoff, func(ctx context.Context) error {
+		return c.Connect()
+	})
 }
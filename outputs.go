@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"options-ws/config"
+	"options-ws/feedpb"
+)
+
+// outputSink writes the events its output selects on the event bus as they come, dropping what it can't keep up with
+// like the other subscribers.
+type outputSink struct {
+	Output  config.Output
+	w       io.WriteCloser
+	stop    chan struct{}
+	done    chan struct{}
+	Dropped int
+}
+
+// openOutputs opens every output and starts writing the events they select, closing the ones opened if one fails.
+func openOutputs(outputs []config.Output) ([]*outputSink, error) {
+	sinks := make([]*outputSink, 0, len(outputs))
+	for _, output := range outputs {
+		var w io.WriteCloser
+		var err error
+		switch output.Type {
+		case "stdout":
+			w = nopCloser{os.Stdout}
+		case "file":
+			w, err = openRotatingFile(output.Path, output.MaxSize, output.MaxFiles)
+		case "jsonl":
+			w, err = openDailyFiles(output.Path, output.MaxSize, output.MaxFiles)
+		default:
+			err = fmt.Errorf("unknown output type: %v", output.Type)
+		}
+		if err != nil {
+			closeOutputs(sinks)
+			return nil, fmt.Errorf("openOutputs: %v", err)
+		}
+		if len(output.Events) == 0 {
+			output.Events = []string{"opportunities"}
+		}
+
+		sink := &outputSink{Output: output, w: w, stop: make(chan struct{}), done: make(chan struct{})}
+		var books *feedSubscriber[BookEvent]
+		var index *feedSubscriber[IndexEvent]
+		var opportunities *feedSubscriber[OpportunityEvent]
+		if slices.Contains(output.Events, "books") {
+			books = subscribeAll(&BookEvents)
+		}
+		if slices.Contains(output.Events, "indexes") {
+			index = subscribeAll(&IndexEvents)
+		}
+		if slices.Contains(output.Events, "opportunities") {
+			opportunities = subscribeAll(&OpportunityEvents)
+		}
+		go sink.writeLoop(books, index, opportunities)
+		sinks = append(sinks, sink)
+		slog.Info("openOutputs: writing", "type", output.Type, "path", output.Path, "events", output.Events)
+	}
+	return sinks, nil
+}
+
+// closeOutputs stops the sinks, writes what they've taken and closes their files.
+func closeOutputs(sinks []*outputSink) {
+	for _, sink := range sinks {
+		close(sink.stop)
+		<-sink.done
+		err := sink.w.Close()
+		if err != nil {
+			slog.Error("closeOutputs: close error", "type", sink.Output.Type, "path", sink.Output.Path, "err", err)
+		}
+		if sink.Dropped > 0 {
+			slog.Warn("closeOutputs: slow output, events dropped", "type", sink.Output.Type, "path", sink.Output.Path, "dropped", sink.Dropped)
+		}
+	}
+}
+
+// writeLoop writes the subscribers' events until stop, a nil subscriber's events aren't selected.
+func (s *outputSink) writeLoop(books *feedSubscriber[BookEvent], index *feedSubscriber[IndexEvent], opportunities *feedSubscriber[OpportunityEvent]) {
+	defer close(s.done)
+	var bookUpdates <-chan BookEvent
+	var indexUpdates <-chan IndexEvent
+	var opportunityUpdates <-chan OpportunityEvent
+	if books != nil {
+		bookUpdates = books.updates
+		defer func() { s.Dropped += BookEvents.Unsubscribe(books) }()
+	}
+	if index != nil {
+		indexUpdates = index.updates
+		defer func() { s.Dropped += IndexEvents.Unsubscribe(index) }()
+	}
+	if opportunities != nil {
+		opportunityUpdates = opportunities.updates
+		defer func() { s.Dropped += OpportunityEvents.Unsubscribe(opportunities) }()
+	}
+
+	for {
+		var line []byte
+		select {
+		case <-s.stop:
+			return
+		case event := <-bookUpdates:
+			line = s.bookLine(event)
+		case event := <-indexUpdates:
+			line = s.indexLine(event)
+		case event := <-opportunityUpdates:
+			line = s.opportunityLine(event)
+		}
+		if line == nil {
+			continue
+		}
+		_, err := s.w.Write(line)
+		if err != nil {
+			slog.Error("outputSink: write error", "type", s.Output.Type, "path", s.Output.Path, "err", err)
+		}
+	}
+}
+
+func (s *outputSink) bookLine(event BookEvent) []byte {
+	if s.Output.Type == "jsonl" {
+		return jsonLine("orderbook", &feedpb.OrderbookUpdate{Instrument: event.Instrument, Exchange: event.Exchange, Bids: feedLevels(event.Bids),
+			Asks: feedLevels(event.Asks), TimeNs: event.Time.UnixNano()})
+	}
+	level := func(orders []Order) string {
+		if len(orders) == 0 {
+			return "-"
+		}
+		return orders[0].Price.String() + " x " + strconv.FormatFloat(orders[0].Amount, 'f', -1, 64)
+	}
+	return []byte(fmt.Sprintf("%v book %v %v bid %v ask %v\n", outputTime(event.Time), event.Exchange, event.Instrument, level(event.Bids), level(event.Asks)))
+}
+
+func (s *outputSink) indexLine(event IndexEvent) []byte {
+	if s.Output.Type == "jsonl" {
+		return jsonLine("index", &feedpb.IndexUpdate{Exchange: event.Exchange, Asset: event.Asset, Price: event.Price, TimeNs: event.Time.UnixNano()})
+	}
+	return []byte(fmt.Sprintf("%v index %v %v %v\n", outputTime(event.Time), event.Exchange, event.Asset, event.Price))
+}
+
+func (s *outputSink) opportunityLine(event OpportunityEvent) []byte {
+	if s.Output.Type == "jsonl" {
+		if event.Closed {
+			return jsonLine("arb", &feedpb.ArbUpdate{Key: event.Key, Closed: true, TimeNs: event.Time.UnixNano()})
+		}
+		return jsonLine("arb", feedArb(event.Key, &event.Table, event.Time))
+	}
+	if event.Closed {
+		return []byte(fmt.Sprintf("%v arb %v closed\n", outputTime(event.Time), event.Key))
+	}
+	table := event.Table
+	return []byte(fmt.Sprintf("%v arb %v buy %v %v at %v, sell %v %v at %v: profit %.2f (%.2f%%, apy %.1f%%) size %v\n", outputTime(event.Time), event.Key,
+		table.AskExchange, table.AskType, table.Asks[0].Price, table.BidExchange, table.BidType, table.Bids[0].Price, table.AbsProfit, table.RelProfit,
+		table.Apy, table.SuggestedSize))
+}
+
+func outputTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// jsonLine encodes update as the bus bridge's json encoding does, {"type": updateType, "update": ...}.
+func jsonLine(updateType string, update proto.Message) []byte {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(update)
+	if err != nil {
+		slog.Error("jsonLine: encode error", "type", updateType, "err", err)
+		return nil
+	}
+	line, _ := json.Marshal(struct {
+		Type   string          `json:"type"`
+		Update json.RawMessage `json:"update"`
+	}{updateType, data}) //compacts it, protojson's output isn't stable
+	return append(line, '\n')
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// rotatingFile appends to path, renaming it path.1 (and path.1 path.2 and so on) once a write would take it past
+// maxSize, keeping maxFiles rotated files. A maxSize of 0 never rotates, a maxFiles of 0 keeps every rotated file.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		err := f.rotate()
+		if err != nil {
+			return 0, fmt.Errorf("rotate: %v", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return err
+	}
+	rotated := 0
+	for {
+		if _, err := os.Stat(f.path + "." + strconv.Itoa(rotated+1)); err != nil {
+			break
+		}
+		rotated++
+	}
+	if f.maxFiles > 0 {
+		for ; rotated >= f.maxFiles; rotated-- { //their numbers would go past maxFiles
+			os.Remove(f.path + "." + strconv.Itoa(rotated))
+		}
+	}
+	for i := rotated; i >= 1; i-- {
+		err = os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1))
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Rename(f.path, f.path+".1")
+	if err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
+
+// dailyFiles writes to dir/options-ws-<UTC day>.jsonl, each a rotatingFile of maxSize keeping its rotated files, and
+// deletes the files of all but the maxDays newest days as a day starts, 0 keeping them all.
+type dailyFiles struct {
+	dir     string
+	maxSize int64
+	maxDays int
+	day     string
+	current *rotatingFile
+}
+
+func openDailyFiles(dir string, maxSize int64, maxDays int) (*dailyFiles, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &dailyFiles{dir: dir, maxSize: maxSize, maxDays: maxDays}, nil
+}
+
+func (d *dailyFiles) Write(p []byte) (int, error) {
+	day := time.Now().UTC().Format(time.DateOnly)
+	if day != d.day {
+		if d.current != nil {
+			d.current.Close()
+			d.current = nil
+		}
+		current, err := openRotatingFile(filepath.Join(d.dir, "options-ws-"+day+".jsonl"), d.maxSize, 0)
+		if err != nil {
+			return 0, err
+		}
+		d.current, d.day = current, day
+		d.prune()
+	}
+	return d.current.Write(p)
+}
+
+// prune deletes the files of the days before the maxDays newest.
+func (d *dailyFiles) prune() {
+	if d.maxDays <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(d.dir, "options-ws-*.jsonl*"))
+	if err != nil {
+		return
+	}
+	dayOf := func(file string) string {
+		day, _, _ := strings.Cut(strings.TrimPrefix(filepath.Base(file), "options-ws-"), ".")
+		return day
+	}
+	days := make([]string, 0)
+	for _, file := range files {
+		if day := dayOf(file); !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+	if len(days) <= d.maxDays {
+		return
+	}
+	sort.Strings(days) //dates sort as strings
+	expired := days[:len(days)-d.maxDays]
+	for _, file := range files {
+		if slices.Contains(expired, dayOf(file)) {
+			err := os.Remove(file)
+			if err != nil {
+				slog.Warn("dailyFiles: prune failed", "file", file, "err", err)
+			}
+		}
+	}
+}
+
+func (d *dailyFiles) Close() error {
+	if d.current == nil {
+		return nil
+	}
+	return d.current.Close()
+}
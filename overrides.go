@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const allExchanges = "*"
+
+// SubscriptionOverridesContainer holds instruments added, kept subscribed while listed whatever the strike and expiry
+// filters, or dropped, left out until cleared. Changes have exchangeReqLoop rebuild its channel lists at once.
+type SubscriptionOverridesContainer struct {
+	Mu        sync.Mutex
+	Overrides map[string]string //key: exchange (or allExchanges) + " " + instrument, value: "add" or "drop"
+	changed   chan struct{}     //closed and replaced on every change
+}
+
+var SubscriptionOverrides = SubscriptionOverridesContainer{Overrides: make(map[string]string), changed: make(chan struct{})}
+
+// Set overrides instrument on exchange (allExchanges for every one) with action "add" or "drop", or clears the
+// override with "auto".
+func (o *SubscriptionOverridesContainer) Set(exchange string, instrument string, action string) {
+	o.Mu.Lock()
+	defer o.Mu.Unlock()
+	key := exchange + " " + instrument
+	if action == "auto" {
+		delete(o.Overrides, key)
+	} else {
+		o.Overrides[key] = action
+	}
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// Clear removes every override with action, "add" or "drop".
+func (o *SubscriptionOverridesContainer) Clear(action string) {
+	o.Mu.Lock()
+	defer o.Mu.Unlock()
+	for key, value := range o.Overrides {
+		if value == action {
+			delete(o.Overrides, key)
+		}
+	}
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// Signal returns a channel that is closed on the next change.
+func (o *SubscriptionOverridesContainer) Signal() <-chan struct{} {
+	o.Mu.Lock()
+	defer o.Mu.Unlock()
+	return o.changed
+}
+
+// override is instrument's action on exchange, an exchange's own override taking precedence. The caller holds Mu.
+func (o *SubscriptionOverridesContainer) override(exchange string, instrument string) string {
+	if action, exists := o.Overrides[exchange+" "+instrument]; exists {
+		return action
+	}
+	return o.Overrides[allExchanges+" "+instrument]
+}
+
+// applySubscriptionOverrides returns the instruments of exchange to subscribe: those of kept (the filtered markets)
+// not dropped, and those of listed (every fetched market) added. Names are in the exchange's naming.
+func applySubscriptionOverrides(exchange string, listed []string, kept []string) []string {
+	SubscriptionOverrides.Mu.Lock()
+	defer SubscriptionOverrides.Mu.Unlock()
+	if len(SubscriptionOverrides.Overrides) == 0 {
+		return kept
+	}
+
+	isKept := make(map[string]bool, len(kept))
+	for _, name := range kept {
+		isKept[name] = true
+	}
+	instruments := make([]string, 0, len(kept))
+	for _, name := range listed {
+		instrument, err := normalizeVenueInstrument(exchange, name)
+		action := ""
+		if err == nil {
+			action = SubscriptionOverrides.override(exchange, instrument)
+		}
+		if (isKept[name] && action != "drop") || action == "add" {
+			instruments = append(instruments, name)
+		}
+	}
+	return instruments
+}
+
+type subscriptionOverrideJson struct {
+	Exchange   string `json:"exchange"` //"*" for every exchange
+	Instrument string `json:"instrument"`
+	Action     string `json:"action"`
+}
+
+func subscriptionOverridesSnapshot() []subscriptionOverrideJson {
+	SubscriptionOverrides.Mu.Lock()
+	overrides := make([]subscriptionOverrideJson, 0, len(SubscriptionOverrides.Overrides))
+	for key, action := range SubscriptionOverrides.Overrides {
+		exchange, instrument, _ := strings.Cut(key, " ")
+		overrides = append(overrides, subscriptionOverrideJson{exchange, instrument, action})
+	}
+	SubscriptionOverrides.Mu.Unlock()
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Instrument+overrides[i].Exchange < overrides[j].Instrument+overrides[j].Exchange
+	})
+	return overrides
+}
+
+// subscriptionOverridesHandler serves /api/subscriptions/instruments: GET lists the overrides, POST
+// ?instrument=ETH-28JUN24-3000-C adds the instrument (?action=drop drops it, ?action=auto clears its override) and
+// DELETE drops it, on every exchange or one with ?exchange=.
+func subscriptionOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	instrument := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("instrument")))
+	exchange := r.URL.Query().Get("exchange")
+	if exchange == "" {
+		exchange = allExchanges
+	}
+	action := r.URL.Query().Get("action")
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, "subscriptionOverridesHandler", subscriptionOverridesSnapshot())
+		return
+	case http.MethodPost:
+		if action == "" {
+			action = "add"
+		}
+	case http.MethodDelete:
+		action = "drop"
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if action != "add" && action != "drop" && action != "auto" {
+		http.Error(w, "action: not add, drop or auto", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseInstrument(instrument); err != nil {
+		http.Error(w, "instrument: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	SubscriptionOverrides.Set(exchange, instrument, action)
+	writeJson(w, "subscriptionOverridesHandler", subscriptionOverridesSnapshot())
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"options-ws/decimal"
+)
+
+// PaperTrade is an opportunity "executed" PaperLatency after it was found as two immediate-or-cancel orders limited at
+// its prices, filled against the books as they are by then without taking liquidity out of them.
+type PaperTrade struct {
+	Key         string
+	BidLeg      string //instrument sold, e.g. "ETH-28JUN24-3000-C"
+	AskLeg      string //instrument bought
+	BidExchange string
+	AskExchange string
+	Detected    time.Time
+	Executed    time.Time
+	Requested   float64 //contracts per leg
+	BidFilled   float64
+	AskFilled   float64
+	Size        float64 //contracts filled on both legs
+	BidPrice    float64 //volume weighted fill prices
+	AskPrice    float64
+	Expected    float64 //profit of Requested at detection
+	Realized    float64 //profit of Size at the fill prices
+}
+
+type PaperLedger struct {
+	Mu        sync.Mutex
+	Trades    []PaperTrade
+	Positions map[string]float64 //key: exchange + " " + instrument, signed contracts of both complete and unhedged legs
+	Expected  float64
+	Realized  float64
+	traded    map[string]bool //opportunities executed during their current lifetime
+}
+
+var Paper = PaperLedger{Positions: make(map[string]float64), traded: make(map[string]bool)}
+
+var PaperLatency = 200 * time.Millisecond //from detection to the orders reaching the exchanges
+var PaperSize = 1.0                       //contracts per trade, less when the suggested size is smaller
+
+const maxPaperTrades = 1000
+
+// paperLoop looks for new opportunities every interval and executes each once per lifetime, an opportunity that
+// disappears and comes back is traded again.
+func paperLoop(interval time.Duration) {
+	for {
+		arbs := ArbContainer.Snapshot()
+		now := time.Now()
+
+		Paper.Mu.Lock()
+		for key := range Paper.traded {
+			if _, exists := arbs[key]; !exists {
+				delete(Paper.traded, key)
+			}
+		}
+		for key, table := range arbs {
+			if Paper.traded[key] {
+				continue
+			}
+			Paper.traded[key] = true
+			time.AfterFunc(PaperLatency, func() { paperExecute(key, table, now) })
+		}
+		Paper.Mu.Unlock()
+
+		time.Sleep(interval)
+	}
+}
+
+// paperFill takes up to amount contracts from levels, best first, priced no worse than limit, returning the contracts
+// filled and their volume weighted price.
+func paperFill(levels []Order, amount float64, limit decimal.Decimal, buy bool) (float64, float64) {
+	filled, cost := 0.0, 0.0
+	for _, level := range levels {
+		if filled >= amount || (buy && level.Price > limit) || (!buy && level.Price < limit) {
+			break
+		}
+		take := min(level.Amount, amount-filled)
+		filled += take
+		cost += take * level.Price.Float64()
+	}
+	if filled == 0 {
+		return 0, 0
+	}
+	return filled, cost / filled
+}
+
+func paperExecute(key string, table ArbTable, detected time.Time) {
+	trade := paperFillTrade(key, table, detected, time.Now())
+
+	Paper.Mu.Lock()
+	Paper.Positions[trade.BidExchange+" "+trade.BidLeg] -= trade.BidFilled
+	Paper.Positions[trade.AskExchange+" "+trade.AskLeg] += trade.AskFilled
+	Paper.Expected += trade.Expected
+	Paper.Realized += trade.Realized
+	Paper.Trades = append(Paper.Trades, trade)
+	if len(Paper.Trades) > maxPaperTrades {
+		Paper.Trades = Paper.Trades[len(Paper.Trades)-maxPaperTrades:]
+	}
+	Paper.Mu.Unlock()
+
+	slog.Info("paperExecute: executed", "key", key, "requested", trade.Requested, "size", trade.Size, "bid_filled", trade.BidFilled,
+		"ask_filled", trade.AskFilled, "expected", trade.Expected, "realized", trade.Realized)
+}
+
+// paperFillTrade fills an opportunity found at detected against the current books at executed, the backtest passes
+// capture times.
+func paperFillTrade(key string, table ArbTable, detected time.Time, executed time.Time) PaperTrade {
+	requested := PaperSize
+	if table.SuggestedSize > 0 {
+		requested = min(requested, table.SuggestedSize)
+	}
+	expectedPerContract := table.AbsProfit
+	if table.VwapProfit > 0 {
+		expectedPerContract = table.VwapProfit
+	}
+
+	trade := PaperTrade{
+		Key:         key,
+		BidLeg:      key + "-" + table.BidType,
+		AskLeg:      key + "-" + table.AskType,
+		BidExchange: table.BidExchange,
+		AskExchange: table.AskExchange,
+		Detected:    detected,
+		Executed:    executed,
+		Requested:   requested,
+		Expected:    expectedPerContract * requested,
+	}
+	if bidBook, exists := OrderbookContainer.Get(trade.BidLeg); exists {
+		trade.BidFilled, trade.BidPrice = paperFill(bidBook.Bids[table.BidExchange], requested, table.Bids[0].Price, false)
+	}
+	if askBook, exists := OrderbookContainer.Get(trade.AskLeg); exists {
+		trade.AskFilled, trade.AskPrice = paperFill(askBook.Asks[table.AskExchange], requested, table.Asks[0].Price, true)
+	}
+	trade.Size = min(trade.BidFilled, trade.AskFilled)
+	if trade.Size > 0 {
+		index, _ := AevoIndex.Get(table.Asset)
+		hedged := table
+		hedged.Forward = index * forwardBasis(table.Asset, table.Expiry, executed) //hedged at the forward of execution time
+		trade.Realized = trade.Size * legProfit(&hedged, trade.BidPrice, trade.AskPrice, index)
+	}
+	return trade
+}
+
+type paperJson struct {
+	Trades    int //of the last maxPaperTrades, as are Filled and Unhedged
+	Filled    int //trades with both legs at least partly filled
+	Unhedged  int //trades with one leg filled more than the other
+	Expected  float64
+	Realized  float64
+	Capture   float64 //Realized / Expected
+	Positions map[string]float64
+	Recent    []PaperTrade //latest first
+}
+
+func paperHandler(w http.ResponseWriter, r *http.Request) {
+	Paper.Mu.Lock()
+	report := paperJson{Trades: len(Paper.Trades), Expected: Paper.Expected, Realized: Paper.Realized, Positions: make(map[string]float64)}
+	for key, amount := range Paper.Positions {
+		if amount != 0 {
+			report.Positions[key] = amount
+		}
+	}
+	for i := len(Paper.Trades) - 1; i >= 0; i-- {
+		trade := Paper.Trades[i]
+		if trade.Size > 0 {
+			report.Filled++
+		}
+		if trade.BidFilled != trade.AskFilled {
+			report.Unhedged++
+		}
+		if len(report.Recent) < 50 {
+			report.Recent = append(report.Recent, trade)
+		}
+	}
+	Paper.Mu.Unlock()
+	if report.Expected != 0 {
+		report.Capture = report.Realized / report.Expected
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		slog.Error("paperHandler: json encode error", "err", err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// tickRecord is one queued row, Table picks the insert statement and Values are its columns in order.
+type tickRecord struct {
+	Table  string
+	Values []interface{}
+}
+
+// tickTables are the persisted tables, the first column of each is the row's time in unix nanoseconds. arb_lifetimes
+// has a row per opportunity once it's gone, with the prices and sizes it was found at and how long it stayed open.
+var tickTables = []struct {
+	Name    string
+	Columns []string
+	Schema  string
+}{
+	{"orderbook_ticks", []string{"time", "exchange", "instrument", "bid", "bid_amount", "ask", "ask_amount", "bids", "asks"},
+		"time BIGINT, exchange TEXT, instrument TEXT, bid DOUBLE PRECISION, bid_amount DOUBLE PRECISION, ask DOUBLE PRECISION, ask_amount DOUBLE PRECISION, bids TEXT, asks TEXT"},
+	{"index_ticks", []string{"time", "exchange", "asset", "price"},
+		"time BIGINT, exchange TEXT, asset TEXT, price DOUBLE PRECISION"},
+	{"arb_opportunities", []string{"time", "key", "bid_exchange", "bid_type", "bid", "ask_exchange", "ask_type", "ask", "abs_profit", "rel_profit", "apy", "suggested_size"},
+		"time BIGINT, key TEXT, bid_exchange TEXT, bid_type TEXT, bid DOUBLE PRECISION, ask_exchange TEXT, ask_type TEXT, ask DOUBLE PRECISION, abs_profit DOUBLE PRECISION, rel_profit DOUBLE PRECISION, apy DOUBLE PRECISION, suggested_size DOUBLE PRECISION"},
+	{"arb_lifetimes", []string{"time", "closed", "duration_ms", "key", "asset", "expiry", "strike", "bid_exchange", "bid_type", "bid", "ask_exchange", "ask_type", "ask", "open_profit", "peak_profit", "close_profit", "peak_apy", "executable_size", "suggested_size", "passes", "updates", "persisted", "open_at_exit"},
+		"time BIGINT, closed BIGINT, duration_ms DOUBLE PRECISION, key TEXT, asset TEXT, expiry TEXT, strike DOUBLE PRECISION, bid_exchange TEXT, bid_type TEXT, bid DOUBLE PRECISION, ask_exchange TEXT, ask_type TEXT, ask DOUBLE PRECISION, open_profit DOUBLE PRECISION, peak_profit DOUBLE PRECISION, close_profit DOUBLE PRECISION, peak_apy DOUBLE PRECISION, executable_size DOUBLE PRECISION, suggested_size DOUBLE PRECISION, passes BIGINT, updates BIGINT, persisted BOOLEAN, open_at_exit BOOLEAN"},
+}
+
+// TickStore writes orderbook updates, index ticks and arb opportunities, taken from the event bus (see events.go), to a
+// database from its own goroutine. Records are queued without blocking, when the queue is full (the database can't
+// keep up) they are dropped and counted, the read loop never waits on disk I/O. Rows are inserted in batches of up to
+// BatchSize per transaction.
+type TickStore struct {
+	db            *sql.DB
+	driver        string
+	queue         chan tickRecord
+	BatchSize     int
+	FlushInterval time.Duration
+	Written       atomic.Int64
+	Dropped       atomic.Int64
+	done          chan struct{}
+	stop          chan struct{} //ends consumeLoop
+	consumed      chan struct{}
+}
+
+// Ticks is the store records are queued on, nil disables persistence.
+var Ticks *TickStore
+
+// openTickStore connects to driver ("sqlite" or "postgres") at dsn and creates the tables if needed.
+func openTickStore(driver string, dsn string, queueSize int) (*TickStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("openTickStore: %v", err)
+	}
+	if driver == "sqlite" {
+		db.SetMaxOpenConns(1) //sqlite allows one writer
+	}
+
+	for _, table := range tickTables {
+		_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + table.Name + " (" + table.Schema + ")")
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("openTickStore: create %v: %v", table.Name, err)
+		}
+	}
+
+	s := &TickStore{
+		db:            db,
+		driver:        driver,
+		queue:         make(chan tickRecord, queueSize),
+		BatchSize:     500,
+		FlushInterval: time.Second,
+		done:          make(chan struct{}),
+		stop:          make(chan struct{}),
+		consumed:      make(chan struct{}),
+	}
+	go s.writeLoop()
+	go s.consumeLoop(subscribeAll(&BookEvents), subscribeAll(&IndexEvents), subscribeAll(&OpportunityEvents))
+
+	return s, nil
+}
+
+// Enqueue queues a record, dropping it if the queue is full.
+func (s *TickStore) Enqueue(table string, values ...interface{}) {
+	select {
+	case s.queue <- tickRecord{table, values}:
+	default:
+		s.Dropped.Add(1)
+	}
+}
+
+// Close stops taking events, writes what's queued and closes the database.
+func (s *TickStore) Close() {
+	close(s.stop)
+	<-s.consumed
+	close(s.queue)
+	<-s.done
+	s.db.Close()
+}
+
+func (s *TickStore) writeLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]tickRecord, 0, s.BatchSize)
+	for {
+		select {
+		case record, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) < s.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (s *TickStore) flush(batch []tickRecord) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := s.insert(batch)
+	if err != nil {
+		slog.Error("TickStore: records lost", "records", len(batch), "err", err)
+		s.Dropped.Add(int64(len(batch)))
+		return
+	}
+	s.Written.Add(int64(len(batch)))
+}
+
+func (s *TickStore) insert(batch []tickRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("insert: begin: %v", err)
+	}
+	defer tx.Rollback() //no-op after Commit
+
+	statements := make(map[string]*sql.Stmt)
+	for _, table := range tickTables {
+		statement, err := tx.Prepare(s.insertSql(table.Name, table.Columns))
+		if err != nil {
+			return fmt.Errorf("insert: prepare %v: %v", table.Name, err)
+		}
+		defer statement.Close()
+		statements[table.Name] = statement
+	}
+
+	for _, record := range batch {
+		_, err = statements[record.Table].Exec(record.Values...)
+		if err != nil {
+			return fmt.Errorf("insert: %v: %v", record.Table, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("insert: commit: %v", err)
+	}
+	return nil
+}
+
+// insertSql builds the insert statement of a table, postgres takes $n placeholders, sqlite ?.
+func (s *TickStore) insertSql(table string, columns []string) string {
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+		if s.driver == "postgres" {
+			placeholders[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+}
+
+// consumeLoop queues the event bus's book, index and opportunity events as records until Close, events its queues had
+// no room for count as Dropped.
+func (s *TickStore) consumeLoop(books *feedSubscriber[BookEvent], index *feedSubscriber[IndexEvent], opportunities *feedSubscriber[OpportunityEvent]) {
+	defer close(s.consumed)
+	defer func() {
+		dropped := BookEvents.Unsubscribe(books) + IndexEvents.Unsubscribe(index) + OpportunityEvents.Unsubscribe(opportunities)
+		s.Dropped.Add(int64(dropped))
+	}()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case event := <-books.updates:
+			s.recordBook(event)
+		case event := <-index.updates:
+			s.Enqueue("index_ticks", event.Time.UnixNano(), event.Exchange, event.Asset, event.Price)
+		case event := <-opportunities.updates:
+			if event.Closed {
+				continue //arb_lifetimes has it, see recordArbLife
+			}
+			table := event.Table
+			s.Enqueue("arb_opportunities", event.Time.UnixNano(), event.Key, table.BidExchange, table.BidType, table.Bids[0].Price.Float64(),
+				table.AskExchange, table.AskType, table.Asks[0].Price.Float64(), table.AbsProfit, table.RelProfit, table.Apy, table.SuggestedSize)
+		}
+	}
+}
+
+// recordBook queues an exchange's side of an orderbook after an update, the full depth as JSON.
+func (s *TickStore) recordBook(event BookEvent) {
+	var bid, bidAmount, ask, askAmount float64
+	if len(event.Bids) > 0 {
+		bid, bidAmount = event.Bids[0].Price.Float64(), event.Bids[0].Amount
+	}
+	if len(event.Asks) > 0 {
+		ask, askAmount = event.Asks[0].Price.Float64(), event.Asks[0].Amount
+	}
+	bidsJson, _ := json.Marshal(event.Bids) //Orders are plain numbers and strings
+	asksJson, _ := json.Marshal(event.Asks)
+	s.Enqueue("orderbook_ticks", event.Time.UnixNano(), event.Exchange, event.Instrument, bid, bidAmount, ask, askAmount, string(bidsJson), string(asksJson))
+}
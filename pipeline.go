@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type pipelineFrame struct {
+	Exchange string
+	Raw      []byte
+	Pooled   bool      //read by wssRead, released to framePool once processed
+	Received time.Time //when it was submitted, processing latency is measured from it
+}
+
+// FrameSink takes raw frames from connections, captures and fixtures: a Pipeline or the AssetRouter in front of
+// per asset pipelines. SubmitPooled takes frames read by wssRead and releases them once processed.
+type FrameSink interface {
+	Submit(exchange string, raw []byte)
+	SubmitPooled(exchange string, raw []byte)
+}
+
+// Pipeline shards raw frames across workers by channel name so that all updates of an instrument are handled, in
+// order, by the same worker while different instruments are processed in parallel. A single arb goroutine subscribes
+// to the book changes and index events of the assets it covers, with a queue of one so events coalesce while a pass
+// is running.
+type Pipeline struct {
+	assets    func() []string //underlyings the arb pass covers
+	shards    []chan pipelineFrame
+	books     *feedSubscriber[string]     //nil without an arb pass
+	index     *feedSubscriber[IndexEvent] //nil without an arb pass
+	workers   sync.WaitGroup
+	arbStop   chan struct{}
+	arbDone   chan struct{}
+	Processed atomic.Int64
+	Stalls    atomic.Int64 //Submits that found their shard full and held up the read loop
+}
+
+// newPipeline processes frames of every asset, its arb pass covering all of Assets.
+func newPipeline(workers int, queueSize int) *Pipeline {
+	return newScopedPipeline(currentAssets, func(string) bool { return true }, workers, queueSize)
+}
+
+// newAssetPipeline processes the frames of one underlying, an AssetRouter hands it only that asset's channels.
+func newAssetPipeline(asset string, workers int, queueSize int) *Pipeline {
+	return newScopedPipeline(func() []string { return []string{asset} }, func(a string) bool { return a == asset }, workers, queueSize)
+}
+
+// newScopedPipeline runs an arb pass over assets on the events of the assets covers selects, none with a nil covers.
+func newScopedPipeline(assets func() []string, covers func(asset string) bool, workers int, queueSize int) *Pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &Pipeline{
+		assets:  assets,
+		shards:  make([]chan pipelineFrame, workers),
+		arbStop: make(chan struct{}),
+		arbDone: make(chan struct{}),
+	}
+	if covers != nil {
+		p.books = BookChanges.SubscribeQueue(func(instrument string) bool { return covers(instrumentAsset(instrument)) }, 1)
+		p.index = IndexEvents.SubscribeQueue(func(event IndexEvent) bool { return covers(event.Asset) }, 1)
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan pipelineFrame, queueSize)
+		p.workers.Add(1)
+		go p.worker(p.shards[i])
+	}
+	go p.arbLoop()
+
+	return p
+}
+
+// Submit queues a frame on its instrument's shard, blocking if that shard's queue is full.
+func (p *Pipeline) Submit(exchange string, raw []byte) {
+	p.submit(pipelineFrame{exchange, raw, false, time.Now()})
+}
+
+func (p *Pipeline) SubmitPooled(exchange string, raw []byte) {
+	p.submit(pipelineFrame{exchange, raw, true, time.Now()})
+}
+
+func (p *Pipeline) submit(frame pipelineFrame) {
+	shard := p.shards[p.shardIndex(frame.Exchange, frame.Raw)]
+	select {
+	case shard <- frame:
+	default:
+		p.Stalls.Add(1)
+		shard <- frame
+	}
+}
+
+// Queued returns the frames waiting on the fullest shard and across all shards, a growing maximum means one
+// instrument's updates arrive faster than its worker handles them.
+func (p *Pipeline) Queued() (fullest int, total int) {
+	for _, shard := range p.shards {
+		fullest = max(fullest, len(shard))
+		total += len(shard)
+	}
+	return fullest, total
+}
+
+// Close stops accepting frames, waits for queued frames and the final arb pass to finish.
+func (p *Pipeline) Close() {
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.workers.Wait()
+	close(p.arbStop)
+	<-p.arbDone
+}
+
+func (p *Pipeline) shardIndex(exchange string, raw []byte) int {
+	if len(p.shards) == 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write(Channels.Channel(exchange, raw))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+func (p *Pipeline) worker(shard chan pipelineFrame) {
+	defer p.workers.Done()
+	for frame := range shard {
+		processFrame(frame.Exchange, frame.Raw)
+		recordChannelUpdate(frame.Exchange, Channels.Channel(frame.Exchange, frame.Raw), len(frame.Raw), frame.Received)
+		if frame.Pooled {
+			releaseFrame(frame.Raw)
+		}
+		p.Processed.Add(1)
+	}
+}
+
+// arbLoop runs an arb pass on every event it takes and a final one once the pipeline is closed, without subscribers
+// it only waits to be stopped.
+func (p *Pipeline) arbLoop() {
+	defer close(p.arbDone)
+	if p.books == nil {
+		<-p.arbStop
+		return
+	}
+	defer BookChanges.Unsubscribe(p.books)
+	defer IndexEvents.Unsubscribe(p.index)
+	for {
+		select {
+		case <-p.books.updates:
+		case <-p.index.updates:
+		case <-p.arbStop:
+			p.arbPass()
+			return
+		}
+		p.arbPass()
+	}
+}
+
+func (p *Pipeline) arbPass() {
+	nextArbGeneration()
+	for _, asset := range p.assets() {
+		runStrategies(asset)
+		updateBoxTables(asset)
+	}
+	enforceMemoryBudget()
+}
+
+// frameChannel extracts the channel name (e.g. "orderbook:ETH-28JUN24-3000-C" or "orderbook.ETH-20240628-3000-C.10.10")
+// without decoding the frame, both aevo and lyra frames carry it as a "channel" string field. Frames without one
+// (subscription responses, pongs) return nil and all land on the same shard.
+func frameChannel(raw []byte) []byte {
+	return rawField(raw, `"channel":"`)
+}
+
+// rawField returns the value of the first string field starting with key, e.g. `"channel":"`, in a raw frame.
+func rawField(raw []byte, key string) []byte {
+	start := bytes.Index(raw, []byte(key))
+	if start < 0 {
+		return nil
+	}
+	start += len(key)
+
+	end := bytes.IndexByte(raw[start:], '"')
+	if end < 0 {
+		return nil
+	}
+
+	return raw[start : start+end]
+}
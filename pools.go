@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"nhooyr.io/websocket"
+)
+
+const initialFrameSize = 4 * 1024
+const maxPooledFrame = 1024 * 1024 //larger buffers, a rare huge snapshot, are left to the garbage collector
+
+// framePool holds the buffers frames are read into, back once the pipeline has processed them. Nothing decoded keeps
+// a reference into a frame, json.Unmarshal copies strings out of it.
+var framePool = sync.Pool{New: func() any {
+	raw := make([]byte, 0, initialFrameSize)
+	return &raw
+}}
+
+func acquireFrame() []byte {
+	return (*framePool.Get().(*[]byte))[:0]
+}
+
+// releaseFrame returns a frame read by wssRead to the pool, the caller must not use it afterwards.
+func releaseFrame(raw []byte) {
+	if cap(raw) > maxPooledFrame {
+		return
+	}
+	raw = raw[:0]
+	framePool.Put(&raw)
+}
+
+// wssRead reads the next message into a pooled buffer, the reader of the frame releases it with releaseFrame.
+func wssRead(ctx context.Context, c *websocket.Conn) (websocket.MessageType, []byte, error) {
+	messageType, reader, err := c.Reader(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("wssRead: read error: %w", err)
+	}
+
+	raw, err := readFrame(acquireFrame(), reader)
+	if err != nil {
+		releaseFrame(raw)
+		return 0, nil, fmt.Errorf("wssRead: read error: %w", err)
+	}
+	return messageType, raw, nil
+}
+
+// readFrame appends everything reader has to raw, growing it as needed.
+func readFrame(raw []byte, reader io.Reader) ([]byte, error) {
+	for {
+		if len(raw) == cap(raw) {
+			raw = append(raw, 0)[:len(raw)]
+		}
+		n, err := reader.Read(raw[len(raw):cap(raw)])
+		raw = raw[:len(raw)+n]
+		if err == io.EOF {
+			return raw, nil
+		}
+		if err != nil {
+			return raw, err
+		}
+	}
+}
+
+// messagePool reuses a channel's decoded message structs. reset clears a message for the next frame, keeping the
+// backing arrays of its level slices so json.Unmarshal appends into them instead of growing them from nil.
+type messagePool[T any] struct {
+	pool  sync.Pool
+	reset func(*T)
+}
+
+func newMessagePool[T any](reset func(*T)) *messagePool[T] {
+	return &messagePool[T]{pool: sync.Pool{New: func() any { return new(T) }}, reset: reset}
+}
+
+func (p *messagePool[T]) Get() *T {
+	message := p.pool.Get().(*T)
+	p.reset(message)
+	return message
+}
+
+func (p *messagePool[T]) Put(message *T) {
+	p.pool.Put(message)
+}
+
+// appendVenueKey appends exchange + " " + name, the key of the per exchange and channel (or instrument) maps, to buf.
+// Indexing a map with string(key) of a stack buffer doesn't allocate, concatenating the strings does.
+func appendVenueKey[T string | []byte](buf []byte, exchange string, name T) []byte {
+	buf = append(buf, exchange...)
+	buf = append(buf, ' ')
+	return append(buf, name...)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+)
+
+type Position struct {
+	Exchange      string
+	Instrument    string
+	Amount        float64 //signed, negative is short
+	AvgEntryPrice float64
+	MarkPrice     float64
+	Greeks        aevo.Greeks //per contract
+}
+
+type OpenOrder struct {
+	Exchange   string
+	OrderId    string
+	Instrument string
+	Side       string
+	Price      float64
+	Amount     float64
+	Filled     float64
+}
+
+type Fill struct {
+	Exchange   string
+	TradeId    string
+	OrderId    string
+	Instrument string
+	Side       string
+	Price      float64
+	Amount     float64
+	Fees       float64
+	Time       time.Time
+}
+
+// AccountState is an exchange account's margin, polled since none of the private feeds carry it.
+type AccountState struct {
+	Equity            float64
+	AvailableBalance  float64
+	InitialMargin     float64
+	MaintenanceMargin float64
+	Updated           time.Time
+}
+
+const maxFills = 100 //recent fills kept for display
+
+type PortfolioContainer struct {
+	Mu        sync.Mutex
+	Positions map[string]*Position    //key: exchange + " " + instrument
+	Orders    map[string]OpenOrder    //key: exchange + " " + order id
+	Fills     []Fill                  //latest last, at most maxFills
+	Accounts  map[string]AccountState //key: exchange
+	Imported  time.Time
+	Streamed  time.Time //last private channel update, zero without a private feed
+}
+
+var Portfolio = PortfolioContainer{Positions: make(map[string]*Position), Orders: make(map[string]OpenOrder), Accounts: make(map[string]AccountState)}
+
+// aevoImportPortfolio replaces aevo's positions and open orders in Portfolio with the ones on the account.
+func aevoImportPortfolio(client *aevo.Client) error {
+	positions, err := client.Positions()
+	if err != nil {
+		return fmt.Errorf("aevoImportPortfolio: %v", err)
+	}
+
+	orders, err := client.Orders()
+	if err != nil {
+		return fmt.Errorf("aevoImportPortfolio: %v", err)
+	}
+
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+	aevoSetPositions(positions)
+	for key, order := range Portfolio.Orders {
+		if order.Exchange == "aevo" {
+			delete(Portfolio.Orders, key)
+		}
+	}
+	aevoUpdateOrders(orders)
+	Portfolio.Imported = time.Now()
+
+	slog.Info("aevoImportPortfolio: imported portfolio", "positions", len(positions), "orders", len(orders))
+	return nil
+}
+
+// aevoSetPositions replaces aevo's positions with positions, the caller holds Portfolio.Mu.
+func aevoSetPositions(positions []aevo.Position) {
+	for key, position := range Portfolio.Positions {
+		if position.Exchange == "aevo" {
+			delete(Portfolio.Positions, key)
+		}
+	}
+	for _, p := range positions {
+		amount := p.Amount
+		if p.Side == "sell" {
+			amount = -amount
+		}
+		Portfolio.Positions["aevo "+p.InstrumentName] = &Position{"aevo", p.InstrumentName, amount, p.AvgEntryPrice, p.MarkPrice, p.Greeks}
+	}
+}
+
+// aevoUpdateOrders adds or updates orders, dropping the ones no longer open. The caller holds Portfolio.Mu.
+func aevoUpdateOrders(orders []aevo.Order) {
+	for _, o := range orders {
+		key := "aevo " + o.OrderId
+		if o.OrderStatus == "filled" || o.OrderStatus == "cancelled" || o.OrderStatus == "expired" {
+			delete(Portfolio.Orders, key)
+			continue
+		}
+		Portfolio.Orders[key] = OpenOrder{"aevo", o.OrderId, o.InstrumentName, o.Side, o.Price, o.Amount, o.Filled}
+	}
+}
+
+// aevoApplyFill records a fill and moves its position right away, the positions channel then confirms it. Until it
+// does the position keeps its entry price averaged with the fill's and the last known greeks.
+func aevoApplyFill(f aevo.Fill) {
+	amount := f.Filled
+	if f.Side == "sell" {
+		amount = -amount
+	}
+
+	key := "aevo " + f.InstrumentName
+	position, exists := Portfolio.Positions[key]
+	if !exists {
+		position = &Position{Exchange: "aevo", Instrument: f.InstrumentName}
+		Portfolio.Positions[key] = position
+	}
+	switch {
+	case position.Amount == 0 || (position.Amount > 0) == (amount > 0): //opening or adding
+		position.AvgEntryPrice = (position.AvgEntryPrice*math.Abs(position.Amount) + f.Price*math.Abs(amount)) / (math.Abs(position.Amount) + math.Abs(amount))
+	case math.Abs(amount) > math.Abs(position.Amount): //flipped, the rest opens at the fill price
+		position.AvgEntryPrice = f.Price
+	}
+	position.Amount += amount
+	if position.Amount == 0 {
+		delete(Portfolio.Positions, key)
+	}
+
+	Portfolio.Fills = append(Portfolio.Fills, Fill{"aevo", f.TradeId, f.OrderId, f.InstrumentName, f.Side, f.Price, f.Filled, f.Fees, time.Unix(0, f.Created)})
+	if len(Portfolio.Fills) > maxFills {
+		Portfolio.Fills = Portfolio.Fills[len(Portfolio.Fills)-maxFills:]
+	}
+}
+
+// aevoProcessPrivate handles a frame of the authenticated aevo connection, its channels (fills, positions and order
+// updates) are decoded through Channels as "aevo-private".
+func aevoProcessPrivate(raw []byte) {
+	if frameChannel(raw) == nil && bytes.Contains(raw, []byte(`"error"`)) {
+		slog.Error("aevoProcessPrivate: error", "frame", string(raw)) //e.g. a rejected auth
+		return
+	}
+	Channels.Decode("aevo-private", raw)
+}
+
+func aevoDecodeFill(raw []byte) error {
+	var message aevo.FillMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	fill := message.Data.Fill
+	slog.Info("aevoDecodeFill: fill", "instrument", fill.InstrumentName, "side", fill.Side, "amount", fill.Filled, "price", fill.Price)
+
+	Portfolio.Mu.Lock()
+	aevoApplyFill(fill)
+	Portfolio.Streamed = time.Now()
+	Portfolio.Mu.Unlock()
+	if Quoting != nil {
+		Quoting.OnFill(fill)
+	}
+	return nil
+}
+
+func aevoDecodePositions(raw []byte) error {
+	var message aevo.PositionsMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+	aevoSetPositions(message.Data.Positions)
+	Portfolio.Streamed = time.Now()
+	return nil
+}
+
+func aevoDecodeOrders(raw []byte) error {
+	var message aevo.OrdersMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+	aevoUpdateOrders(message.Data.Orders)
+	Portfolio.Streamed = time.Now()
+	return nil
+}
+
+// aevoAccountLoop polls the account's margin every interval.
+func aevoAccountLoop(client *aevo.Client, interval time.Duration) {
+	for {
+		account, err := client.Account()
+		if err != nil {
+			slog.Warn("aevoAccountLoop: account request failed", "err", err)
+		} else {
+			Portfolio.Mu.Lock()
+			Portfolio.Accounts["aevo"] = AccountState{account.Equity, account.AvailableBalance, account.InitialMargin, account.MaintenanceMargin, time.Now()}
+			Portfolio.Mu.Unlock()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// inventory returns the signed position held in an exchange's instrument and the signed amount its open orders would
+// still add, so an opportunity already traded or being traded isn't traded again.
+func inventory(exchange string, instrument string) (held float64, pending float64) {
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+
+	if position, exists := Portfolio.Positions[exchange+" "+instrument]; exists {
+		held = position.Amount
+	}
+	for _, order := range Portfolio.Orders {
+		if order.Exchange != exchange || order.Instrument != instrument {
+			continue
+		}
+		remaining := order.Amount - order.Filled
+		if order.Side == "sell" {
+			remaining = -remaining
+		}
+		pending += remaining
+	}
+	return held, pending
+}
+
+type portfolioJson struct {
+	Imported      time.Time
+	Streamed      time.Time
+	Positions     []Position
+	Orders        []OpenOrder
+	Fills         []Fill
+	Accounts      map[string]AccountState
+	UnrealizedPnl float64
+	Delta         float64
+	Gamma         float64
+	Vega          float64
+	Theta         float64
+}
+
+// crossExchangeMid is the mid of the best bid and ask across exchanges, 0 when either side is missing or the
+// instrument is quarantined.
+func crossExchangeMid(instrument string) float64 {
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists || quarantined(instrument, ArbClock()) {
+		return 0
+	}
+
+	bestBid, bestAsk := 0.0, math.Inf(1)
+	for _, bids := range orderbook.Bids {
+		if len(bids) > 0 && bids[0].Price.Float64() > bestBid {
+			bestBid = bids[0].Price.Float64()
+		}
+	}
+	for _, asks := range orderbook.Asks {
+		if len(asks) > 0 && asks[0].Price.Float64() < bestAsk {
+			bestAsk = asks[0].Price.Float64()
+		}
+	}
+	if bestBid <= 0 || math.IsInf(bestAsk, 1) {
+		return 0
+	}
+
+	return (bestBid + bestAsk) / 2
+}
+
+// portfolioSnapshot marks positions to the live cross exchange mid where there is one and sums pnl and greeks.
+func portfolioSnapshot() portfolioJson {
+	Portfolio.Mu.Lock()
+	snapshot := portfolioJson{Imported: Portfolio.Imported, Streamed: Portfolio.Streamed, Fills: append([]Fill(nil), Portfolio.Fills...),
+		Accounts: make(map[string]AccountState)}
+	for exchange, account := range Portfolio.Accounts {
+		snapshot.Accounts[exchange] = account
+	}
+	for _, position := range Portfolio.Positions {
+		snapshot.Positions = append(snapshot.Positions, *position)
+	}
+	for _, order := range Portfolio.Orders {
+		snapshot.Orders = append(snapshot.Orders, order)
+	}
+	Portfolio.Mu.Unlock()
+
+	for i := range snapshot.Positions {
+		position := &snapshot.Positions[i]
+		if mid := crossExchangeMid(position.Instrument); mid > 0 {
+			position.MarkPrice = mid
+		}
+		snapshot.UnrealizedPnl += (position.MarkPrice - position.AvgEntryPrice) * position.Amount
+		snapshot.Delta += position.Greeks.Delta * position.Amount
+		snapshot.Gamma += position.Greeks.Gamma * position.Amount
+		snapshot.Vega += position.Greeks.Vega * position.Amount
+		snapshot.Theta += position.Greeks.Theta * position.Amount
+	}
+	sort.Slice(snapshot.Positions, func(i, j int) bool { return snapshot.Positions[i].Instrument < snapshot.Positions[j].Instrument })
+	sort.Slice(snapshot.Orders, func(i, j int) bool { return snapshot.Orders[i].Instrument < snapshot.Orders[j].Instrument })
+
+	return snapshot
+}
+
+func portfolioHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(portfolioSnapshot())
+	if err != nil {
+		slog.Error("portfolioHandler: json encode error", "err", err)
+	}
+}
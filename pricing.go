@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// BsResult is a Black-Scholes value with greeks in exchange conventions: vega per vol point, theta per day.
+type BsResult struct {
+	Price float64
+	Delta float64
+	Gamma float64
+	Vega  float64
+	Theta float64
+	Rho   float64
+}
+
+func normCdf(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+func normPdf(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// blackScholes prices a european option, vol and rate as fractions, years to expiry. At or past expiry (or with no
+// vol) it returns intrinsic value with a step delta.
+func blackScholes(optionType string, spot float64, strike float64, years float64, vol float64, rate float64) BsResult {
+	isCall := optionType == "C"
+	if years <= 0 || vol <= 0 || spot <= 0 || strike <= 0 {
+		intrinsic := math.Max(spot-strike, 0)
+		delta := 0.0
+		if spot > strike {
+			delta = 1
+		}
+		if !isCall {
+			intrinsic = math.Max(strike-spot, 0)
+			delta = 0
+			if spot < strike {
+				delta = -1
+			}
+		}
+		return BsResult{Price: intrinsic, Delta: delta}
+	}
+
+	sqrtT := math.Sqrt(years)
+	d1 := (math.Log(spot/strike) + (rate+vol*vol/2)*years) / (vol * sqrtT)
+	d2 := d1 - vol*sqrtT
+	discount := math.Exp(-rate * years)
+
+	result := BsResult{
+		Gamma: normPdf(d1) / (spot * vol * sqrtT),
+		Vega:  spot * normPdf(d1) * sqrtT / 100,
+	}
+	decay := -spot * normPdf(d1) * vol / (2 * sqrtT)
+	if isCall {
+		result.Price = spot*normCdf(d1) - strike*discount*normCdf(d2)
+		result.Delta = normCdf(d1)
+		result.Theta = (decay - rate*strike*discount*normCdf(d2)) / 365
+		result.Rho = strike * years * discount * normCdf(d2) / 100
+	} else {
+		result.Price = strike*discount*normCdf(-d2) - spot*normCdf(-d1)
+		result.Delta = normCdf(d1) - 1
+		result.Theta = (decay + rate*strike*discount*normCdf(-d2)) / 365
+		result.Rho = -strike * years * discount * normCdf(-d2) / 100
+	}
+
+	return result
+}
+
+// instrumentExpiry converts an instrument's "02JAN06" expiry component to the 08:00 UTC settlement time.
+func instrumentExpiry(expiry string) (time.Time, error) {
+	ts, err := time.Parse("02Jan06", expiry) //month names parse case insensitively
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ts.Add(8 * time.Hour), nil
+}
+
+func yearsUntil(expiry time.Time, now time.Time) float64 {
+	return expiry.Sub(now).Hours() / (365 * 24)
+}
+
+// impliedVol inverts blackScholes by bisection, ok is false when price is outside the no-arbitrage bounds (below
+// intrinsic, above spot for calls or strike for puts) or the vol would be above 500%.
+func impliedVol(optionType string, price float64, spot float64, strike float64, years float64) (float64, bool) {
+	if price <= 0 || years <= 0 || spot <= 0 || strike <= 0 {
+		return 0, false
+	}
+	intrinsic, upper := math.Max(spot-strike, 0), spot
+	if optionType != "C" {
+		intrinsic, upper = math.Max(strike-spot, 0), strike
+	}
+	if price <= intrinsic || price >= upper {
+		return 0, false
+	}
+
+	low, high := 0.001, 5.0
+	if blackScholes(optionType, spot, strike, years, high, 0).Price < price {
+		return 0, false
+	}
+	for i := 0; i < 60 && high-low > 1e-6; i++ {
+		mid := (low + high) / 2
+		if blackScholes(optionType, spot, strike, years, mid, 0).Price < price {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, true
+}
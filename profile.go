@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"time"
+)
+
+// profileLoop writes a CPU profile (sampled over cpuDuration) and a heap profile to dir every interval, keeping only
+// the newest keep files of each kind so the directory acts as a ring buffer of recent snapshots.
+func profileLoop(dir string, interval time.Duration, cpuDuration time.Duration, keep int) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		slog.Error("profileLoop: unable to create profile directory, profiling disabled", "err", err)
+		return
+	}
+	if cpuDuration > interval {
+		cpuDuration = interval
+	}
+
+	for {
+		stamp := time.Now().UTC().Format("20060102T150405Z")
+
+		err = writeCpuProfile(filepath.Join(dir, "cpu-"+stamp+".pprof"), cpuDuration)
+		if err != nil {
+			slog.Error("profileLoop: profile failed", "err", err)
+		}
+		err = writeHeapProfile(filepath.Join(dir, "heap-"+stamp+".pprof"))
+		if err != nil {
+			slog.Error("profileLoop: profile failed", "err", err)
+		}
+
+		pruneProfiles(dir, "cpu-", keep)
+		pruneProfiles(dir, "heap-", keep)
+
+		time.Sleep(interval - cpuDuration)
+	}
+}
+
+func writeCpuProfile(path string, duration time.Duration) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("writeCpuProfile: create error: %v", err)
+	}
+	defer file.Close()
+
+	err = pprof.StartCPUProfile(file)
+	if err != nil {
+		return fmt.Errorf("writeCpuProfile: start error: %v", err) //another cpu profile (e.g. net/http/pprof) may be running
+	}
+	time.Sleep(duration)
+	pprof.StopCPUProfile()
+
+	return nil
+}
+
+func writeHeapProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("writeHeapProfile: create error: %v", err)
+	}
+	defer file.Close()
+
+	err = pprof.Lookup("heap").WriteTo(file, 0)
+	if err != nil {
+		return fmt.Errorf("writeHeapProfile: write error: %v", err)
+	}
+
+	return nil
+}
+
+func pruneProfiles(dir string, prefix string, keep int) {
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"*.pprof"))
+	if err != nil || len(matches) <= keep {
+		return
+	}
+
+	sort.Strings(matches) //timestamps in names sort chronologically
+	for _, path := range matches[:len(matches)-keep] {
+		err = os.Remove(path)
+		if err != nil {
+			slog.Error("pruneProfiles: remove failed", "err", err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+	"options-ws/decimal"
+)
+
+// Quote is a desired two sided quote for one instrument.
+type Quote struct {
+	Instrument string
+	FairValue  float64
+	Inventory  float64
+	BidPrice   float64
+	BidAmount  float64
+	AskPrice   float64
+	AskAmount  float64
+	Updated    time.Time
+}
+
+// QuotingEngine keeps two sided quotes around the fitted surface's fair value on a fixed set of instruments, skewed
+// against inventory: a long position lowers both prices (to sell more readily) and shrinks the bid, a short one the
+// reverse. A side is pulled once inventory reaches MaxInventory in its direction. Prices and amounts are rounded to
+// aevo's steps, the bid down and the ask up. With Place set each side rests as a post only aevo order through
+// aevoPlaceOrder, replaced when the quote moves and cancelled when it's pulled; fills of those orders reach OnFill
+// from the private feed.
+type QuotingEngine struct {
+	Instruments  []string
+	HalfSpread   float64 //fraction of fair value
+	Size         float64 //contracts per side
+	Skew         float64 //fraction of fair value shifted per contract of inventory
+	MaxInventory float64 //contracts, per instrument
+	Place        bool    //rest the quotes as orders, otherwise they're only computed and served on /api/quotes
+
+	Mu        sync.Mutex
+	Inventory map[string]float64
+	Quotes    map[string]Quote
+	Orders    map[string]quoteOrder //resting quote orders, key: instrument and side
+}
+
+// quoteOrder is a resting quote, Requested the amount asked of aevoPlaceOrder before the risk limits sized it.
+type quoteOrder struct {
+	aevo.Order
+	Requested float64
+}
+
+// Quoting is the running engine, nil unless quoting.
+var Quoting *QuotingEngine
+
+func newQuotingEngine(instruments []string) *QuotingEngine {
+	return &QuotingEngine{
+		Instruments:  instruments,
+		HalfSpread:   0.02,
+		Size:         1,
+		Skew:         0.002,
+		MaxInventory: 10,
+		Inventory:    make(map[string]float64),
+		Quotes:       make(map[string]Quote),
+		Orders:       make(map[string]quoteOrder),
+	}
+}
+
+// OnFill records a fill of one of the engine's orders in its inventory, other fills are ignored.
+func (q *QuotingEngine) OnFill(fill aevo.Fill) {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+	key := fill.InstrumentName + " " + fill.Side
+	order, exists := q.Orders[key]
+	if !exists || order.OrderId != fill.OrderId {
+		return
+	}
+
+	amount := fill.Filled
+	if fill.Side == "sell" {
+		amount = -amount
+	}
+	q.Inventory[fill.InstrumentName] += amount
+	order.Filled += fill.Filled
+	if order.Filled >= order.Amount || fill.OrderStatus == "filled" {
+		delete(q.Orders, key)
+	} else {
+		q.Orders[key] = order
+	}
+	slog.Info("QuotingEngine: quote filled", "instrument", fill.InstrumentName, "side", fill.Side, "amount", fill.Filled, "price", fill.Price,
+		"inventory", q.Inventory[fill.InstrumentName])
+}
+
+// fairValue prices instrument off surface, the fitted IV at its strike and expiry, 0 without a fit there or when the
+// instrument is quarantined.
+func fairValue(instrument string, surface *IvSurface, now time.Time) float64 {
+	if quarantined(instrument, now) {
+		return 0
+	}
+	return modelValue(instrument, surface, now)
+}
+
+// ownLevels are the engine's resting quotes as buildSurfaceExcluding leaves them out.
+func (q *QuotingEngine) ownLevels() map[string]Order {
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+	own := make(map[string]Order, len(q.Orders))
+	for key, order := range q.Orders {
+		instrument, side, _ := strings.Cut(key, " ")
+		level := "bid"
+		if side == "sell" {
+			level = "ask"
+		}
+		own["aevo "+instrument+" "+level] = Order{Price: decimal.FromFloat(order.Price), Amount: order.Amount - order.Filled}
+	}
+	return own
+}
+
+func (q *QuotingEngine) quote(instrument string, fair float64, inventory float64) Quote {
+	center := fair * (1 - q.Skew*inventory)
+	quote := Quote{
+		Instrument: instrument,
+		FairValue:  fair,
+		Inventory:  inventory,
+		BidPrice:   roundPrice("aevo", instrument, decimal.FromFloat(center*(1-q.HalfSpread)), true).Float64(),
+		AskPrice:   roundPrice("aevo", instrument, decimal.FromFloat(center*(1+q.HalfSpread)), false).Float64(),
+		BidAmount:  roundAmount("aevo", instrument, math.Max(0, math.Min(q.Size, q.MaxInventory-inventory))),
+		AskAmount:  roundAmount("aevo", instrument, math.Max(0, math.Min(q.Size, q.MaxInventory+inventory))),
+		Updated:    time.Now(),
+	}
+
+	return quote
+}
+
+// rest keeps one side of instrument's quote resting as an order of amount at price, cancelling the order there when it
+// differs or was partly filled and placing the new one, only cancelling when amount is 0.
+func (q *QuotingEngine) rest(instrument string, side string, price float64, amount float64) {
+	key := instrument + " " + side
+	q.Mu.Lock()
+	order, resting := q.Orders[key]
+	q.Mu.Unlock()
+	if resting && order.OrderStatus != "dry_run" {
+		Portfolio.Mu.Lock()
+		_, resting = Portfolio.Orders["aevo "+order.OrderId] //filled, cancelled or swept by the dead man's switch
+		Portfolio.Mu.Unlock()
+	}
+	if resting && order.Filled == 0 && order.Requested == amount && math.Abs(order.Price-price) < 1e-9 {
+		return
+	}
+
+	if resting {
+		err := AevoClient.CancelOrder(order.OrderId)
+		if err != nil {
+			slog.Error("QuotingEngine: cancel failed", "instrument", instrument, "side", side, "order_id", order.OrderId, "err", err)
+			return
+		}
+		Portfolio.Mu.Lock()
+		delete(Portfolio.Orders, "aevo "+order.OrderId)
+		Portfolio.Mu.Unlock()
+	}
+	q.Mu.Lock()
+	delete(q.Orders, key)
+	q.Mu.Unlock()
+	if amount <= 0 || price <= 0 {
+		return
+	}
+
+	placed, err := aevoPlaceOrder(instrument, aevo.OrderRequest{IsBuy: side == "buy", Amount: amount, LimitPrice: price, PostOnly: true})
+	if err != nil {
+		slog.Warn("QuotingEngine: quote not placed", "instrument", instrument, "side", side, "amount", amount, "price", price, "err", err)
+		return
+	}
+	q.Mu.Lock()
+	q.Orders[key] = quoteOrder{placed, amount}
+	q.Mu.Unlock()
+}
+
+func (q *QuotingEngine) update() {
+	now, own := time.Now(), q.ownLevels()
+	surfaces := make(map[string]*IvSurface) //nil when the asset's can't be built
+	for _, instrument := range q.Instruments {
+		asset := instrumentAsset(instrument)
+		if _, exists := surfaces[asset]; !exists {
+			surfaces[asset], _ = buildSurfaceExcluding(asset, now, own)
+		}
+		fair := fairValue(instrument, surfaces[asset], now)
+		if FeedsStale.Load() {
+			fair = 0 //the dead man's switch cancelled everything, nothing rests until the feeds are back
+		}
+
+		q.Mu.Lock()
+		previous, quoted := q.Quotes[instrument]
+		if fair <= 0 {
+			if quoted {
+				delete(q.Quotes, instrument)
+				slog.Info("QuotingEngine: no fair value, pulled quote", "instrument", instrument)
+			}
+			q.Mu.Unlock()
+			if q.Place {
+				q.rest(instrument, "buy", 0, 0)
+				q.rest(instrument, "sell", 0, 0)
+			}
+			continue
+		}
+
+		quote := q.quote(instrument, fair, q.Inventory[instrument])
+		q.Quotes[instrument] = quote
+		q.Mu.Unlock()
+
+		if !quoted || math.Abs(quote.BidPrice-previous.BidPrice) > 1e-9 || math.Abs(quote.AskPrice-previous.AskPrice) > 1e-9 {
+			slog.Info("QuotingEngine: quote", "instrument", instrument, "fair", quote.FairValue, "inventory", quote.Inventory,
+				"bid_amount", quote.BidAmount, "bid", quote.BidPrice, "ask_amount", quote.AskAmount, "ask", quote.AskPrice)
+		}
+		if q.Place {
+			q.rest(instrument, "buy", quote.BidPrice, quote.BidAmount)
+			q.rest(instrument, "sell", quote.AskPrice, quote.AskAmount)
+		}
+	}
+}
+
+func (q *QuotingEngine) Loop(interval time.Duration) {
+	for {
+		q.update()
+		time.Sleep(interval)
+	}
+}
+
+func (q *QuotingEngine) quotesHandler(w http.ResponseWriter, r *http.Request) {
+	q.Mu.Lock()
+	quotes := make([]Quote, 0, len(q.Quotes))
+	for _, quote := range q.Quotes {
+		quotes = append(quotes, quote)
+	}
+	q.Mu.Unlock()
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Instrument < quotes[j].Instrument })
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(quotes)
+	if err != nil {
+		slog.Error("quotesHandler: json encode error", "err", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Package ratelimit paces requests to an exchange with a token bucket shared by its REST requests and websocket
+// subscription messages, and retries rate limited REST requests after the delay the exchange asks for.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const MaxRetries = 4 //retries of a rate limited or unavailable request before Do gives up
+
+// Limiter is a token bucket of Burst tokens refilled at Rate a second. A nil Limiter doesn't limit.
+type Limiter struct {
+	Rate  float64
+	Burst float64
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: float64(max(burst, 1)), tokens: float64(max(burst, 1)), last: time.Now()}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it.
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = min(l.Burst, l.tokens+now.Sub(l.last).Seconds()*l.Rate)
+	l.last = now
+	l.tokens--
+
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.Rate * float64(time.Second))
+	}
+	if paused := l.pausedUntil.Sub(now); paused > wait {
+		wait = paused
+	}
+	return wait
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil || l.Rate <= 0 {
+		return nil
+	}
+	wait := l.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause holds every request for d, e.g. after the exchange answered 429.
+func (l *Limiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// RetryAfter parses a response's Retry-After header, given in seconds or as an HTTP date.
+func RetryAfter(res *http.Response) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// Do sends the request newRequest builds once l allows it. A 429 or 503 response pauses l for its Retry-After, or
+// an exponential backoff from a second without one, so the exchange's other requests back off too, and is retried
+// up to MaxRetries times.
+func Do(client *http.Client, l *Limiter, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		err = l.Wait(req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+			return res, nil
+		}
+		res.Body.Close()
+		if attempt == MaxRetries {
+			return nil, fmt.Errorf("%v %v: %v after %v retries", req.Method, req.URL.Path, res.Status, MaxRetries)
+		}
+
+		delay, ok := RetryAfter(res)
+		if !ok {
+			delay = time.Second << attempt
+		}
+		l.Pause(delay)
+		if l == nil {
+			time.Sleep(delay)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var RiskFreeRate float64 = 0.05 //annual, as a fraction, until the lending pool's rate is fetched
+var LendingPool string          //DefiLlama yields pool id, e.g. aave v3 USDC, empty uses RiskFreeRate
+var YieldsHttp string = "https://yields.llama.fi"
+
+type RatesContainer struct {
+	Mu      sync.RWMutex
+	Lending float64 //annual, as a fraction
+	Updated time.Time
+}
+
+var Rates = RatesContainer{}
+
+// riskFreeRate is the lending pool's last fetched rate, RiskFreeRate before the first fetch or without a pool. It
+// also discounts box payouts unless BoxRate is set.
+func riskFreeRate() float64 {
+	Rates.Mu.RLock()
+	defer Rates.Mu.RUnlock()
+	if Rates.Updated.IsZero() {
+		return RiskFreeRate
+	}
+	return Rates.Lending
+}
+
+// fetchLendingRate returns the current supply APY of a DefiLlama pool as a fraction.
+func fetchLendingRate(pool string) (float64, error) {
+	res, err := http.Get(YieldsHttp + "/chart/" + pool)
+	if err != nil {
+		return 0, fmt.Errorf("fetchLendingRate: request error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetchLendingRate: status %v", res.Status)
+	}
+
+	var chart struct {
+		Data []struct {
+			Apy float64 `json:"apy"` //percent
+		} `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&chart)
+	if err != nil {
+		return 0, fmt.Errorf("fetchLendingRate: json decode error: %v", err)
+	}
+	if len(chart.Data) == 0 {
+		return 0, fmt.Errorf("fetchLendingRate: no data for pool %v", pool)
+	}
+	return chart.Data[len(chart.Data)-1].Apy / 100, nil
+}
+
+func ratesLoop(interval time.Duration) {
+	for {
+		rate, err := fetchLendingRate(LendingPool)
+		if err != nil {
+			slog.Warn("ratesLoop: keeping the previous rate", "err", err)
+		} else {
+			Rates.Mu.Lock()
+			Rates.Lending, Rates.Updated = rate, time.Now()
+			Rates.Mu.Unlock()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// annualFunding is the perpetual's current funding annualized, false when it's missing or older than perpStale.
+func annualFunding(asset string, now time.Time) (float64, bool) {
+	AevoPerps.Mu.RLock()
+	perp, exists := AevoPerps.Perps[asset]
+	AevoPerps.Mu.RUnlock()
+	if !exists || now.Sub(perp.Updated) > perpStale {
+		return 0, false
+	}
+	return perp.Funding * 24 * 365, true
+}
+
+// excessApy is apy (percent) over lending the capital out at the risk-free rate, the ArbTable's ExcessApy.
+func excessApy(apy float64) float64 {
+	return apy - riskFreeRate()*100
+}
+
+// ratesHandler serves /api/rates, the risk-free rate with its source and every asset's annualized perpetual funding.
+func ratesHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	source := "fixed"
+	Rates.Mu.RLock()
+	updated := Rates.Updated
+	Rates.Mu.RUnlock()
+	if !updated.IsZero() {
+		source = "defillama:" + LendingPool
+	}
+
+	AevoPerps.Mu.RLock()
+	assets := make([]string, 0, len(AevoPerps.Perps))
+	for asset := range AevoPerps.Perps {
+		assets = append(assets, asset)
+	}
+	AevoPerps.Mu.RUnlock()
+	funding := make(map[string]float64)
+	for _, asset := range assets {
+		if rate, ok := annualFunding(asset, now); ok {
+			funding[asset] = rate
+		}
+	}
+
+	writeJson(w, "ratesHandler", struct {
+		RiskFree float64            `json:"risk_free"`
+		Source   string             `json:"source"`
+		Updated  time.Time          `json:"updated"`
+		Funding  map[string]float64 `json:"funding"` //annual, key: asset
+	}{riskFreeRate(), source, updated, funding})
+}
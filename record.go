@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recorder appends every received websocket frame to a capture file, the format readCapture, -bench and -replay read.
+type Recorder struct {
+	Mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	Frames int64
+}
+
+var Recording *Recorder //nil unless -record is given
+
+func openRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("openRecorder: %v", err)
+	}
+	r := &Recorder{file: file, writer: bufio.NewWriterSize(file, 1024*1024)}
+	go r.flushLoop(time.Second)
+	return r, nil
+}
+
+func (r *Recorder) Record(exchange string, raw []byte) {
+	line, err := json.Marshal(CapturedFrame{Time: time.Now().UnixNano(), Exchange: exchange, Data: string(raw)})
+	if err != nil {
+		slog.Error("Recorder: json encode error", "err", err)
+		return
+	}
+
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	r.writer.Write(line)
+	r.writer.WriteByte('\n')
+	r.Frames++
+}
+
+// flushLoop bounds how much of a session a crash can lose.
+func (r *Recorder) flushLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		r.Mu.Lock()
+		err := r.writer.Flush()
+		r.Mu.Unlock()
+		if err != nil {
+			slog.Error("Recorder: flush error", "err", err)
+		}
+	}
+}
+
+func (r *Recorder) Close() error {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	err := r.writer.Flush()
+	if err != nil {
+		return err
+	}
+	return r.file.Close()
+}
+
+// replayCapture feeds a capture file through the pipeline keeping the recorded gaps between frames divided by speed,
+// 0 replays as fast as the pipeline accepts frames.
+func replayCapture(path string, speed float64, pipeline FrameSink) error {
+	frames, err := readCapture(path)
+	if err != nil {
+		return fmt.Errorf("replayCapture: %v", err)
+	}
+	if len(frames) == 0 {
+		return fmt.Errorf("replayCapture: no frames in %v", path)
+	}
+
+	start := time.Now()
+	first := frames[0].Time
+	for _, frame := range frames {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(frame.Time-first) / speed))
+			time.Sleep(time.Until(due))
+		}
+		pipeline.Submit(frame.Exchange, []byte(frame.Data))
+	}
+
+	slog.Info("replayCapture: finished", "path", path, "frames", len(frames), "recorded", time.Duration(frames[len(frames)-1].Time-first), "took", time.Since(start))
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+var RestFallbackAfter = time.Minute //0 disables the fallback
+var RestFallbackBatch = 20          //books fetched per exchange and pass, the venue's limiter paces them further
+
+type restFallbackBook struct {
+	Instrument string //in the exchange's naming, what FetchOrderbook takes
+	Fetched    time.Time
+}
+
+type RestFallbackContainer struct {
+	Mu       sync.Mutex
+	Fetchers map[string]BookFetcher
+	Books    map[string]map[string]*restFallbackBook //key: exchange, then book channel
+	Since    map[string]time.Time                    //by exchange, when its channels were first registered
+	Fetches  map[string]int64                        //by exchange
+	Errors   map[string]int64
+}
+
+var RestFallback = RestFallbackContainer{
+	Fetchers: make(map[string]BookFetcher),
+	Books:    make(map[string]map[string]*restFallbackBook),
+	Since:    make(map[string]time.Time),
+	Fetches:  make(map[string]int64),
+	Errors:   make(map[string]int64),
+}
+
+// Register replaces the book channels of exchange the fallback covers with those of instruments, exchanges without
+// a REST book endpoint are skipped.
+func (f *RestFallbackContainer) Register(exchange Exchange, instruments []string) {
+	fetcher, ok := exchange.(BookFetcher)
+	if !ok {
+		return
+	}
+	name := exchange.Name()
+
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	previous := f.Books[name]
+	books := make(map[string]*restFallbackBook, len(instruments))
+	for _, instrument := range instruments {
+		channels := exchange.OrderbookChannels([]string{instrument})
+		if len(channels) != 1 {
+			continue
+		}
+		book, exists := previous[channels[0]]
+		if !exists {
+			book = &restFallbackBook{Instrument: instrument}
+		}
+		books[channels[0]] = book
+	}
+	f.Fetchers[name] = fetcher
+	f.Books[name] = books
+	if f.Since[name].IsZero() {
+		f.Since[name] = time.Now()
+	}
+}
+
+// restFallbackDue returns the instruments of exchange whose books need a REST snapshot at now, those whose
+// subscription failed or whose side hasn't been updated for RestFallbackAfter, refetched least recently first.
+func restFallbackDue(exchange string, now time.Time) []*restFallbackBook {
+	RestFallback.Mu.Lock()
+	started := now.Sub(RestFallback.Since[exchange]) >= RestFallbackAfter //give the websocket its first snapshots
+	channels := make(map[string]*restFallbackBook, len(RestFallback.Books[exchange]))
+	for channel, book := range RestFallback.Books[exchange] {
+		if now.Sub(book.Fetched) >= RestFallbackAfter {
+			channels[channel] = book
+		}
+	}
+	RestFallback.Mu.Unlock()
+
+	due := make([]*restFallbackBook, 0)
+	for channel, book := range channels {
+		if Subscriptions.Failed(exchange, channel) {
+			due = append(due, book)
+			continue
+		}
+		if !started {
+			continue
+		}
+		instrument, err := normalizeVenueInstrument(exchange, book.Instrument)
+		if err != nil {
+			continue
+		}
+		OrderbookContainer.Mu.RLock()
+		orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+		stale := exists && !orderbook.Timestamps[exchange].IsZero() && now.Sub(orderbook.Timestamps[exchange]) >= RestFallbackAfter
+		OrderbookContainer.Mu.RUnlock()
+		if stale {
+			due = append(due, book)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Fetched.Before(due[j].Fetched) })
+	return due[:min(len(due), RestFallbackBatch)]
+}
+
+// applyRestSnapshot replaces exchange's side of the snapshot's book, unless the websocket updated it since fetchedAt,
+// and reports whether it did. The side stays flagged RestSourced until the websocket updates it again.
+func applyRestSnapshot(exchange string, snapshot OrderbookSnapshot, fetchedAt time.Time) bool {
+	bids, asks := snapshot.Bids[exchange], snapshot.Asks[exchange]
+	if len(bids) <= 0 && len(asks) <= 0 {
+		return false
+	}
+
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[snapshot.Instrument]
+	if !exists {
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[snapshot.Instrument] = orderbook
+	}
+	if orderbook.Timestamps[exchange].After(fetchedAt) {
+		return false //the websocket came back while the request was in flight
+	}
+	if orderbook.Timestamps == nil {
+		orderbook.Timestamps = make(map[string]time.Time)
+	}
+	if orderbook.RestSourced == nil {
+		orderbook.RestSourced = make(map[string]bool)
+	}
+
+	orderbook.Bids[exchange] = bids
+	orderbook.Asks[exchange] = asks
+	orderbook.Timestamps[exchange] = fetchedAt
+	orderbook.RestSourced[exchange] = true
+	delete(orderbook.Sequences, exchange) //deltas can't apply on top of it, the next one requests a websocket snapshot
+	applyDepthLimit(orderbook, exchange)
+	trackBookMetrics(orderbook, exchange)
+	orderbook.UpdateCount++
+	publishBookEvent(exchange, snapshot.Instrument, orderbook.Bids[exchange], orderbook.Asks[exchange])
+	return true
+}
+
+// restFallbackLoop fetches the books due a REST snapshot every interval.
+func restFallbackLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		now := time.Now()
+
+		RestFallback.Mu.Lock()
+		fetchers := make(map[string]BookFetcher, len(RestFallback.Fetchers))
+		for exchange, fetcher := range RestFallback.Fetchers {
+			fetchers[exchange] = fetcher
+		}
+		RestFallback.Mu.Unlock()
+
+		for exchange, fetcher := range fetchers {
+			for _, book := range restFallbackDue(exchange, now) {
+				fetchedAt := time.Now()
+				snapshot, err := fetcher.FetchOrderbook(book.Instrument)
+
+				RestFallback.Mu.Lock()
+				book.Fetched = fetchedAt
+				if err != nil {
+					RestFallback.Errors[exchange]++
+				} else {
+					RestFallback.Fetches[exchange]++
+				}
+				RestFallback.Mu.Unlock()
+
+				if err != nil {
+					slog.Warn("restFallbackLoop: fetch failed", "exchange", exchange, "instrument", book.Instrument, "err", err)
+					continue
+				}
+				applyRestSnapshot(exchange, snapshot, fetchedAt)
+			}
+		}
+	}
+}
+
+// markRestSourcedLegs flags the strike's ArbTable when a leg is priced from a REST sourced side, updateArbTable
+// stores a new table every pass so websocket priced ones are never flagged. Callers hold OrderbookContainer.Mu.
+func markRestSourcedLegs(key string, callOrderbook *OrderbookData, putOrderbook *OrderbookData) {
+	if len(callOrderbook.RestSourced) == 0 && len(putOrderbook.RestSourced) == 0 {
+		return
+	}
+	book := func(optionType string) *OrderbookData {
+		if optionType == "C" {
+			return callOrderbook
+		}
+		return putOrderbook
+	}
+
+	ArbContainer.Mu.Lock()
+	defer ArbContainer.Mu.Unlock()
+	table, exists := ArbContainer.ArbTables[key]
+	if !exists {
+		return
+	}
+	table.RestSourced = book(table.BidType).RestSourced[table.BidExchange] || book(table.AskType).RestSourced[table.AskExchange]
+}
+
+type restFallbackStatusJson struct {
+	Books   int   `json:"books"` //currently REST sourced
+	Fetches int64 `json:"fetches"`
+	Errors  int64 `json:"errors"`
+}
+
+// restFallbackStatus reports, by exchange, the book sides currently REST sourced and the fallback's fetches so far.
+func restFallbackStatus() map[string]restFallbackStatusJson {
+	status := make(map[string]restFallbackStatusJson)
+	RestFallback.Mu.Lock()
+	for exchange := range RestFallback.Fetchers {
+		status[exchange] = restFallbackStatusJson{Fetches: RestFallback.Fetches[exchange], Errors: RestFallback.Errors[exchange]}
+	}
+	RestFallback.Mu.Unlock()
+
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+	for _, orderbook := range OrderbookContainer.Orderbooks {
+		for exchange, sourced := range orderbook.RestSourced {
+			if sourced {
+				entry := status[exchange]
+				entry.Books++
+				status[exchange] = entry
+			}
+		}
+	}
+	return status
+}
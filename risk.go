@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"options-ws/aevo"
+	"options-ws/decimal"
+)
+
+// RiskLimits bound every order before it's placed, 0 disables a limit. Open orders count as if filled.
+type RiskLimits struct {
+	MaxNotional  float64 //USD index notional of one order
+	MaxContracts float64 //absolute contracts held per instrument
+	MaxDelta     float64 //absolute aggregate delta, in the underlying, summed across assets
+	MaxVega      float64 //absolute aggregate vega, USD per vol point
+}
+
+var Limits RiskLimits
+
+// portfolioExposure sums delta and vega over positions and open orders with live greeks where available, the ones
+// last reported with the position otherwise.
+func portfolioExposure(now time.Time) (delta float64, vega float64) {
+	Portfolio.Mu.Lock()
+	amounts := make(map[string]float64)
+	reported := make(map[string]aevo.Greeks)
+	for _, position := range Portfolio.Positions {
+		amounts[position.Instrument] += position.Amount
+		reported[position.Instrument] = position.Greeks
+	}
+	for _, order := range Portfolio.Orders {
+		remaining := order.Amount - order.Filled
+		if order.Side == "sell" {
+			remaining = -remaining
+		}
+		amounts[order.Instrument] += remaining
+	}
+	Portfolio.Mu.Unlock()
+
+	for instrument, amount := range amounts {
+		greeks, source := instrumentGreeks(instrument, now)
+		if source == "" {
+			greeks = reported[instrument]
+		}
+		delta += greeks.Delta * amount
+		vega += greeks.Vega * amount
+	}
+	return delta, vega
+}
+
+// maxAmount is the largest order of step exposure per contract that keeps |current + step*amount| within limit, 0
+// when current is already at or beyond it in step's direction. Orders reducing the exposure are not bound.
+func maxAmount(current float64, step float64, limit float64) float64 {
+	if limit <= 0 || step == 0 {
+		return math.Inf(1)
+	}
+	if step < 0 {
+		current, step = -current, -step
+	}
+	return max((limit-current)/step, 0)
+}
+
+// checkRisk returns the part of an order of amount contracts that fits Limits and the limit that cut it, "" when it
+// fits whole. The error is set when nothing fits.
+func checkRisk(exchange string, instrument string, isBuy bool, amount float64, now time.Time) (float64, string, error) {
+	side := 1.0
+	if !isBuy {
+		side = -1
+	}
+
+	allowed, binding := amount, ""
+	bound := func(limit string, most float64) {
+		if most < allowed {
+			allowed, binding = most, limit
+		}
+	}
+
+	asset := strings.Split(instrument, "-")[0]
+	if index, exists := AevoIndex.Get(asset); exists && index > 0 && Limits.MaxNotional > 0 {
+		bound("notional", Limits.MaxNotional/index)
+	}
+	held, pending := inventory(exchange, instrument)
+	bound("contracts", maxAmount(held+pending, side, Limits.MaxContracts))
+	if Limits.MaxDelta > 0 || Limits.MaxVega > 0 {
+		greeks, _ := instrumentGreeks(instrument, now)
+		delta, vega := portfolioExposure(now)
+		bound("delta", maxAmount(delta, greeks.Delta*side, Limits.MaxDelta))
+		bound("vega", maxAmount(vega, greeks.Vega*side, Limits.MaxVega))
+	}
+
+	if allowed <= 0 {
+		return 0, binding, fmt.Errorf("checkRisk: %v %v rejected by the %v limit", instrument, amount, binding)
+	}
+	return allowed, binding, nil
+}
+
+// aevoPlaceOrder places an order on aevo within Limits, sized down when the whole amount would breach one, and
+// tracks it as open so the next check sees it before the private feed does. The price and amount are rounded to the
+// instrument's steps and an order below its minimum is rejected. The instrument id is looked up when not set.
+func aevoPlaceOrder(instrument string, order aevo.OrderRequest) (aevo.Order, error) {
+	allowed, binding, err := checkRisk("aevo", instrument, order.IsBuy, order.Amount, time.Now())
+	if err != nil {
+		slog.Warn("aevoPlaceOrder: order rejected", "instrument", instrument, "amount", order.Amount, "limit", binding)
+		return aevo.Order{}, fmt.Errorf("aevoPlaceOrder: %v", err)
+	}
+	if allowed < order.Amount {
+		slog.Info("aevoPlaceOrder: order sized down", "instrument", instrument, "amount", order.Amount, "allowed", allowed, "limit", binding)
+		order.Amount = allowed
+	}
+	order.LimitPrice = roundPrice("aevo", instrument, decimal.FromFloat(order.LimitPrice), order.IsBuy).Float64()
+	order.Amount = roundAmount("aevo", instrument, order.Amount)
+	if belowMinimumOrder("aevo", instrument, order.Amount, order.LimitPrice) {
+		return aevo.Order{}, fmt.Errorf("aevoPlaceOrder: %v %v at %v below the minimum order", instrument, order.Amount, order.LimitPrice)
+	}
+
+	if order.InstrumentId == 0 {
+		AevoMarketList.Mu.Lock()
+		market, exists := AevoMarketList.Markets[instrument]
+		AevoMarketList.Mu.Unlock()
+		if !exists {
+			return aevo.Order{}, fmt.Errorf("aevoPlaceOrder: unknown instrument %v", instrument)
+		}
+		order.InstrumentId = market.InstrumentId
+	}
+
+	placed, err := AevoClient.PlaceOrder(order)
+	if err != nil {
+		return placed, fmt.Errorf("aevoPlaceOrder: %v", err)
+	}
+	placed.InstrumentName = instrument
+	if placed.OrderStatus != "dry_run" { //never fills, it would hold its size against the limits forever
+		Portfolio.Mu.Lock()
+		aevoUpdateOrders([]aevo.Order{placed})
+		Portfolio.Mu.Unlock()
+	}
+	return placed, nil
+}
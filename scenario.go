@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ScenarioLeg is one priced component of a portfolio or candidate structure. Legs without a strike are linear in the
+// underlying (perps, the index hedge of a parity trade).
+type ScenarioLeg struct {
+	Instrument string
+	Amount     float64 //signed contracts
+	OptionType string  //"C", "P" or "" for linear
+	Strike     float64
+	Expiry     time.Time
+	Iv         float64 //fraction
+}
+
+type ScenarioResult struct {
+	SpotShock float64            //percent
+	VolShift  float64            //vol points
+	Spots     map[string]float64 //by asset, shocked
+	Pnl       float64
+	Delta     float64
+	Gamma     float64
+	Vega      float64
+	Theta     float64
+}
+
+// parseScenarioLeg builds a leg from an instrument name, taking iv from the exchange's market greeks and falling back
+// to the leg's own iv.
+func parseScenarioLeg(instrument string, amount float64, iv float64) (ScenarioLeg, error) {
+	leg := ScenarioLeg{Instrument: instrument, Amount: amount, Iv: iv}
+	if strings.Count(instrument, "-") != 3 {
+		return leg, nil //perp or spot, priced linearly
+	}
+
+	option, err := parseInstrument(instrument)
+	if err != nil {
+		return leg, fmt.Errorf("parseScenarioLeg: %v", err)
+	}
+	leg.OptionType, leg.Strike, leg.Expiry = option.Type, option.Strike, option.Expiry
+
+	AevoMarketList.Mu.Lock()
+	if market, exists := AevoMarketList.Markets[instrument]; exists && market.Greeks.Iv > 0 {
+		leg.Iv = market.Greeks.Iv
+	}
+	AevoMarketList.Mu.Unlock()
+
+	return leg, nil
+}
+
+func priceLeg(leg ScenarioLeg, spot float64, volShift float64, now time.Time) BsResult {
+	if leg.OptionType == "" {
+		return BsResult{Price: spot, Delta: 1}
+	}
+	return blackScholes(leg.OptionType, spot, leg.Strike, yearsUntil(leg.Expiry, now), leg.Iv+volShift/100, 0)
+}
+
+// legSpots are the aevo index prices of the legs' assets.
+func legSpots(legs []ScenarioLeg) (map[string]float64, error) {
+	spots := make(map[string]float64)
+	for _, leg := range legs {
+		asset := instrumentAsset(leg.Instrument)
+		if _, exists := spots[asset]; exists {
+			continue
+		}
+		spot, _ := AevoIndex.Get(asset)
+		if spot <= 0 {
+			return nil, fmt.Errorf("legSpots: no %v index price yet", asset)
+		}
+		spots[asset] = spot
+	}
+	return spots, nil
+}
+
+// runScenarios reprices legs for every spot shock / vol shift pair, every asset's spot in spots shocked alike, pnl
+// relative to the unshocked value.
+func runScenarios(legs []ScenarioLeg, spots map[string]float64, spotShocks []float64, volShifts []float64) []ScenarioResult {
+	now := time.Now()
+	base := 0.0
+	for _, leg := range legs {
+		base += priceLeg(leg, spots[instrumentAsset(leg.Instrument)], 0, now).Price * leg.Amount
+	}
+
+	results := make([]ScenarioResult, 0, len(spotShocks)*len(volShifts))
+	for _, shock := range spotShocks {
+		shocked := make(map[string]float64, len(spots))
+		for asset, spot := range spots {
+			shocked[asset] = spot * (1 + shock/100)
+		}
+		for _, shift := range volShifts {
+			result := ScenarioResult{SpotShock: shock, VolShift: shift, Spots: shocked}
+			value := 0.0
+			for _, leg := range legs {
+				priced := priceLeg(leg, shocked[instrumentAsset(leg.Instrument)], shift, now)
+				value += priced.Price * leg.Amount
+				result.Delta += priced.Delta * leg.Amount
+				result.Gamma += priced.Gamma * leg.Amount
+				result.Vega += priced.Vega * leg.Amount
+				result.Theta += priced.Theta * leg.Amount
+			}
+			result.Pnl = value - base
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+func portfolioLegs() ([]ScenarioLeg, error) {
+	Portfolio.Mu.Lock()
+	defer Portfolio.Mu.Unlock()
+
+	legs := make([]ScenarioLeg, 0, len(Portfolio.Positions))
+	for _, position := range Portfolio.Positions {
+		leg, err := parseScenarioLeg(position.Instrument, position.Amount, position.Greeks.Iv)
+		if err != nil {
+			return nil, err
+		}
+		legs = append(legs, leg)
+	}
+
+	return legs, nil
+}
+
+// arbLegs is one unit of an ArbTable opportunity: short the bid leg, long the ask leg and the index hedge that
+// completes the parity (long underlying when selling the call).
+func arbLegs(key string) ([]ScenarioLeg, error) {
+	table, exists := ArbContainer.Get(key)
+	if !exists {
+		return nil, fmt.Errorf("arbLegs: no opportunity %v", key)
+	}
+	bidType, askType := table.BidType, table.AskType
+	bidIv, askIv := table.Bids[0].Iv, table.Asks[0].Iv
+	asset := table.Asset
+
+	short, err := parseScenarioLeg(key+"-"+bidType, -1, bidIv)
+	if err != nil {
+		return nil, err
+	}
+	long, err := parseScenarioLeg(key+"-"+askType, 1, askIv)
+	if err != nil {
+		return nil, err
+	}
+	hedge := ScenarioLeg{Instrument: asset, Amount: 1}
+	if bidType == "P" {
+		hedge.Amount = -1
+	}
+
+	return []ScenarioLeg{short, long, hedge}, nil
+}
+
+func parseShocks(raw string, fallback []float64) ([]float64, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	shocks := make([]float64, 0)
+	for _, part := range strings.Split(raw, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parseShocks: %v", err)
+		}
+		shocks = append(shocks, value)
+	}
+	return shocks, nil
+}
+
+// scenarioRequest parses ?spot=-20,-10,0,10,20&vol=-10,0,10&arb=<key>, without arb the tracked portfolio is used.
+func scenarioRequest(r *http.Request) ([]ScenarioResult, []float64, []float64, error) {
+	query := r.URL.Query()
+	spotShocks, err := parseShocks(query.Get("spot"), []float64{-20, -10, -5, 0, 5, 10, 20})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	volShifts, err := parseShocks(query.Get("vol"), []float64{-10, 0, 10})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var legs []ScenarioLeg
+	if key := query.Get("arb"); key != "" {
+		legs, err = arbLegs(key)
+	} else {
+		legs, err = portfolioLegs()
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	spots, err := legSpots(legs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return runScenarios(legs, spots, spotShocks, volShifts), spotShocks, volShifts, nil
+}
+
+func scenariosApiHandler(w http.ResponseWriter, r *http.Request) {
+	results, _, _, err := scenarioRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		slog.Error("scenariosApiHandler: json encode error", "err", err)
+	}
+}
+
+func serveScenarios(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/scenarios.html"))
+	tmpl.Execute(w, nil)
+}
+
+// scenarioTableHandler renders a pnl grid, spot shocks down and vol shifts across, for the htmx page.
+func scenarioTableHandler(w http.ResponseWriter, r *http.Request) {
+	results, spotShocks, volShifts, err := scenarioRequest(r)
+	if err != nil {
+		fmt.Fprintf(w, `<tr><td>%s</td></tr>`, template.HTMLEscapeString(err.Error()))
+		return
+	}
+
+	responseStr := `<tr><th>Spot \ Vol</th>`
+	for _, shift := range volShifts {
+		responseStr += fmt.Sprintf(`<th>%+g</th>`, shift)
+	}
+	responseStr += `<th>Delta</th><th>Gamma</th><th>Vega</th><th>Theta</th></tr>`
+
+	for i, shock := range spotShocks {
+		row := results[i*len(volShifts) : (i+1)*len(volShifts)]
+		responseStr += fmt.Sprintf(`<tr><th>%+g%%</th>`, shock)
+		for _, result := range row {
+			responseStr += fmt.Sprintf(`<td>%s</td>`, strconv.FormatFloat(result.Pnl, 'f', 2, 64))
+		}
+		unshifted := row[0]
+		for _, result := range row {
+			if result.VolShift == 0 {
+				unshifted = result
+			}
+		}
+		responseStr += fmt.Sprintf(`<td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			strconv.FormatFloat(unshifted.Delta, 'f', 3, 64),
+			strconv.FormatFloat(unshifted.Gamma, 'f', 5, 64),
+			strconv.FormatFloat(unshifted.Vega, 'f', 2, 64),
+			strconv.FormatFloat(unshifted.Theta, 'f', 2, 64),
+		)
+	}
+
+	fmt.Fprint(w, responseStr)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"options-ws/aevo"
+)
+
+type ScreenerRow struct {
+	Instrument   string
+	Expiry       string
+	Strike       float64
+	OptionType   string
+	Days         float64
+	Delta        float64
+	Gamma        float64
+	Theta        float64
+	Vega         float64
+	Iv           float64 //vol points
+	IvBid        float64 //vol points, best aevo bid
+	IvAsk        float64 //vol points, best aevo ask
+	RealizedVol  float64 //vol points, 24h of index samples
+	IvRvSpread   float64
+	ThetaVega    float64 //|theta| / vega
+	Bid          float64
+	Ask          float64
+	SpreadPct    float64 //(ask - bid) / mid * 100, 0 when not two sided
+	OpenInterest float64
+	OiChangeDay  float64
+}
+
+// ScreenerFilter bounds are inclusive, nil means unbounded.
+type ScreenerFilter struct {
+	MinDays, MaxDays           *float64
+	MinAbsDelta, MaxAbsDelta   *float64
+	MinThetaVega, MaxThetaVega *float64
+	MinIvRv, MaxIvRv           *float64
+	MaxSpreadPct               *float64
+	MinOpenInterest            *float64
+	OptionType                 string
+	Sort                       string
+	Limit                      int
+}
+
+func parseBound(query url.Values, name string) (*float64, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	return &value, nil
+}
+
+func parseScreenerFilter(query url.Values) (ScreenerFilter, error) {
+	filter := ScreenerFilter{OptionType: strings.ToUpper(query.Get("type")), Sort: query.Get("sort"), Limit: 200}
+	bounds := map[string]**float64{
+		"min_days":       &filter.MinDays,
+		"max_days":       &filter.MaxDays,
+		"min_delta":      &filter.MinAbsDelta,
+		"max_delta":      &filter.MaxAbsDelta,
+		"min_theta_vega": &filter.MinThetaVega,
+		"max_theta_vega": &filter.MaxThetaVega,
+		"min_iv_rv":      &filter.MinIvRv,
+		"max_iv_rv":      &filter.MaxIvRv,
+		"max_spread":     &filter.MaxSpreadPct,
+		"min_oi":         &filter.MinOpenInterest,
+	}
+	for name, bound := range bounds {
+		value, err := parseBound(query, name)
+		if err != nil {
+			return filter, err
+		}
+		*bound = value
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return filter, fmt.Errorf("limit: %v", err)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+func within(value float64, low *float64, high *float64) bool {
+	return (low == nil || value >= *low) && (high == nil || value <= *high)
+}
+
+func (f ScreenerFilter) Match(row ScreenerRow) bool {
+	return within(row.Days, f.MinDays, f.MaxDays) &&
+		within(math.Abs(row.Delta), f.MinAbsDelta, f.MaxAbsDelta) &&
+		within(row.ThetaVega, f.MinThetaVega, f.MaxThetaVega) &&
+		within(row.IvRvSpread, f.MinIvRv, f.MaxIvRv) &&
+		(f.MaxSpreadPct == nil || (row.SpreadPct > 0 && row.SpreadPct <= *f.MaxSpreadPct)) &&
+		within(row.OpenInterest, f.MinOpenInterest, nil) &&
+		(f.OptionType == "" || f.OptionType == row.OptionType)
+}
+
+// screenerRows computes screener metrics for every active aevo market from its greeks, the live books, index history
+// and open interest.
+func screenerRows(now time.Time) []ScreenerRow {
+	AevoMarketList.Mu.Lock()
+	markets := make([]aevo.Market, 0, len(AevoMarketList.Markets))
+	for _, market := range AevoMarketList.Markets {
+		markets = append(markets, market)
+	}
+	AevoMarketList.Mu.Unlock()
+
+	rvs := make(map[string]float64) //by asset
+	for _, market := range markets {
+		asset := instrumentAsset(market.InstrumentName)
+		if _, exists := rvs[asset]; !exists {
+			rvs[asset] = realizedVol(indexSamples("aevo", asset, now.Add(-24*time.Hour))) * 100
+		}
+	}
+	oi := openInterestChanges(now)
+
+	greeks := make(map[string]aevo.Greeks, len(markets)) //model greeks when aevo's are missing or stale, before the books are locked
+	for _, market := range markets {
+		greeks[market.InstrumentName], _ = instrumentGreeks(market.InstrumentName, now)
+	}
+
+	rows := make([]ScreenerRow, 0, len(markets))
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+	for _, market := range markets {
+		components := strings.Split(market.InstrumentName, "-")
+		if len(components) != 4 {
+			continue
+		}
+
+		greeks, rv := greeks[market.InstrumentName], rvs[instrumentAsset(market.InstrumentName)]
+		row := ScreenerRow{
+			Instrument:   market.InstrumentName,
+			Expiry:       components[1],
+			Strike:       float64(market.Strike),
+			OptionType:   components[3],
+			Days:         time.Until(time.Unix(0, market.Expiry)).Hours() / 24,
+			Delta:        greeks.Delta,
+			Gamma:        greeks.Gamma,
+			Theta:        greeks.Theta,
+			Vega:         greeks.Vega,
+			Iv:           greeks.Iv * 100,
+			RealizedVol:  rv,
+			OpenInterest: oi[market.InstrumentName].OpenInterest,
+			OiChangeDay:  oi[market.InstrumentName].ChangeDay,
+		}
+		if rv > 0 {
+			row.IvRvSpread = row.Iv - rv
+		}
+		if row.Vega != 0 {
+			row.ThetaVega = math.Abs(row.Theta) / row.Vega
+		}
+
+		if orderbook, exists := OrderbookContainer.Orderbooks[market.InstrumentName]; exists {
+			if bids := orderbook.Bids["aevo"]; len(bids) > 0 {
+				row.Bid = bids[0].Price.Float64()
+				row.IvBid = bids[0].Iv * 100
+			}
+			if asks := orderbook.Asks["aevo"]; len(asks) > 0 {
+				row.Ask = asks[0].Price.Float64()
+				row.IvAsk = asks[0].Iv * 100
+			}
+			if row.Bid > 0 && row.Ask > 0 {
+				row.SpreadPct = (row.Ask - row.Bid) / ((row.Ask + row.Bid) / 2) * 100
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func screen(filter ScreenerFilter) []ScreenerRow {
+	matched := make([]ScreenerRow, 0)
+	for _, row := range screenerRows(time.Now()) {
+		if filter.Match(row) {
+			matched = append(matched, row)
+		}
+	}
+
+	less := map[string]func(a, b ScreenerRow) bool{
+		"theta_vega": func(a, b ScreenerRow) bool { return a.ThetaVega > b.ThetaVega },
+		"iv_rv":      func(a, b ScreenerRow) bool { return a.IvRvSpread > b.IvRvSpread },
+		"spread":     func(a, b ScreenerRow) bool { return a.SpreadPct < b.SpreadPct },
+		"oi":         func(a, b ScreenerRow) bool { return a.OpenInterest > b.OpenInterest },
+	}[filter.Sort]
+	if less == nil {
+		less = func(a, b ScreenerRow) bool { return a.Instrument < b.Instrument }
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched
+}
+
+// screenerApiHandler serves /api/screener, filters are query parameters, e.g.
+// /api/screener?max_days=14&max_delta=0.3&min_iv_rv=5&sort=iv_rv
+func screenerApiHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseScreenerFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(screen(filter))
+	if err != nil {
+		slog.Error("screenerApiHandler: json encode error", "err", err)
+	}
+}
+
+func serveScreener(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/screener.html"))
+	tmpl.Execute(w, nil)
+}
+
+// screenerTableHandler renders screener rows for the htmx table on /screener, with the same filters as the API.
+func screenerTableHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseScreenerFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseStr := ""
+	for _, row := range screen(filter) {
+		responseStr += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			row.Instrument,
+			strconv.FormatFloat(row.Days, 'f', 1, 64),
+			strconv.FormatFloat(row.Delta, 'f', 3, 64),
+			strconv.FormatFloat(row.Theta, 'f', 3, 64),
+			strconv.FormatFloat(row.Vega, 'f', 3, 64),
+			strconv.FormatFloat(row.ThetaVega, 'f', 3, 64),
+			strconv.FormatFloat(row.Iv, 'f', 1, 64),
+			strconv.FormatFloat(row.IvRvSpread, 'f', 1, 64),
+			strconv.FormatFloat(row.Bid, 'f', 3, 64),
+			strconv.FormatFloat(row.Ask, 'f', 3, 64),
+			strconv.FormatFloat(row.SpreadPct, 'f', 2, 64),
+			strconv.FormatFloat(row.OpenInterest, 'f', 1, 64),
+			strconv.FormatFloat(row.OiChangeDay, 'f', 1, 64),
+		)
+	}
+
+	fmt.Fprint(w, responseStr)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// Script is a user Starlark file loaded from -scripts. It may define any of
+//
+//	on_book(instrument, book)       book: {"bids": {exchange: [(price, amount, iv), ...]}, "asks": ..., "best_bid", "best_ask"}
+//	on_index(exchange, asset, price)
+//	on_surface(asset, expiry, atm_iv)  atm_iv in vol points
+//
+// which are called for every change since the previous pass, and report back through the alert(message) and
+// opportunity(name, instrument, score=0, note="") builtins. Module globals are frozen once the file has run, the
+// predeclared state dict is not and persists across calls (callbacks never run concurrently).
+type Script struct {
+	Name      string
+	onBook    starlark.Value
+	onIndex   starlark.Value
+	onSurface starlark.Value
+	errors    int
+}
+
+type ScriptOpportunity struct {
+	Script     string
+	Name       string
+	Instrument string
+	Score      float64
+	Note       string
+	Time       time.Time
+}
+
+type ScriptsContainer struct {
+	Mu            sync.Mutex
+	Scripts       []*Script
+	Opportunities map[string]*ScriptOpportunity //key: script + " " + name + " " + instrument
+}
+
+var Scripts = ScriptsContainer{Opportunities: make(map[string]*ScriptOpportunity)}
+
+const scriptStepBudget = 1000000             //starlark execution steps per callback before it is cancelled
+const scriptMaxErrors = 10                   //callback errors after which a script is disabled
+const scriptOpportunityTtl = 5 * time.Minute //opportunities not re-emitted within this are dropped
+
+const scriptBookDepth = 10
+
+func scriptBuiltins(name string) starlark.StringDict {
+	alert := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var message string
+		err := starlark.UnpackArgs(fn.Name(), args, kwargs, "message", &message)
+		if err != nil {
+			return nil, err
+		}
+		slog.Warn("SCRIPT ALERT", "script", name, "message", message)
+		return starlark.None, nil
+	}
+
+	opportunity := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var opportunityName, instrument, note string
+		var score starlark.Value = starlark.Float(0)
+		err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &opportunityName, "instrument", &instrument, "score?", &score, "note?", &note)
+		if err != nil {
+			return nil, err
+		}
+		scoreFloat, ok := starlark.AsFloat(score)
+		if !ok {
+			return nil, fmt.Errorf("%v: score must be a number, got %v", fn.Name(), score.Type())
+		}
+
+		Scripts.Mu.Lock()
+		Scripts.Opportunities[name+" "+opportunityName+" "+instrument] = &ScriptOpportunity{name, opportunityName, instrument, scoreFloat, note, time.Now()}
+		Scripts.Mu.Unlock()
+		return starlark.None, nil
+	}
+
+	return starlark.StringDict{
+		"alert":       starlark.NewBuiltin("alert", alert),
+		"opportunity": starlark.NewBuiltin("opportunity", opportunity),
+		"state":       starlark.NewDict(0),
+	}
+}
+
+func scriptThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			slog.Info("script print", "script", thread.Name, "message", msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(scriptStepBudget)
+	return thread
+}
+
+// loadScripts executes every *.star file in dir once and keeps the ones defining at least one callback.
+func loadScripts(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return fmt.Errorf("loadScripts: %v", err)
+	}
+
+	scripts := make([]*Script, 0, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		globals, err := starlark.ExecFile(scriptThread(name), path, nil, scriptBuiltins(name))
+		if err != nil {
+			return fmt.Errorf("loadScripts: %v: %v", name, err)
+		}
+
+		script := &Script{Name: name, onBook: globals["on_book"], onIndex: globals["on_index"], onSurface: globals["on_surface"]}
+		if script.onBook == nil && script.onIndex == nil && script.onSurface == nil {
+			slog.Warn("loadScripts: script defines no on_book, on_index or on_surface, skipping", "script", name)
+			continue
+		}
+		scripts = append(scripts, script)
+	}
+
+	Scripts.Mu.Lock()
+	Scripts.Scripts = scripts
+	Scripts.Mu.Unlock()
+
+	slog.Info("loadScripts: loaded scripts", "scripts", len(scripts), "dir", dir)
+	return nil
+}
+
+// call runs one callback on a fresh thread (a thread that hit the step budget stays cancelled), a script that keeps
+// failing is disabled rather than logging on every pass.
+func (s *Script) call(fn starlark.Value, args ...starlark.Value) {
+	if fn == nil || s.errors >= scriptMaxErrors {
+		return
+	}
+
+	_, err := starlark.Call(scriptThread(s.Name), fn, args, nil)
+	if err == nil {
+		return
+	}
+
+	s.errors++
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		slog.Error("script error", "script", s.Name, "backtrace", evalErr.Backtrace())
+	} else {
+		slog.Error("script error", "script", s.Name, "err", err)
+	}
+	if s.errors >= scriptMaxErrors {
+		slog.Error("script disabled", "script", s.Name, "errors", s.errors)
+	}
+}
+
+func scriptLevels(orders map[string][]Order) *starlark.Dict {
+	levels := starlark.NewDict(len(orders))
+	for exchange, exchangeOrders := range orders {
+		list := make([]starlark.Value, 0, min(len(exchangeOrders), scriptBookDepth))
+		for _, order := range exchangeOrders[:min(len(exchangeOrders), scriptBookDepth)] {
+			list = append(list, starlark.Tuple{starlark.Float(order.Price.Float64()), starlark.Float(order.Amount), starlark.Float(order.Iv)})
+		}
+		levels.SetKey(starlark.String(exchange), starlark.NewList(list))
+	}
+	return levels
+}
+
+// scriptBook converts an orderbook to the dict on_book receives, best_bid/best_ask are across exchanges, None if
+// that side is empty.
+func scriptBook(orderbook *OrderbookData) *starlark.Dict {
+	book := starlark.NewDict(4)
+	book.SetKey(starlark.String("bids"), scriptLevels(orderbook.Bids))
+	book.SetKey(starlark.String("asks"), scriptLevels(orderbook.Asks))
+
+	var bestBid, bestAsk starlark.Value = starlark.None, starlark.None
+	for _, bids := range orderbook.Bids {
+		if len(bids) > 0 && (bestBid == starlark.None || bids[0].Price.Float64() > float64(bestBid.(starlark.Float))) {
+			bestBid = starlark.Float(bids[0].Price.Float64())
+		}
+	}
+	for _, asks := range orderbook.Asks {
+		if len(asks) > 0 && (bestAsk == starlark.None || asks[0].Price.Float64() < float64(bestAsk.(starlark.Float))) {
+			bestAsk = starlark.Float(asks[0].Price.Float64())
+		}
+	}
+	book.SetKey(starlark.String("best_bid"), bestBid)
+	book.SetKey(starlark.String("best_ask"), bestAsk)
+
+	return book
+}
+
+// scriptLoop polls the stores and calls every script's callbacks with what changed since the last pass. Scripts run
+// one at a time on this goroutine so they never see concurrent calls.
+func scriptLoop(interval time.Duration) {
+	bookUpdates := make(map[string]float64) //instrument -> LastUpdated at the last pass
+	indexPrices := make(map[string]float64) //exchange + " " + asset -> price
+	surface := make(map[string]float64)     //asset + " " + expiry -> ATM IV
+
+	for {
+		time.Sleep(interval)
+
+		Scripts.Mu.Lock()
+		scripts := Scripts.Scripts
+		for key, opportunity := range Scripts.Opportunities {
+			if time.Since(opportunity.Time) > scriptOpportunityTtl {
+				delete(Scripts.Opportunities, key)
+			}
+		}
+		Scripts.Mu.Unlock()
+
+		type bookUpdate struct {
+			instrument string
+			book       *starlark.Dict
+		}
+		books := make([]bookUpdate, 0)
+		OrderbookContainer.Mu.RLock()
+		for instrument, orderbook := range OrderbookContainer.Orderbooks {
+			if bookUpdates[instrument] != orderbook.LastUpdated {
+				bookUpdates[instrument] = orderbook.LastUpdated
+				books = append(books, bookUpdate{instrument, scriptBook(orderbook)})
+			}
+		}
+		for instrument := range bookUpdates {
+			if _, exists := OrderbookContainer.Orderbooks[instrument]; !exists {
+				delete(bookUpdates, instrument)
+			}
+		}
+		OrderbookContainer.Mu.RUnlock()
+		sort.Slice(books, func(i, j int) bool { return books[i].instrument < books[j].instrument })
+
+		for _, update := range books {
+			for _, script := range scripts {
+				script.call(script.onBook, starlark.String(update.instrument), update.book)
+			}
+		}
+
+		for exchange, index := range map[string]*IndexContainer{"aevo": &AevoIndex, "lyra": &LyraIndex} {
+			prices := index.Snapshot()
+
+			for asset, price := range prices {
+				if indexPrices[exchange+" "+asset] == price {
+					continue
+				}
+				indexPrices[exchange+" "+asset] = price
+				for _, script := range scripts {
+					script.call(script.onIndex, starlark.String(exchange), starlark.String(asset), starlark.Float(price))
+				}
+			}
+		}
+
+		for _, asset := range currentAssets() {
+			index, _ := AevoIndex.Get(asset)
+			if index <= 0 {
+				continue
+			}
+
+			for expiry, iv := range atmIvs(asset, index) {
+				if surface[asset+" "+expiry] == iv {
+					continue
+				}
+				surface[asset+" "+expiry] = iv
+				for _, script := range scripts {
+					script.call(script.onSurface, starlark.String(asset), starlark.String(expiry), starlark.Float(iv))
+				}
+			}
+		}
+	}
+}
+
+func scriptOpportunitiesHandler(w http.ResponseWriter, r *http.Request) {
+	Scripts.Mu.Lock()
+	opportunities := make([]ScriptOpportunity, 0, len(Scripts.Opportunities))
+	for _, opportunity := range Scripts.Opportunities {
+		opportunities = append(opportunities, *opportunity)
+	}
+	Scripts.Mu.Unlock()
+	sort.Slice(opportunities, func(i, j int) bool { return opportunities[i].Score > opportunities[j].Score })
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(opportunities)
+	if err != nil {
+		slog.Error("scriptOpportunitiesHandler: json encode error", "err", err)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+	"options-ws/aevo"
+)
+
+// fixtureFrame is a capture line with an optional close code, a line with Close set makes the mock exchange drop the
+// connection with that code instead of sending Data, the client has to reconnect and resubscribe to get the rest.
+type fixtureFrame struct {
+	CapturedFrame
+	Close int `json:"close,omitempty"`
+}
+
+type expectedBook struct {
+	Bid float64 `json:"bid"` //best bid, 0 expects no bids
+	Ask float64 `json:"ask"`
+}
+
+type expectedOpportunity struct {
+	BidType     string  `json:"bid_type"`
+	BidExchange string  `json:"bid_exchange"`
+	AskExchange string  `json:"ask_exchange"`
+	AbsProfit   float64 `json:"abs_profit"`
+}
+
+// selfTestExpectations is expected.json of a fixture directory.
+type selfTestExpectations struct {
+	Subscribe     map[string][]string                `json:"subscribe"`   //exchange -> channels the harness subscribes to
+	Connections   map[string]int                     `json:"connections"` //exchange -> connections the mock should see
+	Orderbooks    map[string]map[string]expectedBook `json:"orderbooks"`  //instrument -> exchange -> best prices
+	Index         map[string]map[string]float64      `json:"index"`       //exchange -> asset -> price
+	Opportunities map[string]expectedOpportunity     `json:"opportunities"`
+}
+
+// mockExchange serves one exchange's fixture frames in order across however many connections it takes, each
+// connection only gets frames once every expected channel has been subscribed on it.
+type mockExchange struct {
+	Exchange string
+	Channels []string
+	Frames   []fixtureFrame
+
+	Mu          sync.Mutex
+	next        int
+	Sent        int
+	Connections int
+	Errors      []string
+	Done        chan struct{}
+}
+
+func newMockExchange(exchange string, channels []string, frames []fixtureFrame) *mockExchange {
+	m := &mockExchange{Exchange: exchange, Channels: channels, Done: make(chan struct{})}
+	for _, frame := range frames {
+		if frame.Exchange == exchange {
+			m.Frames = append(m.Frames, frame)
+		}
+	}
+	if len(m.Frames) == 0 {
+		close(m.Done)
+	}
+	return m
+}
+
+// subscribedChannels decodes aevo ({"op":"subscribe","data":[...]}), lyra and binance subscribe requests.
+func subscribedChannels(raw []byte) []string {
+	var request struct {
+		Data   []string `json:"data"`
+		Params []string `json:"params"`
+	}
+	var lyraRequest struct {
+		Params struct {
+			Channels []string `json:"channels"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(raw, &request) == nil {
+		return append(request.Data, request.Params...)
+	}
+	if json.Unmarshal(raw, &lyraRequest) == nil {
+		return lyraRequest.Params.Channels
+	}
+	return nil
+}
+
+func (m *mockExchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		m.fail("accept error: %v", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	m.Mu.Lock()
+	m.Connections++
+	connection := m.Connections
+	m.Mu.Unlock()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	subscribed := make(chan string, 1024)
+	go func() {
+		defer cancel()
+		for {
+			_, raw, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			for _, channel := range subscribedChannels(raw) {
+				subscribed <- channel
+			}
+		}
+	}()
+
+	pending := make(map[string]bool)
+	for _, channel := range m.Channels {
+		pending[channel] = true
+	}
+	timeout := time.After(5 * time.Second)
+	for len(pending) > 0 {
+		select {
+		case channel := <-subscribed:
+			delete(pending, channel)
+		case <-timeout:
+			m.fail("connection %v: %v of %v channels never subscribed", connection, len(pending), len(m.Channels))
+			return
+		}
+	}
+
+	for {
+		m.Mu.Lock()
+		if m.next >= len(m.Frames) {
+			m.Mu.Unlock()
+			break
+		}
+		frame := m.Frames[m.next]
+		m.next++
+		m.Mu.Unlock()
+
+		if frame.Close != 0 {
+			conn.Close(websocket.StatusCode(frame.Close), "selftest")
+			return
+		}
+
+		err = conn.Write(ctx, websocket.MessageText, []byte(frame.Data))
+		if err != nil {
+			m.fail("connection %v: write error: %v", connection, err)
+			return
+		}
+		m.Mu.Lock()
+		m.Sent++
+		m.Mu.Unlock()
+	}
+
+	close(m.Done)
+	<-ctx.Done() //keep the connection open until the harness closes it
+}
+
+func (m *mockExchange) fail(format string, v ...interface{}) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+	m.Errors = append(m.Errors, m.Exchange+": "+fmt.Sprintf(format, v...))
+}
+
+func readFixture(path string) ([]fixtureFrame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("readFixture: open error: %v", err)
+	}
+	defer file.Close()
+
+	frames := make([]fixtureFrame, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var frame fixtureFrame
+		err = json.Unmarshal(scanner.Bytes(), &frame)
+		if err != nil {
+			return nil, fmt.Errorf("readFixture: line %v: %v", line, err)
+		}
+		frames = append(frames, frame)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("readFixture: scan error: %v", err)
+	}
+
+	return frames, nil
+}
+
+func readExpectations(path string) (selfTestExpectations, error) {
+	var expected selfTestExpectations
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return expected, fmt.Errorf("readExpectations: %v", err)
+	}
+	err = json.Unmarshal(raw, &expected)
+	if err != nil {
+		return expected, fmt.Errorf("readExpectations: %v", err)
+	}
+	return expected, nil
+}
+
+var selfTestSubscribeJson = map[string]func(channels []string) []byte{
+	"aevo":    aevo.SubscribeJson,
+	"lyra":    lyraSubscribeJson,
+	"binance": binanceSubscribeJson,
+}
+
+// runSelfTest plays dir/frames.jsonl through mock exchange servers, real WssConns and the pipeline, then checks the
+// resulting orderbooks, index and opportunities against dir/expected.json. Returns the failures.
+func runSelfTest(dir string, pipeline *Pipeline) []string {
+	frames, err := readFixture(filepath.Join(dir, "frames.jsonl"))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	expected, err := readExpectations(filepath.Join(dir, "expected.json"))
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	mocks := make([]*mockExchange, 0)
+	for exchange, channels := range expected.Subscribe {
+		subscribeJson, exists := selfTestSubscribeJson[exchange]
+		if !exists {
+			return []string{"runSelfTest: unknown exchange " + exchange}
+		}
+
+		mock := newMockExchange(exchange, channels, frames)
+		server := httptest.NewServer(mock)
+		defer server.Close()
+		mocks = append(mocks, mock)
+
+		conn := newWssConn(exchange, "ws"+strings.TrimPrefix(server.URL, "http"), subscribeJson)
+		err = conn.Connect()
+		if err != nil {
+			return []string{fmt.Sprintf("runSelfTest: %v: %v", exchange, err)}
+		}
+		defer conn.Close()
+		go wssReadLoop(conn, pipeline)
+
+		err = conn.Subscribe(channels)
+		if err != nil {
+			return []string{fmt.Sprintf("runSelfTest: %v: %v", exchange, err)}
+		}
+	}
+
+	failures := make([]string, 0)
+	sent := 0
+	deadline := time.After(20 * time.Second)
+	for _, mock := range mocks {
+		select {
+		case <-mock.Done:
+		case <-deadline:
+			failures = append(failures, mock.Exchange+": fixture frames not all sent before the deadline")
+		}
+		mock.Mu.Lock()
+		failures = append(failures, mock.Errors...)
+		sent += mock.Sent
+		if want, exists := expected.Connections[mock.Exchange]; exists && mock.Connections != want {
+			failures = append(failures, fmt.Sprintf("%v: %v connections, expected %v", mock.Exchange, mock.Connections, want))
+		}
+		mock.Mu.Unlock()
+	}
+
+	for start := time.Now(); pipeline.Processed.Load() < int64(sent); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			failures = append(failures, fmt.Sprintf("pipeline processed %v of %v frames", pipeline.Processed.Load(), sent))
+			break
+		}
+	}
+	for _, asset := range Assets {
+		runStrategies(asset) //the coalesced arb pass may not have run after the last frame yet
+	}
+
+	failures = append(failures, checkOrderbooks(expected.Orderbooks)...)
+	failures = append(failures, checkIndex(expected.Index)...)
+	failures = append(failures, checkOpportunities(expected.Opportunities)...)
+	return failures
+}
+
+func closeEnough(a float64, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func checkOrderbooks(expected map[string]map[string]expectedBook) []string {
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+
+	failures := make([]string, 0)
+	for instrument, exchanges := range expected {
+		orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+		if !exists {
+			failures = append(failures, "orderbook "+instrument+" missing")
+			continue
+		}
+		for exchange, want := range exchanges {
+			got := expectedBook{}
+			if bids := orderbook.Bids[exchange]; len(bids) > 0 {
+				got.Bid = bids[0].Price.Float64()
+			}
+			if asks := orderbook.Asks[exchange]; len(asks) > 0 {
+				got.Ask = asks[0].Price.Float64()
+			}
+			if !closeEnough(got.Bid, want.Bid) || !closeEnough(got.Ask, want.Ask) {
+				failures = append(failures, fmt.Sprintf("orderbook %v %v: best %v/%v, expected %v/%v", instrument, exchange, got.Bid, got.Ask, want.Bid, want.Ask))
+			}
+		}
+	}
+	return failures
+}
+
+func checkIndex(expected map[string]map[string]float64) []string {
+	indexes := map[string]*IndexContainer{"aevo": &AevoIndex, "lyra": &LyraIndex}
+
+	failures := make([]string, 0)
+	for exchange, assets := range expected {
+		index, exists := indexes[exchange]
+		if !exists {
+			failures = append(failures, "no index for exchange "+exchange)
+			continue
+		}
+		for asset, want := range assets {
+			if got, _ := index.Get(asset); !closeEnough(got, want) {
+				failures = append(failures, fmt.Sprintf("%v index %v: %v, expected %v", exchange, asset, got, want))
+			}
+		}
+	}
+	return failures
+}
+
+// checkOpportunities requires exactly the expected ArbTables, a spurious opportunity fails as much as a missing one.
+func checkOpportunities(expected map[string]expectedOpportunity) []string {
+	ArbContainer.Mu.RLock()
+	defer ArbContainer.Mu.RUnlock()
+
+	failures := make([]string, 0)
+	for key, want := range expected {
+		table, exists := ArbContainer.ArbTables[key]
+		if !exists {
+			failures = append(failures, "opportunity "+key+" missing")
+			continue
+		}
+		got := expectedOpportunity{table.BidType, table.BidExchange, table.AskExchange, table.AbsProfit}
+		if got.BidType != want.BidType || got.BidExchange != want.BidExchange || got.AskExchange != want.AskExchange || !closeEnough(got.AbsProfit, want.AbsProfit) {
+			failures = append(failures, fmt.Sprintf("opportunity %v: %+v, expected %+v", key, got, want))
+		}
+	}
+
+	unexpected := make([]string, 0)
+	for key := range ArbContainer.ArbTables {
+		if _, exists := expected[key]; !exists {
+			unexpected = append(unexpected, key)
+		}
+	}
+	sort.Strings(unexpected)
+	for _, key := range unexpected {
+		failures = append(failures, "unexpected opportunity "+key)
+	}
+
+	return failures
+}
+
+// TestSelfTest plays every fixture directory under testdata/selftest through mock exchange servers, real WssConns and
+// the full pipeline with fresh state and checks the resulting orderbooks, index and opportunities.
+func TestSelfTest(t *testing.T) {
+	MaxBookAge = 0 //fixtures carry the timestamps they were recorded with
+	dirs, err := filepath.Glob(filepath.Join("testdata", "selftest", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			resetState()
+			failures := runSelfTest(dir, newPipeline(runtime.NumCPU(), 1024)) //not closed, a failed run can leave frames in flight
+			for _, failure := range failures {
+				t.Error(failure)
+			}
+		})
+	}
+}
+
+func resetState() {
+	ExchangeFees = nil
+
+	OrderbookContainer.Mu.Lock()
+	OrderbookContainer.Orderbooks = make(map[string]*OrderbookData)
+	OrderbookContainer.Mu.Unlock()
+
+	ArbContainer.Mu.Lock()
+	ArbContainer.ArbTables = make(map[string]*ArbTable)
+	ArbContainer.Mu.Unlock()
+
+	for _, index := range []*IndexContainer{&AevoIndex, &LyraIndex, &AevoForwards} {
+		index.Mu.Lock()
+		index.Index = make(map[string]float64)
+		index.Mu.Unlock()
+	}
+
+	AevoPerps.Mu.Lock()
+	AevoPerps.Perps = make(map[string]PerpTicker)
+	AevoPerps.Mu.Unlock()
+
+	Breaker.Mu.Lock()
+	Breaker.Quarantined = make(map[string]*Quarantine)
+	Breaker.Indexes = make(map[string]float64) //fixtures' indexes aren't one feed's ticks
+	Breaker.Mu.Unlock()
+}
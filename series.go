@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var SeriesInterval = 10 * time.Second //0 disables the history
+var SeriesRetention = 6 * time.Hour
+
+const markExchange = "aevo-mark"
+
+// seriesSample is compact as a few thousand instruments on five exchanges are kept, about 30KB per instrument and
+// exchange at the defaults.
+type seriesSample struct {
+	Time int64 //unix milliseconds
+	Mark float32
+	Iv   float32 //0 when the book has no IVs
+}
+
+// seriesRing is a fixed capacity ring of samples, oldest overwritten first, like SampleRing.
+type seriesRing struct {
+	samples []seriesSample
+	next    int
+	full    bool
+}
+
+func (r *seriesRing) Add(sample seriesSample) {
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *seriesRing) Len() int {
+	if r.full {
+		return len(r.samples)
+	}
+	return r.next
+}
+
+func (r *seriesRing) at(i int) seriesSample {
+	if !r.full {
+		return r.samples[i]
+	}
+	return r.samples[(r.next+i)%len(r.samples)]
+}
+
+// Since returns samples newer than t in chronological order.
+func (r *seriesRing) Since(t time.Time) []seriesSample {
+	after := t.UnixMilli()
+	n := r.Len()
+	first := n
+	for first > 0 && r.at(first-1).Time > after {
+		first--
+	}
+
+	samples := make([]seriesSample, 0, n-first)
+	for i := first; i < n; i++ {
+		samples = append(samples, r.at(i))
+	}
+	return samples
+}
+
+type SeriesContainer struct {
+	Mu     sync.Mutex
+	Series map[string]*seriesRing //key: exchange + " " + instrument
+}
+
+var Series = SeriesContainer{Series: make(map[string]*seriesRing)}
+
+// bookMark is the mid of the best bid and ask and the mean of their IVs (either one's when the other has none), ok is
+// false unless both sides have a level.
+func bookMark(bids []Order, asks []Order) (float64, float64, bool) {
+	if len(bids) == 0 || len(asks) == 0 || bids[0].Price <= 0 || asks[0].Price <= 0 {
+		return 0, 0, false
+	}
+	iv := 0.0
+	switch {
+	case bids[0].Iv > 0 && asks[0].Iv > 0:
+		iv = (bids[0].Iv + asks[0].Iv) / 2
+	case bids[0].Iv > 0:
+		iv = bids[0].Iv
+	case asks[0].Iv > 0:
+		iv = asks[0].Iv
+	}
+	return (bids[0].Price + asks[0].Price).Float64() / 2, iv, true
+}
+
+func (s *SeriesContainer) add(key string, sample seriesSample, capacity int) {
+	ring, exists := s.Series[key]
+	if !exists {
+		ring = &seriesRing{samples: make([]seriesSample, capacity)}
+		s.Series[key] = ring
+	}
+	ring.Add(sample)
+}
+
+// recordSeries samples every book's mid and IV and aevo's marks (exchange markExchange) at now, and drops the series
+// of instruments that haven't been sampled for SeriesRetention, delisted or expired.
+func recordSeries(now time.Time) {
+	capacity := max(int(SeriesRetention/max(SeriesInterval, time.Second)), 1)
+	ms := now.UnixMilli()
+	orderbooks := OrderbookContainer.Snapshot()
+
+	AevoMarketList.Mu.Lock()
+	marks := make(map[string]seriesSample, len(AevoMarketList.Markets))
+	for instrument, market := range AevoMarketList.Markets {
+		if market.MarkPrice > 0 {
+			marks[instrument] = seriesSample{ms, float32(market.MarkPrice), float32(market.Greeks.Iv)}
+		}
+	}
+	AevoMarketList.Mu.Unlock()
+
+	Series.Mu.Lock()
+	defer Series.Mu.Unlock()
+	for instrument, orderbook := range orderbooks {
+		for exchange, bids := range orderbook.Bids {
+			mark, iv, ok := bookMark(bids, orderbook.Asks[exchange])
+			if ok {
+				Series.add(exchange+" "+instrument, seriesSample{ms, float32(mark), float32(iv)}, capacity)
+			}
+		}
+	}
+	for instrument, sample := range marks {
+		Series.add(markExchange+" "+instrument, sample, capacity)
+	}
+
+	stale := now.Add(-SeriesRetention).UnixMilli()
+	for key, ring := range Series.Series {
+		if ring.Len() > 0 && ring.at(ring.Len()-1).Time < stale {
+			delete(Series.Series, key)
+		}
+	}
+}
+
+// seriesLoop samples the marks every interval.
+func seriesLoop(interval time.Duration) {
+	for {
+		recordSeries(time.Now())
+		time.Sleep(interval)
+	}
+}
+
+// SeriesPoint is a downsampled bucket of samples: the mean mark and IV, and the mark's range so a one sample spike
+// stays visible however far a chart zooms out.
+type SeriesPoint struct {
+	Time    time.Time `json:"time"` //the bucket's last sample
+	Mark    float64   `json:"mark"`
+	MarkMin float64   `json:"mark_min"`
+	MarkMax float64   `json:"mark_max"`
+	Iv      float64   `json:"iv"`      //mean over the samples with an IV, 0 without any
+	Samples int       `json:"samples"` //in the bucket
+}
+
+// downsample buckets samples from since to now into at most points buckets of equal duration, empty buckets left out.
+func downsample(samples []seriesSample, since time.Time, now time.Time, points int) []SeriesPoint {
+	span := now.Sub(since).Milliseconds()
+	if len(samples) == 0 || points <= 0 || span <= 0 {
+		return []SeriesPoint{}
+	}
+
+	downsampled := make([]SeriesPoint, 0, min(points, len(samples)))
+	bucket := -1
+	ivs := 0
+	for _, sample := range samples {
+		i := min(int((sample.Time-since.UnixMilli())*int64(points)/span), points-1)
+		mark, iv := float64(sample.Mark), float64(sample.Iv)
+		if i != bucket {
+			if len(downsampled) > 0 {
+				finishPoint(&downsampled[len(downsampled)-1], ivs)
+			}
+			downsampled = append(downsampled, SeriesPoint{MarkMin: mark, MarkMax: mark})
+			bucket, ivs = i, 0
+		}
+		point := &downsampled[len(downsampled)-1]
+		point.Time = time.UnixMilli(sample.Time)
+		point.Mark += mark
+		point.MarkMin = math.Min(point.MarkMin, mark)
+		point.MarkMax = math.Max(point.MarkMax, mark)
+		if iv > 0 {
+			point.Iv += iv
+			ivs++
+		}
+		point.Samples++
+	}
+	finishPoint(&downsampled[len(downsampled)-1], ivs)
+	return downsampled
+}
+
+// finishPoint turns a bucket's sums into means.
+func finishPoint(point *SeriesPoint, ivs int) {
+	point.Mark /= float64(point.Samples)
+	if ivs > 0 {
+		point.Iv /= float64(ivs)
+	}
+}
+
+type instrumentSeries struct {
+	Exchange string        `json:"exchange"`
+	Points   []SeriesPoint `json:"points"`
+}
+
+// seriesRequest returns the downsampled series of ?instrument= on every exchange with history, or ?exchange=, over
+// ?window= (default 1h, at most SeriesRetention) in at most ?points= (default 300) points per exchange.
+func seriesRequest(r *http.Request, now time.Time) (string, time.Time, []instrumentSeries, error) {
+	query := r.URL.Query()
+	instrument := strings.ToUpper(strings.TrimSpace(query.Get("instrument")))
+	if _, err := parseInstrument(instrument); err != nil {
+		return "", time.Time{}, nil, fmt.Errorf("instrument: %v", err)
+	}
+	window := time.Hour
+	if raw := query.Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return "", time.Time{}, nil, fmt.Errorf("window: not a positive duration: %v", raw)
+		}
+		window = min(parsed, SeriesRetention)
+	}
+	points := 300
+	if raw := query.Get("points"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return "", time.Time{}, nil, fmt.Errorf("points: not a positive integer: %v", raw)
+		}
+		points = parsed
+	}
+	filter := query.Get("exchange")
+	since := now.Add(-window)
+
+	series := make([]instrumentSeries, 0)
+	Series.Mu.Lock()
+	for key, ring := range Series.Series {
+		exchange, name, _ := strings.Cut(key, " ")
+		if name == instrument && (filter == "" || exchange == filter) {
+			series = append(series, instrumentSeries{exchange, downsample(ring.Since(since), since, now, points)})
+		}
+	}
+	Series.Mu.Unlock()
+	sort.Slice(series, func(i, j int) bool { return series[i].Exchange < series[j].Exchange })
+	return instrument, since, series, nil
+}
+
+// seriesHandler serves /api/series?instrument=ETH-28JUN24-3000-C, the instrument's mark and IV history per exchange.
+func seriesHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	instrument, since, series, err := seriesRequest(r, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, "seriesHandler", struct {
+		Instrument string             `json:"instrument"`
+		From       time.Time          `json:"from"`
+		To         time.Time          `json:"to"`
+		Interval   string             `json:"interval"`
+		Series     []instrumentSeries `json:"series"`
+	}{instrument, since, now, SeriesInterval.String(), series})
+}
+
+func serveSeries(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/series.html"))
+	tmpl.Execute(w, nil)
+}
+
+var seriesColors = [...]string{"#1f77b4", "#d62728", "#2ca02c", "#9467bd", "#ff7f0e", "#8c564b"}
+
+const chartWidth, chartHeight = 800, 240
+
+// seriesPolylines renders one svg chart of value over from..to, a line per exchange.
+func seriesPolylines(title string, series []instrumentSeries, value func(SeriesPoint) float64, from time.Time, to time.Time) string {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, point := range s.Points {
+			if v := value(point); v > 0 {
+				low, high = math.Min(low, v), math.Max(high, v)
+			}
+		}
+	}
+	if math.IsInf(low, 1) {
+		return fmt.Sprintf("<p>%s: no samples</p>", title)
+	}
+	if high == low {
+		high, low = high+1, low-1
+	}
+
+	span := float64(to.Sub(from))
+	chart := fmt.Sprintf(`<svg width="%d" height="%d" style="border: 1px solid rgb(0, 0, 0)"><text x="4" y="14">%s %s - %s</text>`,
+		chartWidth, chartHeight, title, strconv.FormatFloat(low, 'f', 2, 64), strconv.FormatFloat(high, 'f', 2, 64))
+	for i, s := range series {
+		coordinates := make([]string, 0, len(s.Points))
+		for _, point := range s.Points {
+			v := value(point)
+			if v <= 0 {
+				continue
+			}
+			x := float64(point.Time.Sub(from)) / span * chartWidth
+			y := (1-(v-low)/(high-low))*(chartHeight-24) + 20
+			coordinates = append(coordinates, strconv.FormatFloat(x, 'f', 1, 64)+","+strconv.FormatFloat(y, 'f', 1, 64))
+		}
+		chart += fmt.Sprintf(`<polyline fill="none" stroke="%s" points="%s" />`, seriesColors[i%len(seriesColors)], strings.Join(coordinates, " "))
+	}
+	return chart + "</svg>"
+}
+
+// seriesChartHandler renders the mark and IV charts of the form on /series for htmx.
+func seriesChartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("instrument") == "" {
+		fmt.Fprint(w, "<p>enter an instrument</p>")
+		return
+	}
+	now := time.Now()
+	instrument, since, series, err := seriesRequest(r, now)
+	if err != nil {
+		fmt.Fprintf(w, "<p>%s</p>", template.HTMLEscapeString(err.Error()))
+		return
+	}
+	if len(series) == 0 {
+		fmt.Fprintf(w, "<p>no history of %s</p>", template.HTMLEscapeString(instrument))
+		return
+	}
+
+	legend := ""
+	for i, s := range series {
+		legend += fmt.Sprintf(`<span style="color: %s">%s</span> `, seriesColors[i%len(seriesColors)], s.Exchange)
+	}
+	fmt.Fprint(w, "<p>"+legend+"</p>")
+	fmt.Fprint(w, seriesPolylines("Mark", series, func(point SeriesPoint) float64 { return point.Mark }, since, now))
+	fmt.Fprint(w, seriesPolylines("IV", series, func(point SeriesPoint) float64 { return point.Iv }, since, now))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"log/slog"
+)
+
+var WssConnections = 1                        //connections per exchange
+var WssExchangeConnections = map[string]int{} //per exchange overrides of WssConnections
+
+// connectionsFor is the number of connections exchange's channels are spread over.
+func connectionsFor(exchange string) int {
+	if n, exists := WssExchangeConnections[exchange]; exists && n > 0 {
+		return n
+	}
+	return max(WssConnections, 1)
+}
+
+// ShardedConn is an exchange's connections, a channel is subscribed on Shards[hash(channel) % len(Shards)] so it's
+// resubscribed and unsubscribed on the connection it was subscribed on. Batch acknowledgements (batchAcks) are matched
+// across shards in send order, a rejection may be attributed to another shard's batch.
+type ShardedConn struct {
+	Exchange string
+	Shards   []*WssConn
+}
+
+// newShardedConn builds n unconnected connections to url, configure and Connect each of the Shards.
+func newShardedConn(exchange string, url string, subscribeJson func(channels []string) []byte, n int) *ShardedConn {
+	s := &ShardedConn{Exchange: exchange, Shards: make([]*WssConn, max(n, 1))}
+	for i := range s.Shards {
+		s.Shards[i] = newWssConn(exchange, url, subscribeJson)
+		s.Shards[i].Shard = i
+	}
+	return s
+}
+
+func (s *ShardedConn) shard(channel string) *WssConn {
+	if len(s.Shards) == 1 {
+		return s.Shards[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(channel))
+	return s.Shards[h.Sum32()%uint32(len(s.Shards))]
+}
+
+// split groups channels by the shard they go to, in their order.
+func (s *ShardedConn) split(channels []string) map[*WssConn][]string {
+	shards := make(map[*WssConn][]string, len(s.Shards))
+	for _, channel := range channels {
+		c := s.shard(channel)
+		shards[c] = append(shards[c], channel)
+	}
+	return shards
+}
+
+// Subscribe subscribes each channel on its shard, a failing shard doesn't stop the others.
+func (s *ShardedConn) Subscribe(channels []string) error {
+	var errs []error
+	for c, shardChannels := range s.split(channels) {
+		errs = append(errs, c.Subscribe(shardChannels))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ShardedConn) Resubscribe(channels []string) error {
+	var errs []error
+	for c, shardChannels := range s.split(channels) {
+		errs = append(errs, c.Resubscribe(shardChannels))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ShardedConn) Unsubscribe(channels []string) error {
+	var errs []error
+	for c, shardChannels := range s.split(channels) {
+		errs = append(errs, c.Unsubscribe(shardChannels))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ShardedConn) Close() {
+	for _, c := range s.Shards {
+		c.Close()
+	}
+}
+
+// logShards reports how an exchange's channels are spread, once its first markets are subscribed.
+func (s *ShardedConn) logShards() {
+	if len(s.Shards) == 1 {
+		return
+	}
+	counts := make([]int, len(s.Shards))
+	for i, c := range s.Shards {
+		counts[i], _ = c.Subscribed()
+	}
+	slog.Info("exchangeReqLoop: channels per connection", "exchange", s.Exchange, "channels", counts)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"sync"
+
+	"options-ws/aevo"
+	"options-ws/decimal"
+)
+
+// InstrumentLimits are per order limits published by the exchange, zero means unknown/unlimited.
+type InstrumentLimits struct {
+	MaxAmount     float64 //contracts
+	MaxOrderValue float64 //premium, price * amount
+	MaxNotional   float64 //index * amount
+
+	PriceStep     decimal.Decimal //tick, see steps.go
+	AmountStep    decimal.Decimal
+	MinAmount     float64 //contracts
+	MinOrderValue float64 //premium, price * amount
+}
+
+type LimitsContainer struct {
+	Mu     sync.Mutex
+	Limits map[string]InstrumentLimits //key: exchange + " " + normalized instrument, e.g. "aevo ETH-02JAN06-3000-C"
+}
+
+var InstrumentLimitsContainer = LimitsContainer{Limits: make(map[string]InstrumentLimits)}
+
+var AvailableMargin float64 //capital available per opportunity, 0 is unlimited
+var MinEdge float64         //minimum profit per contract required for a level to count towards suggested size
+
+func aevoUpdateLimits(markets []aevo.Market) {
+	InstrumentLimitsContainer.Mu.Lock()
+	defer InstrumentLimitsContainer.Mu.Unlock()
+
+	for _, market := range markets {
+		InstrumentLimitsContainer.Limits["aevo "+market.InstrumentName] = InstrumentLimits{
+			MaxOrderValue: market.MaxOrderValue,
+			MaxNotional:   market.MaxNotionalValue,
+			PriceStep:     market.PriceStep,
+			AmountStep:    market.AmountStep,
+			MinOrderValue: market.MinOrderValue,
+		}
+	}
+}
+
+func lyraUpdateLimits(markets []lyraMarket) {
+	InstrumentLimitsContainer.Mu.Lock()
+	defer InstrumentLimitsContainer.Mu.Unlock()
+
+	for _, market := range markets {
+		instrument, err := lyraNormalizeInstrument(market.InstrumentName)
+		if err != nil {
+			continue
+		}
+
+		InstrumentLimitsContainer.Limits["lyra "+instrument] = InstrumentLimits{
+			MaxAmount:  market.MaximumAmount,
+			PriceStep:  market.TickSize,
+			AmountStep: market.AmountStep,
+			MinAmount:  market.MinimumAmount,
+		}
+	}
+}
+
+// legProfit is the per contract profit after fees of selling at bid and buying at ask for an ArbTable's leg types,
+// against the table's Forward when set.
+func legProfit(table *ArbTable, bid float64, ask float64, index float64) float64 {
+	fees := tradeFee(table.BidExchange, bid, index, true) + tradeFee(table.AskExchange, ask, index, true)
+	forward := index
+	if table.Forward > 0 {
+		forward = table.Forward
+	}
+	if table.BidType == "C" { //sell call, buy put, long underlying
+		return (bid + table.Strike) - (ask + forward) - fees
+	}
+	return (bid + forward) - (ask + table.Strike) - fees //sell put, buy call, short underlying
+}
+
+// depthFill walks both legs' levels and returns the contracts executable while each matched pair of levels still
+// makes at least minEdge per contract, and the total profit of executing them.
+func depthFill(table *ArbTable, index float64, minEdge float64) (float64, float64) {
+	size, profit := 0.0, 0.0
+	bidLevel, askLevel := 0, 0
+	bidLeft, askLeft := 0.0, 0.0
+	if len(table.Bids) > 0 && len(table.Asks) > 0 {
+		bidLeft, askLeft = table.Bids[0].Amount, table.Asks[0].Amount
+	}
+
+	for bidLevel < len(table.Bids) && askLevel < len(table.Asks) {
+		edge := legProfit(table, table.Bids[bidLevel].Price.Float64(), table.Asks[askLevel].Price.Float64(), index)
+		if edge < minEdge {
+			break
+		}
+
+		fill := math.Min(bidLeft, askLeft)
+		size += fill
+		profit += fill * edge
+		bidLeft -= fill
+		askLeft -= fill
+
+		if bidLeft <= 0 {
+			bidLevel++
+			if bidLevel < len(table.Bids) {
+				bidLeft = table.Bids[bidLevel].Amount
+			}
+		}
+		if askLeft <= 0 {
+			askLevel++
+			if askLevel < len(table.Asks) {
+				askLeft = table.Asks[askLevel].Amount
+			}
+		}
+	}
+
+	return size, profit
+}
+
+func legLimit(exchange string, instrument string, price float64, index float64) float64 {
+	InstrumentLimitsContainer.Mu.Lock()
+	limits, exists := InstrumentLimitsContainer.Limits[exchange+" "+instrument]
+	InstrumentLimitsContainer.Mu.Unlock()
+
+	limit := math.Inf(1)
+	if !exists {
+		return limit
+	}
+	if limits.MaxAmount > 0 {
+		limit = math.Min(limit, limits.MaxAmount)
+	}
+	if limits.MaxOrderValue > 0 && price > 0 {
+		limit = math.Min(limit, limits.MaxOrderValue/price)
+	}
+	if limits.MaxNotional > 0 && index > 0 {
+		limit = math.Min(limit, limits.MaxNotional/index)
+	}
+
+	return limit
+}
+
+// suggestSize fills ExecutableSize/VwapProfit from every profitable level pair, and SuggestedSize/SuggestedNotional
+// with the smallest of the depth at MinEdge, both legs' exchange order limits and what AvailableMargin can fund rounded
+// down to the legs' amount steps, SizeLimit names the binding constraint.
+func suggestSize(table *ArbTable, key string, index float64) {
+	executable, profit := depthFill(table, index, 0)
+	table.ExecutableSize = executable
+	table.VwapProfit = 0
+	if executable > 0 {
+		table.VwapProfit = profit / executable
+	}
+
+	size, _ := depthFill(table, index, MinEdge)
+	table.SizeLimit = "depth"
+
+	bidLimit := legLimit(table.BidExchange, key+"-"+table.BidType, table.Bids[0].Price.Float64(), index)
+	askLimit := legLimit(table.AskExchange, key+"-"+table.AskType, table.Asks[0].Price.Float64(), index)
+	if limit := math.Min(bidLimit, askLimit); limit < size {
+		size = limit
+		table.SizeLimit = "order limit"
+	}
+
+	if AvailableMargin > 0 {
+		if limit := AvailableMargin / table.Capital; limit < size {
+			size = limit
+			table.SizeLimit = "margin"
+		}
+	}
+
+	size = legAmount(table, key, size)
+	table.SuggestedSize = size
+	table.SuggestedNotional = size * index
+}
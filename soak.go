@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// soakGenerator produces synthetic aevo and lyra frames for a fixed chain of ETH options around a random walk index.
+type soakGenerator struct {
+	rng         *rand.Rand
+	index       float64
+	expiries    []time.Time
+	strikes     []float64
+	sequence    int64
+	instruments int
+}
+
+func newSoakGenerator(instruments int) *soakGenerator {
+	g := &soakGenerator{
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		index: 3000,
+	}
+
+	now := time.Now().UTC()
+	for i := 1; i <= 4; i++ {
+		g.expiries = append(g.expiries, time.Date(now.Year(), now.Month(), now.Day(), 8, 0, 0, 0, time.UTC).AddDate(0, 0, 7*i))
+	}
+	strikeCount := instruments / (2 * len(g.expiries))
+	if strikeCount < 1 {
+		strikeCount = 1
+	}
+	for i := 0; i < strikeCount; i++ {
+		g.strikes = append(g.strikes, 2000+float64(i)*50)
+	}
+	g.instruments = strikeCount * len(g.expiries) * 2
+
+	return g
+}
+
+func (g *soakGenerator) price(strike float64, expiry time.Time, optionType string) float64 {
+	days := time.Until(expiry).Hours() / 24
+	timeValue := g.index * 0.6 * math.Sqrt(days/365) * 0.4 * math.Exp(-math.Abs(g.index-strike)/(g.index*0.2))
+	intrinsic := g.index - strike
+	if optionType == "P" {
+		intrinsic = -intrinsic
+	}
+
+	return math.Max(intrinsic, 0) + timeValue + 0.1
+}
+
+func (g *soakGenerator) levels(mid float64, side float64, withIv bool) [][]string {
+	depth := 1 + g.rng.Intn(10)
+	levels := make([][]string, depth)
+	for i := range levels {
+		p := mid * (1 + side*(0.01+0.005*float64(i)+g.rng.Float64()*0.01))
+		level := []string{strconv.FormatFloat(p, 'f', 2, 64), strconv.FormatFloat(0.1+g.rng.Float64()*20, 'f', 2, 64)}
+		if withIv {
+			level = append(level, strconv.FormatFloat(0.4+g.rng.Float64()*0.4, 'f', 4, 64))
+		}
+		levels[i] = level
+	}
+
+	return levels
+}
+
+// next returns the exchange name and raw frame of the next synthetic message.
+func (g *soakGenerator) next() (string, []byte) {
+	g.sequence++
+	now := time.Now()
+
+	if g.rng.Intn(50) == 0 {
+		g.index *= 1 + (g.rng.Float64()-0.5)*0.002
+		if g.rng.Intn(2) == 0 {
+			data, _ := json.Marshal(map[string]interface{}{
+				"channel": "index:ETH",
+				"data":    map[string]string{"price": strconv.FormatFloat(g.index, 'f', 2, 64), "timestamp": strconv.FormatInt(now.UnixNano(), 10)},
+			})
+			return "aevo", data
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"method": "subscription",
+			"params": map[string]interface{}{
+				"channel": "spot_feed.ETH",
+				"data":    map[string]interface{}{"timestamp": now.UnixMilli(), "feeds": map[string]interface{}{"ETH": map[string]string{"price": strconv.FormatFloat(g.index, 'f', 2, 64)}}},
+			},
+		})
+		return "lyra", data
+	}
+
+	expiry := g.expiries[g.rng.Intn(len(g.expiries))]
+	strike := g.strikes[g.rng.Intn(len(g.strikes))]
+	optionType := "C"
+	if g.rng.Intn(2) == 0 {
+		optionType = "P"
+	}
+	mid := g.price(strike, expiry, optionType)
+	strikeStr := strconv.FormatFloat(strike, 'f', 0, 64)
+
+	if g.rng.Intn(2) == 0 {
+		instrument := "ETH-" + strings.ToUpper(expiry.Format("02Jan06")) + "-" + strikeStr + "-" + optionType
+		data, _ := json.Marshal(map[string]interface{}{
+			"channel": "orderbook:" + instrument,
+			"data": map[string]interface{}{
+				"type":            "snapshot",
+				"instrument_name": instrument,
+				"bids":            g.levels(mid, -1, true),
+				"asks":            g.levels(mid, 1, true),
+				"last_updated":    strconv.FormatInt(now.UnixNano(), 10),
+			},
+		})
+		return "aevo", data
+	}
+
+	instrument := "ETH-" + expiry.Format("20060102") + "-" + strikeStr + "-" + optionType
+	data, _ := json.Marshal(map[string]interface{}{
+		"method": "subscription",
+		"params": map[string]interface{}{
+			"channel": "orderbook." + instrument + ".10.10",
+			"data": map[string]interface{}{
+				"instrument_name": instrument,
+				"bids":            g.levels(mid, -1, false),
+				"asks":            g.levels(mid, 1, false),
+				"timestamp":       now.UnixMilli(),
+			},
+		},
+	})
+	return "lyra", data
+}
+
+// runSoak feeds synthetic traffic at rate messages/sec through the pipeline for duration, periodically reporting
+// heap, goroutine and store sizes. If no message is processed for a whole report interval the goroutine stacks
+// are dumped and the process exits, since the pipeline is presumed deadlocked.
+func runSoak(duration time.Duration, rate int, instruments int, pipeline *Pipeline) {
+	if rate <= 0 {
+		log.Fatalf("runSoak: rate must be positive: %v", rate)
+	}
+
+	gen := newSoakGenerator(instruments)
+	fmt.Printf("Soak: %v at %v msg/s over %v instruments\n\n", duration, rate, gen.instruments)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer pipeline.Close()
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		deadline := time.Now().Add(duration)
+		carry := 0.0
+		for now := range tick.C {
+			if now.After(deadline) {
+				return
+			}
+			carry += float64(rate) / 100
+			for ; carry >= 1; carry-- {
+				pipeline.Submit(gen.next())
+			}
+		}
+	}()
+
+	report := time.NewTicker(10 * time.Second)
+	defer report.Stop()
+	start := time.Now()
+	var last int64
+	var baseHeap uint64
+	for {
+		select {
+		case <-done:
+			soakReport(start, pipeline.Processed.Load(), baseHeap)
+			fmt.Printf("Soak finished\n\n")
+			return
+		case <-report.C:
+			count := pipeline.Processed.Load()
+			if count == last {
+				slog.Error("runSoak: no messages processed in the last interval, dumping goroutines")
+				pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+				os.Exit(1)
+			}
+			last = count
+			heap := soakReport(start, count, baseHeap)
+			if baseHeap == 0 {
+				baseHeap = heap
+			}
+		}
+	}
+}
+
+func soakReport(start time.Time, processed int64, baseHeap uint64) uint64 {
+	var mem runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&mem)
+
+	ArbContainer.Mu.RLock()
+	arbs := len(ArbContainer.ArbTables)
+	ArbContainer.Mu.RUnlock()
+	OrderbookContainer.Mu.RLock()
+	orderbooks := len(OrderbookContainer.Orderbooks)
+	OrderbookContainer.Mu.RUnlock()
+
+	growth := 0.0 //percent since the first report
+	if baseHeap > 0 {
+		growth = (float64(mem.HeapAlloc)/float64(baseHeap) - 1) * 100
+	}
+
+	gcs := mem.NumGC - mem.NumForcedGC //the collections the traffic caused, not the reports'
+	gcPer1000 := 0.0
+	if processed > 0 {
+		gcPer1000 = float64(gcs) * 1000 / float64(processed)
+	}
+
+	elapsed := time.Since(start)
+	slog.Info("soak: report", "elapsed", elapsed.Round(time.Second), "processed", processed, "msg_per_sec", float64(processed)/elapsed.Seconds(),
+		"heap_kb", mem.HeapAlloc/1024, "heap_growth_pct", growth, "gc_cycles", gcs, "gc_per_1000_msgs", gcPer1000,
+		"gc_pause_ms", time.Duration(mem.PauseTotalNs).Milliseconds(), "goroutines", runtime.NumGoroutine(), "orderbooks", orderbooks, "arb_tables", arbs)
+
+	return mem.HeapAlloc
+}
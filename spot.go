@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ExternalSpot holds the median of the CEX spot prices per asset.
+var ExternalSpot = IndexContainer{Index: make(map[string]float64)}
+
+var spotClient = &http.Client{Timeout: 5 * time.Second}
+
+type spotSource struct {
+	Name  string
+	Fetch func(asset string) (float64, error)
+}
+
+var spotSources = []spotSource{
+	{"binance", binanceSpot},
+	{"coinbase", coinbaseSpot},
+	{"kraken", krakenSpot},
+}
+
+func getJson(url string, v interface{}) error {
+	res, err := spotClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("request error: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %v", res.Status)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("json decode error: %v", err)
+	}
+
+	return nil
+}
+
+func binanceSpot(asset string) (float64, error) {
+	var ticker struct {
+		Price float64 `json:"price,string"`
+	}
+	err := getJson("https://api.binance.com/api/v3/ticker/price?symbol="+asset+"USDT", &ticker)
+	return ticker.Price, err
+}
+
+func coinbaseSpot(asset string) (float64, error) {
+	var spot struct {
+		Data struct {
+			Amount float64 `json:"amount,string"`
+		} `json:"data"`
+	}
+	err := getJson("https://api.coinbase.com/v2/prices/"+asset+"-USD/spot", &spot)
+	return spot.Data.Amount, err
+}
+
+func krakenSpot(asset string) (float64, error) {
+	var ticker struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Close []string `json:"c"`
+		} `json:"result"`
+	}
+	err := getJson("https://api.kraken.com/0/public/Ticker?pair="+asset+"USD", &ticker)
+	if err != nil {
+		return 0, err
+	}
+	if len(ticker.Error) > 0 {
+		return 0, fmt.Errorf("kraken error: %v", ticker.Error)
+	}
+
+	for _, pair := range ticker.Result { //result is keyed by kraken's own pair name, e.g. XETHZUSD
+		if len(pair.Close) > 0 {
+			return strconv.ParseFloat(pair.Close[0], 64)
+		}
+	}
+	return 0, fmt.Errorf("kraken: no ticker in response")
+}
+
+// externalSpot fetches every source and returns the median of the ones that answered.
+func externalSpot(asset string) (float64, int) {
+	prices := make([]float64, 0, len(spotSources))
+	for _, source := range spotSources {
+		price, err := source.Fetch(asset)
+		if err != nil || price <= 0 {
+			slog.Warn("externalSpot: request failed", "source", source.Name, "asset", asset, "err", err)
+			continue
+		}
+		prices = append(prices, price)
+	}
+	if len(prices) == 0 {
+		return 0, 0
+	}
+
+	sort.Float64s(prices)
+	mid := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[mid-1] + prices[mid]) / 2, len(prices)
+	}
+	return prices[mid], len(prices)
+}
+
+// spotDeviationLoop polls external spot and alerts once when the aevo index deviates from it by more than threshold
+// percent, and again when it returns within threshold.
+func spotDeviationLoop(asset string, threshold float64, interval time.Duration) {
+	alerting := false
+	for {
+		spot, sources := externalSpot(asset)
+		if sources > 0 {
+			ExternalSpot.Mu.Lock()
+			ExternalSpot.Index[asset] = spot
+			ExternalSpot.Mu.Unlock()
+
+			index, _ := AevoIndex.Get(asset)
+
+			if index > 0 {
+				deviation := (index - spot) / spot * 100
+				if math.Abs(deviation) > threshold && !alerting {
+					slog.Warn("SPOT ALERT: aevo index deviates from external spot", "asset", asset, "index", index, "deviation_pct", deviation, "spot", spot, "sources", sources)
+					alerting = true
+				} else if math.Abs(deviation) <= threshold && alerting {
+					slog.Info("SPOT ALERT: aevo index back within threshold of external spot", "asset", asset, "index", index, "threshold_pct", threshold, "spot", spot)
+					alerting = false
+				}
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
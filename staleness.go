@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+var MaxBookAge time.Duration //sides older than this are skipped by arb passes, 0 disables the staleness check
+
+// ExchangeLag is how far processing runs behind an exchange's feed, from its timestamps to the messages being applied.
+type ExchangeLag struct {
+	Last    time.Duration
+	Average time.Duration //exponentially weighted over recent messages
+	Max     time.Duration //within the current lagWindow
+	Samples int64
+	Offset  time.Duration    //estimated clock offset, the smallest lag of the last lagWindow, see latency.go
+	Feed    latencyHistogram //lags net of Offset
+
+	windowStart time.Time
+	windowMin   time.Duration
+}
+
+type ExchangeLagsContainer struct {
+	Mu   sync.Mutex
+	Lags map[string]*ExchangeLag //key: exchange
+}
+
+var LagContainer = ExchangeLagsContainer{Lags: make(map[string]*ExchangeLag)}
+
+const lagWindow = time.Minute
+
+// markBookUpdated stamps exchange's side of orderbook with the exchange's timestamp of the message just applied and
+// records its lag, its best prices' lifetimes and whether it's crossed, the side is websocket sourced again. Callers
+// hold OrderbookContainer.Mu.
+func markBookUpdated(orderbook *OrderbookData, exchange string, exchangeTime time.Time) {
+	if orderbook.Timestamps == nil {
+		orderbook.Timestamps = make(map[string]time.Time)
+	}
+	orderbook.Timestamps[exchange] = exchangeTime
+	delete(orderbook.RestSourced, exchange)
+	trackQuoteLives(orderbook, exchange, exchangeTime)
+	trackCrossed(orderbook, exchange, exchangeTime)
+	trackBookMetrics(orderbook, exchange)
+	recordLag(exchange, time.Since(exchangeTime))
+}
+
+func recordLag(exchange string, lag time.Duration) {
+	now := time.Now()
+
+	LagContainer.Mu.Lock()
+	defer LagContainer.Mu.Unlock()
+
+	stats, exists := LagContainer.Lags[exchange]
+	if !exists {
+		stats = &ExchangeLag{Average: lag, Offset: lag, windowStart: now, windowMin: lag}
+		LagContainer.Lags[exchange] = stats
+	}
+	if now.Sub(stats.windowStart) >= lagWindow {
+		stats.Offset = stats.windowMin //the whole window's minimum replaces the running one
+		stats.Max, stats.windowStart, stats.windowMin = 0, now, lag
+	}
+	stats.Last = lag
+	stats.Average += (lag - stats.Average) / 20
+	stats.Max = max(stats.Max, lag)
+	stats.Samples++
+	stats.windowMin = min(stats.windowMin, lag)
+	stats.Offset = min(stats.Offset, lag)
+	stats.Feed.Add(lag - stats.Offset)
+}
+
+// bookStale reports whether exchange's side of orderbook is older than MaxBookAge at now. Sides without a timestamp
+// (set directly, e.g. by tests or REST snapshots) are never stale.
+func bookStale(orderbook *OrderbookData, exchange string, now time.Time) bool {
+	if MaxBookAge <= 0 {
+		return false
+	}
+	updated, exists := orderbook.Timestamps[exchange]
+	return exists && now.Sub(updated) > MaxBookAge
+}
+
+type lagStatusJson struct {
+	LastMs    float64 `json:"last_ms"`
+	AverageMs float64 `json:"average_ms"`
+	MaxMs     float64 `json:"max_ms"` //within the last minute or so
+	Samples   int64   `json:"samples"`
+	OffsetMs  float64 `json:"clock_offset_ms"` //estimated, see latency.go
+	FeedP99Ms float64 `json:"feed_p99_ms"`     //net of the clock offset
+	Stale     int     `json:"stale_books"`     //book sides arb passes currently skip
+}
+
+// lagStatus reports each exchange's lag and how many of its book sides are stale at now.
+func lagStatus(now time.Time) map[string]lagStatusJson {
+	status := make(map[string]lagStatusJson)
+	LagContainer.Mu.Lock()
+	for exchange, lag := range LagContainer.Lags {
+		status[exchange] = lagStatusJson{
+			LastMs:    float64(lag.Last) / float64(time.Millisecond),
+			AverageMs: float64(lag.Average) / float64(time.Millisecond),
+			MaxMs:     float64(lag.Max) / float64(time.Millisecond),
+			Samples:   lag.Samples,
+			OffsetMs:  milliseconds(lag.Offset),
+			FeedP99Ms: milliseconds(lag.Feed.Quantile(0.99)),
+		}
+	}
+	LagContainer.Mu.Unlock()
+
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+	for _, orderbook := range OrderbookContainer.Orderbooks {
+		for exchange := range orderbook.Timestamps {
+			if bookStale(orderbook, exchange, now) {
+				lag := status[exchange]
+				lag.Stale++
+				status[exchange] = lag
+			}
+		}
+	}
+	return status
+}
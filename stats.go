@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const statsRateWindow = 10 * time.Second
+
+type ChannelStats struct {
+	Exchange    string
+	Channel     string
+	Updates     int64
+	Bytes       int64
+	Conflated   int64 //updates replaced by a newer one before an arb pass saw them
+	Resyncs     int64 //snapshots requested after a sequence gap
+	Mismatches  int64 //books whose checksum didn't match the exchange's
+	FirstUpdate time.Time
+	LastUpdate  time.Time
+	Processing  latencyHistogram //from the frame being read to it being processed
+
+	rate          float64
+	windowStart   time.Time
+	windowUpdates int64
+	generation    int64
+	slowWarned    time.Time
+}
+
+type ChannelStatsContainer struct {
+	Mu            sync.Mutex
+	Stats         map[string]*ChannelStats //key: exchange + " " + channel
+	ArbGeneration int64                    //incremented at the start of every arb pass
+}
+
+var StatsContainer = ChannelStatsContainer{Stats: make(map[string]*ChannelStats)}
+
+// recordChannelUpdate records a frame of size bytes on channel, read at received (zero if unknown) and processed now.
+func recordChannelUpdate(exchange string, channel []byte, size int, received time.Time) {
+	if len(channel) == 0 {
+		return
+	}
+	now := time.Now()
+
+	StatsContainer.Mu.Lock()
+	defer StatsContainer.Mu.Unlock()
+
+	var buf [128]byte
+	key := appendVenueKey(buf[:0], exchange, channel)
+	stats, exists := StatsContainer.Stats[string(key)]
+	if !exists {
+		stats = &ChannelStats{Exchange: exchange, Channel: string(channel), FirstUpdate: now, windowStart: now}
+		StatsContainer.Stats[string(key)] = stats
+	} else if stats.generation == StatsContainer.ArbGeneration {
+		stats.Conflated++
+	}
+
+	stats.Updates++
+	stats.Bytes += int64(size)
+	stats.LastUpdate = now
+	stats.generation = StatsContainer.ArbGeneration
+
+	stats.windowUpdates++
+	if elapsed := now.Sub(stats.windowStart); elapsed >= statsRateWindow {
+		stats.rate = float64(stats.windowUpdates) / elapsed.Seconds()
+		stats.windowStart = now
+		stats.windowUpdates = 0
+	}
+
+	if received.IsZero() {
+		return
+	}
+	latency := now.Sub(received)
+	stats.Processing.Add(latency)
+	if MaxProcessingLatency > 0 && latency > MaxProcessingLatency && now.Sub(stats.slowWarned) >= latencyWarnEvery {
+		stats.slowWarned = now
+		warnSlowProcessing(exchange, stats.Channel, latency)
+	}
+}
+
+func recordResync(exchange string, channel string) {
+	now := time.Now()
+
+	StatsContainer.Mu.Lock()
+	defer StatsContainer.Mu.Unlock()
+
+	key := exchange + " " + channel
+	stats, exists := StatsContainer.Stats[key]
+	if !exists {
+		stats = &ChannelStats{Exchange: exchange, Channel: channel, FirstUpdate: now, windowStart: now}
+		StatsContainer.Stats[key] = stats
+	}
+	stats.Resyncs++
+}
+
+func recordChecksumMismatch(exchange string, channel string) {
+	now := time.Now()
+
+	StatsContainer.Mu.Lock()
+	defer StatsContainer.Mu.Unlock()
+
+	key := exchange + " " + channel
+	stats, exists := StatsContainer.Stats[key]
+	if !exists {
+		stats = &ChannelStats{Exchange: exchange, Channel: channel, FirstUpdate: now, windowStart: now}
+		StatsContainer.Stats[key] = stats
+	}
+	stats.Mismatches++
+}
+
+func nextArbGeneration() {
+	StatsContainer.Mu.Lock()
+	StatsContainer.ArbGeneration++
+	StatsContainer.Mu.Unlock()
+}
+
+type channelStatsJson struct {
+	Exchange      string    `json:"exchange"`
+	Channel       string    `json:"channel"`
+	Updates       int64     `json:"updates"`
+	UpdatesPerSec float64   `json:"updates_per_sec"`
+	LastUpdate    time.Time `json:"last_update"`
+	AgeSeconds    float64   `json:"age_seconds"`
+	AvgSize       float64   `json:"avg_size"`
+	Conflated     int64     `json:"conflated"`
+	Resyncs       int64     `json:"resyncs"`
+	Mismatches    int64     `json:"checksum_mismatches"`
+	ProcessingP99 float64   `json:"processing_p99_ms"`
+}
+
+type connectionStatusJson struct {
+	Exchange   string `json:"exchange"`
+	Shard      int    `json:"shard"`
+	Requested  int    `json:"requested_channels"`
+	Subscribed int    `json:"subscribed_channels"`
+	Reconnects int    `json:"reconnects"`
+	Stale      int    `json:"stale"`
+}
+
+type statusJson struct {
+	Processed   int64                             `json:"processed"`
+	Unrouted    int64                             `json:"unrouted"` //frames of assets no pipeline routes, e.g. removed ones
+	Pipelines   map[string]PipelineStatus         `json:"pipelines"`
+	Lag         map[string]lagStatusJson          `json:"lag"` //by exchange, from the exchange's timestamp to the book being updated
+	Persisted   int64                             `json:"persisted"`
+	Dropped     int64                             `json:"persist_dropped"` //records the database queue had no room for
+	Connections []connectionStatusJson            `json:"connections"`
+	Channels    []channelStatsJson                `json:"channels"`
+	Unknown     []unknownChannel                  `json:"unknown_channels"` //channel types without a decoder
+	Fallback    map[string]restFallbackStatusJson `json:"rest_fallback"`    //by exchange
+}
+
+func channelStatsSnapshot() []channelStatsJson {
+	now := time.Now()
+
+	StatsContainer.Mu.Lock()
+	defer StatsContainer.Mu.Unlock()
+
+	channels := make([]channelStatsJson, 0, len(StatsContainer.Stats))
+	for _, stats := range StatsContainer.Stats {
+		rate := stats.rate
+		if now.Sub(stats.windowStart) >= statsRateWindow { //no update closed the window, use what it has so far
+			rate = float64(stats.windowUpdates) / now.Sub(stats.windowStart).Seconds()
+		} else if stats.rate == 0 {
+			rate = float64(stats.windowUpdates) / max(now.Sub(stats.windowStart).Seconds(), 1)
+		}
+
+		channels = append(channels, channelStatsJson{
+			Exchange:      stats.Exchange,
+			Channel:       stats.Channel,
+			Updates:       stats.Updates,
+			UpdatesPerSec: rate,
+			LastUpdate:    stats.LastUpdate,
+			AgeSeconds:    now.Sub(stats.LastUpdate).Seconds(),
+			AvgSize:       float64(stats.Bytes) / float64(stats.Updates),
+			Conflated:     stats.Conflated,
+			Resyncs:       stats.Resyncs,
+			Mismatches:    stats.Mismatches,
+			ProcessingP99: milliseconds(stats.Processing.Quantile(0.99)),
+		})
+	}
+
+	return channels
+}
+
+// statusHandler serves /api/status, ?sort=age lists the longest silent channels first, the default sorts by
+// updates/sec with the noisiest first.
+func statusHandler(conns []*WssConn, router *AssetRouter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := statusJson{
+			Processed: router.Processed(),
+			Unrouted:  router.Dropped.Load(),
+			Pipelines: router.Status(),
+			Lag:       lagStatus(time.Now()),
+			Channels:  channelStatsSnapshot(),
+			Unknown:   Channels.Unknown(),
+			Fallback:  restFallbackStatus(),
+		}
+		if Ticks != nil {
+			status.Persisted, status.Dropped = Ticks.Written.Load(), Ticks.Dropped.Load()
+		}
+		for _, c := range conns {
+			requested, subscribed := c.Subscribed()
+			c.Mu.Lock()
+			reconnects, stale := c.Reconnects, c.Stale
+			c.Mu.Unlock()
+			status.Connections = append(status.Connections, connectionStatusJson{c.Exchange, c.Shard, requested, subscribed, reconnects, stale})
+		}
+
+		if r.URL.Query().Get("sort") == "age" {
+			sort.Slice(status.Channels, func(i, j int) bool { return status.Channels[i].AgeSeconds > status.Channels[j].AgeSeconds })
+		} else {
+			sort.Slice(status.Channels, func(i, j int) bool { return status.Channels[i].UpdatesPerSec > status.Channels[j].UpdatesPerSec })
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(status)
+		if err != nil {
+			slog.Error("statusHandler: json encode error", "err", err)
+		}
+	}
+}
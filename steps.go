@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+
+	"options-ws/decimal"
+)
+
+func instrumentLimits(exchange string, instrument string) (InstrumentLimits, bool) {
+	InstrumentLimitsContainer.Mu.Lock()
+	defer InstrumentLimitsContainer.Mu.Unlock()
+	limits, exists := InstrumentLimitsContainer.Limits[exchange+" "+instrument]
+	return limits, exists
+}
+
+// roundPrice rounds a proposed limit price to the instrument's tick, down when buying and up when selling.
+func roundPrice(exchange string, instrument string, price decimal.Decimal, buy bool) decimal.Decimal {
+	limits, _ := instrumentLimits(exchange, instrument)
+	if buy {
+		return price.Floor(limits.PriceStep)
+	}
+	return price.Ceil(limits.PriceStep)
+}
+
+// roundAmount rounds a proposed amount down to the instrument's step.
+func roundAmount(exchange string, instrument string, amount float64) float64 {
+	limits, _ := instrumentLimits(exchange, instrument)
+	if limits.AmountStep <= 0 {
+		return amount
+	}
+	return decimal.FromFloat(amount).Floor(limits.AmountStep).Float64()
+}
+
+// onTick reports whether a quoted price is on the instrument's tick, always when the venue publishes none. Only aevo
+// and lyra do, deribit and okx prices are converted from the underlying and never on a USD tick.
+func onTick(exchange string, instrument string, price decimal.Decimal) bool {
+	limits, _ := instrumentLimits(exchange, instrument)
+	return price.Multiple(limits.PriceStep)
+}
+
+// belowMinimumOrder reports whether amount contracts at price is less than the instrument's minimum order.
+func belowMinimumOrder(exchange string, instrument string, amount float64, price float64) bool {
+	limits, _ := instrumentLimits(exchange, instrument)
+	return amount <= 0 || amount < limits.MinAmount || amount*price < limits.MinOrderValue
+}
+
+// legAmount rounds an arb's size down to both legs' steps, nested steps (0.01 and 0.1) leave a multiple of both.
+func legAmount(table *ArbTable, key string, size float64) float64 {
+	return roundAmount(table.AskExchange, key+"-"+table.AskType, roundAmount(table.BidExchange, key+"-"+table.BidType, size))
+}
+
+// orderable reports whether an opportunity can be traded: both legs' best levels on their tick, a level off it is a
+// mis-scaled or misparsed feed, and its executable size, rounded to the legs' steps, at least each leg's minimum order.
+func orderable(key string, table *ArbTable) bool {
+	bidLeg, askLeg := key+"-"+table.BidType, key+"-"+table.AskType
+	bid, ask := table.Bids[0].Price, table.Asks[0].Price
+	if !onTick(table.BidExchange, bidLeg, bid) || !onTick(table.AskExchange, askLeg, ask) {
+		slog.Debug("orderable: quote off tick", "key", key, "bid_exchange", table.BidExchange, "bid", bid, "ask_exchange", table.AskExchange, "ask", ask)
+		return false
+	}
+
+	size := legAmount(table, key, table.ExecutableSize)
+	if belowMinimumOrder(table.BidExchange, bidLeg, size, bid.Float64()) || belowMinimumOrder(table.AskExchange, askLeg, size, ask.Float64()) {
+		slog.Debug("orderable: executable size below the minimum order", "key", key, "size", size)
+		return false
+	}
+	return true
+}
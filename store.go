@@ -0,0 +1,116 @@
+package main
+
+import "time"
+
+// Get reads an index price under Mu.RLock, only writers take Mu so pollers of the stores don't serialize.
+func (c *IndexContainer) Get(asset string) (float64, bool) {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	price, exists := c.Index[asset]
+	return price, exists
+}
+
+func (c *IndexContainer) Set(asset string, price float64) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.Index[asset] = price
+}
+
+func (c *IndexContainer) Snapshot() map[string]float64 {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	snapshot := make(map[string]float64, len(c.Index))
+	for asset, price := range c.Index {
+		snapshot[asset] = price
+	}
+	return snapshot
+}
+
+// Get returns a copy of an instrument's orderbook, its Bids/Asks maps are copies too.
+func (c *OrderbooksContainer) Get(instrument string) (OrderbookData, bool) {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	orderbook, exists := c.Orderbooks[instrument]
+	if !exists {
+		return OrderbookData{}, false
+	}
+	return orderbook.copy(), true
+}
+
+func (c *OrderbooksContainer) Set(instrument string, orderbook OrderbookData) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.Orderbooks[instrument] = &orderbook
+}
+
+func (c *OrderbooksContainer) Snapshot() map[string]OrderbookData {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	snapshot := make(map[string]OrderbookData, len(c.Orderbooks))
+	for instrument, orderbook := range c.Orderbooks {
+		snapshot[instrument] = orderbook.copy()
+	}
+	return snapshot
+}
+
+// copy copies the maps, not the Order slices: updates replace them rather than modifying them in place.
+func (o *OrderbookData) copy() OrderbookData {
+	orderbook := *o
+	orderbook.Bids = make(map[string][]Order, len(o.Bids))
+	for exchange, bids := range o.Bids {
+		orderbook.Bids[exchange] = bids
+	}
+	orderbook.Asks = make(map[string][]Order, len(o.Asks))
+	for exchange, asks := range o.Asks {
+		orderbook.Asks[exchange] = asks
+	}
+	orderbook.Sequences = make(map[string]float64, len(o.Sequences))
+	for exchange, sequence := range o.Sequences {
+		orderbook.Sequences[exchange] = sequence
+	}
+	orderbook.Timestamps = make(map[string]time.Time, len(o.Timestamps))
+	for exchange, timestamp := range o.Timestamps {
+		orderbook.Timestamps[exchange] = timestamp
+	}
+	orderbook.RestSourced = make(map[string]bool, len(o.RestSourced))
+	for exchange, sourced := range o.RestSourced {
+		orderbook.RestSourced[exchange] = sourced
+	}
+	orderbook.Metrics = make(map[string]BookMetrics, len(o.Metrics))
+	for exchange, metrics := range o.Metrics {
+		orderbook.Metrics[exchange] = metrics
+	}
+	return orderbook
+}
+
+func (c *ArbTablesContainer) Get(key string) (ArbTable, bool) {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	table, exists := c.ArbTables[key]
+	if !exists {
+		return ArbTable{}, false
+	}
+	return *table, true
+}
+
+func (c *ArbTablesContainer) Set(key string, table ArbTable) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.ArbTables[key] = &table
+}
+
+func (c *ArbTablesContainer) Delete(key string) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	delete(c.ArbTables, key)
+}
+
+func (c *ArbTablesContainer) Snapshot() map[string]ArbTable {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	snapshot := make(map[string]ArbTable, len(c.ArbTables))
+	for key, table := range c.ArbTables {
+		snapshot[key] = *table
+	}
+	return snapshot
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategy is a scanner the arb pass runs over each underlying: OnIndex with the asset's index, OnOrderbook with each
+// of its books but quarantined ones while OrderbookContainer.Mu is read locked, then Scanned. Opportunities may be
+// called from any goroutine and, with an AssetRouter, the others concurrently for different assets. A new one is
+// enabled with -strategies once its constructor is in strategyConstructors.
+type Strategy interface {
+	Name() string
+	OnIndex(asset string, index float64, now time.Time)
+	OnOrderbook(instrument string, orderbook *OrderbookData, now time.Time)
+	Scanned(asset string, now time.Time)
+	Opportunities() []Opportunity
+}
+
+// Opportunity is what a strategy found, in the terms every strategy shares.
+type Opportunity struct {
+	Strategy string  `json:"strategy"`
+	Key      string  `json:"key"` //unique within the strategy, e.g. a strike for parity
+	Asset    string  `json:"asset"`
+	Profit   float64 `json:"profit"` //per contract after fees
+	Apy      float64 `json:"apy"`
+	Detail   any     `json:"detail,omitempty"` //the strategy's own description, an ArbTable for parity
+}
+
+var strategyConstructors = map[string]func() Strategy{
+	"parity": newParityStrategy,
+}
+
+type StrategiesContainer struct {
+	Mu         sync.RWMutex
+	Strategies []Strategy
+}
+
+var Strategies = StrategiesContainer{Strategies: []Strategy{newParityStrategy()}}
+
+// setStrategies enables the strategies named, in order.
+func setStrategies(names []string) error {
+	strategies := make([]Strategy, 0, len(names))
+	for _, name := range names {
+		constructor, exists := strategyConstructors[strings.TrimSpace(name)]
+		if !exists {
+			return fmt.Errorf("setStrategies: unknown strategy %q", name)
+		}
+		strategies = append(strategies, constructor())
+	}
+
+	Strategies.Mu.Lock()
+	Strategies.Strategies = strategies
+	Strategies.Mu.Unlock()
+	return nil
+}
+
+func enabledStrategies() []Strategy {
+	Strategies.Mu.RLock()
+	defer Strategies.Mu.RUnlock()
+	return Strategies.Strategies
+}
+
+// runStrategies is an arb pass of asset through every enabled strategy.
+func runStrategies(asset string) {
+	now := ArbClock()
+	strategies := enabledStrategies()
+	index, _ := AevoIndex.Get(asset)
+	for _, strategy := range strategies {
+		strategy.OnIndex(asset, index, now)
+	}
+
+	OrderbookContainer.Mu.RLock()
+	checkBooks(asset, now) //before any book of the pass is priced
+	for instrument, orderbook := range OrderbookContainer.Orderbooks {
+		if !strings.HasPrefix(instrument, asset+"-") || quarantined(instrument, now) {
+			continue
+		}
+		for _, strategy := range strategies {
+			strategy.OnOrderbook(instrument, orderbook, now)
+		}
+	}
+	OrderbookContainer.Mu.RUnlock()
+
+	for _, strategy := range strategies {
+		strategy.Scanned(asset, now)
+	}
+}
+
+// opportunitiesHandler serves /api/opportunities, every enabled strategy's opportunities by Apy, of one strategy with
+// ?strategy= or one asset with ?asset=.
+func opportunitiesHandler(w http.ResponseWriter, r *http.Request) {
+	name, asset := r.URL.Query().Get("strategy"), r.URL.Query().Get("asset")
+
+	opportunities := make([]Opportunity, 0)
+	for _, strategy := range enabledStrategies() {
+		if name != "" && strategy.Name() != name {
+			continue
+		}
+		for _, opportunity := range strategy.Opportunities() {
+			if asset == "" || opportunity.Asset == asset {
+				opportunities = append(opportunities, opportunity)
+			}
+		}
+	}
+	sort.Slice(opportunities, func(i, j int) bool { return opportunities[i].Apy > opportunities[j].Apy })
+	writeJson(w, "opportunitiesHandler", opportunities)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+var StrikeRange float64     //fraction of the index, 0.3 subscribes strikes within ±30% of it, 0 every strike
+var MaxExpiry time.Duration //0 subscribes every expiry
+
+const refilterMove = 0.25 //fraction of StrikeRange the index moves before the lists are rebuilt
+
+type StrikeFilterContainer struct {
+	Mu      sync.Mutex
+	Centers map[string]float64 //by asset, the index the subscribed strike range is centered on
+	changed chan struct{}      //closed and replaced whenever a center moves
+}
+
+var StrikeFilter = StrikeFilterContainer{Centers: make(map[string]float64), changed: make(chan struct{})}
+
+// strikeFilterSignal returns a channel that is closed the next time the index moved far enough for the subscription
+// lists to be rebuilt.
+func strikeFilterSignal() <-chan struct{} {
+	StrikeFilter.Mu.Lock()
+	defer StrikeFilter.Mu.Unlock()
+	return StrikeFilter.changed
+}
+
+// filterIndex is the index strike ranges are centered on, the first of the exchanges' indexes that has asset.
+func filterIndex(asset string) (float64, bool) {
+	for _, index := range []*IndexContainer{&AevoIndex, &DeribitIndex, &OkxIndex, &LyraIndex, &BinanceOptionsIndex} {
+		if price, exists := index.Get(asset); exists && price > 0 {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// filterInstruments returns the instruments of exchange (in its naming) the filters keep at now. With a StrikeRange,
+// the instruments of assets without an index yet are held back until strikeFilterLoop sees one, names that don't parse
+// are kept.
+func filterInstruments(exchange string, instruments []string, now time.Time) []string {
+	if StrikeRange <= 0 && MaxExpiry <= 0 {
+		return instruments
+	}
+
+	centers := make(map[string]float64)
+	kept := make([]string, 0, len(instruments))
+	for _, name := range instruments {
+		instrument, err := parseVenueInstrument(exchange, name)
+		if err != nil {
+			kept = append(kept, name)
+			continue
+		}
+		if MaxExpiry > 0 && instrument.Expiry.Sub(now) > MaxExpiry {
+			continue
+		}
+		if StrikeRange > 0 {
+			center, exists := centers[instrument.Asset]
+			if !exists {
+				center, _ = filterIndex(instrument.Asset)
+				centers[instrument.Asset] = center
+			}
+			if center <= 0 || math.Abs(instrument.Strike/center-1) > StrikeRange {
+				continue
+			}
+		}
+		kept = append(kept, name)
+	}
+
+	StrikeFilter.Mu.Lock()
+	for asset, center := range centers {
+		if center > 0 {
+			StrikeFilter.Centers[asset] = center
+		} else {
+			slog.Warn("filterInstruments: no index yet, holding back the asset's instruments", "exchange", exchange, "asset", asset)
+		}
+	}
+	StrikeFilter.Mu.Unlock()
+	return kept
+}
+
+// strikeFilterLoop signals strikeFilterSignal every interval an asset's index moved refilterMove of StrikeRange away
+// from its center, or first became available, so the lists are rebuilt around the new index.
+func strikeFilterLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		moved := make([]string, 0)
+		StrikeFilter.Mu.Lock()
+		for _, asset := range currentAssets() {
+			index, exists := filterIndex(asset)
+			if !exists {
+				continue
+			}
+			center, centered := StrikeFilter.Centers[asset]
+			if centered && math.Abs(index/center-1) <= StrikeRange*refilterMove {
+				continue
+			}
+			StrikeFilter.Centers[asset] = index //signalled once, the rebuilt lists center on the index at that time
+			moved = append(moved, asset)
+		}
+		if len(moved) > 0 {
+			close(StrikeFilter.changed)
+			StrikeFilter.changed = make(chan struct{})
+		}
+		StrikeFilter.Mu.Unlock()
+
+		if len(moved) > 0 {
+			slog.Info("strikeFilterLoop: index moved, rebuilding subscriptions", "assets", moved)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var AckTimeout = 15 * time.Second
+var SubscribeRetries = 3
+
+// batchAcks are the exchanges acknowledging subscribe messages in order without naming their channels.
+var batchAcks = map[string]bool{"binance": true, "binance-options": true}
+
+// subscriptionState is a channel written in a subscribe message, pending until the exchange confirms it with an
+// acknowledgement naming it or a first frame on it.
+type subscriptionState struct {
+	Exchange  string    `json:"exchange"`
+	Channel   string    `json:"channel"`
+	Sent      time.Time `json:"sent"`
+	Attempts  int       `json:"attempts"` //subscribe messages sent since the last confirmation
+	Confirmed bool      `json:"confirmed"`
+	Failed    bool      `json:"failed"`          //retries exhausted without a confirmation
+	Error     string    `json:"error,omitempty"` //the exchange's rejection of the last attempt
+
+	conn *WssConn //the connection it was sent on, retries resubscribe on it
+}
+
+type SubscriptionTracker struct {
+	Mu      sync.RWMutex
+	States  map[string]*subscriptionState //key: exchange + " " + channel
+	batches map[string][][]string         //batchAcks exchanges' unacknowledged messages in send order
+	errors  map[string]string             //by exchange, the last error response no channel could be matched to
+}
+
+var Subscriptions = SubscriptionTracker{
+	States:  make(map[string]*subscriptionState),
+	batches: make(map[string][][]string),
+	errors:  make(map[string]string),
+}
+
+// Sent records a subscribe message of channels written on c.
+func (t *SubscriptionTracker) Sent(c *WssConn, channels []string) {
+	now := time.Now()
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	for _, channel := range channels {
+		key := c.Exchange + " " + channel
+		state, exists := t.States[key]
+		if !exists || state.Confirmed {
+			state = &subscriptionState{Exchange: c.Exchange, Channel: channel}
+			t.States[key] = state
+		}
+		state.Sent, state.conn = now, c
+		state.Attempts++
+		state.Error = ""
+	}
+	if batchAcks[c.Exchange] {
+		t.batches[c.Exchange] = append(t.batches[c.Exchange], channels)
+	}
+}
+
+// Forget stops tracking unsubscribed channels.
+func (t *SubscriptionTracker) Forget(exchange string, channels []string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	for _, channel := range channels {
+		delete(t.States, exchange+" "+channel)
+	}
+}
+
+// ResetBatches drops the unacknowledged messages of a replaced connection, their acknowledgements won't come.
+func (t *SubscriptionTracker) ResetBatches(exchange string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	delete(t.batches, exchange)
+}
+
+// Confirm confirms channel on a frame received on it, it's called for every decoded frame so the common case of an
+// already confirmed (or untracked) channel only takes the read lock.
+func (t *SubscriptionTracker) Confirm(exchange string, channel []byte) {
+	var buf [128]byte
+	t.Mu.RLock()
+	state, exists := t.States[string(appendVenueKey(buf[:0], exchange, channel))]
+	pending := exists && !state.Confirmed
+	t.Mu.RUnlock()
+	if pending {
+		t.acknowledge(exchange, []string{string(channel)}, "")
+	}
+}
+
+// Failed reports whether channel's subscription ran out of retries without being confirmed.
+func (t *SubscriptionTracker) Failed(exchange string, channel string) bool {
+	t.Mu.RLock()
+	defer t.Mu.RUnlock()
+	state, exists := t.States[exchange+" "+channel]
+	return exists && state.Failed
+}
+
+// acknowledge confirms channels, or records their rejection with reason when it isn't empty.
+func (t *SubscriptionTracker) acknowledge(exchange string, channels []string, reason string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	for _, channel := range channels {
+		state, exists := t.States[exchange+" "+channel]
+		if !exists {
+			continue
+		}
+		if reason != "" {
+			state.Error = reason
+			continue
+		}
+		state.Confirmed, state.Failed, state.Attempts, state.Error = true, false, 0, ""
+	}
+}
+
+// acknowledgeBatch confirms (or rejects, reason not empty) the oldest unacknowledged message of a batchAcks exchange.
+func (t *SubscriptionTracker) acknowledgeBatch(exchange string, reason string) {
+	t.Mu.Lock()
+	batches := t.batches[exchange]
+	if len(batches) == 0 {
+		t.Mu.Unlock()
+		return
+	}
+	t.batches[exchange] = batches[1:]
+	t.Mu.Unlock()
+	t.acknowledge(exchange, batches[0], reason)
+}
+
+func (t *SubscriptionTracker) recordError(exchange string, reason string) {
+	t.Mu.Lock()
+	t.errors[exchange] = reason
+	t.Mu.Unlock()
+	slog.Warn("observeAck: error response", "exchange", exchange, "error", reason)
+}
+
+type ackResponse struct {
+	Id     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+	Event  string          `json:"event"` //okx
+	Arg    struct {
+		Channel string `json:"channel"`
+		InstId  string `json:"instId"`
+	} `json:"arg"`
+	Msg string `json:"msg"` //okx error
+}
+
+// errorText is a response's error as text, a string or an object's message.
+func errorText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var object struct {
+		Message string `json:"message"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(raw, &object) == nil && (object.Message != "" || object.Msg != "") {
+		return object.Message + object.Msg
+	}
+	return string(raw)
+}
+
+// observeAck matches a frame without a channel against the exchange's subscribe responses: lyra's per channel status
+// (request id "2"), deribit's list of subscribed channels (id 3), OKX's subscribe events and binance's empty results
+// (id 1). Aevo names its acknowledgements' channel "subscribe", see aevoDecodeSubscribed. Error responses that don't
+// name channels are only recorded, the timeout retries their channels. Deribit's login response (deribitAuthId) is
+// logged.
+func observeAck(exchange string, raw []byte) {
+	var response ackResponse
+	if json.Unmarshal(raw, &response) != nil {
+		return //pongs and other non-JSON frames
+	}
+	id := strings.Trim(string(response.Id), `"`)
+
+	switch {
+	case exchange == "okx" && response.Event == "subscribe":
+		channel := response.Arg.Channel + ":" + response.Arg.InstId
+		Subscriptions.acknowledge(exchange, []string{channel}, "")
+	case exchange == "okx" && response.Event == "error":
+		Subscriptions.recordError(exchange, response.Msg)
+	case batchAcks[exchange] && id == "1":
+		reason := ""
+		if len(response.Error) > 0 {
+			reason = errorText(response.Error)
+		}
+		Subscriptions.acknowledgeBatch(exchange, reason)
+	case exchange == "lyra" && id == "2" && len(response.Result) > 0:
+		var result struct {
+			Status map[string]string `json:"status"`
+		}
+		if json.Unmarshal(response.Result, &result) != nil {
+			return
+		}
+		for channel, status := range result.Status {
+			if status == "ok" {
+				status = ""
+			}
+			Subscriptions.acknowledge(exchange, []string{channel}, status)
+		}
+	case exchange == "deribit" && id == strconv.Itoa(deribitAuthId):
+		if len(response.Error) > 0 && string(response.Error) != "null" {
+			slog.Error("observeAck: deribit login rejected", "err", errorText(response.Error))
+			Subscriptions.recordError(exchange, errorText(response.Error))
+		} else {
+			slog.Info("observeAck: deribit logged in")
+		}
+	case exchange == "deribit" && id == "7" && len(response.Error) > 0 && string(response.Error) != "null":
+		slog.Error("observeAck: deribit cancel on disconnect rejected", "err", errorText(response.Error))
+	case exchange == "deribit" && id == "3" && len(response.Result) > 0:
+		var channels []string
+		if json.Unmarshal(response.Result, &channels) == nil {
+			Subscriptions.acknowledge(exchange, channels, "")
+		}
+	case len(response.Error) > 0 && string(response.Error) != "null":
+		Subscriptions.recordError(exchange, errorText(response.Error))
+	}
+}
+
+// aevoDecodeSubscribed returns the decoder confirming the channels of aevo's {"channel":"subscribe","data":[...]}
+// acknowledgements on exchange, "aevo" or "aevo-private".
+func aevoDecodeSubscribed(exchange string) ChannelDecoder {
+	return func(raw []byte) error {
+		var message struct {
+			Data []string `json:"data"`
+		}
+		err := json.Unmarshal(raw, &message)
+		if err != nil {
+			return err
+		}
+		Subscriptions.acknowledge(exchange, message.Data, "")
+		return nil
+	}
+}
+
+// subscriptionLoop resubscribes rejected channels and channels pending for longer than AckTimeout, and marks those
+// out of retries as failed.
+func subscriptionLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		now := time.Now()
+
+		retries := make(map[*WssConn][]string)
+		Subscriptions.Mu.Lock()
+		for _, state := range Subscriptions.States {
+			if state.Confirmed || state.Failed || (state.Error == "" && now.Sub(state.Sent) < AckTimeout) {
+				continue
+			}
+			if state.Attempts > SubscribeRetries {
+				state.Failed = true
+				slog.Warn("subscriptionLoop: subscription never confirmed", "exchange", state.Exchange, "channel", state.Channel, "attempts", state.Attempts, "error", state.Error)
+				continue
+			}
+			retries[state.conn] = append(retries[state.conn], state.Channel)
+		}
+		Subscriptions.Mu.Unlock()
+
+		for c, channels := range retries {
+			slog.Info("subscriptionLoop: retrying unconfirmed subscriptions", "exchange", c.Exchange, "channels", len(channels))
+			for i := 0; i < len(channels); i += SubscribeBatchSize {
+				err := c.Resubscribe(channels[i:min(i+SubscribeBatchSize, len(channels))])
+				if err != nil {
+					slog.Error("subscriptionLoop: resubscribe failed", "err", err)
+					break
+				}
+			}
+		}
+	}
+}
+
+type subscriptionCounts struct {
+	Confirmed int    `json:"confirmed"`
+	Pending   int    `json:"pending"`
+	Failed    int    `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type connectionSubscriptions struct {
+	Exchange string   `json:"exchange"`
+	Shard    int      `json:"shard"`
+	Desired  int      `json:"desired"`
+	Missing  []string `json:"missing,omitempty"` //wanted, not sent on the current connection
+	Stray    []string `json:"stray,omitempty"`   //sent, no longer wanted
+}
+
+// subscriptionsHandler serves /api/subscriptions, per exchange counts of confirmed, pending and failed channels, the
+// unconfirmed channels and those that never confirmed, and each connection's wanted channels against those sent on it,
+// of one exchange with ?exchange=.
+func subscriptionsHandler(conns []*WssConn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query().Get("exchange")
+
+		counts := make(map[string]*subscriptionCounts)
+		unconfirmed := make([]subscriptionState, 0)
+		neverConfirmed := make([]string, 0)
+		Subscriptions.Mu.RLock()
+		for _, state := range Subscriptions.States {
+			if filter != "" && state.Exchange != filter {
+				continue
+			}
+			count, exists := counts[state.Exchange]
+			if !exists {
+				count = &subscriptionCounts{LastError: Subscriptions.errors[state.Exchange]}
+				counts[state.Exchange] = count
+			}
+			switch {
+			case state.Confirmed:
+				count.Confirmed++
+				continue
+			case state.Failed:
+				count.Failed++
+				neverConfirmed = append(neverConfirmed, state.Exchange+" "+state.Channel)
+			default:
+				count.Pending++
+			}
+			unconfirmed = append(unconfirmed, *state)
+		}
+		Subscriptions.Mu.RUnlock()
+
+		connections := make([]connectionSubscriptions, 0, len(conns))
+		for _, c := range conns {
+			if filter != "" && c.Exchange != filter {
+				continue
+			}
+			desired, missing, stray := c.SubscriptionDiff()
+			sort.Strings(missing)
+			sort.Strings(stray)
+			connections = append(connections, connectionSubscriptions{c.Exchange, c.Shard, desired, missing, stray})
+		}
+
+		sort.Slice(unconfirmed, func(i, j int) bool {
+			return unconfirmed[i].Exchange+unconfirmed[i].Channel < unconfirmed[j].Exchange+unconfirmed[j].Channel
+		})
+		sort.Strings(neverConfirmed)
+		writeJson(w, "subscriptionsHandler", struct {
+			Exchanges      map[string]*subscriptionCounts `json:"exchanges"`
+			Unconfirmed    []subscriptionState            `json:"unconfirmed"`
+			NeverConfirmed []string                       `json:"never_confirmed"` //"exchange channel"
+			Connections    []connectionSubscriptions      `json:"connections"`
+		}{counts, unconfirmed, neverConfirmed, connections})
+	}
+}
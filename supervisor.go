@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// permanentError marks an error retrying can't fix, such as a rejected handshake, a malformed url or bad credentials.
+type permanentError struct {
+	Err error
+}
+
+func (e permanentError) Error() string { return e.Err.Error() }
+func (e permanentError) Unwrap() error { return e.Err }
+
+// permanent wraps err so supervise stops retrying on it, nil stays nil.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// supervise runs op until it succeeds, retrying transient errors after a backoff doubling from minBackoff up to
+// maxBackoff with jitter. It returns a permanent error of op or the context's error as soon as either occurs. Errors
+// are returned up to the goroutine owning an operation, which supervises it, only startup in main treats one as fatal.
+func supervise(ctx context.Context, name string, minBackoff time.Duration, maxBackoff time.Duration, op func(ctx context.Context) error) error {
+	backoff := minBackoff
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || isPermanent(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		slog.Warn("supervise: attempt failed", "op", name, "attempt", attempt, "retry_in", wait.Round(time.Millisecond), "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
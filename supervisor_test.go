@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+func TestSupervise(t *testing.T) {
+	transient := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		errs     []error //returned by successive attempts, nil once they run out
+		cancelAt int     //attempt the context is cancelled in, 0 never
+		want     error
+		attempts int
+	}{
+		{name: "success", errs: nil, want: nil, attempts: 1},
+		{name: "permanent returns at once", errs: []error{permanent(errors.New("bad handshake"))}, want: permanentError{}, attempts: 1},
+		{name: "transient retried", errs: []error{transient, transient, transient}, want: nil, attempts: 4},
+		{name: "permanent after transient", errs: []error{transient, permanent(errors.New("banned"))}, want: permanentError{}, attempts: 2},
+		{name: "cancelled stops retrying", errs: []error{transient, transient, transient, transient}, cancelAt: 2, want: context.Canceled, attempts: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			attempts := 0
+			var waits []time.Time
+			err := supervise(ctx, test.name, 10*time.Millisecond, 40*time.Millisecond, func(ctx context.Context) error {
+				attempts++
+				waits = append(waits, time.Now())
+				if attempts == test.cancelAt {
+					cancel()
+				}
+				if attempts > len(test.errs) {
+					return nil
+				}
+				return test.errs[attempts-1]
+			})
+
+			switch want := test.want.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+			case permanentError:
+				if !isPermanent(err) {
+					t.Errorf("err = %v, want a permanent error", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("err = %v, want %v", err, want)
+				}
+			}
+			if attempts != test.attempts {
+				t.Errorf("attempts = %v, want %v", attempts, test.attempts)
+			}
+			for i := 1; i < len(waits); i++ { //jitter keeps each wait within half the backoff and the backoff
+				backoff := min(10*time.Millisecond<<(i-1), 40*time.Millisecond)
+				if wait := waits[i].Sub(waits[i-1]); wait < backoff/2 {
+					t.Errorf("wait before attempt %v = %v, want at least %v", i+1, wait, backoff/2)
+				}
+			}
+		})
+	}
+}
+
+func TestDialSessionClassifiesHandshakes(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int //0 accepts the websocket
+		wantErr   bool
+		permanent bool
+	}{
+		{name: "accepted", status: 0},
+		{name: "not found", status: http.StatusNotFound, wantErr: true, permanent: true},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: true, permanent: true},
+		{name: "too many requests", status: http.StatusTooManyRequests, wantErr: true},
+		{name: "request timeout", status: http.StatusRequestTimeout, wantErr: true},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.status != 0 {
+					http.Error(w, http.StatusText(test.status), test.status)
+					return
+				}
+				c, err := websocket.Accept(w, r, nil)
+				if err != nil {
+					return
+				}
+				c.Close(websocket.StatusNormalClosure, "")
+			}))
+			defer server.Close()
+
+			session, err := dialSession("ws"+strings.TrimPrefix(server.URL, "http"), websocket.CompressionDisabled)
+			if session != nil {
+				session.Conn.CloseNow()
+				session.Cancel()
+			}
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %v", err, test.wantErr)
+			}
+			if isPermanent(err) != test.permanent {
+				t.Errorf("isPermanent(%v) = %v, want %v", err, isPermanent(err), test.permanent)
+			}
+		})
+	}
+}
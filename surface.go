@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var SurfaceTolerance = 5.0 //vol points a quote's IV may sit on the wrong side of the fitted smile before it's flagged
+
+// SurfaceQuote is one exchange's best bid or ask of an instrument with its implied vol, from the exchange's level IV
+// or inverted from the price when the exchange doesn't publish one.
+type SurfaceQuote struct {
+	Instrument string
+	Exchange   string
+	Side       string //"bid" or "ask"
+	Price      float64
+	Iv         float64 //vol points
+	FitIv      float64 //vol points, the fitted smile at the quote's strike
+	Deviation  float64 //Iv - FitIv
+}
+
+// SmileFit is a quadratic smile in log moneyness, iv (vol points) = A + B*k + C*k^2 with k = ln(strike / spot), fitted
+// to strikes between MinK and MaxK.
+type SmileFit struct {
+	A, B, C    float64
+	MinK, MaxK float64
+}
+
+func (f SmileFit) Iv(k float64) float64 {
+	return f.A + f.B*k + f.C*k*k
+}
+
+type SmilePoint struct {
+	Strike    float64
+	Moneyness float64 //k = ln(strike / spot)
+	Iv        float64 //vol points, mid of the best bid and ask IVs of the out of the money option
+}
+
+type Smile struct {
+	Expiry string
+	Years  float64
+	Points []SmilePoint
+	Fit    *SmileFit //nil with fewer than 3 points
+
+	quotes []SurfaceQuote
+}
+
+// IvSurface is the implied vol of an asset's options by expiry and strike. Strikes between fitted points follow
+// each expiry's SmileFit, expiries in between are interpolated linearly in total variance.
+type IvSurface struct {
+	Asset    string
+	Spot     float64
+	Smiles   []Smile //nearest expiry first
+	Outliers []SurfaceQuote
+}
+
+// fitSmile solves the least squares normal equations of the quadratic, nil if they're singular or there are fewer than
+// 3 points.
+func fitSmile(points []SmilePoint) *SmileFit {
+	if len(points) < 3 {
+		return nil
+	}
+
+	var m [3][4]float64 //augmented normal equations
+	fit := SmileFit{MinK: math.Inf(1), MaxK: math.Inf(-1)}
+	for _, point := range points {
+		powers := [3]float64{1, point.Moneyness, point.Moneyness * point.Moneyness}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				m[i][j] += powers[i] * powers[j]
+			}
+			m[i][3] += powers[i] * point.Iv
+		}
+		fit.MinK = math.Min(fit.MinK, point.Moneyness)
+		fit.MaxK = math.Max(fit.MaxK, point.Moneyness)
+	}
+
+	for col := 0; col < 3; col++ { //gaussian elimination with partial pivoting
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := 0; row < 3; row++ {
+			if row == col {
+				continue
+			}
+			factor := m[row][col] / m[col][col]
+			for j := col; j < 4; j++ {
+				m[row][j] -= factor * m[col][j]
+			}
+		}
+	}
+
+	fit.A, fit.B, fit.C = m[0][3]/m[0][0], m[1][3]/m[1][1], m[2][3]/m[2][2]
+	return &fit
+}
+
+// quoteIv is the implied vol of a level in vol points, the exchange's own when published.
+func quoteIv(order Order, optionType string, spot float64, strike float64, years float64) (float64, bool) {
+	if order.Iv > 0 {
+		return order.Iv * 100, true
+	}
+	iv, ok := impliedVol(optionType, order.Price.Float64(), spot, strike, years)
+	return iv * 100, ok
+}
+
+// buildSurface collects every exchange's best quotes of asset's live options, fits a smile per expiry to the two sided
+// out of the money mids and flags quotes whose IV is more than SurfaceTolerance through the fit: bids above it and
+// asks below it.
+func buildSurface(asset string, now time.Time) (*IvSurface, error) {
+	return buildSurfaceExcluding(asset, now, nil)
+}
+
+// topLevel is the best of orders once own's amount is taken off the level at own's price, false if nothing is left.
+func topLevel(orders []Order, own Order) (Order, bool) {
+	for _, order := range orders {
+		if own.Amount > 0 && order.Price == own.Price {
+			order.Amount -= own.Amount
+			if order.Amount <= 1e-9 {
+				continue
+			}
+		}
+		return order, true
+	}
+	return Order{}, false
+}
+
+// buildSurfaceExcluding is buildSurface without the orders in own, the account's resting orders keyed by exchange,
+// instrument and "bid" or "ask", so quotes don't feed back into the fair value they're priced around.
+func buildSurfaceExcluding(asset string, now time.Time, own map[string]Order) (*IvSurface, error) {
+	spot, _ := AevoIndex.Get(asset)
+	if spot <= 0 {
+		return nil, fmt.Errorf("buildSurface: no %v index price yet", asset)
+	}
+
+	smiles := make(map[string]*Smile)
+	OrderbookContainer.Mu.RLock()
+	for instrument, orderbook := range OrderbookContainer.Orderbooks {
+		components := strings.Split(instrument, "-")
+		if len(components) != 4 || components[0] != asset {
+			continue
+		}
+		expiry, err := instrumentExpiry(components[1])
+		if err != nil || !expiry.After(now) {
+			continue
+		}
+		strike, err := strconv.ParseFloat(components[2], 64)
+		if err != nil {
+			continue
+		}
+		optionType, years := components[3], yearsUntil(expiry, now)
+
+		smile, exists := smiles[components[1]]
+		if !exists {
+			smile = &Smile{Expiry: components[1], Years: years}
+			smiles[components[1]] = smile
+		}
+
+		bestBid, bestAsk := 0.0, 0.0
+		for side, levels := range map[string]map[string][]Order{"bid": orderbook.Bids, "ask": orderbook.Asks} {
+			for exchange, orders := range levels {
+				top, ok := topLevel(orders, own[exchange+" "+instrument+" "+side])
+				if !ok {
+					continue
+				}
+				iv, ok := quoteIv(top, optionType, spot, strike, years)
+				if !ok {
+					continue
+				}
+				smile.quotes = append(smile.quotes, SurfaceQuote{Instrument: instrument, Exchange: exchange, Side: side, Price: top.Price.Float64(), Iv: iv})
+				if side == "bid" {
+					bestBid = math.Max(bestBid, iv)
+				} else if bestAsk == 0 || iv < bestAsk {
+					bestAsk = iv
+				}
+			}
+		}
+
+		outOfTheMoney := (optionType == "C") == (strike >= spot)
+		if outOfTheMoney && bestBid > 0 && bestAsk > 0 {
+			smile.Points = append(smile.Points, SmilePoint{Strike: strike, Moneyness: math.Log(strike / spot), Iv: (bestBid + bestAsk) / 2})
+		}
+	}
+	OrderbookContainer.Mu.RUnlock()
+
+	surface := &IvSurface{Asset: asset, Spot: spot, Smiles: make([]Smile, 0, len(smiles))}
+	for _, smile := range smiles {
+		sort.Slice(smile.Points, func(i, j int) bool { return smile.Points[i].Strike < smile.Points[j].Strike })
+		smile.Fit = fitSmile(smile.Points)
+		if smile.Fit != nil {
+			for _, quote := range smile.quotes {
+				strike, _ := strconv.ParseFloat(strings.Split(quote.Instrument, "-")[2], 64)
+				quote.FitIv = smile.Fit.Iv(math.Log(strike / spot))
+				quote.Deviation = quote.Iv - quote.FitIv
+				if (quote.Side == "bid" && quote.Deviation > SurfaceTolerance) || (quote.Side == "ask" && quote.Deviation < -SurfaceTolerance) {
+					surface.Outliers = append(surface.Outliers, quote)
+				}
+			}
+		}
+		surface.Smiles = append(surface.Smiles, *smile)
+	}
+	sort.Slice(surface.Smiles, func(i, j int) bool { return surface.Smiles[i].Years < surface.Smiles[j].Years })
+	sort.Slice(surface.Outliers, func(i, j int) bool {
+		return math.Abs(surface.Outliers[i].Deviation) > math.Abs(surface.Outliers[j].Deviation)
+	})
+
+	return surface, nil
+}
+
+// Iv interpolates the surface at a strike and time to expiry: each smile's fit at the strike's moneyness, linearly in
+// total variance between the expiries either side, flat beyond the first and last fitted expiry.
+func (s *IvSurface) Iv(strike float64, years float64) (float64, bool) {
+	k := math.Log(strike / s.Spot)
+	fitted := make([]Smile, 0, len(s.Smiles))
+	for _, smile := range s.Smiles {
+		if smile.Fit != nil {
+			fitted = append(fitted, smile)
+		}
+	}
+	if len(fitted) == 0 || years <= 0 {
+		return 0, false
+	}
+
+	if years <= fitted[0].Years {
+		return fitted[0].Fit.Iv(k), true
+	}
+	for i := 1; i < len(fitted); i++ {
+		if years > fitted[i].Years {
+			continue
+		}
+		before, after := fitted[i-1], fitted[i]
+		varBefore := math.Pow(before.Fit.Iv(k), 2) * before.Years
+		varAfter := math.Pow(after.Fit.Iv(k), 2) * after.Years
+		weight := (years - before.Years) / (after.Years - before.Years)
+		return math.Sqrt((varBefore + weight*(varAfter-varBefore)) / years), true
+	}
+	return fitted[len(fitted)-1].Fit.Iv(k), true
+}
+
+var surfaceMoneyness = []float64{70, 80, 90, 95, 100, 105, 110, 120, 130} //heatmap columns, strike as percent of spot
+
+// surfaceGrid evaluates each fitted smile at surfaceMoneyness, 0 where that's outside its fitted strikes.
+func surfaceGrid(surface *IvSurface) [][]float64 {
+	grid := make([][]float64, len(surface.Smiles))
+	for i, smile := range surface.Smiles {
+		grid[i] = make([]float64, len(surfaceMoneyness))
+		if smile.Fit == nil {
+			continue
+		}
+		for j, percent := range surfaceMoneyness {
+			if k := math.Log(percent / 100); k >= smile.Fit.MinK && k <= smile.Fit.MaxK {
+				grid[i][j] = smile.Fit.Iv(k)
+			}
+		}
+	}
+	return grid
+}
+
+// surfaceHandler serves /api/iv-surface?asset=ETH, the smiles, fits, outliers and heatmap grid, or with &strike=
+// and &days= the interpolated IV there.
+func surfaceHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	asset := strings.ToUpper(query.Get("asset"))
+	if asset == "" {
+		asset = "ETH"
+	}
+	surface, err := buildSurface(asset, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if query.Has("strike") || query.Has("days") {
+		strike, strikeErr := strconv.ParseFloat(query.Get("strike"), 64)
+		days, daysErr := strconv.ParseFloat(query.Get("days"), 64)
+		if strikeErr != nil || daysErr != nil {
+			http.Error(w, "strike and days must both be numbers", http.StatusBadRequest)
+			return
+		}
+		iv, ok := surface.Iv(strike, days/365)
+		writeJson(w, "surfaceHandler", struct {
+			Iv float64
+			Ok bool
+		}{iv, ok})
+		return
+	}
+
+	writeJson(w, "surfaceHandler", struct {
+		*IvSurface
+		Moneyness []float64
+		Grid      [][]float64
+	}{surface, surfaceMoneyness, surfaceGrid(surface)})
+}
+
+func serveSurface(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/surface.html"))
+	tmpl.Execute(w, nil)
+}
+
+// heatColor shades an IV from blue (low) to red (high) within the grid's range.
+func heatColor(iv float64, low float64, high float64) string {
+	if iv <= 0 || high <= low {
+		return "#ffffff"
+	}
+	t := (iv - low) / (high - low)
+	return fmt.Sprintf("rgb(%d,%d,%d)", int(80+175*t), 120, int(255-175*t))
+}
+
+// smileSvg draws a smile's mids as dots and its fit as a line, IV against moneyness.
+func smileSvg(smile Smile, low float64, high float64) string {
+	const width, height = 300.0, 120.0
+	minK, maxK := math.Log(0.5), math.Log(1.5)
+	x := func(k float64) float64 { return (k - minK) / (maxK - minK) * width }
+	y := func(iv float64) float64 { return height - (iv-low)/math.Max(high-low, 1)*height }
+
+	svg := fmt.Sprintf(`<svg width="%v" height="%v" style="border:1px solid #000">`, width, height)
+	if smile.Fit != nil {
+		path := ""
+		for k := math.Max(smile.Fit.MinK, minK); k <= math.Min(smile.Fit.MaxK, maxK); k += 0.01 {
+			path += fmt.Sprintf("%.1f,%.1f ", x(k), y(smile.Fit.Iv(k)))
+		}
+		svg += fmt.Sprintf(`<polyline fill="none" stroke="red" points="%s"/>`, path)
+	}
+	for _, point := range smile.Points {
+		svg += fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="2"/>`, x(point.Moneyness), y(point.Iv))
+	}
+	return svg + "</svg>"
+}
+
+// surfaceTableHandler renders the heatmap, a smile chart per expiry and the outliers for /surface.
+func surfaceTableHandler(w http.ResponseWriter, r *http.Request) {
+	asset := strings.ToUpper(r.URL.Query().Get("asset"))
+	if asset == "" {
+		asset = "ETH"
+	}
+	surface, err := buildSurface(asset, time.Now())
+	if err != nil {
+		fmt.Fprintf(w, `<p>%s</p>`, template.HTMLEscapeString(err.Error()))
+		return
+	}
+
+	grid := surfaceGrid(surface)
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, row := range grid {
+		for _, iv := range row {
+			if iv > 0 {
+				low, high = math.Min(low, iv), math.Max(high, iv)
+			}
+		}
+	}
+	if math.IsInf(low, 1) { //no fitted smile yet
+		low, high = 0, 100
+	}
+
+	responseStr := `<table><tr><th>Expiry \ Strike % spot</th>`
+	for _, percent := range surfaceMoneyness {
+		responseStr += fmt.Sprintf(`<th>%v</th>`, percent)
+	}
+	responseStr += `<th>Smile</th></tr>`
+	for i, smile := range surface.Smiles {
+		responseStr += fmt.Sprintf(`<tr><th>%s</th>`, smile.Expiry)
+		for _, iv := range grid[i] {
+			value := ""
+			if iv > 0 {
+				value = strconv.FormatFloat(iv, 'f', 1, 64)
+			}
+			responseStr += fmt.Sprintf(`<td style="background:%s">%s</td>`, heatColor(iv, low, high), value)
+		}
+		responseStr += `<td>` + smileSvg(smile, low-5, high+5) + `</td></tr>`
+	}
+	responseStr += `</table><h3>Outliers</h3><table><tr><th>Instrument</th><th>Exchange</th><th>Side</th><th>Price</th><th>IV</th><th>Fit</th><th>Deviation</th></tr>`
+	for _, quote := range surface.Outliers {
+		responseStr += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			quote.Instrument,
+			quote.Exchange,
+			quote.Side,
+			strconv.FormatFloat(quote.Price, 'f', 3, 64),
+			strconv.FormatFloat(quote.Iv, 'f', 1, 64),
+			strconv.FormatFloat(quote.FitIv, 'f', 1, 64),
+			strconv.FormatFloat(quote.Deviation, 'f', 1, 64),
+		)
+	}
+	responseStr += `</table>`
+
+	fmt.Fprint(w, responseStr)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+	"options-ws/decimal"
+)
+
+// TickerStreamer is an Exchange publishing per instrument tickers, TickerChannels takes instruments in the exchange's
+// naming like OrderbookChannels.
+type TickerStreamer interface {
+	TickerChannels(instruments []string) []string
+}
+
+var TickerAssetsMu sync.RWMutex
+var TickerAssets = make(map[string]bool) //assets whose instruments are subscribed as tickers instead of full books
+
+func setTickerAssets(assets []string) {
+	TickerAssetsMu.Lock()
+	defer TickerAssetsMu.Unlock()
+	TickerAssets = make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		TickerAssets[strings.ToUpper(asset)] = true
+	}
+}
+
+// splitTickerInstruments splits an exchange's instruments into those subscribed as books and those subscribed as
+// tickers, every instrument is a book one when the exchange has no tickers.
+func splitTickerInstruments(exchange Exchange, instruments []string) ([]string, []string) {
+	if _, ok := exchange.(TickerStreamer); !ok {
+		return instruments, nil
+	}
+	TickerAssetsMu.RLock()
+	defer TickerAssetsMu.RUnlock()
+	booked, ticked := make([]string, 0, len(instruments)), make([]string, 0)
+	for _, instrument := range instruments {
+		asset, _, _ := strings.Cut(instrument, "-")
+		if TickerAssets[asset] {
+			ticked = append(ticked, instrument)
+		} else {
+			booked = append(booked, instrument)
+		}
+	}
+	return booked, ticked
+}
+
+// applyTicker replaces exchange's side of instrument's book with its ticker's best bid and ask, an empty side (0
+// amount) clears it.
+func applyTicker(exchange string, instrument string, bid Order, ask Order, exchangeTime time.Time) {
+	OrderbookContainer.Mu.Lock()
+	defer OrderbookContainer.Mu.Unlock()
+
+	orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+	if !exists {
+		if bid.Amount <= 0 && ask.Amount <= 0 {
+			return
+		}
+		orderbook = &OrderbookData{Bids: make(map[string][]Order), Asks: make(map[string][]Order)}
+		OrderbookContainer.Orderbooks[instrument] = orderbook
+	}
+
+	orderbook.Bids[exchange], orderbook.Asks[exchange] = nil, nil
+	if bid.Amount > 0 && bid.Price > 0 {
+		orderbook.Bids[exchange] = []Order{bid}
+	}
+	if ask.Amount > 0 && ask.Price > 0 {
+		orderbook.Asks[exchange] = []Order{ask}
+	}
+	orderbook.LastUpdated = float64(exchangeTime.UnixNano())
+	markBookUpdated(orderbook, exchange, exchangeTime)
+	orderbook.UpdateCount++
+	publishBookEvent(exchange, instrument, orderbook.Bids[exchange], orderbook.Asks[exchange])
+}
+
+// aevoApplyTicker applies an option ticker as aevo's book and keeps its greeks as the market's.
+func aevoApplyTicker(ticker aevo.Ticker, timestamp int64) {
+	bid := Order{ticker.Bid.Price, ticker.Bid.Amount, ticker.Bid.Iv, "aevo"}
+	ask := Order{ticker.Ask.Price, ticker.Ask.Amount, ticker.Ask.Iv, "aevo"}
+	applyTicker("aevo", ticker.InstrumentName, bid, ask, time.Unix(0, timestamp))
+	aevoUpdateMark(ticker.InstrumentName, ticker.Mark.Price, time.Unix(0, timestamp))
+
+	if ticker.Mark.Iv > 0 {
+		AevoMarketList.Mu.Lock()
+		if market, exists := AevoMarketList.Markets[ticker.InstrumentName]; exists {
+			market.Greeks = ticker.Mark.Greeks
+			AevoMarketList.Markets[ticker.InstrumentName] = market
+		}
+		AevoMarketList.Mu.Unlock()
+	}
+}
+
+type deribitTickerMessage struct {
+	Params struct {
+		Channel string `json:"channel"`
+		Data    struct {
+			InstrumentName string  `json:"instrument_name"`
+			BestBidPrice   float64 `json:"best_bid_price"` //in the underlying
+			BestBidAmount  float64 `json:"best_bid_amount"`
+			BestAskPrice   float64 `json:"best_ask_price"`
+			BestAskAmount  float64 `json:"best_ask_amount"`
+			BidIv          float64 `json:"bid_iv"` //percent
+			AskIv          float64 `json:"ask_iv"`
+			IndexPrice     float64 `json:"index_price"`
+			Timestamp      int64   `json:"timestamp"` //unix milliseconds
+		} `json:"data"`
+	} `json:"params"`
+}
+
+func deribitDecodeTicker(raw []byte) error {
+	var message deribitTickerMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	data := message.Params.Data
+	instrument, err := deribitNormalizeInstrument(data.InstrumentName)
+	if err != nil {
+		return err
+	}
+	bid := Order{decimal.FromFloat(data.BestBidPrice * data.IndexPrice), data.BestBidAmount, data.BidIv / 100, "deribit"}
+	ask := Order{decimal.FromFloat(data.BestAskPrice * data.IndexPrice), data.BestAskAmount, data.AskIv / 100, "deribit"}
+	applyTicker("deribit", instrument, bid, ask, time.UnixMilli(data.Timestamp))
+	return nil
+}
+
+type lyraTickerMessage struct {
+	Params struct {
+		Channel string `json:"channel"` //"ticker.<instrument>.<interval>", the data doesn't name the instrument
+		Data    struct {
+			Timestamp        int64 `json:"timestamp"` //unix milliseconds
+			InstrumentTicker struct {
+				BestBidPrice  decimal.Decimal `json:"best_bid_price"` //sent as a string
+				BestBidAmount float64         `json:"best_bid_amount,string"`
+				BestAskPrice  decimal.Decimal `json:"best_ask_price"`
+				BestAskAmount float64         `json:"best_ask_amount,string"`
+				OptionPricing struct {
+					BidIv float64 `json:"bid_iv,string"`
+					AskIv float64 `json:"ask_iv,string"`
+				} `json:"option_pricing"`
+			} `json:"instrument_ticker"`
+		} `json:"data"`
+	} `json:"params"`
+}
+
+func lyraDecodeTicker(raw []byte) error {
+	var message lyraTickerMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(message.Params.Channel, "ticker.")
+	end := strings.LastIndex(name, ".")
+	if end < 0 {
+		return fmt.Errorf("lyraDecodeTicker: unexpected channel %v", message.Params.Channel)
+	}
+	instrument, err := lyraNormalizeInstrument(name[:end])
+	if err != nil {
+		return err
+	}
+	ticker := message.Params.Data.InstrumentTicker
+	bid := Order{ticker.BestBidPrice, ticker.BestBidAmount, ticker.OptionPricing.BidIv, "lyra"}
+	ask := Order{ticker.BestAskPrice, ticker.BestAskAmount, ticker.OptionPricing.AskIv, "lyra"}
+	applyTicker("lyra", instrument, bid, ask, time.UnixMilli(message.Params.Data.Timestamp))
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+type TicketLeg struct {
+	Action     string  `json:"action"` //"buy" or "sell"
+	Type       string  `json:"type"`   //"call", "put" or "future"
+	Instrument string  `json:"instrument"`
+	Exchange   string  `json:"exchange,omitempty"` //empty for the future, hedged wherever the forward is priced
+	Size       float64 `json:"size"`               //contracts, one unit of the underlying each
+	Limit      float64 `json:"limit_price"`        //worst level the size reaches
+	Vwap       float64 `json:"vwap"`
+	Displayed  float64 `json:"displayed"` //contracts shown on the leg's levels up to Limit
+}
+
+// TradeTicket is an ArbTable as the orders that capture it. Selling the call and buying the put is a conversion, a
+// synthetic short forward hedged with a long one, the reverse a reversal. The option legs walk the displayed levels up
+// to the table's SuggestedSize.
+type TradeTicket struct {
+	Key               string      `json:"key"`
+	Strategy          string      `json:"strategy"` //"conversion" or "reversal"
+	Legs              []TicketLeg `json:"legs"`
+	Size              float64     `json:"size"`
+	SizeLimit         string      `json:"size_limit"`  //see ArbTable.SizeLimit
+	NetPremium        float64     `json:"net_premium"` //per contract, option legs' vwaps sold less bought, positive is a credit
+	NetCredit         float64     `json:"net_credit"`  //NetPremium * Size, negative is a debit
+	SyntheticForward  float64     `json:"synthetic_forward"`
+	Forward           float64     `json:"forward"`
+	Fees              float64     `json:"fees"`                //per contract
+	ProfitPerContract float64     `json:"profit_per_contract"` //synthetic against actual forward at the vwaps, after Fees
+	ExpectedProfit    float64     `json:"expected_profit"`
+	RestSourced       bool        `json:"rest_sourced"`
+}
+
+// fillLevels walks levels (best first) for size contracts, returning the worst price reached, the volume weighted
+// price and the contracts displayed up to that level.
+func fillLevels(levels []Order, size float64) (float64, float64, float64) {
+	if len(levels) == 0 {
+		return 0, 0, 0
+	}
+	if size <= 0 {
+		return levels[0].Price.Float64(), levels[0].Price.Float64(), levels[0].Amount
+	}
+	limit, cost, filled, displayed := 0.0, 0.0, 0.0, 0.0
+	for _, level := range levels {
+		if filled >= size {
+			break
+		}
+		fill := math.Min(level.Amount, size-filled)
+		limit = level.Price.Float64()
+		cost += fill * level.Price.Float64()
+		filled += fill
+		displayed += level.Amount
+	}
+	return limit, cost / filled, displayed
+}
+
+// tradeTicket builds the ticket of the opportunity on strike key (e.g. "ETH-28JUN24-3000").
+func tradeTicket(key string, table ArbTable) TradeTicket {
+	size := table.SuggestedSize
+	bidLimit, bidVwap, bidDisplayed := fillLevels(table.Bids, size)
+	askLimit, askVwap, askDisplayed := fillLevels(table.Asks, size)
+	optionType := map[string]string{"C": "call", "P": "put"}
+
+	ticket := TradeTicket{
+		Key:       key,
+		Strategy:  "conversion",
+		Size:      size,
+		SizeLimit: table.SizeLimit,
+		Legs: []TicketLeg{
+			{"sell", optionType[table.BidType], key + "-" + table.BidType, table.BidExchange, size, bidLimit, bidVwap, bidDisplayed},
+			{"buy", optionType[table.AskType], key + "-" + table.AskType, table.AskExchange, size, askLimit, askVwap, askDisplayed},
+		},
+		NetPremium:  bidVwap - askVwap,
+		Forward:     table.Forward,
+		Fees:        table.Fees,
+		RestSourced: table.RestSourced,
+	}
+	future := TicketLeg{Action: "buy", Type: "future", Instrument: table.Asset + "-" + table.Expiry, Size: size, Limit: table.Forward, Vwap: table.Forward}
+	edge := 0.0
+	if table.BidType == "C" { //sell call buy put: synthetic short at strike + call - put, long the forward
+		ticket.SyntheticForward = table.Strike + bidVwap - askVwap
+		edge = ticket.SyntheticForward - table.Forward
+	} else { //sell put buy call: synthetic long at strike + call - put, short the forward
+		ticket.Strategy = "reversal"
+		future.Action = "sell"
+		ticket.SyntheticForward = table.Strike + askVwap - bidVwap
+		edge = table.Forward - ticket.SyntheticForward
+	}
+	ticket.Legs = append(ticket.Legs, future)
+	ticket.NetCredit = ticket.NetPremium * size
+	ticket.ProfitPerContract = edge - table.Fees
+	ticket.ExpectedProfit = ticket.ProfitPerContract * size
+	return ticket
+}
+
+// ticketsHandler serves /api/tickets, the trade tickets of the open opportunities by expected profit, of one strike
+// with ?key= (e.g. ETH-28JUN24-3000) or one asset with ?asset=.
+func ticketsHandler(w http.ResponseWriter, r *http.Request) {
+	key, asset := r.URL.Query().Get("key"), r.URL.Query().Get("asset")
+
+	tickets := make([]TradeTicket, 0)
+	for strike, table := range ArbContainer.Snapshot() {
+		if (key != "" && strike != key) || (asset != "" && table.Asset != asset) {
+			continue
+		}
+		tickets = append(tickets, tradeTicket(strike, table))
+	}
+	if key != "" && len(tickets) == 0 {
+		http.Error(w, "no open opportunity on "+strconv.Quote(key), http.StatusNotFound)
+		return
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].ExpectedProfit > tickets[j].ExpectedProfit })
+	writeJson(w, "ticketsHandler", tickets)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"options-ws/aevo"
+)
+
+// Trade is a print of an instrument's trades channel, subscribed next to its book with SubscribeTrades.
+type Trade struct {
+	Exchange   string
+	Instrument string  //normalized, e.g. "ETH-28JUN24-3000-C"
+	Price      float64 //USD
+	Amount     float64
+	Side       string //"buy" or "sell", the taker's
+	Time       time.Time
+}
+
+// TradeStreamer is an Exchange publishing per instrument trades, TradeChannels takes instruments in the exchange's
+// naming like OrderbookChannels. Lyra only publishes trades per asset and instrument type, which don't route to an
+// asset's pipeline, so it isn't one.
+type TradeStreamer interface {
+	TradeChannels(instruments []string) []string
+}
+
+type TradesContainer struct {
+	Mu     sync.RWMutex
+	Trades map[string][]Trade //key: instrument, oldest first
+	Last   map[string]Trade   //key: exchange + " " + instrument
+}
+
+var Trades = TradesContainer{Trades: make(map[string][]Trade), Last: make(map[string]Trade)}
+
+var SubscribeTrades bool
+var TradeWindow = 15 * time.Minute //prints older than this are dropped from the statistics
+var TradeTolerance = 0.01          //fraction a print may be through a quote before it contradicts it, USD conversions of coin quoted prints differ slightly
+
+func recordTrade(trade Trade) {
+	Trades.Mu.Lock()
+	defer Trades.Mu.Unlock()
+
+	trades := append(Trades.Trades[trade.Instrument], trade)
+	cutoff := trade.Time.Add(-TradeWindow)
+	expired := sort.Search(len(trades), func(i int) bool { return !trades[i].Time.Before(cutoff) })
+	Trades.Trades[trade.Instrument] = trades[expired:]
+
+	key := trade.Exchange + " " + trade.Instrument
+	if last, exists := Trades.Last[key]; !exists || !trade.Time.Before(last.Time) {
+		Trades.Last[key] = trade
+	}
+}
+
+// tradedThrough reports whether a print on exchange after the book side's last update at since went through its best
+// level, below a bid or above an ask: the book missed an update and the arb engine leaves the side out.
+func tradedThrough(instrument string, exchange string, levels []Order, bid bool, since time.Time) bool {
+	if len(levels) == 0 || since.IsZero() {
+		return false
+	}
+	Trades.Mu.RLock()
+	last, exists := Trades.Last[exchange+" "+instrument]
+	Trades.Mu.RUnlock()
+	if !exists || !last.Time.After(since) {
+		return false
+	}
+	if bid {
+		return last.Price < levels[0].Price.Float64()*(1-TradeTolerance)
+	}
+	return last.Price > levels[0].Price.Float64()*(1+TradeTolerance)
+}
+
+type TradeStats struct {
+	Instrument   string
+	Trades       int
+	Volume       float64 //contracts
+	Notional     float64 //USD premium
+	Vwap         float64
+	BuyVolume    float64
+	SellVolume   float64
+	Imbalance    float64 //(buy - sell) / volume, from -1 all sells to 1 all buys
+	LastPrice    float64
+	LastExchange string
+	LastTime     time.Time
+}
+
+// tradeStats summarizes an instrument's prints within TradeWindow of now.
+func tradeStats(instrument string, now time.Time) TradeStats {
+	Trades.Mu.RLock()
+	defer Trades.Mu.RUnlock()
+
+	stats := TradeStats{Instrument: instrument}
+	cutoff := now.Add(-TradeWindow)
+	for _, trade := range Trades.Trades[instrument] {
+		if trade.Time.Before(cutoff) {
+			continue
+		}
+		stats.Trades++
+		stats.Volume += trade.Amount
+		stats.Notional += trade.Amount * trade.Price
+		if trade.Side == "buy" {
+			stats.BuyVolume += trade.Amount
+		} else {
+			stats.SellVolume += trade.Amount
+		}
+		if !trade.Time.Before(stats.LastTime) {
+			stats.LastPrice, stats.LastExchange, stats.LastTime = trade.Price, trade.Exchange, trade.Time
+		}
+	}
+	if stats.Volume > 0 {
+		stats.Vwap = stats.Notional / stats.Volume
+		stats.Imbalance = (stats.BuyVolume - stats.SellVolume) / stats.Volume
+	}
+	return stats
+}
+
+// tradesHandler serves /api/trades, trade statistics of every instrument traded within TradeWindow by volume, or of
+// one with ?instrument=.
+func tradesHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if instrument := r.URL.Query().Get("instrument"); instrument != "" {
+		writeJson(w, "tradesHandler", tradeStats(strings.ToUpper(instrument), now))
+		return
+	}
+
+	Trades.Mu.RLock()
+	instruments := make([]string, 0, len(Trades.Trades))
+	for instrument := range Trades.Trades {
+		instruments = append(instruments, instrument)
+	}
+	Trades.Mu.RUnlock()
+
+	stats := make([]TradeStats, 0, len(instruments))
+	for _, instrument := range instruments {
+		if instrumentStats := tradeStats(instrument, now); instrumentStats.Trades > 0 {
+			stats = append(stats, instrumentStats)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Volume > stats[j].Volume })
+	writeJson(w, "tradesHandler", stats)
+}
+
+func aevoDecodeTrade(raw []byte) error {
+	var message aevo.TradeMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	trade := message.Data
+	recordTrade(Trade{"aevo", trade.InstrumentName, trade.Price, trade.Amount, trade.Side, time.Unix(0, trade.CreatedTimestamp)})
+	return nil
+}
+
+type deribitTradeMessage struct {
+	Params struct {
+		Channel string `json:"channel"`
+		Data    []struct {
+			InstrumentName string  `json:"instrument_name"`
+			Price          float64 `json:"price"` //in the underlying
+			IndexPrice     float64 `json:"index_price"`
+			Amount         float64 `json:"amount"`
+			Direction      string  `json:"direction"`
+			Timestamp      int64   `json:"timestamp"` //unix milliseconds
+		} `json:"data"`
+	} `json:"params"`
+}
+
+func deribitDecodeTrades(raw []byte) error {
+	var message deribitTradeMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return err
+	}
+	for _, trade := range message.Params.Data {
+		instrument, err := deribitNormalizeInstrument(trade.InstrumentName)
+		if err != nil {
+			return err
+		}
+		recordTrade(Trade{"deribit", instrument, trade.Price * trade.IndexPrice, trade.Amount, trade.Direction, time.UnixMilli(trade.Timestamp)})
+	}
+	return nil
+}
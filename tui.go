@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type tuiTick time.Time
+
+// tuiModel is the -tui dashboard, refreshed once a second. Up/down (or k/j) move through the opportunities, enter
+// opens the strike's books and esc goes back, x drops the strike's subscriptions, r restores them and q quits.
+type tuiModel struct {
+	conns  []*WssConn
+	router *AssetRouter
+
+	arbs          []ArbSnapshot //best Apy first, discounted by FillProbability
+	cursor        int
+	book          string //structure whose books are shown, e.g. "ETH-28JUN24-3000", "" shows the dashboard
+	processed     int64
+	processedRate float64
+	lastTick      time.Time
+	height        int
+}
+
+func newTuiModel(conns []*WssConn, router *AssetRouter) tuiModel {
+	m := tuiModel{conns: conns, router: router, height: 40}
+	return m.refresh(time.Now())
+}
+
+func tuiTickCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return tuiTick(t) })
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tuiTickCmd()
+}
+
+func (m tuiModel) refresh(now time.Time) tuiModel {
+	m.arbs = m.arbs[:0]
+	for key, table := range ArbContainer.Snapshot() {
+		m.arbs = append(m.arbs, ArbSnapshot{key, table})
+	}
+	sort.Slice(m.arbs, func(i, j int) bool { return m.arbs[i].rankValue("apy") > m.arbs[j].rankValue("apy") })
+	m.cursor = min(m.cursor, max(len(m.arbs)-1, 0))
+
+	processed := m.router.Processed()
+	if !m.lastTick.IsZero() {
+		m.processedRate = float64(processed-m.processed) / now.Sub(m.lastTick).Seconds()
+	}
+	m.processed, m.lastTick = processed, now
+	return m
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tuiTick:
+		return m.refresh(time.Time(msg)), tuiTickCmd()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = min(m.cursor+1, max(len(m.arbs)-1, 0))
+		case "enter":
+			if m.cursor < len(m.arbs) {
+				m.book = m.arbs[m.cursor].Key
+			}
+		case "esc", "backspace":
+			m.book = ""
+		case "x":
+			if m.cursor < len(m.arbs) {
+				SubscriptionOverrides.Set(allExchanges, m.arbs[m.cursor].Key+"-C", "drop")
+				SubscriptionOverrides.Set(allExchanges, m.arbs[m.cursor].Key+"-P", "drop")
+			}
+		case "r":
+			SubscriptionOverrides.Clear("drop")
+		}
+	}
+	return m, nil
+}
+
+func (m tuiModel) View() string {
+	if m.book != "" {
+		return m.bookView()
+	}
+
+	var b strings.Builder
+	b.WriteString(tuiHeading("Index"))
+	indexes := []struct {
+		Exchange string
+		Prices   map[string]float64
+	}{{"aevo", AevoIndex.Snapshot()}, {"lyra", LyraIndex.Snapshot()}, {"deribit", DeribitIndex.Snapshot()}, {"okx", OkxIndex.Snapshot()}, {"binance-options", BinanceOptionsIndex.Snapshot()}}
+	for _, asset := range currentAssets() {
+		fmt.Fprintf(&b, "%-6v", asset)
+		for _, index := range indexes {
+			if price, exists := index.Prices[asset]; exists {
+				fmt.Fprintf(&b, "  %v %-12v", index.Exchange, strconv.FormatFloat(price, 'f', 2, 64))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	rates := make(map[string]float64)
+	for _, channel := range channelStatsSnapshot() {
+		rates[channel.Exchange] += channel.UpdatesPerSec
+	}
+	b.WriteString(tuiHeading("Connections"))
+	fmt.Fprintf(&b, "%-10v %12v %11v %6v %10v\n", "exchange", "subscribed", "reconnects", "stale", "msgs/s")
+	for _, c := range m.conns {
+		requested, subscribed := c.Subscribed()
+		c.Mu.Lock()
+		reconnects, stale := c.Reconnects, c.Stale
+		c.Mu.Unlock()
+		fmt.Fprintf(&b, "%-10v %12v %11v %6v %10v\n", c.Exchange, fmt.Sprintf("%v/%v", subscribed, requested), reconnects, stale,
+			strconv.FormatFloat(rates[c.Exchange], 'f', 1, 64))
+	}
+	fmt.Fprintf(&b, "processed %v frames, %v/s\n", m.processed, strconv.FormatFloat(m.processedRate, 'f', 1, 64))
+	if overrides := subscriptionOverridesSnapshot(); len(overrides) > 0 {
+		names := make([]string, len(overrides))
+		for i, override := range overrides {
+			names[i] = override.Action + " " + override.Instrument
+		}
+		fmt.Fprintf(&b, "overrides (r restores drops): %v\n", strings.Join(names, ", "))
+	}
+
+	b.WriteString(tuiHeading(fmt.Sprintf("Opportunities (%v)", len(m.arbs))))
+	fmt.Fprintf(&b, "  %-20v %-16v %-16v %10v %8v %8v %8v\n", "strike", "sell", "buy", "profit", "rel %", "apy %", "size")
+	rows := max(m.height-strings.Count(b.String(), "\n")-3, 1)
+	start := max(m.cursor-rows+1, 0)
+	for i := start; i < len(m.arbs) && i < start+rows; i++ {
+		arb := m.arbs[i]
+		marker := "  "
+		if i == m.cursor {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%v%-20v %-16v %-16v %10v %8v %8v %8v\n", marker, arb.Key, arb.BidType+" "+arb.BidExchange, arb.AskType+" "+arb.AskExchange,
+			strconv.FormatFloat(arb.AbsProfit, 'f', 2, 64), strconv.FormatFloat(arb.RelProfit, 'f', 2, 64),
+			strconv.FormatFloat(arb.Apy, 'f', 1, 64), strconv.FormatFloat(arb.SuggestedSize, 'f', 2, 64))
+	}
+	b.WriteString("\n↑/↓ select  enter books  q quit")
+	return b.String()
+}
+
+// bookView shows the call and put books of m.book side by side by exchange, bids and asks best first.
+func (m tuiModel) bookView() string {
+	var b strings.Builder
+	levels := max((m.height-8)/2, 1)
+	for _, optionType := range []string{"C", "P"} {
+		instrument := m.book + "-" + optionType
+		b.WriteString(tuiHeading(instrument))
+		orderbook, exists := OrderbookContainer.Get(instrument)
+		if !exists {
+			b.WriteString("no book\n")
+			continue
+		}
+
+		exchanges := make([]string, 0)
+		for exchange := range orderbook.Bids {
+			exchanges = append(exchanges, exchange)
+		}
+		for exchange := range orderbook.Asks {
+			if _, exists := orderbook.Bids[exchange]; !exists {
+				exchanges = append(exchanges, exchange)
+			}
+		}
+		sort.Strings(exchanges)
+
+		columns := make([]string, 0, len(exchanges))
+		for _, exchange := range exchanges {
+			columns = append(columns, fmt.Sprintf("%-39v", exchange))
+		}
+		b.WriteString(strings.Join(columns, " | ") + "\n")
+		for level := 0; level < levels; level++ {
+			empty := true
+			columns = columns[:0]
+			for _, exchange := range exchanges {
+				bid, ask := tuiLevel(orderbook.Bids[exchange], level), tuiLevel(orderbook.Asks[exchange], level)
+				empty = empty && bid == "" && ask == ""
+				columns = append(columns, fmt.Sprintf("%19v %19v", bid, ask))
+			}
+			if empty {
+				break
+			}
+			b.WriteString(strings.Join(columns, " | ") + "\n")
+		}
+	}
+	b.WriteString("\nesc back  q quit")
+	return b.String()
+}
+
+func tuiLevel(orders []Order, level int) string {
+	if level >= len(orders) {
+		return ""
+	}
+	return strconv.FormatFloat(orders[level].Amount, 'f', 2, 64) + " @ " + strconv.FormatFloat(orders[level].Price.Float64(), 'f', 2, 64)
+}
+
+func tuiHeading(title string) string {
+	return "\n\x1b[1m" + title + "\x1b[0m\n"
+}
+
+// runTui shows the dashboard until the user quits.
+func runTui(conns []*WssConn, router *AssetRouter) error {
+	_, err := tea.NewProgram(newTuiModel(conns, router), tea.WithAltScreen()).Run()
+	if err != nil {
+		return fmt.Errorf("runTui: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VolAlerter tracks ATM implied vol per expiry from aevo book IVs and alerts when it moves more than SpikePoints vol
+// points within Window, or when it differs from index realized vol over Window by more than DivergencePoints.
+// An expiry that alerted is quiet for one Window.
+type VolAlerter struct {
+	Asset            string
+	SpikePoints      float64
+	DivergencePoints float64
+	Window           time.Duration
+
+	Mu          sync.Mutex
+	AtmIv       map[string]*SampleRing //key: expiry, e.g. "28JUN24", values in vol points
+	lastAlerted map[string]time.Time
+}
+
+func newVolAlerter(asset string) *VolAlerter {
+	return &VolAlerter{
+		Asset:            asset,
+		SpikePoints:      5,
+		DivergencePoints: 20,
+		Window:           15 * time.Minute,
+		AtmIv:            make(map[string]*SampleRing),
+		lastAlerted:      make(map[string]time.Time),
+	}
+}
+
+func orderIv(orders map[string][]Order) (float64, bool) {
+	aevo := orders["aevo"]
+	if len(aevo) == 0 || aevo[0].Iv <= 0 {
+		return 0, false
+	}
+	return aevo[0].Iv, true
+}
+
+// atmIvs returns the ATM implied vol in vol points per expiry, averaging the best bid and ask IV of the call and put
+// at the strike closest to index.
+func atmIvs(asset string, index float64) map[string]float64 {
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+
+	closest := make(map[string]float64) //expiry -> strike
+	for key := range OrderbookContainer.Orderbooks {
+		components := strings.Split(key, "-")
+		if len(components) != 4 || components[0] != asset {
+			continue
+		}
+		strike, err := strconv.ParseFloat(components[2], 64)
+		if err != nil {
+			continue
+		}
+		current, exists := closest[components[1]]
+		if !exists || math.Abs(strike-index) < math.Abs(current-index) {
+			closest[components[1]] = strike
+		}
+	}
+
+	ivs := make(map[string]float64)
+	for expiry, strike := range closest {
+		sum, count := 0.0, 0
+		for _, optionType := range []string{"C", "P"} {
+			instrument := asset + "-" + expiry + "-" + strconv.FormatFloat(strike, 'f', -1, 64) + "-" + optionType
+			orderbook, exists := OrderbookContainer.Orderbooks[instrument]
+			if !exists || quarantined(instrument, ArbClock()) {
+				continue
+			}
+			if iv, ok := orderIv(orderbook.Bids); ok {
+				sum += iv
+				count++
+			}
+			if iv, ok := orderIv(orderbook.Asks); ok {
+				sum += iv
+				count++
+			}
+		}
+		if count > 0 {
+			ivs[expiry] = sum / float64(count) * 100
+		}
+	}
+
+	return ivs
+}
+
+func (v *VolAlerter) check(now time.Time) {
+	index, _ := AevoIndex.Get(v.Asset)
+	if index <= 0 {
+		return
+	}
+
+	rv := realizedVol(indexSamples("aevo", v.Asset, now.Add(-v.Window))) * 100
+
+	v.Mu.Lock()
+	defer v.Mu.Unlock()
+	for expiry, iv := range atmIvs(v.Asset, index) {
+		ring, exists := v.AtmIv[expiry]
+		if !exists {
+			ring = newSampleRing(int(v.Window/time.Second) + 1)
+			v.AtmIv[expiry] = ring
+		}
+		ring.Add(Sample{now, iv})
+
+		if now.Sub(v.lastAlerted[expiry]) < v.Window {
+			continue
+		}
+
+		samples := ring.Since(now.Add(-v.Window))
+		low, high := iv, iv
+		for _, sample := range samples {
+			low = math.Min(low, sample.Value)
+			high = math.Max(high, sample.Value)
+		}
+		if high-low > v.SpikePoints {
+			slog.Warn("VOL ALERT: ATM IV spike", "asset", v.Asset, "expiry", expiry, "move", high-low, "window", v.Window, "iv", iv, "low", low, "high", high)
+			v.lastAlerted[expiry] = now
+			continue
+		}
+
+		if rv > 0 && math.Abs(iv-rv) > v.DivergencePoints {
+			slog.Warn("VOL ALERT: ATM IV diverges from realized vol", "asset", v.Asset, "expiry", expiry, "iv", iv, "window", v.Window, "rv", rv, "divergence", iv-rv)
+			v.lastAlerted[expiry] = now
+		}
+	}
+}
+
+func (v *VolAlerter) Loop(interval time.Duration) {
+	for {
+		v.check(time.Now())
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchlistContainer holds the watched instruments ("ETH-28JUN24-3000-C") and structures ("ETH-28JUN24-3000", both
+// legs of the parity pair). They get full depth lyra books, pinned placement in the UI and their own alerts.
+type WatchlistContainer struct {
+	Mu      sync.Mutex
+	Entries map[string]bool
+}
+
+var Watchlist = WatchlistContainer{Entries: make(map[string]bool)}
+
+var WatchMoveAlert float64 = 5 //percent mid move of a watched instrument that alerts
+
+func setWatchlist(entries []string) {
+	Watchlist.Mu.Lock()
+	defer Watchlist.Mu.Unlock()
+
+	Watchlist.Entries = make(map[string]bool)
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			Watchlist.Entries[entry] = true
+		}
+	}
+}
+
+// isWatched reports whether an instrument, or the structure it is a leg of, is on the watchlist. Structure keys
+// (ArbTables keys) are watched if listed directly or if either leg is.
+func isWatched(name string) bool {
+	Watchlist.Mu.Lock()
+	defer Watchlist.Mu.Unlock()
+
+	if Watchlist.Entries[name] {
+		return true
+	}
+	if structure, found := strings.CutSuffix(name, "-C"); found {
+		return Watchlist.Entries[structure]
+	}
+	if structure, found := strings.CutSuffix(name, "-P"); found {
+		return Watchlist.Entries[structure]
+	}
+	return Watchlist.Entries[name+"-C"] || Watchlist.Entries[name+"-P"]
+}
+
+func watchedInstruments() []string {
+	Watchlist.Mu.Lock()
+	entries := make([]string, 0, len(Watchlist.Entries))
+	for entry := range Watchlist.Entries {
+		entries = append(entries, entry)
+	}
+	Watchlist.Mu.Unlock()
+
+	instruments := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "-C") || strings.HasSuffix(entry, "-P") {
+			instruments = append(instruments, entry)
+		} else {
+			instruments = append(instruments, entry+"-C", entry+"-P")
+		}
+	}
+	sort.Strings(instruments)
+
+	return instruments
+}
+
+type watchTop struct {
+	Bid, BidAmount, Ask, AskAmount float64
+	BidExchange, AskExchange       string
+}
+
+func topOfBook(orderbook *OrderbookData) watchTop {
+	top := watchTop{Ask: math.Inf(1)}
+	for exchange, bids := range orderbook.Bids {
+		if len(bids) > 0 && bids[0].Price.Float64() > top.Bid {
+			top.Bid, top.BidAmount, top.BidExchange = bids[0].Price.Float64(), bids[0].Amount, exchange
+		}
+	}
+	for exchange, asks := range orderbook.Asks {
+		if len(asks) > 0 && asks[0].Price.Float64() < top.Ask {
+			top.Ask, top.AskAmount, top.AskExchange = asks[0].Price.Float64(), asks[0].Amount, exchange
+		}
+	}
+	if math.IsInf(top.Ask, 1) {
+		top.Ask = 0
+	}
+
+	return top
+}
+
+func watchedTops() map[string]watchTop {
+	tops := make(map[string]watchTop)
+	instruments := watchedInstruments()
+
+	OrderbookContainer.Mu.RLock()
+	defer OrderbookContainer.Mu.RUnlock()
+	for _, instrument := range instruments {
+		if orderbook, exists := OrderbookContainer.Orderbooks[instrument]; exists {
+			tops[instrument] = topOfBook(orderbook)
+		}
+	}
+
+	return tops
+}
+
+// watchAlertLoop alerts when a watched structure gets an arb opportunity and when a watched instrument's mid moves
+// more than WatchMoveAlert percent from where it last alerted.
+func watchAlertLoop(interval time.Duration) {
+	reference := make(map[string]float64)
+	hadArb := make(map[string]bool)
+	for {
+		for instrument, top := range watchedTops() {
+			if top.Bid <= 0 || top.Ask <= 0 || quarantined(instrument, ArbClock()) {
+				continue
+			}
+			mid := (top.Bid + top.Ask) / 2
+			previous, exists := reference[instrument]
+			if !exists {
+				reference[instrument] = mid
+				continue
+			}
+			if move := (mid - previous) / previous * 100; math.Abs(move) > WatchMoveAlert {
+				slog.Warn("WATCH ALERT: mid moved", "instrument", instrument, "move_pct", move, "mid", mid, "bid", top.Bid, "bid_exchange", top.BidExchange, "ask", top.Ask, "ask_exchange", top.AskExchange)
+				reference[instrument] = mid
+			}
+		}
+
+		ArbContainer.Mu.RLock()
+		current := make(map[string]*ArbTable)
+		for key, table := range ArbContainer.ArbTables {
+			if isWatched(key) {
+				current[key] = table
+			}
+		}
+		for key, table := range current {
+			if !hadArb[key] {
+				slog.Warn("WATCH ALERT: arb", "key", key, "sell", table.BidType, "sell_exchange", table.BidExchange, "buy", table.AskType, "buy_exchange", table.AskExchange, "profit", table.AbsProfit, "apy", table.Apy)
+			}
+		}
+		ArbContainer.Mu.RUnlock()
+		hadArb = make(map[string]bool, len(current))
+		for key := range current {
+			hadArb[key] = true
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func watchlistHandler(w http.ResponseWriter, r *http.Request) {
+	tops := watchedTops()
+
+	responseStr := ""
+	for _, instrument := range watchedInstruments() {
+		top, exists := tops[instrument]
+		if !exists {
+			responseStr += fmt.Sprintf(`<tr><td>%s</td><td colspan="6">no book</td></tr>`, instrument)
+			continue
+		}
+		responseStr += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			instrument,
+			top.BidExchange,
+			strconv.FormatFloat(top.BidAmount, 'f', 2, 64),
+			strconv.FormatFloat(top.Bid, 'f', 3, 64),
+			strconv.FormatFloat(top.Ask, 'f', 3, 64),
+			strconv.FormatFloat(top.AskAmount, 'f', 2, 64),
+			top.AskExchange,
+		)
+	}
+
+	fmt.Fprint(w, responseStr)
+}